@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"os"
+
 	"github.com/spf13/cobra"
 
 	gl "github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/manifest"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/progress"
 )
 
 // complianceCmd represents the compliance command
@@ -11,24 +15,33 @@ var complianceCmd = &cobra.Command{
 	Use:   "compliance",
 	Short: "Compare gitlab's project settings with desired state",
 	Run: func(cmd *cobra.Command, args []string) {
+		runManifest := startManifest("compliance", env.Dryrun)
+		defer writeManifest(runManifest)
+
 		client, err := gitlabClient()
 		if err != nil {
 			logger.Fatal(err)
 		}
+		checkEdition(client)
 
 		if env.Dryrun {
 			logger.Infof("DRYRUN: No settings will be updated.")
 		}
 
-		manager := gl.NewProjectManager(
-			logger.WithField("module", "project_manager"),
-			client.Groups,
-			client.Projects,
-			client.ProtectedBranches,
-			client.ProtectedTags,
-			client.Branches,
-			cfg,
-		)
+		outputs := reportOutputs()
+		if env.JunitReport != "" {
+			outputs = append(outputs, gl.Output{Sink: gl.OutputFile, Format: gl.FormatJUnit, Path: env.JunitReport})
+		}
+		// A configured compliance email is sent unless --output selects the email format
+		if cfg.EmailConfigured() && !hasSink(outputs, gl.OutputEmail) {
+			outputs = append(outputs, gl.Output{Sink: gl.OutputEmail, Format: gl.FormatHTML})
+		}
+
+		manager := gl.NewProjectManager(logger.WithField("module", "project_manager"), gitlabClients(client), cfg)
+		manager.SetReportOptions(reportOptions())
+		manager.SetPersonalProjectUsers(env.IncludePersonalProjects)
+		manager.SetCreatedSince(createdSince())
+		addStartupWarnings(manager)
 
 		if !manager.ComplianceReady() {
 			logger.Fatal("No compliance configuration.")
@@ -39,57 +52,127 @@ var complianceCmd = &cobra.Command{
 			logger.Fatal(err)
 		}
 
+		// Only fetch the settings of subsections with mandatory settings
+		_, fetchProjectSettings := cfg.Compliance.Mandatory["project_settings"]
+		_, fetchApprovalSettings := cfg.Compliance.Mandatory["approval_settings"]
+
 		logger.Infof("Identified %d valid project(s).", len(projects))
+		checkProjectCount(len(projects))
+		runManifest.AddProjects(projectPaths(projects))
+		p := progress.New(os.Stdout, logger, isTerminal(os.Stdout), len(projects))
+		var processed, errored int
 		for index, project := range projects {
-			logger.Infof("Processing project #%d: %s", index+1, project.PathWithNamespace)
+			if manager.MaxErrorsReached(env.MaxErrors) {
+				logger.Errorf("Reached %d error(s), skipping the remaining %d project(s).", manager.ErrorCount(), len(projects)-index)
+				break
+			}
 
-			// Get current approval settings
-			approvalSettings, err := manager.GetProjectApprovalSettings(project)
-			if err != nil {
-				logger.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
-				manager.SetError(true)
+			p.Next(project.PathWithNamespace)
+			logger.Debugf("Processing project #%d: %s", index+1, project.PathWithNamespace)
+			errors := manager.ErrorCount()
+			runManifest.StartProject(project.PathWithNamespace)
+
+			if fetchApprovalSettings {
+				// Get current approval settings
+				approvalSettings, err := manager.GetProjectApprovalSettings(project)
+				if err != nil {
+					logger.Errorf("failed to get current approval settings of project %s: %v", project.PathWithNamespace, err)
+					manager.SetError(true)
+				}
+
+				// Record current approval settings
+				manager.ApprovalSettingsOriginal[project.PathWithNamespace] = approvalSettings
+
+				// Record the approval settings locked by the group, which can't be enforced per project
+				locks, err := manager.GetApprovalSettingLocks(project)
+				if err != nil {
+					logger.Error(err)
+					manager.SetError(true)
+				}
+				manager.ApprovalSettingLocks[project.PathWithNamespace] = locks
 			}
 
-			// Record current approval settings
-			manager.ApprovalSettingsOriginal[project.PathWithNamespace] = approvalSettings
+			if fetchProjectSettings {
+				// Get current settings states
+				projectSettings, err := manager.GetProjectSettings(project)
+				if err != nil {
+					logger.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+					manager.SetError(true)
+				}
 
-			// Get current settings states
-			projectSettings, err := manager.GetProjectSettings(project)
-			if err != nil {
-				logger.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
-				manager.SetError(true)
+				// Record current settings states
+				manager.ProjectSettingsOriginal[project.PathWithNamespace] = projectSettings
 			}
 
-			// Record current settings states
-			manager.ProjectSettingsOriginal[project.PathWithNamespace] = projectSettings
-		}
-
-		if err := manager.GenerateComplianceReport(); err != nil {
-			logger.Errorf("failed to create changelog report: %v", err)
-			manager.SetError(true)
+			runManifest.EndProject()
+			processed++
+			if manager.ErrorCount() != errors {
+				errored++
+			}
 		}
+		p.Done()
 
-		if err := manager.GenerateComplianceEmail(); err != nil {
-			logger.Errorf("failed to email changelog report: %v", err)
+		if err := manager.WriteComplianceOutputs(outputs); err != nil {
+			logger.Errorf("failed to create compliance report: %v", err)
 			manager.SetError(true)
 		}
-
+		reportWarnings(manager)
+
+		scores := manager.ComplianceScores()
+		sendMetrics("compliance", map[string]int{
+			"projects.processed": processed,
+			"projects.errored":   errored,
+		}, map[string]float64{
+			"compliance.score": scores.Overall,
+		})
+		recordComplianceManifest(runManifest, manager, len(projects), processed, errored)
+		runManifest.SetComplianceScores(scores.Overall, scores.Projects)
+
+		runManifest.Complete()
 		if manager.GetError() {
 			logger.Fatal("Error(s) encountered.")
 		}
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(complianceCmd)
+// recordComplianceManifest records the numbers of projects and the non-compliant projects of
+// the run in the manifest
+func recordComplianceManifest(recorder *manifest.Recorder, manager *gl.ProjectManager, projects, processed, errored int) {
+	var noncompliant []string
+	for _, result := range manager.ComplianceResults() {
+		if !result.Compliant && (len(noncompliant) == 0 || noncompliant[len(noncompliant)-1] != result.Project) {
+			noncompliant = append(noncompliant, result.Project)
+		}
+	}
+
+	recorder.MarkProjects(manifest.ProjectNoncompliant, noncompliant)
+	recorder.SetCounts(map[string]int{
+		"projects.total":        projects,
+		"projects.processed":    processed,
+		"projects.noncompliant": len(noncompliant),
+		"projects.errored":      errored,
+	})
+}
 
-	// Here you will define your flags and configuration settings.
+// hasSink reports whether any of the outputs writes to the sink
+func hasSink(outputs []gl.Output, sink string) bool {
+	for _, output := range outputs {
+		if output.Sink == sink {
+			return true
+		}
+	}
+
+	return false
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// complianceCmd.PersistentFlags().String("foo", "", "A help for foo")
+func init() {
+	rootCmd.AddCommand(complianceCmd)
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// complianceCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	addDryrunFlag(complianceCmd)
+	addCreatedSinceFlag(complianceCmd)
+	addOutputFlag(complianceCmd)
+	addManifestFlag(complianceCmd)
+	addWarningsAsErrorsFlag(complianceCmd)
+	complianceCmd.Flags().BoolVar(&env.OnlyNoncompliant, "only-noncompliant", false, "Only list projects with non-compliant settings in the report (env: ONLY_NONCOMPLIANT)")
+	complianceCmd.Flags().StringVar(&env.JunitReport, "junit-report", "", "Write the compliance results as JUnit XML to this path or s3:// URL, like --output file:junit=PATH (env: JUNIT_REPORT)")
 }
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/r3labs/diff"
+	"github.com/spf13/cobra"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// diffConfigCmd represents the diff-config command
+var diffConfigCmd = &cobra.Command{
+	Use:   "diff-config <old config> <new config>",
+	Short: "Show the policy changes between two config files, without connecting to GitLab",
+	Args:  cobra.ExactArgs(2),
+	// A pure local operation, which needs neither GITLAB_TOKEN nor CONFIG_FILE
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		old, err := config.Parse(args[0])
+		if err != nil {
+			logger.Fatal(err)
+		}
+		new, err := config.Parse(args[1])
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		changes, err := config.Diff(old, new)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		if len(changes) == 0 {
+			fmt.Println("No policy changes.")
+			return
+		}
+		printChanges(changes, "")
+	},
+}
+
+// printChanges prints the added (+), removed (-) and changed (~) settings, each line
+// starting with the indent
+func printChanges(changes []config.Change, indent string) {
+	for _, c := range changes {
+		switch c.Type {
+		case diff.CREATE:
+			fmt.Printf("%s+ %s: %v\n", indent, c.Path, c.To)
+		case diff.DELETE:
+			fmt.Printf("%s- %s: %v\n", indent, c.Path, c.From)
+		default:
+			fmt.Printf("%s~ %s: %v -> %v\n", indent, c.Path, c.From, c.To)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(diffConfigCmd)
+}
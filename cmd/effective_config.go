@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	gl "github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab"
+)
+
+// fullEffectiveConfig holds --full, printing the complete effective configs
+var fullEffectiveConfig bool
+
+// effectiveConfigCmd represents the effective-config command
+var effectiveConfigCmd = &cobra.Command{
+	Use:   "effective-config",
+	Short: "Show the rules matching each project and the settings they change, without changing any settings",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := gitlabClient()
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		manager := gl.NewProjectManager(logger.WithField("module", "project_manager"), gitlabClients(client), cfg)
+		manager.SetPersonalProjectUsers(env.IncludePersonalProjects)
+		manager.SetCreatedSince(createdSince())
+
+		projects, err := manager.GetProjects()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		checkProjectCount(len(projects))
+
+		for _, project := range projects {
+			effective, rules, err := manager.EffectiveConfig(project)
+			if err != nil {
+				logger.Errorf("failed to get the effective config of repo %v: %v", project.PathWithNamespace, err)
+				manager.SetError(true)
+				continue
+			}
+
+			if len(rules) == 0 {
+				fmt.Printf("%s: no rules\n", project.PathWithNamespace)
+			} else {
+				fmt.Printf("%s: rules %s\n", project.PathWithNamespace, strings.Join(rules, ", "))
+			}
+
+			if fullEffectiveConfig {
+				b, err := config.Redacted(effective)
+				if err != nil {
+					logger.Fatal(err)
+				}
+				fmt.Printf("  %s\n", b)
+				continue
+			}
+			changes, err := config.Diff(cfg, effective)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			printChanges(changes, "  ")
+		}
+
+		if manager.GetError() {
+			logger.Fatal("failed to get the effective config of some projects")
+		}
+	},
+}
+
+func init() {
+	effectiveConfigCmd.Flags().BoolVar(&fullEffectiveConfig, "full", false, "Print the complete effective config of each project as JSON, with secrets redacted")
+	rootCmd.AddCommand(effectiveConfigCmd)
+	addCreatedSinceFlag(effectiveConfigCmd)
+}
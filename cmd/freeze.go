@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
+
+	gl "github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/progress"
+)
+
+// freezeCmd represents the freeze command
+var freezeCmd = &cobra.Command{
+	Use:   "freeze",
+	Short: "Set the merge access level of the configured protected branches to no one, e.g. during a release freeze",
+	Run: func(cmd *cobra.Command, args []string) {
+		// A second freeze would record the frozen levels and break the unfreeze
+		if _, err := os.Stat(env.FreezeState); err == nil {
+			logger.Fatalf("Freeze state file %s exists already, unfreeze first.", env.FreezeState)
+		}
+
+		client, err := gitlabClient()
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		if env.Dryrun {
+			logger.Infof("DRYRUN: No settings will be updated.")
+		}
+
+		manager := newFreezeManager(client)
+
+		projects, err := manager.GetProjects()
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		// Each level is flushed before its branch is frozen, so an aborted freeze can be undone
+		if env.Dryrun {
+			logger.Infof("DRYRUN: Skipped writing freeze state file %s.", env.FreezeState)
+		} else if err := manager.CreateFreezeState(env.FreezeState); err != nil {
+			logger.Fatal(err)
+		}
+
+		logger.Infof("Identified %d valid project(s).", len(projects))
+		checkProjectCount(len(projects))
+
+		p := progress.New(os.Stdout, logger, isTerminal(os.Stdout), len(projects))
+		for index, project := range projects {
+			if manager.MaxErrorsReached(env.MaxErrors) {
+				logger.Errorf("Reached %d error(s), skipping the remaining %d project(s).", manager.ErrorCount(), len(projects)-index)
+				break
+			}
+
+			p.Next(project.PathWithNamespace)
+			if err := manager.FreezeBranches(project, env.Dryrun); err != nil {
+				logger.Errorf("failed to freeze branches of repo %v: %v", project.PathWithNamespace, err)
+				manager.SetError(true)
+			}
+		}
+		p.Done()
+
+		if err := manager.GenerateChangeLogReport(false); err != nil {
+			logger.Errorf("failed to create changelog report: %v", err)
+			manager.SetError(true)
+		}
+		if env.Dryrun {
+			manager.GenerateDryrunCallReport()
+		}
+
+		if manager.GetError() {
+			logger.Fatal("Error(s) encountered.")
+		}
+	},
+}
+
+// unfreezeCmd represents the unfreeze command
+var unfreezeCmd = &cobra.Command{
+	Use:   "unfreeze",
+	Short: "Restore the merge access levels of the protected branches recorded by freeze",
+	Run: func(cmd *cobra.Command, args []string) {
+		state, err := gl.ReadFreezeState(env.FreezeState)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		client, err := gitlabClient()
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		if env.Dryrun {
+			logger.Infof("DRYRUN: No settings will be updated.")
+		}
+
+		manager := newFreezeManager(client)
+
+		logger.Infof("Restoring %d protected branch(es).", len(state.Branches))
+		for _, b := range state.Branches {
+			if err := manager.UnfreezeBranch(b, env.Dryrun); err != nil {
+				logger.Errorf("failed to unfreeze branch %v of repo %v: %v", b.Branch, b.Project, err)
+				manager.SetError(true)
+			}
+		}
+
+		if err := manager.GenerateChangeLogReport(false); err != nil {
+			logger.Errorf("failed to create changelog report: %v", err)
+			manager.SetError(true)
+		}
+		if env.Dryrun {
+			manager.GenerateDryrunCallReport()
+		}
+
+		if manager.GetError() {
+			logger.Fatal("Error(s) encountered, keeping the freeze state file for another unfreeze.")
+		}
+
+		// Allow the next freeze
+		if env.Dryrun {
+			logger.Infof("DRYRUN: Skipped removing freeze state file %s.", env.FreezeState)
+		} else if err := os.Remove(env.FreezeState); err != nil {
+			logger.Fatalf("failed to remove freeze state file: %v", err)
+		}
+	},
+}
+
+// newFreezeManager returns the project manager of the freeze and unfreeze commands
+func newFreezeManager(client *gitlab.Client) *gl.ProjectManager {
+	manager := gl.NewProjectManager(logger.WithField("module", "project_manager"), gitlabClients(client), cfg)
+	manager.SetPersonalProjectUsers(env.IncludePersonalProjects)
+
+	return manager
+}
+
+func init() {
+	rootCmd.AddCommand(freezeCmd)
+	rootCmd.AddCommand(unfreezeCmd)
+
+	for _, cmd := range []*cobra.Command{freezeCmd, unfreezeCmd} {
+		addDryrunFlag(cmd)
+		cmd.Flags().StringVar(&env.FreezeState, "freeze-state", "./freeze-state.json", "The file recording the pre-freeze merge access levels for unfreeze (env: FREEZE_STATE)")
+	}
+}
@@ -1,15 +1,137 @@
 package cmd
 
-import "github.com/xanzy/go-gitlab"
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	gl "github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/httpheader"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/httptrace"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/tokenpool"
+)
 
 func gitlabClient() (*gitlab.Client, error) {
 	baseURL := "https://gitlab.com/"
 	if env.GitlabEndpoint != "" {
 		baseURL = env.GitlabEndpoint
 	}
-	client, err := gitlab.NewClient(env.GitlabToken, gitlab.WithBaseURL(baseURL))
+
+	if len(env.GitlabToken) == 0 || env.GitlabToken[0] == "" {
+		return nil, fmt.Errorf("GITLAB_TOKEN must be set")
+	}
+	if len(env.GitlabToken) > 1 {
+		if err := checkTokens(baseURL); err != nil {
+			return nil, err
+		}
+		logger.Infof("Rotating between %d GitLab tokens.", len(env.GitlabToken))
+	}
+
+	client, err := gitlab.NewClient(env.GitlabToken[0], gitlab.WithBaseURL(baseURL), gitlab.WithHTTPClient(httpClient()))
 	if err != nil {
 		return nil, err
 	}
+	client.UserAgent = env.UserAgent
 	return client, nil
 }
+
+// checkTokens verifies that all tokens of GITLAB_TOKEN are active personal access tokens of
+// the same user with the same scopes, so rotating between them never changes what a request
+// may do
+func checkTokens(baseURL string) error {
+	var tokens []*gitlab.PersonalAccessToken
+	for i, token := range env.GitlabToken {
+		if token == "" {
+			return fmt.Errorf("GITLAB_TOKEN %d of %d is empty", i+1, len(env.GitlabToken))
+		}
+		client, err := gitlab.NewClient(token, gitlab.WithBaseURL(baseURL), gitlab.WithHTTPClient(&http.Client{Transport: httpTransport()}))
+		if err != nil {
+			return err
+		}
+		pat, _, err := client.PersonalAccessTokens.GetSinglePersonalAccessToken()
+		if err != nil {
+			return fmt.Errorf("failed to look up GITLAB_TOKEN %d of %d: %v", i+1, len(env.GitlabToken), err)
+		}
+		tokens = append(tokens, pat)
+	}
+
+	return tokenpool.Check(tokens)
+}
+
+// checkEdition fails the run if the config uses EE-only sections on GitLab CE. With
+// --allow-missing-features the sections are skipped with a warning instead.
+func checkEdition(client *gitlab.Client) {
+	sections := cfg.EnterpriseSections()
+	if len(sections) == 0 {
+		return
+	}
+
+	enterprise, version, err := gl.IsEnterpriseEdition(client.Metadata)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if enterprise {
+		return
+	}
+
+	if !env.AllowMissingFeatures {
+		logger.Fatalf("GitLab %s is no enterprise edition, which the config sections %s need. Pass --allow-missing-features to skip them.",
+			version, strings.Join(sections, ", "))
+	}
+	message := fmt.Sprintf("GitLab %s is no enterprise edition, skipping the config sections %s.", version, strings.Join(sections, ", "))
+	logger.Warn(message)
+	startupWarnings = append(startupWarnings, message)
+	cfg.DropEnterpriseSections()
+}
+
+// gitlabClients returns the API clients of the project manager, without the users client
+// reading the two-factor authentication state of group members
+func gitlabClients(client *gitlab.Client) gl.Clients {
+	return gl.Clients{
+		Groups:               client.Groups,
+		Projects:             client.Projects,
+		ProtectedBranches:    client.ProtectedBranches,
+		ProtectedTags:        client.ProtectedTags,
+		Branches:             client.Branches,
+		AccessTokens:         client.ProjectAccessTokens,
+		RepositoryFiles:      client.RepositoryFiles,
+		Repositories:         client.Repositories,
+		ComplianceFrameworks: complianceFrameworksClient(client),
+		GroupVariables:       client.GroupVariables,
+		ProjectVariables:     client.ProjectVariables,
+		ApprovalSettingLocks: gl.NewApprovalSettingLocksService(client),
+		ProjectMirrors:       client.ProjectMirrors,
+		GroupMembers:         client.GroupMembers,
+	}
+}
+
+// complianceFrameworksClient returns the GraphQL client for compliance frameworks of the
+// GitLab instance of the REST client
+func complianceFrameworksClient(client *gitlab.Client) *gl.ComplianceFrameworksService {
+	return gl.NewComplianceFrameworksService(client.BaseURL(), env.GitlabToken[0], httpClient())
+}
+
+// httpClient returns an HTTP client sending the User-Agent and correlation ID of the run,
+// which also logs all requests if tracing is enabled and counts them for the metrics. With
+// several GitLab tokens the requests rotate between them.
+func httpClient() *http.Client {
+	if len(env.GitlabToken) > 1 {
+		return &http.Client{Transport: &tokenpool.Transport{Base: httpTransport(), Tokens: env.GitlabToken}}
+	}
+
+	return &http.Client{Transport: httpTransport()}
+}
+
+// httpTransport returns the transport of httpClient, authenticating with the token of the
+// request
+func httpTransport() http.RoundTripper {
+	var base http.RoundTripper
+	if env.TraceHTTP {
+		base = &httptrace.Transport{Logger: logger.WithField("module", "http")}
+	}
+
+	transport := &httpheader.Transport{Base: base, UserAgent: env.UserAgent, RequestID: env.RequestID}
+	return &countingTransport{Base: transport}
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	gl "github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab"
+)
+
+// listProjectsCmd represents the list-projects command
+var listProjectsCmd = &cobra.Command{
+	Use:   "list-projects",
+	Short: "List the projects a sync would operate on, without changing any settings",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := gitlabClient()
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		manager := gl.NewProjectManager(logger.WithField("module", "project_manager"), gitlabClients(client), cfg)
+		manager.SetPersonalProjectUsers(env.IncludePersonalProjects)
+		manager.SetCreatedSince(createdSince())
+
+		projects, err := manager.GetProjects()
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		logger.Infof("Identified %d valid project(s).", len(projects))
+		checkProjectCount(len(projects))
+		for _, project := range projects {
+			fmt.Printf("%d\t%s\n", project.ID, project.PathWithNamespace)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listProjectsCmd)
+	addCreatedSinceFlag(listProjectsCmd)
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/checkpoint"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/manifest"
+)
+
+// startManifest returns the recorder of the manifest of the run of the command. With
+// --manifest-file it records the errors logged from now on and writes the manifest when the
+// run exits by a fatal error; the command defers writeManifest for all other exits.
+func startManifest(command string, dryrun bool) *manifest.Recorder {
+	hash, err := checkpoint.Hash(cfg)
+	if err != nil {
+		logger.Warnf("failed to hash the config for the manifest: %v", err)
+	}
+	recorder := manifest.New(command, hash, []string{cfg.GroupName}, dryrun)
+
+	if env.ManifestFile != "" {
+		logger.AddHook(recorder)
+		logrus.RegisterExitHandler(func() {
+			writeManifest(recorder)
+		})
+	}
+
+	return recorder
+}
+
+// writeManifest writes the manifest to --manifest-file, if given. Failures are only logged,
+// the manifest must never change the outcome of a run.
+func writeManifest(recorder *manifest.Recorder) {
+	if env.ManifestFile == "" {
+		return
+	}
+
+	if err := recorder.Write(env.ManifestFile); err != nil {
+		logger.Warn(err)
+		return
+	}
+	logger.Debugf("Wrote manifest to %s.", env.ManifestFile)
+}
+
+// projectPaths returns the paths with namespace of the projects
+func projectPaths(projects []gitlab.Project) []string {
+	paths := make([]string, 0, len(projects))
+	for _, project := range projects {
+		paths = append(paths, project.PathWithNamespace)
+	}
+
+	return paths
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/statsd"
+)
+
+var (
+	// runStart is the start of the run, for the duration metric
+	runStart = time.Now()
+
+	// apiCalls counts the GitLab API requests of the run
+	apiCalls int64
+)
+
+// countingTransport is a http.RoundTripper counting the requests in apiCalls
+type countingTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip counts the request and executes it with the base transport
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&apiCalls, 1)
+
+	return t.Base.RoundTrip(req)
+}
+
+// sendMetrics sends the counters and gauges of the command, e.g. projects.processed, together
+// with the number of API calls and the duration of the run to the StatsD server configured in
+// metrics.statsd. Failures are only logged, metrics must never fail a run.
+func sendMetrics(command string, counters map[string]int, gauges map[string]float64) {
+	if cfg.Metrics == nil || cfg.Metrics.StatsD == nil {
+		return
+	}
+	s := cfg.Metrics.StatsD
+
+	var tags map[string]string
+	if s.Dialect == config.StatsDDialectDogStatsD {
+		tags = map[string]string{"group": cfg.GroupName, "command": command}
+	}
+
+	client, err := statsd.New(s.Address, s.Prefix, tags)
+	if err != nil {
+		logger.Warn(err)
+		return
+	}
+	defer client.Close()
+
+	counters["api_calls"] = int(atomic.LoadInt64(&apiCalls))
+	for name, value := range counters {
+		if err := client.Count(name, value); err != nil {
+			logger.Warn(err)
+			return
+		}
+	}
+	for name, value := range gauges {
+		if err := client.Gauge(name, value); err != nil {
+			logger.Warn(err)
+			return
+		}
+	}
+	if err := client.Timing("duration", time.Since(runStart)); err != nil {
+		logger.Warn(err)
+		return
+	}
+
+	logger.Debugf("Sent metrics to statsd %s.", s.Address)
+}
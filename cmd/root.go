@@ -3,26 +3,66 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	gl "github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/httpheader"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/tokenpool"
 )
 
 type envCfg struct {
-	ConfigFile     string `split_words:"true" default:"./config.json"`
-	Dryrun         bool
-	GitlabEndpoint string `split_words:"true"`
-	GitlabToken    string `split_words:"true" required:"true"`
-	Verbose        bool
+	ConfigFile              string `split_words:"true"`
+	AllowMissingFeatures    bool   `split_words:"true"`
+	CanaryCount             int    `split_words:"true"`
+	CanaryPercent           int    `split_words:"true"`
+	CheckpointFile          string `split_words:"true"`
+	CreatedSince            string `split_words:"true"`
+	DiffReport              string `split_words:"true"`
+	Confirm                 bool   `ignored:"true"`
+	Dryrun                  bool
+	FailOnEmpty             bool     `split_words:"true"`
+	FreezeState             string   `split_words:"true"`
+	FullDiff                bool     `split_words:"true"`
+	GitlabEndpoint          string   `split_words:"true"`
+	GitlabToken             []string `split_words:"true" required:"true"`
+	IncludePersonalProjects []string `split_words:"true"`
+	JunitReport             string   `split_words:"true"`
+	ManifestFile            string   `split_words:"true"`
+	MarkdownReport          string   `split_words:"true"`
+	MaxErrors               int      `split_words:"true"`
+	Output                  []string
+	Only                    []string
+	OnlyNoncompliant        bool `split_words:"true"`
+	Patch                   string
+	PreviousState           string        `split_words:"true"`
+	ProjectTimeout          time.Duration `split_words:"true"`
+	RequestID               string        `split_words:"true"`
+	Resume                  bool
+	Set                     []string `ignored:"true"`
+	Skip                    []string
+	Sort                    string
+	StateFile               string `split_words:"true"`
+	Strict                  bool
+	TraceHTTP               bool   `split_words:"true"`
+	WarningsAsErrors        bool   `split_words:"true"`
+	HomogeneousApprovals    bool   `split_words:"true"`
+	UserAgent               string `split_words:"true"`
+	Verbose                 bool
+	Yes                     bool `ignored:"true"`
 }
 
 var (
 	env    = &envCfg{}
 	logger = logrus.New()
 	cfg    *config.Config
+
+	// dryrunFlag holds --dry-run, which overrides the DRYRUN env var when given
+	dryrunFlag bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -34,13 +74,49 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			logger.Fatal(err)
 		}
+		logger.AddHook(&tokenpool.RedactHook{Tokens: env.GitlabToken})
 
-		logger.Infof("Loading config file from %v", env.ConfigFile)
+		if env.ConfigFile == config.Stdin {
+			logger.Infof("Loading config from stdin")
+		} else {
+			logger.Infof("Loading config file from %v", env.ConfigFile)
+		}
 
-		cfg, err = config.Parse(env.ConfigFile)
+		if env.Patch == "" && len(env.Set) == 0 {
+			cfg, err = config.Parse(env.ConfigFile)
+		} else {
+			if env.Patch != "" {
+				logger.Infof("Applying config patch from %v", env.Patch)
+			}
+			for _, set := range env.Set {
+				logger.Infof("Applying config override --set %v", set)
+			}
+			cfg, err = config.ParseOverridden(env.ConfigFile, env.Patch, env.Set)
+		}
 		if err != nil {
 			logger.Fatal(err)
 		}
+		if env.Patch != "" || len(env.Set) > 0 {
+			effective, err := config.Redacted(cfg)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			logger.Infof("Effective config: %s", effective)
+		}
+
+		// The env vars are processed after the flags were parsed, so an explicit --dry-run
+		// has to be applied again to take precedence over DRYRUN
+		if f := cmd.Flags().Lookup("dry-run"); f != nil && f.Changed {
+			env.Dryrun = dryrunFlag
+		}
+
+		if env.Strict {
+			cfg.Strict = true
+		}
+
+		if err := reportOptions().Validate(); err != nil {
+			logger.Fatal(err)
+		}
 
 		if env.Verbose {
 			logger.SetLevel(logrus.DebugLevel)
@@ -48,9 +124,103 @@ var rootCmd = &cobra.Command{
 			logger.SetLevel(logrus.InfoLevel)
 		}
 
+		// All GitLab API requests of the run carry the correlation ID
+		if env.RequestID == "" {
+			env.RequestID, err = httpheader.NewRequestID()
+			if err != nil {
+				logger.Fatal(err)
+			}
+		}
+		logger.Infof("Correlation ID of this run: %s (sent as %s header)", env.RequestID, httpheader.RequestIDHeader)
+
 	},
 }
 
+func init() {
+	rootCmd.PersistentFlags().StringVar(&env.ConfigFile, "config", "./config.json", "The JSON or YAML config file, - to read it from stdin (env: CONFIG_FILE)")
+	rootCmd.PersistentFlags().StringVar(&env.Patch, "patch", "", "A JSON Patch or JSON Merge Patch file, JSON or YAML, applied on top of the config before validation (env: PATCH)")
+	rootCmd.PersistentFlags().StringArrayVar(&env.Set, "set", nil, "Override a config value as key.path=value, e.g. approval_settings.approvals_before_merge=3, applied after --patch before validation, repeatable")
+	rootCmd.PersistentFlags().BoolVarP(&env.Verbose, "verbose", "v", false, "Enable debug logging, e.g. to show why projects are skipped (env: VERBOSE)")
+	rootCmd.PersistentFlags().BoolVar(&env.AllowMissingFeatures, "allow-missing-features", false, "Skip config sections needing GitLab EE with a warning on GitLab CE instead of failing (env: ALLOW_MISSING_FEATURES)")
+	rootCmd.PersistentFlags().BoolVar(&env.FailOnEmpty, "fail-on-empty", false, "Fail if no projects remain after filtering, e.g. due to a misconfigured whitelist (env: FAIL_ON_EMPTY)")
+	rootCmd.PersistentFlags().StringSliceVar(&env.IncludePersonalProjects, "include-personal-projects", nil, "Also process the personal projects of these users, subject to the same project filters (env: INCLUDE_PERSONAL_PROJECTS)")
+	rootCmd.PersistentFlags().IntVar(&env.MaxErrors, "max-errors", 0, "Stop processing further projects after this many errors, 0 for unlimited (env: MAX_ERRORS)")
+	rootCmd.PersistentFlags().StringVar(&env.Sort, "sort", "name", "Order of the projects in the reports: name, noncompliance or changes (env: SORT)")
+	rootCmd.PersistentFlags().BoolVar(&env.Strict, "strict", false, "Treat warnings, e.g. failing to verify a protection, as errors (env: STRICT)")
+	rootCmd.PersistentFlags().StringVar(&env.UserAgent, "user-agent", "gitlab-settings-enforcer", "The User-Agent sent with all GitLab API requests (env: USER_AGENT)")
+	rootCmd.PersistentFlags().StringVar(&env.RequestID, "request-id", "", "The correlation ID sent as X-Request-ID header with all GitLab API requests, a random UUID if not set (env: REQUEST_ID)")
+	rootCmd.PersistentFlags().BoolVar(&env.TraceHTTP, "trace-http", false, "Log all GitLab API requests and responses with secrets redacted (env: TRACE_HTTP)")
+}
+
+// addDryrunFlag adds the --dry-run flag to the command
+func addDryrunFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&dryrunFlag, "dry-run", false, "Only log the changes without applying them; overrides the DRYRUN env var when given, e.g. --dry-run=false (env: DRYRUN)")
+}
+
+// addCreatedSinceFlag adds the --created-since flag to the command
+func addCreatedSinceFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&env.CreatedSince, "created-since", "", "Only process projects created within this many days (e.g. 30d), this duration (e.g. 12h) or since this date (e.g. 2024-01-31); whitelisted projects are always processed (env: CREATED_SINCE)")
+}
+
+// createdSince returns the creation time given by --created-since, the zero time if not set
+func createdSince() time.Time {
+	since, err := gl.ParseCreatedSince(env.CreatedSince, time.Now())
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	return since
+}
+
+// checkProjectCount fails the run if no projects were identified and --fail-on-empty is set
+func checkProjectCount(count int) {
+	if count == 0 && env.FailOnEmpty {
+		logger.Fatal("No projects to process, failing as --fail-on-empty is set.")
+	}
+}
+
+// reportOptions returns the order and filtering of the reports given by the flags
+func reportOptions() gl.ReportOptions {
+	return gl.ReportOptions{Sort: env.Sort, OnlyNonCompliant: env.OnlyNoncompliant}
+}
+
+// reportOutputs returns the outputs given by --output, or the console if none is given. The
+// outputs are validated before any project is processed.
+func reportOutputs() []gl.Output {
+	var outputs []gl.Output
+	for _, spec := range env.Output {
+		output, err := gl.ParseOutput(spec)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if output.Sink == gl.OutputEmail && !cfg.EmailConfigured() {
+			logger.Fatalf("output %s needs compliance.email.from, server and port in the config", spec)
+		}
+		outputs = append(outputs, output)
+	}
+
+	if len(outputs) == 0 {
+		outputs = append(outputs, gl.Output{Sink: gl.OutputConsole, Format: gl.FormatText})
+	}
+
+	return outputs
+}
+
+// addOutputFlag adds the --output flag to the command
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&env.Output, "output", nil, "Write the report to this output, given as SINK[:FORMAT][=PATH], e.g. console, file:json=report.json or email:html; repeatable, defaults to the console (env: OUTPUT)")
+}
+
+// addManifestFlag adds the --manifest-file flag to the command
+func addManifestFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&env.ManifestFile, "manifest-file", "", "Write a JSON manifest summarizing the run, e.g. its status, counts and errors per project, to this path or s3:// URL, also if the run fails (env: MANIFEST_FILE)")
+}
+
+// addWarningsAsErrorsFlag adds the --warnings-as-errors flag to the command
+func addWarningsAsErrorsFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&env.WarningsAsErrors, "warnings-as-errors", false, "Fail the run if any warning was reported, e.g. about skipped projects (env: WARNINGS_AS_ERRORS)")
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
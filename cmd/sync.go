@@ -1,8 +1,20 @@
 package cmd
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/checkpoint"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
 	gl "github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/hook"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/manifest"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/progress"
 	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
 )
 
 // syncCmd represents the sync command
@@ -10,24 +22,55 @@ var syncCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Sync gitlab's project settings with the config",
 	Run: func(cmd *cobra.Command, args []string) {
+		runManifest := startManifest("sync", env.Dryrun)
+		defer writeManifest(runManifest)
+
 		client, err := gitlabClient()
 		if err != nil {
 			logger.Fatal(err)
 		}
+		checkEdition(client)
+
+		if err := checkSyncSections(); err != nil {
+			logger.Fatal(err)
+		}
 
 		if env.Dryrun {
 			logger.Infof("DRYRUN: No settings will be updated.")
 		}
 
-		manager := gl.NewProjectManager(
-			logger.WithField("module", "project_manager"),
-			client.Groups,
-			client.Projects,
-			client.ProtectedBranches,
-			client.ProtectedTags,
-			client.Branches,
-			cfg,
-		)
+		outputs := reportOutputs()
+		if env.MarkdownReport != "" {
+			outputs = append(outputs, gl.Output{Sink: gl.OutputFile, Format: gl.FormatMarkdown, Path: env.MarkdownReport})
+		}
+		if env.DiffReport != "" {
+			outputs = append(outputs, gl.Output{Sink: gl.OutputFile, Format: gl.FormatDiff, Path: env.DiffReport})
+		}
+
+		newManager := func() *gl.ProjectManager {
+			clients := gitlabClients(client)
+			clients.Users = client.Users
+			manager := gl.NewProjectManager(logger.WithField("module", "project_manager"), clients, cfg)
+			manager.SetReportOptions(reportOptions())
+			manager.SetPersonalProjectUsers(env.IncludePersonalProjects)
+			manager.SetCreatedSince(createdSince())
+			manager.SetHomogeneousApprovals(env.HomogeneousApprovals)
+			addStartupWarnings(manager)
+			return manager
+		}
+		manager := newManager()
+
+		// Read before the state file of this run may overwrite it
+		var previous []gl.ProjectState
+		if env.PreviousState != "" {
+			previous, err = gl.ReadProjectStates(env.PreviousState)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			if previous == nil {
+				logger.Infof("No previous state found at %s, skipping the drift detection.", env.PreviousState)
+			}
+		}
 
 		projects, err := manager.GetProjects()
 		if err != nil {
@@ -35,55 +78,393 @@ var syncCmd = &cobra.Command{
 		}
 
 		logger.Infof("Identified %d valid project(s).", len(projects))
-		for index, project := range projects {
-			logger.Infof("Processing project #%d: %s", index+1, project.PathWithNamespace)
+		checkProjectCount(len(projects))
 
-			// Update branches
-			if err := manager.EnsureBranchesAndProtection(project, env.Dryrun); err != nil {
-				logger.Errorf("failed to ensure branches of repo %v: %v", project.PathWithNamespace, err)
-				manager.SetError(true)
+		if err := gl.ValidateCanary(env.CanaryPercent, env.CanaryCount); err != nil {
+			logger.Fatal(err)
+		}
+		if env.CanaryPercent > 0 || env.CanaryCount > 0 {
+			projects = gl.CanaryProjects(projects, env.CanaryPercent, env.CanaryCount)
+			logger.Infof("Canary mode: syncing %d project(s) only:", len(projects))
+			for _, project := range projects {
+				logger.Infof("  canary %s", project.PathWithNamespace)
 			}
+		}
 
-			// Update tags
-			if err := manager.EnsureTagsProtection(project, env.Dryrun); err != nil {
-				logger.Errorf("failed to ensure tags of repo %v: %v", project.PathWithNamespace, err)
-				manager.SetError(true)
+		var cp *checkpoint.Checkpoint
+		if !env.Dryrun {
+			cp, projects = resumeCheckpoint(projects)
+		}
+
+		if env.Confirm && !env.Dryrun && !env.Yes {
+			if !isTerminal(os.Stdin) {
+				logger.Fatal("--confirm needs an interactive terminal, pass --yes to apply without prompting.")
 			}
 
-			// Update general settings
-			if err := manager.UpdateProjectSettings(project, env.Dryrun); err != nil {
-				logger.Errorf("failed to update project settings of repo %v: %v", project.PathWithNamespace, err)
-				manager.SetError(true)
+			// Compute the plan without applying it
+			plan := newManager()
+			syncProjects(plan, projects, true, nil, nil)
+			if err := plan.GenerateChangeLogReport(env.FullDiff); err != nil {
+				logger.Fatalf("failed to create changelog report: %v", err)
+			}
+			if changes, err := plan.HasChanges(); err == nil && !changes {
+				logger.Infof("No settings changes planned, only branch and tag protections listed above may change.")
 			}
 
-			// Update approval settings
-			if err := manager.UpdateProjectApprovalSettings(project, env.Dryrun); err != nil {
-				logger.Errorf("failed to update approval settings of repo %v: %v", project.PathWithNamespace, err)
-				manager.SetError(true)
+			if !confirm("Apply these changes to %d project(s)?", len(projects)) {
+				logger.Infof("Aborted, no settings were updated.")
+				return
 			}
 		}
 
-		if err := manager.GenerateChangeLogReport(); err != nil {
+		runManifest.AddProjects(projectPaths(projects))
+		processed, errored := syncProjects(manager, projects, env.Dryrun, cp, runManifest)
+
+		if previous != nil {
+			manager.GenerateDriftReport(previous)
+		}
+
+		if err := manager.WriteChangeLogOutputs(outputs, env.FullDiff, env.Dryrun); err != nil {
 			logger.Errorf("failed to create changelog report: %v", err)
 			manager.SetError(true)
 		}
+		if env.Dryrun {
+			manager.GenerateDryrunCallReport()
+		}
+
+		if env.StateFile != "" {
+			if err := manager.WriteStateFile(env.StateFile); err != nil {
+				logger.Errorf("failed to write state file: %v", err)
+				manager.SetError(true)
+			}
+		}
+
+		reportWarnings(manager)
+		runPostRunHook(manager, len(projects))
+		sendSyncMetrics(manager, processed, errored)
+		recordSyncManifest(runManifest, manager, len(projects), processed, errored)
+
+		// A complete run leaves nothing to resume
+		if cp != nil && !manager.GetError() {
+			if err := cp.Remove(); err != nil {
+				logger.Warn(err)
+			}
+		}
 
+		runManifest.Complete()
 		if manager.GetError() {
 			logger.Fatal("Error(s) encountered.")
 		}
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(syncCmd)
+// runPostRunHook notifies the configured post_run command or webhook with the run summary.
+// Failures only fail the run with post_run.fail_on_error set.
+func runPostRunHook(manager *gl.ProjectManager, projects int) {
+	if cfg.PostRun == nil {
+		return
+	}
+
+	err := func() error {
+		summary, err := manager.RunSummary(projects, env.Dryrun)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(summary)
+		if err != nil {
+			return fmt.Errorf("failed to convert run summary to json: %v", err)
+		}
+
+		if cfg.PostRun.URL != "" {
+			return hook.Post(cfg.PostRun.URL, payload)
+		}
+		return hook.Command(cfg.PostRun.Command, payload)
+	}()
+	if err == nil {
+		logger.Infof("Post run hook completed.")
+		return
+	}
+
+	if cfg.PostRun.FailOnError {
+		logger.Errorf("post run hook failed: %v", err)
+		manager.SetError(true)
+		return
+	}
+	logger.Warnf("post run hook failed: %v", err)
+}
+
+// sendSyncMetrics sends the numbers of processed, changed and errored projects of the run
+func sendSyncMetrics(manager *gl.ProjectManager, processed, errored int) {
+	if cfg.Metrics == nil {
+		return
+	}
+
+	summary, err := manager.RunSummary(processed, env.Dryrun)
+	if err != nil {
+		logger.Warnf("failed to summarize the run for the metrics: %v", err)
+		return
+	}
+
+	sendMetrics("sync", map[string]int{
+		"projects.processed": processed,
+		"projects.changed":   len(summary.ChangedProjects),
+		"projects.errored":   errored,
+	}, nil)
+}
+
+// recordSyncManifest records the numbers of projects and the changed projects of the run in
+// the manifest
+func recordSyncManifest(recorder *manifest.Recorder, manager *gl.ProjectManager, projects, processed, errored int) {
+	summary, err := manager.RunSummary(processed, env.Dryrun)
+	if err != nil {
+		logger.Warnf("failed to summarize the run for the manifest: %v", err)
+		return
+	}
+
+	recorder.MarkProjects(manifest.ProjectChanged, summary.ChangedProjects)
+	recorder.SetCounts(map[string]int{
+		"projects.total":     projects,
+		"projects.processed": processed,
+		"projects.changed":   len(summary.ChangedProjects),
+		"projects.errored":   errored,
+	})
+}
+
+// resumeCheckpoint returns the checkpoint recording the projects synced successfully, and the
+// projects left to sync. With --resume the projects done by the previous run of the same
+// config, --only and --skip are skipped; otherwise the checkpoint starts empty.
+func resumeCheckpoint(projects []gitlab.Project) (*checkpoint.Checkpoint, []gitlab.Project) {
+	key, err := checkpoint.Hash(struct {
+		Config interface{} `json:"config"`
+		Only   []string    `json:"only"`
+		Skip   []string    `json:"skip"`
+	}{cfg, env.Only, env.Skip})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if !env.Resume {
+		return checkpoint.New(env.CheckpointFile, key), projects
+	}
+
+	cp, stale, err := checkpoint.Load(env.CheckpointFile, key)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if stale {
+		logger.Warnf("Checkpoint %s was written for another config, syncing all projects.", env.CheckpointFile)
+	}
+
+	remaining := make([]gitlab.Project, 0, len(projects))
+	for _, project := range projects {
+		if cp.Done(project.PathWithNamespace) {
+			logger.Debugf("Skipping project %s, already synced according to the checkpoint.", project.PathWithNamespace)
+			continue
+		}
+		remaining = append(remaining, project)
+	}
+	logger.Infof("Resuming: skipping %d project(s) already synced, %d project(s) left.", len(projects)-len(remaining), len(remaining))
+
+	return cp, remaining
+}
+
+// syncProjects enforces the config on each of the projects, recording errors on the manager.
+// Once --max-errors is reached, the remaining projects are skipped. Projects synced without
+// errors are recorded in the checkpoint, and the errors of each project in the manifest, if
+// given. It returns the number of projects processed and of those with errors.
+func syncProjects(manager *gl.ProjectManager, projects []gitlab.Project, dryrun bool, cp *checkpoint.Checkpoint, recorder *manifest.Recorder) (processed, errored int) {
+	// Update the group defaults new projects start with
+	if syncSectionSelected("group_settings") {
+		if err := manager.EnsureGroupSettings(dryrun); err != nil {
+			logger.Errorf("failed to ensure group settings of group %v: %v", cfg.GroupName, err)
+			manager.SetError(true)
+		}
+	}
+
+	if syncSectionSelected("group_ci_variables") {
+		if err := manager.EnsureGroupVariables(dryrun); err != nil {
+			logger.Errorf("failed to ensure CI/CD variables of group %v: %v", cfg.GroupName, err)
+			manager.SetError(true)
+		}
+	}
+
+	if syncSectionSelected("group_members") {
+		if err := manager.EnsureGroupMembers(dryrun); err != nil {
+			logger.Errorf("failed to ensure members of group %v: %v", cfg.GroupName, err)
+			manager.SetError(true)
+		}
+	}
+
+	p := progress.New(os.Stdout, logger, isTerminal(os.Stdout), len(projects))
+	defer p.Done()
+
+	for index, project := range projects {
+		if manager.MaxErrorsReached(env.MaxErrors) {
+			logger.Errorf("Reached %d error(s), skipping the remaining %d project(s).", manager.ErrorCount(), len(projects)-index)
+			return processed, errored
+		}
+
+		p.Next(project.PathWithNamespace)
+		logger.Debugf("Processing project #%d: %s", index+1, project.PathWithNamespace)
+
+		errors := manager.ErrorCount()
+		if recorder != nil {
+			recorder.StartProject(project.PathWithNamespace)
+		}
+		syncProject(manager, project, dryrun)
+		if recorder != nil {
+			recorder.EndProject()
+		}
+		processed++
+
+		if manager.ErrorCount() != errors {
+			errored++
+			continue
+		}
+		if cp != nil {
+			if err := cp.MarkDone(project.PathWithNamespace); err != nil {
+				logger.Warn(err)
+			}
+		}
+	}
+
+	return processed, errored
+}
+
+// syncProject enforces the config on the project. Once --project-timeout passed, the
+// remaining steps are skipped and the project is recorded as a single error.
+func syncProject(manager *gl.ProjectManager, project gitlab.Project, dryrun bool) {
+	done := manager.StartProject(env.ProjectTimeout)
+	defer done()
+
+	// Skip projects which are still being imported or have an empty repository
+	if ready, err := manager.CheckProjectReady(project); !ready {
+		if err != nil {
+			logger.Errorf("failed to process repo %v: %v", project.PathWithNamespace, err)
+			manager.SetError(true)
+		}
+		return
+	}
+
+	// Enforce the config with the settings of the rules matching the project
+	if err := manager.UseProjectConfig(project); err != nil {
+		logger.Errorf("failed to process repo %v: %v", project.PathWithNamespace, err)
+		manager.SetError(true)
+		return
+	}
+
+	// Fetch the current settings of the project concurrently, before the ordered writes
+	manager.PrefetchProjectState(project)
 
-	// Here you will define your flags and configuration settings.
+	for _, step := range manager.ProjectSteps() {
+		if !syncSectionSelected(step.Section) {
+			logger.Debugf("Skipping %s of repo %v, not selected by --only/--skip.", step.Section, project.PathWithNamespace)
+			continue
+		}
+
+		err := step.Run(project, dryrun)
+		if manager.ProjectTimedOut() {
+			logger.Errorf("timed out processing repo %v after %v, skipping its remaining settings", project.PathWithNamespace, env.ProjectTimeout)
+			manager.SetError(true)
+			return
+		}
+		if err != nil {
+			logger.Errorf("failed to %s of repo %v: %v", step.Action, project.PathWithNamespace, err)
+			manager.SetError(true)
+		}
+	}
+}
+
+// syncSections lists the config sections sync enforces, the group sections followed by the
+// project sections in their default order. approval_rules are the approval_rule of
+// protected_branches.
+var syncSections = append([]string{"group_settings", "group_ci_variables", "group_members"}, config.ProjectSyncSections...)
+
+// checkSyncSections validates the sections selected by --only or --skip
+func checkSyncSections() error {
+	if len(env.Only) > 0 && len(env.Skip) > 0 {
+		return fmt.Errorf("only one is allowed: --only / --skip")
+	}
+
+	for _, section := range append(append([]string{}, env.Only...), env.Skip...) {
+		if !containsSection(syncSections, section) {
+			return fmt.Errorf("unknown section %q, must be one of: %s", section, strings.Join(syncSections, ", "))
+		}
+	}
+
+	return nil
+}
+
+// syncSectionSelected reports whether the section is enforced, i.e. listed in --only or not
+// listed in --skip
+func syncSectionSelected(section string) bool {
+	if len(env.Only) > 0 {
+		return containsSection(env.Only, section)
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// syncCmd.PersistentFlags().String("foo", "", "A help for foo")
+	return !containsSection(env.Skip, section)
+}
+
+// containsSection reports whether the sections contain the section
+func containsSection(sections []string, section string) bool {
+	for _, s := range sections {
+		if s == section {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isTerminal reports whether the file is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm prompts the question on stdout and reads the answer from stdin. Anything but
+// y or yes is treated as no.
+func confirm(format string, a ...interface{}) bool {
+	fmt.Printf(format+" [y/N] ", a...)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// syncCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	addDryrunFlag(syncCmd)
+	addCreatedSinceFlag(syncCmd)
+	addOutputFlag(syncCmd)
+	addManifestFlag(syncCmd)
+	addWarningsAsErrorsFlag(syncCmd)
+	syncCmd.Flags().BoolVar(&env.FullDiff, "full-diff", false, "Show complete before/after lists in the change log instead of only added/removed elements (env: FULL_DIFF)")
+	syncCmd.Flags().StringVar(&env.DiffReport, "diff-report", "", "Write the change log as unified diff, a file per project and a hunk per setting, to this path or s3:// URL, like --output file:diff=PATH (env: DIFF_REPORT)")
+	syncCmd.Flags().StringVar(&env.MarkdownReport, "markdown-report", "", "Write the change log as markdown for a merge request comment to this path or s3:// URL, like --output file:markdown=PATH (env: MARKDOWN_REPORT)")
+	syncCmd.Flags().StringVar(&env.StateFile, "state-file", "", "Write the effective project and approval settings of every project after the sync as JSON to this path or s3:// URL (env: STATE_FILE)")
+	syncCmd.Flags().StringVar(&env.PreviousState, "previous-state", "", "Report the settings changed out of band since the run which wrote this state file, path or s3:// URL (env: PREVIOUS_STATE)")
+	syncCmd.Flags().BoolVar(&env.Confirm, "confirm", false, "Show the planned changes and ask for confirmation before applying them")
+	syncCmd.Flags().BoolVar(&env.HomogeneousApprovals, "homogeneous-approvals", false, "Fetch the approval settings of the first project of each namespace only and assume the others share them, saving an API call per further project (env: HOMOGENEOUS_APPROVALS)")
+	syncCmd.Flags().DurationVar(&env.ProjectTimeout, "project-timeout", gl.DefaultProjectTimeout, "Skip the remaining settings of a project taking longer than this and record it as error, 0 for unlimited (env: PROJECT_TIMEOUT)")
+	syncCmd.Flags().IntVar(&env.CanaryPercent, "canary-percent", 0, "Only sync this percentage of the projects, chosen by a hash of their ID so reruns pick the same ones (env: CANARY_PERCENT)")
+	syncCmd.Flags().IntVar(&env.CanaryCount, "canary-count", 0, "Only sync this many projects, chosen like --canary-percent (env: CANARY_COUNT)")
+	syncCmd.Flags().StringSliceVar(&env.Only, "only", nil, "Only enforce these config sections, e.g. approval_settings,protected_branches (env: ONLY)")
+	syncCmd.Flags().StringSliceVar(&env.Skip, "skip", nil, "Enforce all config sections but these, e.g. project_access_tokens (env: SKIP)")
+	syncCmd.Flags().StringVar(&env.CheckpointFile, "checkpoint-file", checkpoint.DefaultPath, "Record the projects synced without errors in this file, removed once a run completes without errors (env: CHECKPOINT_FILE)")
+	syncCmd.Flags().BoolVar(&env.Resume, "resume", false, "Skip the projects recorded in the checkpoint file by an interrupted run of the same config (env: RESUME)")
+	syncCmd.Flags().BoolVar(&env.Yes, "yes", false, "Apply without prompting, e.g. when --confirm is used without a terminal")
 }
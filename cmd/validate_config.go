@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// onlyChanged holds --only-changed, the git ref or file of the previous config
+var onlyChanged string
+
+// validateConfigCmd represents the validate-config command
+var validateConfigCmd = &cobra.Command{
+	Use:   "validate-config [config]",
+	Short: "Validate a config file without connecting to GitLab, e.g. in a pre-commit hook",
+	Args:  cobra.MaximumNArgs(1),
+	// A pure local operation, which needs neither GITLAB_TOKEN nor CONFIG_FILE
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		path := env.ConfigFile
+		if len(args) == 1 {
+			path = args[0]
+		}
+
+		if onlyChanged == "" {
+			cfg, err := config.Parse(path)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			findings := config.Lint(cfg)
+			for _, finding := range findings {
+				fmt.Printf("warning: %s\n", finding)
+			}
+			if len(findings) > 0 && env.Strict {
+				logger.Fatalf("%s has %d lint finding(s), failing due to --strict", path, len(findings))
+			}
+			fmt.Printf("%s is valid.\n", path)
+			return
+		}
+
+		previous, err := previousConfig(path, onlyChanged)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		sections, err := config.ValidateChanged(path, previous)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		if len(sections) == 0 {
+			fmt.Printf("No changes of %s to validate.\n", path)
+			return
+		}
+		fmt.Printf("Changed sections of %s are valid: %s\n", path, strings.Join(sections, ", "))
+	},
+}
+
+// previousConfig returns the previous config to compare with: the file at from if it exists,
+// otherwise the config file at the git ref from, e.g. HEAD. A config file which doesn't exist
+// at the ref yet is compared with an empty config.
+func previousConfig(path string, from string) ([]byte, error) {
+	if _, err := os.Stat(from); err == nil {
+		// nolint: gosec
+		return ioutil.ReadFile(from)
+	}
+
+	dir, file := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	object := from + ":./" + file
+
+	// nolint: gosec
+	if err := exec.Command("git", "-C", dir, "cat-file", "-e", object).Run(); err != nil {
+		if verr := exec.Command("git", "-C", dir, "rev-parse", "--verify", "--quiet", from+"^{commit}").Run(); verr != nil {
+			return nil, fmt.Errorf("--only-changed %s is neither a file nor a git ref", from)
+		}
+		return []byte("{}"), nil
+	}
+
+	var stderr bytes.Buffer
+	// nolint: gosec
+	git := exec.Command("git", "-C", dir, "show", object)
+	git.Stderr = &stderr
+	b, err := git.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v: %s", object, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return b, nil
+}
+
+func init() {
+	validateConfigCmd.Flags().StringVar(&onlyChanged, "only-changed", "", "Only validate the sections changed versus this git ref (e.g. HEAD) or previous config file, for a fast pre-commit hook")
+	rootCmd.AddCommand(validateConfigCmd)
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	gl "github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab"
+)
+
+// startupWarnings are the warnings logged before the ProjectManager of the run was created,
+// e.g. about skipped config sections
+var startupWarnings []string
+
+// addStartupWarnings records the startup warnings in the manager for its warnings report
+func addStartupWarnings(manager *gl.ProjectManager) {
+	for _, message := range startupWarnings {
+		manager.AddWarning("", message)
+	}
+}
+
+// reportWarnings prints the warnings of the run. With --warnings-as-errors any warning fails
+// the run.
+func reportWarnings(manager *gl.ProjectManager) {
+	manager.GenerateWarningsReport()
+
+	if count := len(manager.Warnings()); env.WarningsAsErrors && count > 0 {
+		logger.Errorf("%d warning(s) encountered, failing as --warnings-as-errors is set.", count)
+		manager.SetError(true)
+	}
+}
@@ -0,0 +1,129 @@
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DefaultPath is the checkpoint file written by sync unless another path is given
+const DefaultPath = ".gitlab-settings-enforcer-checkpoint.json"
+
+// Checkpoint records the projects a run processed successfully, so an interrupted run, e.g.
+// by a rate limit ban or a network drop, can resume without processing them again. It is
+// keyed by the hash of the config, a checkpoint of another config is discarded.
+type Checkpoint struct {
+	path     string
+	key      string
+	projects map[string]bool
+}
+
+// file is the json representation of a Checkpoint
+type file struct {
+	ConfigHash string   `json:"config_hash"`
+	Projects   []string `json:"projects"`
+}
+
+// Hash returns the hex encoded sha256 of the json representation of the config
+func Hash(cfg interface{}) (string, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert config to json: %v", err)
+	}
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// New returns an empty checkpoint for the config hash, written to path
+func New(path, key string) *Checkpoint {
+	return &Checkpoint{path: path, key: key, projects: make(map[string]bool)}
+}
+
+// Load reads the checkpoint of the config hash from path. A missing checkpoint file, or one
+// written for another config, results in an empty checkpoint; stale reports the latter.
+func Load(path, key string) (c *Checkpoint, stale bool, err error) {
+	c = New(path, key)
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read checkpoint file %s: %v", path, err)
+	}
+
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal checkpoint file %s: %v", path, err)
+	}
+	if f.ConfigHash != key {
+		return c, true, nil
+	}
+
+	for _, project := range f.Projects {
+		c.projects[project] = true
+	}
+
+	return c, false, nil
+}
+
+// Done reports whether the project was processed successfully
+func (c *Checkpoint) Done(project string) bool {
+	return c.projects[project]
+}
+
+// Len returns the number of projects processed successfully
+func (c *Checkpoint) Len() int {
+	return len(c.projects)
+}
+
+// MarkDone records the project as processed successfully and writes the checkpoint file.
+// The file is replaced atomically, so an interruption never leaves it truncated.
+func (c *Checkpoint) MarkDone(project string) error {
+	c.projects[project] = true
+
+	f := file{ConfigHash: c.key, Projects: make([]string, 0, len(c.projects))}
+	for p := range c.projects {
+		f.Projects = append(f.Projects, p)
+	}
+	sort.Strings(f.Projects)
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to convert checkpoint to json: %v", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint file %s: %v", c.path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint file %s: %v", c.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint file %s: %v", c.path, err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to write checkpoint file %s: %v", c.path, err)
+	}
+
+	return nil
+}
+
+// Remove deletes the checkpoint file, e.g. once a run completed without errors
+func (c *Checkpoint) Remove() error {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove checkpoint file %s: %v", c.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	c, stale, err := Load(path, "a")
+	if err != nil || stale || c.Len() != 0 {
+		t.Fatalf("Expected an empty checkpoint without a file, got %d project(s), stale %v (%v)", c.Len(), stale, err)
+	}
+	for _, project := range []string{"example/sub/bar", "example/foo"} {
+		if err := c.MarkDone(project); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	resumed, stale, err := Load(path, "a")
+	if err != nil || stale {
+		t.Fatalf("Expected the checkpoint to be loaded, got stale %v (%v)", stale, err)
+	}
+	if !resumed.Done("example/foo") || !resumed.Done("example/sub/bar") || resumed.Done("example/baz") {
+		t.Errorf("Expected foo and bar to be done, got %+v", resumed.projects)
+	}
+
+	// Only the final file remains in the directory
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	if len(files) != 1 {
+		t.Errorf("Expected no temporary files left, got %d file(s)", len(files))
+	}
+
+	if err := resumed.Remove(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint file to be removed, got %v", err)
+	}
+	if err := resumed.Remove(); err != nil {
+		t.Errorf("Expected removing a missing checkpoint to succeed, got %v", err)
+	}
+}
+
+func TestCheckpointConfigChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := New(path, "a").MarkDone("example/foo"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	c, stale, err := Load(path, "b")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !stale || c.Done("example/foo") {
+		t.Errorf("Expected the checkpoint of another config to be discarded, got stale %v", stale)
+	}
+}
+
+func TestHash(t *testing.T) {
+	type config struct {
+		Name string `json:"name"`
+	}
+
+	a, err := Hash(config{Name: "a"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if again, _ := Hash(config{Name: "a"}); again != a {
+		t.Errorf("Expected the same hash for the same config, got %s and %s", a, again)
+	}
+	if b, _ := Hash(config{Name: "b"}); b == a {
+		t.Errorf("Expected another hash for another config, got %s", b)
+	}
+}
@@ -1,37 +1,162 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"html/template"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/internal/stringslice"
 )
 
-// Parse takes the given configFilePath and reads the containing config file into a config struct
+// Parse takes the given configFilePath and reads the containing config file into a config struct.
+// The path - reads the config from stdin.
 func Parse(configFilePath string) (*Config, error) {
-	if err := checkFilePath(&configFilePath); err != nil {
+	b, name, err := readConfigFile(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJSON(b, name)
+}
+
+// ParseReader reads the config from r, JSON or YAML as detected by its content. The name
+// identifies the config in errors.
+func ParseReader(r io.Reader, name string) (*Config, error) {
+	b, err := readConfig(r, name)
+	if err != nil {
 		return nil, err
 	}
 
+	return parseJSON(b, name)
+}
+
+// readConfigFile reads the config file, or stdin for the path -, as JSON. It returns the name
+// identifying the config in errors.
+func readConfigFile(configFilePath string) ([]byte, string, error) {
+	if configFilePath == Stdin {
+		b, err := readConfig(os.Stdin, "stdin")
+		return b, "stdin", err
+	}
+
+	if err := checkFilePath(&configFilePath); err != nil {
+		return nil, "", err
+	}
+
 	// nolint: gosec
-	b, err := ioutil.ReadFile(configFilePath)
+	f, err := os.Open(configFilePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read config file %q: %v", configFilePath, err)
+	}
+	defer f.Close()
+
+	b, err := readConfig(f, configFilePath)
+	return b, configFilePath, err
+}
+
+// readConfig reads the config from r and converts it to JSON if it is YAML
+func readConfig(r io.Reader, name string) ([]byte, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %q: %v", name, err)
+	}
+
+	if !isJSON(b) {
+		if b, err = yamlToJSON(b); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config file %q: %v", name, err)
+		}
+	}
+
+	return b, nil
+}
+
+// parseJSON unmarshals and validates the JSON config. Each rule is validated merged on top
+// of the config.
+func parseJSON(b []byte, name string) (*Config, error) {
+	cfg, err := parseConfig(b, name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file %q: %v", configFilePath, err)
+		return nil, err
+	}
+
+	for _, r := range cfg.Rules {
+		if _, err := cfg.ForRules([]Rule{r}); err != nil {
+			return nil, fmt.Errorf("rules %s: %v", r.Name, err)
+		}
 	}
 
+	return cfg, nil
+}
+
+// parseConfig unmarshals and validates the JSON config, without validating the rules merged
+// on top of it
+func parseConfig(b []byte, name string) (*Config, error) {
 	cfg := &Config{
 		ProjectBlacklist: make([]string, 0),
 		ProjectWhitelist: make([]string, 0),
 		IncludeSubgroups: true,
 	}
 	if err := json.Unmarshal(b, cfg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config file %q: %v", configFilePath, err)
+		return nil, fmt.Errorf("failed to unmarshal config file %q: %v", name, err)
+	}
+	if err := checkArtifactsExpiration(b); err != nil {
+		return nil, err
 	}
 
 	return checkConfig(cfg)
 }
 
+// checkArtifactsExpiration rejects an artifacts expiration in project_settings, which would be
+// dropped silently as unknown key. The default expiration is an instance setting
+// (default_artifacts_expire_in of the admin application settings API), projects only set it per
+// job with artifacts:expire_in.
+func checkArtifactsExpiration(b []byte) error {
+	var raw struct {
+		ProjectSettings map[string]json.RawMessage `json:"project_settings"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	for _, key := range []string{"artifacts_expire_in", "default_artifacts_expire_in"} {
+		if _, ok := raw.ProjectSettings[key]; ok {
+			return errArtifactsExpireInNotPerProject
+		}
+	}
+
+	return nil
+}
+
+// isJSON reports whether the config content is a JSON object, otherwise it is taken as YAML
+func isJSON(b []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(b), []byte("{"))
+}
+
+// yamlToJSON converts the YAML config to JSON, so both share the json tags and unmarshalers
+// of the config types
+func yamlToJSON(b []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, errConfigMustBeObject
+	}
+
+	return json.Marshal(v)
+}
+
 func checkFilePath(configFilePath *string) error {
 	var err error
 	*configFilePath, err = filepath.Abs(*configFilePath)
@@ -50,15 +175,569 @@ func checkFilePath(configFilePath *string) error {
 
 func checkConfig(cfg *Config) (*Config, error) {
 	if len(cfg.ProjectBlacklist) > 0 && len(cfg.ProjectWhitelist) > 0 {
+		if both := filterOverlap(cfg.ProjectWhitelist, cfg.ProjectBlacklist); len(both) > 0 {
+			return nil, fmt.Errorf("%w, %s listed in both: remove them from project_blacklist, the whitelist already excludes all other projects", errOnlyOneOfBlacklistAndWhitelistAllowed, strings.Join(both, ", "))
+		}
 		return nil, errOnlyOneOfBlacklistAndWhitelistAllowed
 	}
 
+	if len(cfg.ManagedFields) > 0 && len(cfg.ImmutableFields) > 0 {
+		return nil, errOnlyOneOfManagedAndImmutableAllowed
+	}
+
+	for _, field := range append(cfg.ManagedFields, cfg.ImmutableFields...) {
+		if !strings.HasPrefix(field, "project_settings.") && !strings.HasPrefix(field, "approval_settings.") {
+			return nil, fmt.Errorf("invalid field %q: must start with project_settings. or approval_settings.", field)
+		}
+	}
+
+	for i := range cfg.ProjectAccessTokens {
+		if err := checkProjectAccessToken(&cfg.ProjectAccessTokens[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range cfg.RequiredFiles {
+		if err := checkRequiredFile(&cfg.RequiredFiles[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkRules(cfg.Rules); err != nil {
+		return nil, err
+	}
+
+	if cfg.TemplatesSource != nil {
+		if cfg.TemplatesSource.Project == "" {
+			return nil, errTemplatesSourceProjectMustBeSet
+		}
+		// The templates directories of GitLab itself are the default layout
+		cfg.TemplatesSource.Path = strings.Trim(cfg.TemplatesSource.Path, "/")
+		if cfg.TemplatesSource.Path == "" {
+			cfg.TemplatesSource.Path = ".gitlab"
+		}
+	}
+
+	approvalRules := make(map[string]bool)
+	for _, b := range cfg.ProtectedBranches {
+		if err := b.PushAccessLevel.Validate(); err != nil {
+			return nil, fmt.Errorf("protected_branches %s: push_access_level: %v", b.Name, err)
+		}
+		if err := b.MergeAccessLevel.Validate(); err != nil {
+			return nil, fmt.Errorf("protected_branches %s: merge_access_level: %v", b.Name, err)
+		}
+		if len(b.UnprotectedExceptions) > 0 && b.Name != WildcardBranch {
+			return nil, errUnprotectedExceptionsRequireWildcard
+		}
+		for _, exception := range b.UnprotectedExceptions {
+			if exception == "" || exception == WildcardBranch {
+				return nil, fmt.Errorf("protected_branches %s: invalid unprotected exception %q, must be a branch name or a wildcard like feature/*", b.Name, exception)
+			}
+		}
+
+		if r := b.ApprovalRule; r != nil {
+			if r.Name == "" {
+				return nil, errApprovalRuleNameMustBeSet
+			}
+			if approvalRules[r.Name] {
+				return nil, fmt.Errorf("protected_branches %s: approval rule %s is configured more than once", b.Name, r.Name)
+			}
+			if r.ApprovalsRequired < 0 {
+				return nil, fmt.Errorf("protected_branches %s: approval_rule.approvals_required must not be negative", b.Name)
+			}
+			approvalRules[r.Name] = true
+		}
+	}
+
+	for i := range cfg.ProtectedBranchPatterns {
+		if err := checkProtectedBranchPattern(&cfg.ProtectedBranchPatterns[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range cfg.ProtectedTags {
+		if err := t.CreateAccessLevel.Validate(); err != nil {
+			return nil, fmt.Errorf("protected_tags %s: create_access_level: %v", t.Name, err)
+		}
+		for _, a := range t.AllowedToCreate {
+			if err := a.Validate(); err != nil {
+				return nil, fmt.Errorf("protected_tags %s: allowed_to_create: %v", t.Name, err)
+			}
+		}
+	}
+
+	if cfg.DefaultBranch != nil {
+		if cfg.DefaultBranch.Name == "" {
+			return nil, errDefaultBranchNameMustBeSet
+		}
+		if cfg.ProjectSettings != nil && cfg.ProjectSettings.DefaultBranch != nil &&
+			*cfg.ProjectSettings.DefaultBranch != cfg.DefaultBranch.Name {
+			return nil, errDefaultBranchMismatch
+		}
+		if p := cfg.DefaultBranch.Protection; p != nil {
+			if err := p.PushAccessLevel.Validate(); err != nil {
+				return nil, fmt.Errorf("default_branch.protection: push_access_level: %v", err)
+			}
+			if err := p.MergeAccessLevel.Validate(); err != nil {
+				return nil, fmt.Errorf("default_branch.protection: merge_access_level: %v", err)
+			}
+			for _, b := range cfg.ProtectedBranches {
+				if b.Name == cfg.DefaultBranch.Name {
+					return nil, errDefaultBranchProtectionConflict
+				}
+			}
+		}
+	}
+
+	if cfg.ServiceDesk != nil {
+		if cfg.ServiceDesk.AddressSuffix != "" && !cfg.ServiceDesk.Enabled {
+			return nil, errServiceDeskSuffixRequiresEnabled
+		}
+		if cfg.ProjectSettings != nil && cfg.ProjectSettings.ServiceDeskEnabled != nil &&
+			*cfg.ProjectSettings.ServiceDeskEnabled != cfg.ServiceDesk.Enabled {
+			return nil, errServiceDeskMismatch
+		}
+	}
+
+	if m := cfg.RemoteMirrors; m != nil {
+		if m.OnlyProtectedBranches != nil && *m.OnlyProtectedBranches && m.MirrorBranchRegex != nil && *m.MirrorBranchRegex != "" {
+			return nil, errRemoteMirrorBranchFilterMustBeUnique
+		}
+		if m.MirrorBranchRegex != nil {
+			if _, err := regexp.Compile(*m.MirrorBranchRegex); err != nil {
+				return nil, fmt.Errorf("remote_mirrors: invalid mirror_branch_regex: %v", err)
+			}
+		}
+	}
+
+	if cfg.PostRun != nil && (len(cfg.PostRun.Command) > 0) == (cfg.PostRun.URL != "") {
+		return nil, errPostRunTargetMustBeUnique
+	}
+
+	if cfg.Metrics != nil && cfg.Metrics.StatsD != nil {
+		if err := checkStatsD(cfg.Metrics.StatsD); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.GroupCIVariables != nil {
+		if err := checkCIVariables(cfg.GroupCIVariables.Variables); err != nil {
+			return nil, fmt.Errorf("group_ci_variables: %v", err)
+		}
+	}
+
+	if cfg.ProjectCIVariables != nil {
+		if err := checkCIVariables(cfg.ProjectCIVariables.Variables); err != nil {
+			return nil, fmt.Errorf("project_ci_variables: %v", err)
+		}
+	}
+
+	if cfg.GroupMembers != nil {
+		seen := make(map[string]bool)
+		for _, member := range cfg.GroupMembers.Members {
+			if err := member.Validate(); err != nil {
+				return nil, err
+			}
+			if seen[member.Key()] {
+				return nil, fmt.Errorf("group_members: duplicate member %s", member.Key())
+			}
+			seen[member.Key()] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, section := range cfg.SyncOrder {
+		if !stringslice.Contains(section, ProjectSyncSections) {
+			return nil, fmt.Errorf("sync_order: unknown section %q, must be one of: %s", section, strings.Join(ProjectSyncSections, ", "))
+		}
+		if seen[section] {
+			return nil, fmt.Errorf("sync_order: section %s is listed more than once", section)
+		}
+		seen[section] = true
+	}
+
+	switch cfg.NotReadyProjects {
+	case "":
+		cfg.NotReadyProjects = NotReadyProjectsSkip
+	case NotReadyProjectsSkip, NotReadyProjectsError:
+	default:
+		return nil, errInvalidNotReadyProjects
+	}
+
+	switch cfg.TwoFactorMembers {
+	case "":
+		cfg.TwoFactorMembers = TwoFactorMembersWarn
+	case TwoFactorMembersWarn, TwoFactorMembersSkip, TwoFactorMembersError:
+	default:
+		return nil, errInvalidTwoFactorMembers
+	}
+
+	if cfg.Compliance != nil {
+		if _, err := texttemplate.New("subject").Parse(cfg.Compliance.Email.SubjectTemplate); err != nil {
+			return nil, fmt.Errorf("invalid compliance.email.subject_template: %v", err)
+		}
+		if _, err := template.New("body").Parse(cfg.Compliance.Email.BodyTemplate); err != nil {
+			return nil, fmt.Errorf("invalid compliance.email.body_template: %v", err)
+		}
+		switch cfg.Compliance.Email.SendOnSuccess {
+		case "", SendOnSuccessReport, SendOnSuccessSummary, SendOnSuccessNone:
+		default:
+			return nil, errInvalidSendOnSuccess
+		}
+
+		if err := checkMandatoryWeights(cfg.Compliance); err != nil {
+			return nil, err
+		}
+
+		// Required topics are compared as set, normalize them for the comparison
+		if topics, ok := cfg.Compliance.Mandatory["project_settings"]["topics"]; ok {
+			required, ok := stringList(topics)
+			if !ok {
+				return nil, errInvalidMandatoryTopics
+			}
+			cfg.Compliance.Mandatory["project_settings"]["topics"] = required
+		}
+	}
+
+	if cfg.Metadata != nil {
+		if d := cfg.Metadata.Description; d != nil {
+			if d.Mode != DescriptionModeExact && d.Mode != DescriptionModeNonEmpty {
+				return nil, errInvalidDescriptionMode
+			}
+			if d.Mode == DescriptionModeNonEmpty && d.Value == "" {
+				return nil, errDescriptionValueMustBeSet
+			}
+			if strings.Contains(d.Value, "{{") {
+				tmpl, err := texttemplate.New("description").Option("missingkey=error").Parse(d.Value)
+				if err != nil {
+					return nil, fmt.Errorf("metadata.description.value: invalid template: %v", err)
+				}
+				d.tmpl = tmpl
+			}
+		}
+
+		if cfg.Metadata.Avatar != "" {
+			if _, err := os.Stat(cfg.Metadata.Avatar); err != nil {
+				return nil, fmt.Errorf("invalid metadata.avatar: %v", err)
+			}
+		}
+	}
+
 	if cfg.ProjectSettings != nil {
 		// Contains ProjectsSettings section
+		// Both would rename or move every project to the same name
 		if cfg.ProjectSettings.Name != nil {
 			return nil, errProjectSettingsNameMustBeEmpty
 		}
+		if cfg.ProjectSettings.Path != nil {
+			return nil, errProjectSettingsPathMustBeEmpty
+		}
+
+		if err := checkAccessControlLevels(cfg.ProjectSettings); err != nil {
+			return nil, err
+		}
+
+		// Merge trains run on merged results pipelines, GitLab rejects them otherwise
+		if t := cfg.ProjectSettings.MergeTrainsEnabled; t != nil && *t {
+			if p := cfg.ProjectSettings.MergePipelinesEnabled; p == nil || !*p {
+				return nil, errMergeTrainsRequireMergePipelines
+			}
+		}
+
+		if s := cfg.ProjectSettings.AutoDevopsDeployStrategy; s != nil && !stringslice.Contains(*s, autoDevopsDeployStrategies) {
+			return nil, errInvalidAutoDevopsDeployStrategy
+		}
+
+		if s := cfg.ProjectSettings.BuildGitStrategy; s != nil && !stringslice.Contains(*s, buildGitStrategies) {
+			return nil, errInvalidBuildGitStrategy
+		}
+
+		if err := checkMergeSettings(cfg.ProjectSettings); err != nil {
+			return nil, err
+		}
 	}
 
 	return cfg, nil
 }
+
+// checkProjectAccessToken validates the token config and applies the defaults
+func checkProjectAccessToken(t *ProjectAccessToken) error {
+	if t.Name == "" {
+		return errTokenNameMustBeSet
+	}
+	if len(t.Scopes) == 0 {
+		return errTokenScopesMustBeSet
+	}
+	if err := t.AccessLevel.Validate(); err != nil {
+		return fmt.Errorf("project_access_tokens %s: access_level: %v", t.Name, err)
+	}
+	if t.Sink.Path == "" {
+		return errTokenSinkMustBeSet
+	}
+
+	switch t.Sink.Format {
+	case "":
+		t.Sink.Format = TokenSinkFormatPlain
+	case TokenSinkFormatPlain, TokenSinkFormatEnv:
+	default:
+		return errInvalidTokenSinkFormat
+	}
+
+	if t.ExpiresInDays == 0 {
+		t.ExpiresInDays = DefaultTokenExpiresInDays
+	}
+	if t.RenewBeforeDays == 0 {
+		t.RenewBeforeDays = DefaultTokenRenewBeforeDays
+	}
+
+	return nil
+}
+
+// stringList returns the decoded JSON array as strings, reporting whether all of its elements
+// are strings
+func stringList(v interface{}) ([]string, bool) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	strs := make([]string, 0, len(list))
+	for _, elem := range list {
+		s, ok := elem.(string)
+		if !ok {
+			return nil, false
+		}
+		strs = append(strs, s)
+	}
+
+	return strs, true
+}
+
+// checkMandatoryWeights moves the weights of the mandatory settings given as
+// {"value": ..., "weight": ...} to Weights, leaving their values in Mandatory
+func checkMandatoryWeights(c *ComplianceSettings) error {
+	for subsection, settings := range c.Mandatory {
+		for setting, value := range settings {
+			weighted, ok := value.(map[string]interface{})
+			if !ok || len(weighted) != 2 {
+				continue
+			}
+			v, hasValue := weighted["value"]
+			w, hasWeight := weighted["weight"]
+			if !hasValue || !hasWeight {
+				continue
+			}
+
+			weight, ok := w.(float64)
+			if !ok || weight <= 0 {
+				return fmt.Errorf("compliance.mandatory.%s.%s: %v", subsection, setting, errInvalidMandatoryWeight)
+			}
+			if c.Weights == nil {
+				c.Weights = make(map[string]map[string]float64)
+			}
+			if c.Weights[subsection] == nil {
+				c.Weights[subsection] = make(map[string]float64)
+			}
+			c.Weights[subsection][setting] = weight
+			settings[setting] = v
+		}
+	}
+
+	return nil
+}
+
+// checkCIVariables validates the keys and types of the variables and defaults the type to
+// env_var and the environment scope to *
+func checkCIVariables(variables []CIVariable) error {
+	keys := make(map[string]bool)
+	for i := range variables {
+		v := &variables[i]
+		if v.Key == "" {
+			return errCIVariableKeyMustBeSet
+		}
+		if keys[v.Key] {
+			return fmt.Errorf("duplicate key %s", v.Key)
+		}
+		keys[v.Key] = true
+
+		switch v.VariableType {
+		case "":
+			v.VariableType = CIVariableTypeEnv
+		case CIVariableTypeEnv, CIVariableTypeFile:
+		default:
+			return errInvalidCIVariableType
+		}
+		if v.EnvironmentScope == "" {
+			v.EnvironmentScope = "*"
+		}
+	}
+
+	return nil
+}
+
+// checkStatsD validates the StatsD address and defaults the dialect to plain
+func checkStatsD(s *StatsDSettings) error {
+	if s.Address == "" {
+		return errStatsDAddressMustBeSet
+	}
+	if _, _, err := net.SplitHostPort(s.Address); err != nil {
+		return fmt.Errorf("metrics.statsd: invalid address %q, must be host:port: %v", s.Address, err)
+	}
+
+	switch s.Dialect {
+	case "":
+		s.Dialect = StatsDDialectPlain
+	case StatsDDialectPlain, StatsDDialectDogStatsD:
+	default:
+		return errInvalidStatsDDialect
+	}
+
+	return nil
+}
+
+// checkProtectedBranchPattern validates the access levels of the pattern and compiles it
+func checkProtectedBranchPattern(p *ProtectedBranchPattern) error {
+	if p.Pattern == "" {
+		return errBranchPatternMustBeSet
+	}
+	if err := p.PushAccessLevel.Validate(); err != nil {
+		return fmt.Errorf("protected_branch_patterns %s: push_access_level: %v", p.Pattern, err)
+	}
+	if err := p.MergeAccessLevel.Validate(); err != nil {
+		return fmt.Errorf("protected_branch_patterns %s: merge_access_level: %v", p.Pattern, err)
+	}
+
+	re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+	if err != nil {
+		return fmt.Errorf("protected_branch_patterns %s: invalid pattern: %v", p.Pattern, err)
+	}
+	p.re = re
+
+	return nil
+}
+
+// checkRequiredFile validates the file config and parses its template
+func checkRequiredFile(f *RequiredFile) error {
+	if f.Path == "" {
+		return errRequiredFilePathMustBeSet
+	}
+	if f.Content != "" && f.Template != "" {
+		return fmt.Errorf("required_files %s: only one is allowed: content / template", f.Path)
+	}
+	if f.Template == "" {
+		return nil
+	}
+
+	// nolint: gosec
+	b, err := ioutil.ReadFile(f.Template)
+	if err != nil {
+		return fmt.Errorf("required_files %s: failed to read template: %v", f.Path, err)
+	}
+	f.tmpl, err = texttemplate.New(f.Path).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return fmt.Errorf("required_files %s: invalid template: %v", f.Path, err)
+	}
+
+	return nil
+}
+
+// autoDevopsDeployStrategies lists the values GitLab accepts for auto_devops_deploy_strategy
+var autoDevopsDeployStrategies = []string{"continuous", "manual", "timed_incremental"}
+
+// buildGitStrategies lists the values GitLab accepts for build_git_strategy
+var buildGitStrategies = []string{"fetch", "clone"}
+
+// mergeMethods lists the values GitLab accepts for merge_method
+var mergeMethods = []string{string(gitlab.NoFastForwardMerge), string(gitlab.RebaseMerge), string(gitlab.FastForwardMerge)}
+
+// squashOptions lists the values GitLab accepts for squash_option
+var squashOptions = []string{string(gitlab.SquashOptionNever), string(gitlab.SquashOptionAlways), string(gitlab.SquashOptionDefaultOn), string(gitlab.SquashOptionDefaultOff)}
+
+// checkMergeSettings rejects unknown merge methods and squash options, and combinations of
+// merge settings that have no effect and hint at a misconfiguration
+func checkMergeSettings(settings *gitlab.EditProjectOptions) error {
+	if m := settings.MergeMethod; m != nil && !stringslice.Contains(string(*m), mergeMethods) {
+		return errInvalidMergeMethod
+	}
+	if s := settings.SquashOption; s != nil && !stringslice.Contains(string(*s), squashOptions) {
+		return errInvalidSquashOption
+	}
+
+	// Fast-forward merges don't create merge commits
+	if m := settings.MergeMethod; m != nil && *m == gitlab.FastForwardMerge {
+		if t := settings.MergeCommitTemplate; t != nil && *t != "" {
+			return errMergeCommitTemplateWithFastForward
+		}
+	}
+	if s := settings.SquashOption; s != nil && *s == gitlab.SquashOptionNever {
+		if t := settings.SquashCommitTemplate; t != nil && *t != "" {
+			return errSquashCommitTemplateWithoutSquash
+		}
+	}
+
+	// Skipped pipelines only matter if merging requires a successful pipeline
+	if a := settings.AllowMergeOnSkippedPipeline; a != nil && *a {
+		if p := settings.OnlyAllowMergeIfPipelineSucceeds; p == nil || !*p {
+			return errSkippedPipelineRequiresPipelineSucceeds
+		}
+	}
+
+	return nil
+}
+
+// deprecatedFeatureFlags maps the deprecated boolean project feature settings to the settings
+// replacing them, mostly access levels. Setting both applies the feature twice with possibly
+// conflicting values.
+var deprecatedFeatureFlags = map[string]string{
+	"container_registry_enabled": "container_registry_access_level",
+	"emails_disabled":            "emails_enabled",
+	"issues_enabled":             "issues_access_level",
+	"jobs_enabled":               "builds_access_level",
+	"merge_requests_enabled":     "merge_requests_access_level",
+	"snippets_enabled":           "snippets_access_level",
+	"wiki_enabled":               "wiki_access_level",
+}
+
+// checkAccessControlLevels validates the values of the *_access_level project settings and
+// rejects mixing them with the deprecated boolean settings they replace
+func checkAccessControlLevels(opt *gitlab.EditProjectOptions) error {
+	set := make(map[string]bool)
+
+	v := reflect.ValueOf(opt).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() != reflect.Ptr || field.IsNil() {
+			continue
+		}
+
+		key := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		set[key] = true
+
+		level, ok := field.Interface().(*gitlab.AccessControlValue)
+		if !ok {
+			continue
+		}
+
+		switch *level {
+		case gitlab.DisabledAccessControl, gitlab.PrivateAccessControl, gitlab.EnabledAccessControl:
+		case gitlab.PublicAccessControl:
+			if key != "pages_access_level" {
+				return fmt.Errorf("project_settings.%s: public is only allowed for pages_access_level", key)
+			}
+		default:
+			allowed := "disabled, private, enabled"
+			if key == "pages_access_level" {
+				allowed += ", public"
+			}
+			return fmt.Errorf("project_settings.%s: invalid value %q, must be one of: %s", key, *level, allowed)
+		}
+	}
+
+	for deprecated, replacement := range deprecatedFeatureFlags {
+		if set[deprecated] && set[replacement] {
+			return fmt.Errorf("project_settings: only one is allowed: %s / %s", deprecated, replacement)
+		}
+	}
+
+	return nil
+}
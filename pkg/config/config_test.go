@@ -0,0 +1,939 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// writeConfig writes the given config content to a temporary file and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	return path
+}
+
+func TestAccessLevelValue(t *testing.T) {
+	tests := []struct {
+		level    AccessLevel
+		expected gitlab.AccessLevelValue
+	}{
+		{level: AccessLevelDeveloper, expected: gitlab.DeveloperPermissions},
+		{level: AccessLevelMaintainer, expected: gitlab.MaintainerPermissions},
+		{level: "40", expected: gitlab.MaintainerPermissions},
+		{level: "60", expected: gitlab.AdminPermissions},
+		{level: "0", expected: gitlab.NoPermissions},
+		{level: "noone", expected: gitlab.NoPermissions},
+	}
+
+	for _, tt := range tests {
+		if v := *tt.level.Value(); v != tt.expected {
+			t.Errorf("Expected access level %q to have value %d, got %d", tt.level, tt.expected, v)
+		}
+	}
+}
+
+func TestParseAccessLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "aliases",
+			content: `{"protected_branches": [{"name": "master", "push_access_level": "maintainer", "merge_access_level": "developer"}]}`,
+		},
+		{
+			name:    "numeric",
+			content: `{"protected_branches": [{"name": "master", "push_access_level": "40", "merge_access_level": "30"}]}`,
+		},
+		{
+			name:    "unknown numeric branch level",
+			content: `{"protected_branches": [{"name": "master", "push_access_level": "45", "merge_access_level": "30"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "out of range tag level",
+			content: `{"protected_tags": [{"name": "v*", "create_access_level": "-1"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "branch pattern",
+			content: `{"protected_branch_patterns": [{"pattern": "release/.*", "push_access_level": "noone", "merge_access_level": "maintainer"}]}`,
+		},
+		{
+			name:    "invalid branch pattern",
+			content: `{"protected_branch_patterns": [{"pattern": "release/(", "push_access_level": "noone", "merge_access_level": "maintainer"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "tag allowed to create user",
+			content: `{"protected_tags": [{"name": "v*", "create_access_level": "noone", "allowed_to_create": [{"user_id": 42}]}]}`,
+		},
+		{
+			name:    "tag allowed to create user and group",
+			content: `{"protected_tags": [{"name": "v*", "allowed_to_create": [{"user_id": 42, "group_id": 7}]}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "exact", content: `{"metadata": {"description": {"mode": "exact", "value": "Managed"}}}`},
+		{name: "non_empty", content: `{"metadata": {"description": {"mode": "non_empty", "value": "Describe me"}}}`},
+		{name: "non_empty without value", content: `{"metadata": {"description": {"mode": "non_empty"}}}`, wantErr: true},
+		{name: "unknown mode", content: `{"metadata": {"description": {"mode": "prefix", "value": "x"}}}`, wantErr: true},
+		{name: "missing avatar", content: `{"metadata": {"avatar": "/does/not/exist.png"}}`, wantErr: true},
+		{name: "template", content: `{"metadata": {"description": {"mode": "exact", "value": "Owned by {{.Team}}"}}}`},
+		{name: "invalid template", content: `{"metadata": {"description": {"mode": "exact", "value": "Owned by {{.Team"}}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDescriptionRender(t *testing.T) {
+	cfg, err := Parse(writeConfig(t, `{"metadata": {"description": {"mode": "exact", "value": "Service owned by {{.Team}} — {{.Tier}} ({{.Namespace}}/{{.Path}})"}}}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	d := cfg.Metadata.Description
+
+	project := gitlab.Project{Path: "billing", PathWithNamespace: "example/payments/billing", Topics: []string{"go", "team:payments", "tier: gold"}}
+	description, err := d.Render(project)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := "Service owned by payments — gold (example/payments/billing)"; description != expected {
+		t.Errorf("Expected %q, got %q", expected, description)
+	}
+
+	// A project without the topic can't be described
+	project.Topics = []string{"team:payments"}
+	if _, err := d.Render(project); err == nil {
+		t.Errorf("Expected an error for the missing tier topic, got none")
+	}
+
+	// Plain values are no templates
+	plain := DescriptionSettings{Mode: DescriptionModeExact, Value: "Managed"}
+	if description, err := plain.Render(project); err != nil || description != "Managed" {
+		t.Errorf("Expected the plain value, got %q (%v)", description, err)
+	}
+}
+
+func TestParseFieldPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "managed", content: `{"managed_fields": ["project_settings.wiki_enabled"]}`},
+		{name: "immutable", content: `{"immutable_fields": ["project_settings.visibility"]}`},
+		{name: "both", content: `{"managed_fields": ["project_settings.wiki_enabled"], "immutable_fields": ["project_settings.visibility"]}`, wantErr: true},
+		{name: "unknown section", content: `{"immutable_fields": ["visibility"]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFieldAllowed(t *testing.T) {
+	managed := &Config{ManagedFields: []string{"project_settings.wiki_enabled"}}
+	if !managed.FieldAllowed("project_settings", "wiki_enabled") || managed.FieldAllowed("project_settings", "visibility") {
+		t.Errorf("Expected only managed fields to be allowed")
+	}
+
+	immutable := &Config{ImmutableFields: []string{"project_settings.visibility"}}
+	if !immutable.FieldAllowed("project_settings", "wiki_enabled") || immutable.FieldAllowed("project_settings", "visibility") {
+		t.Errorf("Expected all but immutable fields to be allowed")
+	}
+}
+
+func TestParseProjectAccessTokens(t *testing.T) {
+	cfg, err := Parse(writeConfig(t, `{"project_access_tokens": [{"name": "ci-bot", "scopes": ["api"], "sink": {"path": "tokens.txt"}}]}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	token := cfg.ProjectAccessTokens[0]
+	if token.Sink.Format != TokenSinkFormatPlain || token.ExpiresInDays != DefaultTokenExpiresInDays || token.RenewBeforeDays != DefaultTokenRenewBeforeDays {
+		t.Errorf("Expected defaults to be applied, got %+v", token)
+	}
+
+	if _, err := Parse(writeConfig(t, `{"project_access_tokens": [{"name": "ci-bot", "scopes": ["api"]}]}`)); err != errTokenSinkMustBeSet {
+		t.Errorf("Expected %v, got %v", errTokenSinkMustBeSet, err)
+	}
+}
+
+func TestParseAccessControlLevelError(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{
+			content:  `{"project_settings": {"security_and_compliance_access_level": "internal"}}`,
+			expected: `project_settings.security_and_compliance_access_level: invalid value "internal", must be one of: disabled, private, enabled`,
+		},
+		{
+			content:  `{"project_settings": {"pages_access_level": "internal"}}`,
+			expected: `project_settings.pages_access_level: invalid value "internal", must be one of: disabled, private, enabled, public`,
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(writeConfig(t, tt.content))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("Expected error %q, got %v", tt.expected, err)
+		}
+	}
+}
+
+func TestParseProjectSettingsIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected error
+	}{
+		{name: "name", content: `{"project_settings": {"name": "renamed"}}`, expected: errProjectSettingsNameMustBeEmpty},
+		{name: "empty name", content: `{"project_settings": {"name": ""}}`, expected: errProjectSettingsNameMustBeEmpty},
+		{name: "yaml name", content: "project_settings:\n  name: renamed\n", expected: errProjectSettingsNameMustBeEmpty},
+		{name: "path", content: `{"project_settings": {"path": "renamed"}}`, expected: errProjectSettingsPathMustBeEmpty},
+		{name: "null name", content: `{"project_settings": {"name": null, "wiki_enabled": false}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(writeConfig(t, tt.content)); err != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseAccessControlLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `{"project_settings": {"issues_access_level": "private", "forking_access_level": "disabled"}}`},
+		{name: "public pages", content: `{"project_settings": {"pages_access_level": "public"}}`},
+		{name: "public issues", content: `{"project_settings": {"issues_access_level": "public"}}`, wantErr: true},
+		{name: "unknown value", content: `{"project_settings": {"repository_access_level": "internal"}}`, wantErr: true},
+		{name: "feature access levels", content: `{"project_settings": {"packages_enabled": false, "analytics_access_level": "private", "security_and_compliance_access_level": "private", "releases_access_level": "enabled", "feature_flags_access_level": "disabled"}}`},
+		{name: "unknown feature flags value", content: `{"project_settings": {"feature_flags_access_level": "maintainer"}}`, wantErr: true},
+		{name: "numeric access level", content: `{"project_settings": {"releases_access_level": 20}}`, wantErr: true},
+		{name: "auto devops", content: `{"project_settings": {"auto_devops_enabled": false, "auto_devops_deploy_strategy": "manual"}}`},
+		{name: "unknown deploy strategy", content: `{"project_settings": {"auto_devops_deploy_strategy": "canary"}}`, wantErr: true},
+		{name: "ci settings", content: `{"project_settings": {"build_git_strategy": "clone", "ci_forward_deployment_enabled": true, "ci_separated_caches": false}}`},
+		{name: "unknown git strategy", content: `{"project_settings": {"build_git_strategy": "none"}}`, wantErr: true},
+		{name: "keep latest artifact", content: `{"project_settings": {"keep_latest_artifact": false}}`},
+		{name: "artifacts expiration", content: `{"project_settings": {"default_artifacts_expire_in": "30 days"}}`, wantErr: true},
+		{name: "merge trains", content: `{"project_settings": {"merge_trains_enabled": true, "merge_pipelines_enabled": true}}`},
+		{name: "merged results only", content: `{"project_settings": {"merge_trains_enabled": false, "merge_pipelines_enabled": true}}`},
+		{name: "merge trains without merged results", content: `{"project_settings": {"merge_trains_enabled": true, "merge_pipelines_enabled": false}}`, wantErr: true},
+		{name: "merge trains with unset merged results", content: `{"project_settings": {"merge_trains_enabled": true}}`, wantErr: true},
+		{name: "fast-forward with squash", content: `{"project_settings": {"merge_method": "ff", "squash_option": "default_on", "squash_commit_template": "%{title}"}}`},
+		{name: "unknown merge method", content: `{"project_settings": {"merge_method": "squash"}}`, wantErr: true},
+		{name: "unknown squash option", content: `{"project_settings": {"squash_option": "sometimes"}}`, wantErr: true},
+		{name: "fast-forward with merge commit template", content: `{"project_settings": {"merge_method": "ff", "merge_commit_template": "Merge %{source_branch}"}}`, wantErr: true},
+		{name: "squash template without squash", content: `{"project_settings": {"squash_option": "never", "squash_commit_template": "%{title}"}}`, wantErr: true},
+		{name: "skipped pipelines", content: `{"project_settings": {"allow_merge_on_skipped_pipeline": true, "only_allow_merge_if_pipeline_succeeds": true}}`},
+		{name: "skipped pipelines without pipeline requirement", content: `{"project_settings": {"allow_merge_on_skipped_pipeline": true}}`, wantErr: true},
+		{name: "mixed with deprecated", content: `{"project_settings": {"issues_enabled": true, "issues_access_level": "private"}}`, wantErr: true},
+		{name: "emails and award emojis", content: `{"project_settings": {"emails_enabled": false, "show_default_award_emojis": false}}`},
+		{name: "legacy emails disabled", content: `{"project_settings": {"emails_disabled": true}}`},
+		{name: "emails enabled and disabled", content: `{"project_settings": {"emails_enabled": true, "emails_disabled": false}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseDefaultBranch(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `{"default_branch": {"name": "main", "delete_old_default": true}}`},
+		{name: "same as project settings", content: `{"default_branch": {"name": "main"}, "project_settings": {"default_branch": "main"}}`},
+		{name: "missing name", content: `{"default_branch": {"delete_old_default": true}}`, wantErr: true},
+		{name: "differs from project settings", content: `{"default_branch": {"name": "main"}, "project_settings": {"default_branch": "develop"}}`, wantErr: true},
+		{name: "protection", content: `{"default_branch": {"name": "main", "protection": {"push_access_level": "maintainer", "merge_access_level": "developer"}}}`},
+		{name: "unknown protection level", content: `{"default_branch": {"name": "main", "protection": {"push_access_level": "35"}}}`, wantErr: true},
+		{name: "protection of protected branch", content: `{"default_branch": {"name": "main", "protection": {"push_access_level": "maintainer"}}, "protected_branches": [{"name": "main"}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseServiceDesk(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "enabled", content: `{"service_desk": {"enabled": true, "address_suffix": "support"}}`},
+		{name: "disabled", content: `{"service_desk": {"enabled": false}}`},
+		{name: "same as project settings", content: `{"service_desk": {"enabled": true}, "project_settings": {"service_desk_enabled": true}}`},
+		{name: "suffix when disabled", content: `{"service_desk": {"address_suffix": "support"}}`, wantErr: true},
+		{name: "differs from project settings", content: `{"service_desk": {"enabled": true}, "project_settings": {"service_desk_enabled": false}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseSendOnSuccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "default", content: `{"compliance": {"email": {"from": "enforcer@example.com"}}}`},
+		{name: "summary", content: `{"compliance": {"email": {"send_on_success": "summary"}}}`},
+		{name: "none", content: `{"compliance": {"email": {"send_on_success": "none"}}}`},
+		{name: "unknown", content: `{"compliance": {"email": {"send_on_success": "never"}}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseMandatoryTopics(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+		wantErr  bool
+	}{
+		{name: "topics", content: `{"compliance": {"mandatory": {"project_settings": {"topics": ["go", "python"]}}}}`, expected: []string{"go", "python"}},
+		{name: "empty", content: `{"compliance": {"mandatory": {"project_settings": {"topics": []}}}}`, expected: []string{}},
+		{name: "single topic", content: `{"compliance": {"mandatory": {"project_settings": {"topics": "go"}}}}`, wantErr: true},
+		{name: "no strings", content: `{"compliance": {"mandatory": {"project_settings": {"topics": [1, 2]}}}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if actual := cfg.Compliance.Mandatory["project_settings"]["topics"]; !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected topics %#v, got %#v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseMandatoryWeights(t *testing.T) {
+	cfg, err := Parse(writeConfig(t, `{"compliance": {"mandatory": {"project_settings": {
+		"topics": {"value": ["go"], "weight": 2},
+		"visibility": "private",
+		"container_expiration_policy_attributes": {"enabled": true}
+	}}}}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	mandatory := cfg.Compliance.Mandatory["project_settings"]
+	if !reflect.DeepEqual(mandatory["topics"], []string{"go"}) || mandatory["visibility"] != "private" {
+		t.Errorf("Expected the values to be unwrapped, got %#v", mandatory)
+	}
+	if _, ok := mandatory["container_expiration_policy_attributes"].(map[string]interface{}); !ok {
+		t.Errorf("Expected other objects to be left alone, got %#v", mandatory)
+	}
+	if w := cfg.Compliance.Weight("project_settings", "topics"); w != 2 {
+		t.Errorf("Expected weight 2, got %v", w)
+	}
+	if w := cfg.Compliance.Weight("project_settings", "visibility"); w != 1 {
+		t.Errorf("Expected the default weight 1, got %v", w)
+	}
+
+	for _, weight := range []string{`0`, `-1`, `"high"`} {
+		if _, err := Parse(writeConfig(t, `{"compliance": {"mandatory": {"project_settings": {"visibility": {"value": "private", "weight": `+weight+`}}}}}`)); err == nil {
+			t.Errorf("Expected an error for weight %s, got none", weight)
+		}
+	}
+}
+
+func TestParseTemplatesSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+		wantErr  bool
+	}{
+		{name: "default path", content: `{"templates_source": {"project": "example/templates"}}`, expected: ".gitlab"},
+		{name: "path", content: `{"templates_source": {"project": "example/templates", "path": "/templates/"}}`, expected: "templates"},
+		{name: "missing project", content: `{"templates_source": {"path": "templates"}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if cfg.TemplatesSource.Path != tt.expected {
+				t.Errorf("Expected path %q, got %q", tt.expected, cfg.TemplatesSource.Path)
+			}
+		})
+	}
+}
+
+func TestParseRemoteMirrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "regex", content: `{"remote_mirrors": {"mirror_branch_regex": "^(main|release/.*)$", "overwrite_diverged_branches": true}}`},
+		{name: "protected branches", content: `{"remote_mirrors": {"only_protected_branches": true, "mirror_branch_regex": ""}}`},
+		{name: "invalid regex", content: `{"remote_mirrors": {"mirror_branch_regex": "release/(.*"}}`, wantErr: true},
+		// GitLab uses RE2, which lacks lookarounds
+		{name: "lookahead", content: `{"remote_mirrors": {"mirror_branch_regex": "^(?!wip/).*"}}`, wantErr: true},
+		{name: "both branch filters", content: `{"remote_mirrors": {"only_protected_branches": true, "mirror_branch_regex": "^main$"}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseApprovalRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `{"protected_branches": [{"name": "main", "approval_rule": {"name": "security", "approvals_required": 2, "group_ids": [7]}}]}`},
+		{name: "missing name", content: `{"protected_branches": [{"name": "main", "approval_rule": {"approvals_required": 2}}]}`, wantErr: true},
+		{name: "negative approvals", content: `{"protected_branches": [{"name": "main", "approval_rule": {"name": "security", "approvals_required": -1}}]}`, wantErr: true},
+		{name: "duplicate name", content: `{"protected_branches": [{"name": "main", "approval_rule": {"name": "security"}}, {"name": "stable", "approval_rule": {"name": "security"}}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseUnprotectedExceptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "wildcard", content: `{"protected_branches": [{"name": "*", "push_access_level": "maintainer", "merge_access_level": "maintainer", "unprotected_exceptions": ["feature/*", "sandbox"]}]}`},
+		{name: "named branch", content: `{"protected_branches": [{"name": "main", "push_access_level": "maintainer", "merge_access_level": "maintainer", "unprotected_exceptions": ["feature/*"]}]}`, wantErr: true},
+		{name: "wildcard exception", content: `{"protected_branches": [{"name": "*", "push_access_level": "maintainer", "merge_access_level": "maintainer", "unprotected_exceptions": ["*"]}]}`, wantErr: true},
+		{name: "empty exception", content: `{"protected_branches": [{"name": "*", "push_access_level": "maintainer", "merge_access_level": "maintainer", "unprotected_exceptions": [""]}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProtectedBranchExcepts(t *testing.T) {
+	b := ProtectedBranch{Name: WildcardBranch, UnprotectedExceptions: []string{"feature/*", "sandbox", "v1.*"}}
+
+	for branch, expected := range map[string]bool{
+		"feature/login":   true,
+		"feature/a/b":     true,
+		"sandbox":         true,
+		"sandbox2":        false,
+		"v1.0":            true,
+		"v10":             false,
+		"main":            false,
+		"hotfix/feature/": false,
+	} {
+		if actual := b.Excepts(branch); actual != expected {
+			t.Errorf("Expected %s to be excepted: %v, got %v", branch, expected, actual)
+		}
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		dialect string
+		wantErr bool
+	}{
+		{name: "default dialect", content: `{"metrics": {"statsd": {"address": "localhost:8125", "prefix": "enforcer"}}}`, dialect: StatsDDialectPlain},
+		{name: "dogstatsd", content: `{"metrics": {"statsd": {"address": "statsd.example.com:8125", "dialect": "dogstatsd"}}}`, dialect: StatsDDialectDogStatsD},
+		{name: "no statsd", content: `{"metrics": {}}`},
+		{name: "missing address", content: `{"metrics": {"statsd": {"prefix": "enforcer"}}}`, wantErr: true},
+		{name: "missing port", content: `{"metrics": {"statsd": {"address": "localhost"}}}`, wantErr: true},
+		{name: "unknown dialect", content: `{"metrics": {"statsd": {"address": "localhost:8125", "dialect": "graphite"}}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.dialect != "" && cfg.Metrics.StatsD.Dialect != tt.dialect {
+				t.Errorf("Expected dialect %s, got %s", tt.dialect, cfg.Metrics.StatsD.Dialect)
+			}
+		})
+	}
+}
+
+func TestParseSyncOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+		wantErr  bool
+	}{
+		{name: "default", content: `{}`, expected: ProjectSyncSections},
+		{name: "partial", content: `{"sync_order": ["protected_branches", "default_branch"]}`, expected: []string{
+			"protected_branches", "default_branch", "project_settings", "required_files", "templates_source",
+			"approval_rules", "compliance_framework", "service_desk", "remote_mirrors", "protected_tags",
+			"project_ci_variables", "metadata", "project_access_tokens", "approval_settings",
+		}},
+		{name: "group section", content: `{"sync_order": ["group_settings"]}`, wantErr: true},
+		{name: "unknown", content: `{"sync_order": ["branches"]}`, wantErr: true},
+		{name: "duplicate", content: `{"sync_order": ["project_settings", "project_settings"]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if actual := cfg.ProjectSyncOrder(); !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected sync order %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParsePostRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "command", content: `{"post_run": {"command": ["./reindex.sh", "--all"]}}`},
+		{name: "url", content: `{"post_run": {"url": "https://ci.example.com/hook", "fail_on_error": true}}`},
+		{name: "neither", content: `{"post_run": {"fail_on_error": true}}`, wantErr: true},
+		{name: "both", content: `{"post_run": {"command": ["./reindex.sh"], "url": "https://ci.example.com/hook"}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseNotReadyProjects(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+		wantErr  bool
+	}{
+		{name: "default", content: `{}`, expected: NotReadyProjectsSkip},
+		{name: "error", content: `{"not_ready_projects": "error"}`, expected: NotReadyProjectsError},
+		{name: "invalid", content: `{"not_ready_projects": "ignore"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if cfg.NotReadyProjects != tt.expected {
+				t.Errorf("Expected not_ready_projects %q, got %q", tt.expected, cfg.NotReadyProjects)
+			}
+		})
+	}
+}
+
+func TestParseProjectSettingsPointerBool(t *testing.T) {
+	settings := map[string]func(o *gitlab.EditProjectOptions) *bool{
+		"remove_source_branch_after_merge": func(o *gitlab.EditProjectOptions) *bool { return o.RemoveSourceBranchAfterMerge },
+		"autoclose_referenced_issues":      func(o *gitlab.EditProjectOptions) *bool { return o.AutocloseReferencedIssues },
+	}
+	tests := []struct {
+		name     string
+		value    string
+		expected *bool
+	}{
+		{name: "enabled", value: "true", expected: gitlab.Bool(true)},
+		{name: "disabled", value: "false", expected: gitlab.Bool(false)},
+		{name: "null", value: "null"},
+		{name: "omitted"},
+	}
+
+	for setting, get := range settings {
+		for _, tt := range tests {
+			t.Run(setting+"/"+tt.name, func(t *testing.T) {
+				content := `{"project_settings": {"wiki_enabled": true}}`
+				if tt.value != "" {
+					content = fmt.Sprintf(`{"project_settings": {%q: %s}}`, setting, tt.value)
+				}
+				cfg, err := Parse(writeConfig(t, content))
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				// Only a set value is enforced, false included, while nil keeps the project's value
+				if got := get(cfg.ProjectSettings); !reflect.DeepEqual(got, tt.expected) {
+					t.Errorf("Expected %s %v, got %v", setting, tt.expected, got)
+				}
+			})
+		}
+	}
+}
+
+func TestParseRequiredFiles(t *testing.T) {
+	template := filepath.Join(t.TempDir(), "CODEOWNERS.tmpl")
+	if err := ioutil.WriteFile(template, []byte("* @{{.PathWithNamespace}}\n"), 0600); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "content", content: `{"required_files": [{"path": "CODEOWNERS", "content": "* @admins"}]}`},
+		{name: "template", content: `{"required_files": [{"path": "CODEOWNERS", "template": "` + template + `"}]}`},
+		{name: "missing path", content: `{"required_files": [{"content": "* @admins"}]}`, wantErr: true},
+		{name: "content and template", content: `{"required_files": [{"path": "CODEOWNERS", "content": "x", "template": "` + template + `"}]}`, wantErr: true},
+		{name: "missing template", content: `{"required_files": [{"path": "CODEOWNERS", "template": "/does/not/exist.tmpl"}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProtectedBranchPatternMatch(t *testing.T) {
+	cfg, err := Parse(writeConfig(t, `{"protected_branch_patterns": [{"pattern": "release/.*"}]}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	p := cfg.ProtectedBranchPatterns[0]
+	if !p.Match("release/1.0") || p.Match("hotfix/release/1.0") || p.Match("release") {
+		t.Errorf("Expected the pattern to match whole branch names only")
+	}
+}
+
+func TestEnterpriseSections(t *testing.T) {
+	cfg, err := Parse(writeConfig(t, `{
+		"protected_branches": [
+			{"name": "main", "push_access_level": "maintainer", "merge_access_level": "developer",
+			 "code_owner_approval_required": true, "approval_rule": {"name": "security", "approvals_required": 2}},
+			{"name": "stable", "push_access_level": "maintainer", "merge_access_level": "maintainer"}
+		],
+		"project_settings": {"wiki_enabled": false, "issues_template": "## Steps to reproduce"},
+		"approval_settings": {"reset_approvals_on_push": true},
+		"compliance_framework": "SOX"
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{
+		"approval_settings",
+		"protected_branches[main].approval_rule",
+		"protected_branches[main].code_owner_approval_required",
+		"compliance_framework",
+		"project_settings.issues_template",
+	}
+	if sections := cfg.EnterpriseSections(); !reflect.DeepEqual(sections, expected) {
+		t.Errorf("Expected EE sections %v, got %v", expected, sections)
+	}
+
+	cfg.DropEnterpriseSections()
+	if sections := cfg.EnterpriseSections(); len(sections) != 0 {
+		t.Errorf("Expected no EE sections after dropping them, got %v", sections)
+	}
+	if cfg.ProjectSettings == nil || cfg.ProjectSettings.WikiEnabled == nil || len(cfg.ProtectedBranches) != 2 {
+		t.Errorf("Expected the CE sections to be kept, got %+v", cfg)
+	}
+}
+
+func TestParseGroupCIVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `{"group_ci_variables": {"variables": [{"key": "REGISTRY", "value": "registry.example.com"}], "prune": true}}`},
+		{name: "missing key", content: `{"group_ci_variables": {"variables": [{"value": "x"}]}}`, wantErr: true},
+		{name: "duplicate key", content: `{"group_ci_variables": {"variables": [{"key": "A"}, {"key": "A"}]}}`, wantErr: true},
+		{name: "invalid type", content: `{"group_ci_variables": {"variables": [{"key": "A", "variable_type": "secret"}]}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			v := cfg.GroupCIVariables.Variables[0]
+			if v.VariableType != CIVariableTypeEnv || v.EnvironmentScope != "*" {
+				t.Errorf("Expected the defaults env_var and *, got %s and %s", v.VariableType, v.EnvironmentScope)
+			}
+		})
+	}
+}
+
+func TestParseProjectCIVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `{"project_ci_variables": {"variables": [{"key": "DEPLOY_TOKEN", "value": "secret", "protected": true, "masked": true}]}}`},
+		{name: "missing key", content: `{"project_ci_variables": {"variables": [{"value": "x"}]}}`, wantErr: true},
+		{name: "duplicate key", content: `{"project_ci_variables": {"variables": [{"key": "A"}, {"key": "A"}]}}`, wantErr: true},
+		{name: "invalid type", content: `{"project_ci_variables": {"variables": [{"key": "A", "variable_type": "secret"}]}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			v := cfg.ProjectCIVariables.Variables[0]
+			if v.VariableType != CIVariableTypeEnv || v.EnvironmentScope != "*" {
+				t.Errorf("Expected the defaults env_var and *, got %s and %s", v.VariableType, v.EnvironmentScope)
+			}
+		})
+	}
+}
+
+func TestParseGroupMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "users and groups", content: `{"group_members": {"members": [{"user_id": 1, "access_level": "owner"}, {"group_id": 7, "access_level": "30"}], "prune": true}}`},
+		{name: "neither user nor group", content: `{"group_members": {"members": [{"access_level": "owner"}]}}`, wantErr: true},
+		{name: "user and group", content: `{"group_members": {"members": [{"user_id": 1, "group_id": 7, "access_level": "owner"}]}}`, wantErr: true},
+		{name: "missing access level", content: `{"group_members": {"members": [{"user_id": 1}]}}`, wantErr: true},
+		{name: "no one", content: `{"group_members": {"members": [{"user_id": 1, "access_level": "noone"}]}}`, wantErr: true},
+		{name: "admin", content: `{"group_members": {"members": [{"user_id": 1, "access_level": "60"}]}}`, wantErr: true},
+		{name: "duplicate user", content: `{"group_members": {"members": [{"user_id": 1, "access_level": "owner"}, {"user_id": 1, "access_level": "guest"}]}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "json", content: `  {"group_name": "example", "protected_branches": [{"name": "main", "push_access_level": "maintainer"}]}`},
+		{name: "yaml", content: "group_name: example\nprotected_branches:\n  - name: main\n    push_access_level: maintainer\n"},
+	}
+
+	for _, tt := range tests {
+		cfg, err := ParseReader(strings.NewReader(tt.content), "stdin")
+		if err != nil {
+			t.Fatalf("%s: Expected no error, got %v", tt.name, err)
+		}
+		if cfg.GroupName != "example" || !cfg.IncludeSubgroups || len(cfg.ProtectedBranches) != 1 {
+			t.Errorf("%s: Expected the config to be parsed with defaults, got %+v", tt.name, cfg)
+		}
+		if level := cfg.ProtectedBranches[0].PushAccessLevel.Value(); *level != gitlab.MaintainerPermissions {
+			t.Errorf("%s: Expected maintainer push access, got %d", tt.name, *level)
+		}
+	}
+
+	if _, err := ParseReader(strings.NewReader("- example\n"), "stdin"); err == nil || !strings.Contains(err.Error(), errConfigMustBeObject.Error()) {
+		t.Errorf("Expected %q for a YAML list, got %v", errConfigMustBeObject, err)
+	}
+	if _, err := ParseReader(strings.NewReader(`{"group_name": `), "stdin"); err == nil {
+		t.Errorf("Expected an error for invalid JSON")
+	}
+}
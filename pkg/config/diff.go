@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/r3labs/diff"
+)
+
+// Change is a difference between two configs. The path names the setting with its json keys,
+// e.g. project_settings.wiki_enabled, and list elements with their name, e.g.
+// protected_branches[main].push_access_level.
+type Change struct {
+	Type string
+	Path string
+	From interface{}
+	To   interface{}
+}
+
+// Diff returns the differences between the old and the new config, in the order of the config
+// fields. Protected branches, tags, access tokens and required files are compared by
+// name (or pattern/path), not by their position in the list.
+func Diff(old *Config, new *Config) ([]Change, error) {
+	changelog, err := diff.Diff(old, new)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff configs: %v", err)
+	}
+
+	changes := make([]Change, 0, len(changelog))
+	for _, c := range changelog {
+		changes = append(changes, Change{Type: c.Type, Path: settingPath(c.Path), From: derefValue(c.From), To: derefValue(c.To)})
+	}
+
+	return changes, nil
+}
+
+// derefValue returns the value a pointer points to, e.g. of a setting changed from unset to
+// set, or nil for a nil pointer
+func derefValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr {
+		return v
+	}
+	if rv.IsNil() {
+		return nil
+	}
+
+	return rv.Elem().Interface()
+}
+
+// settingPath converts the path of a change, given as go field names and list identifiers,
+// to the json keys of the config
+func settingPath(path []string) string {
+	var b strings.Builder
+
+	t := reflect.TypeOf(Config{})
+	for _, element := range path {
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if t == nil || t.Kind() != reflect.Struct {
+			// Slice and map elements, or values of unknown type
+			fmt.Fprintf(&b, "[%s]", element)
+			if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Map) {
+				t = t.Elem()
+			} else {
+				t = nil
+			}
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.WriteString(".")
+		}
+		field, ok := structField(t, element)
+		if !ok {
+			b.WriteString(strcase.ToSnake(element))
+			t = nil
+			continue
+		}
+		b.WriteString(jsonName(field))
+		t = field.Type
+	}
+
+	return b.String()
+}
+
+// structField returns the field of the struct type with the go or diff tag name
+func structField(t reflect.Type, name string) (reflect.StructField, bool) {
+	if field, ok := t.FieldByName(name); ok {
+		return field, true
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("diff"), ",")[0] == name {
+			return t.Field(i), true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// jsonName returns the json key of the field
+func jsonName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+
+	return strcase.ToSnake(field.Name)
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old, err := Parse(writeConfig(t, `{
+		"group_name": "example",
+		"protected_branches": [
+			{"name": "main", "push_access_level": "maintainer", "merge_access_level": "developer"},
+			{"name": "stable", "push_access_level": "maintainer", "merge_access_level": "maintainer"}
+		],
+		"project_settings": {"wiki_enabled": true},
+		"compliance": {"mandatory": {"project_settings": {"visibility": "private"}}}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	new, err := Parse(writeConfig(t, `{
+		"group_name": "example",
+		"protected_branches": [
+			{"name": "stable", "push_access_level": "noone", "merge_access_level": "maintainer"},
+			{"name": "main", "push_access_level": "maintainer", "merge_access_level": "developer"}
+		],
+		"project_settings": {"wiki_enabled": false},
+		"compliance": {"mandatory": {"project_settings": {"visibility": "internal"}}}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	changes, err := Diff(old, new)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var actual []string
+	for _, c := range changes {
+		actual = append(actual, fmt.Sprintf("%s %s: %v -> %v", c.Type, c.Path, c.From, c.To))
+	}
+	expected := []string{
+		"update protected_branches[stable].push_access_level: maintainer -> noone",
+		"update project_settings.wiki_enabled: true -> false",
+		"update compliance.mandatory[project_settings][visibility]: private -> internal",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected changes\n%v\ngot\n%v", expected, actual)
+	}
+
+	if changes, _ := Diff(old, old); len(changes) != 0 {
+		t.Errorf("Expected no changes between equal configs, got %+v", changes)
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import "fmt"
+
+// EnterpriseSections returns the configured sections which need GitLab EE (Premium), e.g.
+// approval rules or compliance frameworks. GitLab CE answers them with 404 errors.
+func (c *Config) EnterpriseSections() []string {
+	var sections []string
+
+	if c.ApprovalSettings != nil {
+		sections = append(sections, "approval_settings")
+	}
+	for _, b := range c.ProtectedBranches {
+		if b.ApprovalRule != nil {
+			sections = append(sections, fmt.Sprintf("protected_branches[%s].approval_rule", b.Name))
+		}
+		if b.CodeOwnerApprovalRequired != nil {
+			sections = append(sections, fmt.Sprintf("protected_branches[%s].code_owner_approval_required", b.Name))
+		}
+	}
+	for _, p := range c.ProtectedBranchPatterns {
+		if p.CodeOwnerApprovalRequired != nil {
+			sections = append(sections, fmt.Sprintf("protected_branch_patterns[%s].code_owner_approval_required", p.Pattern))
+		}
+	}
+	if c.ComplianceFramework != "" {
+		sections = append(sections, "compliance_framework")
+	}
+	if c.ProjectSettings != nil && c.ProjectSettings.IssuesTemplate != nil {
+		sections = append(sections, "project_settings.issues_template")
+	}
+	if c.RemoteMirrors != nil && c.RemoteMirrors.MirrorBranchRegex != nil {
+		sections = append(sections, "remote_mirrors.mirror_branch_regex")
+	}
+	if c.GroupSettings != nil && c.GroupSettings.FileTemplateProjectID != nil {
+		sections = append(sections, "group_settings.file_template_project_id")
+	}
+
+	return sections
+}
+
+// DropEnterpriseSections removes the sections listed by EnterpriseSections, so they are
+// skipped on GitLab CE
+func (c *Config) DropEnterpriseSections() {
+	c.enterpriseDropped = true
+	c.ApprovalSettings = nil
+	for i := range c.ProtectedBranches {
+		c.ProtectedBranches[i].ApprovalRule = nil
+		c.ProtectedBranches[i].CodeOwnerApprovalRequired = nil
+	}
+	for i := range c.ProtectedBranchPatterns {
+		c.ProtectedBranchPatterns[i].CodeOwnerApprovalRequired = nil
+	}
+	c.ComplianceFramework = ""
+	if c.ProjectSettings != nil {
+		c.ProjectSettings.IssuesTemplate = nil
+	}
+	if c.RemoteMirrors != nil {
+		c.RemoteMirrors.MirrorBranchRegex = nil
+	}
+	if c.GroupSettings != nil {
+		c.GroupSettings.FileTemplateProjectID = nil
+	}
+}
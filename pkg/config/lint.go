@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LintFinding is a semantic problem of a valid config, e.g. a whitelist entry which can never
+// match a project, with a suggested fix
+type LintFinding struct {
+	Field      string
+	Entry      string
+	Message    string
+	Suggestion string
+}
+
+func (f LintFinding) String() string {
+	s := f.Field
+	if f.Entry != "" {
+		s += fmt.Sprintf(" %q", f.Entry)
+	}
+
+	return fmt.Sprintf("%s: %s (fix: %s)", s, f.Message, f.Suggestion)
+}
+
+// Lint returns the findings of the checks of the project filters which a valid config can
+// still fail: a group_name processing no group, and project_whitelist or project_blacklist
+// entries which can never match the path of a processed project or are listed twice.
+func Lint(cfg *Config) []LintFinding {
+	var findings []LintFinding
+
+	if strings.TrimSpace(cfg.GroupName) == "" {
+		findings = append(findings, LintFinding{
+			Field:      "group_name",
+			Message:    "is empty, so no group's projects are processed",
+			Suggestion: "set group_name to the full path of the group, e.g. example/team",
+		})
+	}
+
+	findings = append(findings, lintProjectFilter(cfg, "project_whitelist", cfg.ProjectWhitelist)...)
+	findings = append(findings, lintProjectFilter(cfg, "project_blacklist", cfg.ProjectBlacklist)...)
+
+	return findings
+}
+
+// lintProjectFilter checks the entries of a project filter, which are compared literally with
+// the paths with namespace of the projects. Entries outside the group can still match the
+// personal projects processed with --include-personal-projects, so they are reported with that
+// hint rather than as dead.
+func lintProjectFilter(cfg *Config, field string, entries []string) []LintFinding {
+	var findings []LintFinding
+	add := func(entry, message, suggestion string) {
+		findings = append(findings, LintFinding{Field: field, Entry: entry, Message: message, Suggestion: suggestion})
+	}
+
+	group := strings.Trim(cfg.GroupName, "/")
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[entry] {
+			add(entry, "is listed more than once", "remove the duplicate entry")
+			continue
+		}
+		seen[entry] = true
+
+		trimmed := strings.TrimSuffix(strings.Trim(strings.TrimSpace(entry), "/"), ".git")
+		switch {
+		case trimmed == "":
+			add(entry, "is empty and never matches a project", "remove the entry")
+			continue
+		case trimmed != entry:
+			add(entry, "never matches a project, paths have no surrounding spaces, slashes or .git suffix", fmt.Sprintf("use %q", trimmed))
+			continue
+		case strings.ContainsAny(entry, "*?["):
+			add(entry, "is compared literally with the project paths, so the pattern never matches", "list the full paths of the projects instead")
+			continue
+		}
+
+		if group == "" {
+			continue
+		}
+		rel := strings.TrimPrefix(entry, group+"/")
+		if rel == entry {
+			suggestion := fmt.Sprintf("use the path with namespace, e.g. %q", group+"/"+entry)
+			if strings.Contains(entry, "/") {
+				suggestion = fmt.Sprintf("use a path below %q, or keep it for a personal project processed with --include-personal-projects", group)
+			}
+			add(entry, fmt.Sprintf("is outside group_name %q and only matches a personal project", group), suggestion)
+			continue
+		}
+		if !cfg.IncludeSubgroups && strings.Contains(rel, "/") {
+			add(entry, "is in a subgroup, whose projects aren't processed without include_subgroups", "set include_subgroups to true or remove the entry")
+		}
+	}
+
+	return findings
+}
+
+// filterOverlap returns the entries listed in both the whitelist and the blacklist
+func filterOverlap(whitelist, blacklist []string) []string {
+	var both []string
+	for _, entry := range whitelist {
+		for _, b := range blacklist {
+			if entry == b {
+				both = append(both, entry)
+				break
+			}
+		}
+	}
+
+	return both
+}
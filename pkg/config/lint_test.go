@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:    "clean",
+			content: `{"group_name": "example", "project_whitelist": ["example/foo", "example/sub/bar"]}`,
+		},
+		{
+			name:     "empty group",
+			content:  `{"project_blacklist": ["example/foo"]}`,
+			expected: []string{"group_name"},
+		},
+		{
+			name:     "whitelist entries never matching",
+			content:  `{"group_name": "example", "project_whitelist": ["example/foo", "example/foo", " example/bar", "example/baz.git", "example/*", "", "foo", "other/foo"]}`,
+			expected: []string{`project_whitelist "example/foo"`, `project_whitelist " example/bar"`, `project_whitelist "example/baz.git"`, `project_whitelist "example/*"`, "project_whitelist", `project_whitelist "foo"`, `project_whitelist "other/foo"`},
+		},
+		{
+			name:     "blacklisted subgroup project without include_subgroups",
+			content:  `{"group_name": "example/", "include_subgroups": false, "project_blacklist": ["example/foo", "example/sub/bar"]}`,
+			expected: []string{`project_blacklist "example/sub/bar"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(writeConfig(t, tt.content))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var actual []string
+			for _, finding := range Lint(cfg) {
+				if finding.Message == "" || finding.Suggestion == "" {
+					t.Errorf("Expected a message and a suggestion, got %+v", finding)
+				}
+				actual = append(actual, strings.SplitN(finding.String(), ":", 2)[0])
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected findings %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLintSuggestion(t *testing.T) {
+	cfg, err := Parse(writeConfig(t, `{"group_name": "example", "project_blacklist": ["foo", "example/bar/"]}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	findings := Lint(cfg)
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %v", findings)
+	}
+	if !strings.Contains(findings[0].Suggestion, `"example/foo"`) {
+		t.Errorf("Expected the path with namespace to be suggested, got %q", findings[0].Suggestion)
+	}
+	if findings[1].Suggestion != `use "example/bar"` {
+		t.Errorf("Expected the trimmed path to be suggested, got %q", findings[1].Suggestion)
+	}
+}
+
+func TestParseFilterOverlap(t *testing.T) {
+	_, err := Parse(writeConfig(t, `{"project_whitelist": ["example/foo", "example/bar"], "project_blacklist": ["example/bar"]}`))
+	if !errors.Is(err, errOnlyOneOfBlacklistAndWhitelistAllowed) || !strings.Contains(err.Error(), "example/bar listed in both") {
+		t.Errorf("Expected the project listed in both to be reported, got %v", err)
+	}
+
+	_, err = Parse(writeConfig(t, `{"project_whitelist": ["example/foo"], "project_blacklist": ["example/bar"]}`))
+	if err != errOnlyOneOfBlacklistAndWhitelistAllowed {
+		t.Errorf("Expected %v, got %v", errOnlyOneOfBlacklistAndWhitelistAllowed, err)
+	}
+}
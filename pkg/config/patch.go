@@ -0,0 +1,505 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in the logged effective config
+const redacted = "[REDACTED]"
+
+// ParsePatched reads the config like Parse and applies the patch file on top of it before
+// the result is validated like any config. The patch is a JSON Patch (RFC 6902) if it is an
+// array of operations, otherwise a JSON Merge Patch (RFC 7386); both may be written in YAML.
+func ParsePatched(configFilePath, patchFilePath string) (*Config, error) {
+	return ParseOverridden(configFilePath, patchFilePath, nil)
+}
+
+// applyPatchFile applies the patch file to the JSON document
+func applyPatchFile(doc []byte, patchFilePath string) ([]byte, error) {
+	// nolint: gosec
+	patch, err := ioutil.ReadFile(patchFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch file %q: %v", patchFilePath, err)
+	}
+
+	if doc, err = ApplyPatch(doc, patch); err != nil {
+		return nil, fmt.Errorf("failed to apply patch file %q: %v", patchFilePath, err)
+	}
+
+	return doc, nil
+}
+
+// ApplyPatch applies the JSON Patch or JSON Merge Patch, JSON or YAML, to the JSON document
+// and returns the patched document
+func ApplyPatch(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := decodeJSON(doc, &target); err != nil {
+		return nil, err
+	}
+
+	p, err := decodePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p := p.(type) {
+	case []interface{}:
+		if target, err = applyJSONPatch(target, p); err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		target = mergePatch(target, p)
+	default:
+		return nil, errPatchMustBeObjectOrArray
+	}
+
+	if _, ok := target.(map[string]interface{}); !ok {
+		return nil, errConfigMustBeObject
+	}
+
+	return json.Marshal(target)
+}
+
+// decodePatch decodes the patch, JSON if it starts like a JSON object or array, otherwise YAML
+func decodePatch(patch []byte) (interface{}, error) {
+	trimmed := bytes.TrimSpace(patch)
+	if !bytes.HasPrefix(trimmed, []byte("{")) && !bytes.HasPrefix(trimmed, []byte("[")) {
+		var v interface{}
+		if err := yaml.Unmarshal(patch, &v); err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		patch = b
+	}
+
+	var p interface{}
+	if err := decodeJSON(patch, &p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// decodeJSON unmarshals b keeping numbers as json.Number, so IDs are not turned into floats
+func decodeJSON(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	return dec.Decode(v)
+}
+
+// applyJSONPatch applies the operations of the JSON Patch in order and returns the patched
+// document. The first failing operation aborts the patch.
+func applyJSONPatch(doc interface{}, operations []interface{}) (interface{}, error) {
+	for i, o := range operations {
+		op, ok := o.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("operation %d: must be an object", i)
+		}
+
+		var err error
+		if doc, err = applyOperation(doc, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%v %v): %v", i, op["op"], op["path"], err)
+		}
+	}
+
+	return doc, nil
+}
+
+// applyOperation applies a single JSON Patch operation to the document
+func applyOperation(doc interface{}, op map[string]interface{}) (interface{}, error) {
+	path, err := operationPointer(op, "path")
+	if err != nil {
+		return nil, err
+	}
+
+	name, _ := op["op"].(string)
+	switch name {
+	case "add", "replace", "test":
+		value, ok := op["value"]
+		if !ok {
+			return nil, fmt.Errorf("value must be set")
+		}
+		switch name {
+		case "add":
+			return addValue(doc, path, value)
+		case "replace":
+			if _, err := getValue(doc, path); err != nil {
+				return nil, err
+			}
+			if len(path) == 0 {
+				return value, nil
+			}
+			if doc, err = removeValue(doc, path); err != nil {
+				return nil, err
+			}
+			return addValue(doc, path, value)
+		default:
+			actual, err := getValue(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(actual, value) {
+				return nil, fmt.Errorf("test failed, value is %s", mustMarshal(actual))
+			}
+			return doc, nil
+		}
+	case "remove":
+		return removeValue(doc, path)
+	case "move", "copy":
+		from, err := operationPointer(op, "from")
+		if err != nil {
+			return nil, err
+		}
+		value, err := getValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if name == "copy" {
+			return addValue(doc, path, deepCopy(value))
+		}
+		if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+			return nil, fmt.Errorf("cannot move a value into itself")
+		}
+		if doc, err = removeValue(doc, from); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+	default:
+		return nil, fmt.Errorf("op must be one of: add, remove, replace, move, copy, test")
+	}
+}
+
+// operationPointer returns the reference tokens of the JSON Pointer (RFC 6901) in the given
+// member of the operation
+func operationPointer(op map[string]interface{}, member string) ([]string, error) {
+	pointer, ok := op[member].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s must be set", member)
+	}
+
+	return parsePointer(pointer)
+}
+
+// parsePointer splits the JSON Pointer into its unescaped reference tokens. The empty pointer
+// references the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid pointer %q, must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// getValue returns the value referenced by the pointer tokens
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for i, token := range path {
+		switch c := doc.(type) {
+		case map[string]interface{}:
+			v, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", formatPointer(path[:i+1]))
+			}
+			doc = v
+		case []interface{}:
+			idx, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, fmt.Errorf("path %s: %v", formatPointer(path[:i+1]), err)
+			}
+			doc = c[idx]
+		default:
+			return nil, fmt.Errorf("path %s does not exist", formatPointer(path[:i+1]))
+		}
+	}
+
+	return doc, nil
+}
+
+// addValue adds the value at the pointer tokens, replacing an existing object member or
+// inserting into an array, where - appends. The parent must exist.
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token, rest := path[0], path[1:]
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			c[token] = value
+			return c, nil
+		}
+		child, ok := c[token]
+		if !ok {
+			return nil, fmt.Errorf("path /%s does not exist", escapeToken(token))
+		}
+		child, err := addValue(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		c[token] = child
+		return c, nil
+	case []interface{}:
+		if len(rest) == 0 {
+			if token == "-" {
+				return append(c, value), nil
+			}
+			idx, err := arrayIndex(token, len(c))
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[idx+1:], c[idx:])
+			c[idx] = value
+			return c, nil
+		}
+		idx, err := arrayIndex(token, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		if c[idx], err = addValue(c[idx], rest, value); err != nil {
+			return nil, err
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("path /%s does not exist", escapeToken(token))
+	}
+}
+
+// removeValue removes the value at the pointer tokens, which must exist
+func removeValue(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	token, rest := path[0], path[1:]
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		child, ok := c[token]
+		if !ok {
+			return nil, fmt.Errorf("path /%s does not exist", escapeToken(token))
+		}
+		if len(rest) == 0 {
+			delete(c, token)
+			return c, nil
+		}
+		child, err := removeValue(child, rest)
+		if err != nil {
+			return nil, err
+		}
+		c[token] = child
+		return c, nil
+	case []interface{}:
+		idx, err := arrayIndex(token, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			return append(c[:idx], c[idx+1:]...), nil
+		}
+		if c[idx], err = removeValue(c[idx], rest); err != nil {
+			return nil, err
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("path /%s does not exist", escapeToken(token))
+	}
+}
+
+// arrayIndex parses the array index token, which must be within 0 and max
+func arrayIndex(token string, max int) (int, error) {
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if idx > max {
+		return 0, fmt.Errorf("array index %d out of bounds", idx)
+	}
+
+	return idx, nil
+}
+
+// formatPointer joins the reference tokens to a JSON Pointer again
+func formatPointer(path []string) string {
+	var b strings.Builder
+	for _, token := range path {
+		b.WriteString("/" + escapeToken(token))
+	}
+
+	return b.String()
+}
+
+// escapeToken escapes ~ and / in the reference token
+func escapeToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// mergePatch applies the JSON Merge Patch to the target: members of patch objects are merged
+// recursively, null removes a member and all other values replace the target.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergePatch(t[key], value)
+	}
+
+	return t
+}
+
+// deepCopy copies the objects and arrays of the decoded JSON value, so a copied value is not
+// changed by later operations on the original
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c[key] = deepCopy(value)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = deepCopy(value)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// mustMarshal formats the decoded JSON value for errors
+func mustMarshal(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(b)
+}
+
+// Redacted returns the config as JSON with secrets replaced, to log the effective config: the
+// values of group and project CI/CD variables, also in the settings of rules, and everything
+// but scheme and host of the post_run URL.
+func Redacted(cfg *Config) ([]byte, error) {
+	c := *cfg
+
+	if cfg.GroupCIVariables != nil {
+		variables := *cfg.GroupCIVariables
+		variables.Variables = redactVariables(cfg.GroupCIVariables.Variables)
+		c.GroupCIVariables = &variables
+	}
+
+	if cfg.ProjectCIVariables != nil {
+		variables := *cfg.ProjectCIVariables
+		variables.Variables = redactVariables(cfg.ProjectCIVariables.Variables)
+		c.ProjectCIVariables = &variables
+	}
+
+	if len(cfg.Rules) > 0 {
+		c.Rules = make([]Rule, len(cfg.Rules))
+		for i, r := range cfg.Rules {
+			if section, ok := r.Settings["project_ci_variables"].(map[string]interface{}); ok {
+				r.Settings = copyMap(r.Settings)
+				r.Settings["project_ci_variables"] = redactVariableSettings(section)
+			}
+			c.Rules[i] = r
+		}
+	}
+
+	if cfg.PostRun != nil && cfg.PostRun.URL != "" {
+		postRun := *cfg.PostRun
+		postRun.URL = redactURL(postRun.URL)
+		c.PostRun = &postRun
+	}
+
+	return json.Marshal(&c)
+}
+
+// redactVariables returns a copy of the variables with their values replaced
+func redactVariables(variables []CIVariable) []CIVariable {
+	redactedVariables := make([]CIVariable, len(variables))
+	for i, v := range variables {
+		v.Value = redacted
+		redactedVariables[i] = v
+	}
+
+	return redactedVariables
+}
+
+// redactVariableSettings returns a copy of the project_ci_variables section of the settings of
+// a rule with the values of its variables replaced
+func redactVariableSettings(section map[string]interface{}) map[string]interface{} {
+	section = copyMap(section)
+	variables, ok := section["variables"].([]interface{})
+	if !ok {
+		return section
+	}
+
+	redactedVariables := make([]interface{}, len(variables))
+	for i, v := range variables {
+		if variable, ok := v.(map[string]interface{}); ok {
+			variable = copyMap(variable)
+			variable["value"] = redacted
+			v = variable
+		}
+		redactedVariables[i] = v
+	}
+	section["variables"] = redactedVariables
+
+	return section
+}
+
+// copyMap returns a shallow copy of the map
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
+
+// redactURL keeps scheme and host of the URL, its credentials, path and query may be secret,
+// e.g. for chat webhooks
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	if u.User == nil && (u.Path == "" || u.Path == "/") && u.RawQuery == "" {
+		return rawURL
+	}
+
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/internal/stringslice"
+)
+
+// ruleSections are the config sections a rule may set, the settings enforced per project.
+// The group settings, the project selection and the options of the run apply to all projects.
+var ruleSections = []string{
+	"approval_settings", "compliance_framework", "create_default_branch", "default_branch",
+	"immutable_fields", "managed_fields", "metadata", "pipeline_succeeds_requires_ci",
+	"project_access_tokens", "project_ci_variables", "project_settings", "protected_branch_patterns",
+	"protected_branches", "protected_tags", "remote_mirrors", "required_files", "service_desk",
+	"templates_source",
+}
+
+// Rule applies its settings to the projects it matches. The settings are a config fragment
+// merged as JSON Merge Patch (RFC 7386) on top of the config, e.g. to require the clone git
+// strategy in all Go projects.
+type Rule struct {
+	Name     string                 `json:"name" diff:"name,identifier"`
+	Match    RuleMatch              `json:"match"`
+	Settings map[string]interface{} `json:"settings"`
+}
+
+// RuleMatch selects the projects of a rule by all of its set predicates: the path with
+// namespace matching the glob path, in which * and ? don't match a / but ** does, having all
+// of the topics, and the language GitLab detected as main language of the repository.
+type RuleMatch struct {
+	Path     string   `json:"path"`
+	Topics   []string `json:"topics"`
+	Language string   `json:"language"`
+
+	re *regexp.Regexp `diff:"-"`
+}
+
+// Matches reports whether the project with the path, topics and main language, empty if
+// unknown, matches all predicates
+func (m RuleMatch) Matches(path string, topics []string, language string) bool {
+	if m.re != nil && !m.re.MatchString(path) {
+		return false
+	}
+	for _, topic := range m.Topics {
+		if !stringslice.Contains(topic, topics) {
+			return false
+		}
+	}
+	if m.Language != "" && !strings.EqualFold(m.Language, language) {
+		return false
+	}
+
+	return true
+}
+
+// ForRules returns the effective config of a project matched by the rules: the settings of
+// the rules are merged on top of the current config in order, so later rules override earlier
+// ones. Lists like protected_branches are replaced as a whole. Sections dropped on GitLab CE
+// stay dropped, even if a rule sets them. Without rules the config itself is returned.
+func (c *Config) ForRules(rules []Rule) (*Config, error) {
+	if len(rules) == 0 {
+		return c, nil
+	}
+
+	current, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %v", err)
+	}
+	var doc interface{}
+	if err := decodeJSON(current, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %v", err)
+	}
+	names := make([]string, 0, len(rules))
+	for _, r := range rules {
+		doc = mergePatch(doc, deepCopy(map[string]interface{}(r.Settings)))
+		names = append(names, r.Name)
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %v", err)
+	}
+	effective, err := parseConfig(b, "config with rules "+strings.Join(names, ", "))
+	if err != nil {
+		return nil, err
+	}
+	// --strict applies to the whole run
+	effective.Strict = c.Strict
+	// The weights of the compliance settings aren't part of the JSON config
+	effective.Compliance = c.Compliance
+	if c.enterpriseDropped {
+		effective.DropEnterpriseSections()
+	}
+
+	return effective, nil
+}
+
+// checkRules validates the rules and compiles their path globs
+func checkRules(rules []Rule) error {
+	names := make(map[string]bool)
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" {
+			return errRuleNameMustBeSet
+		}
+		if names[r.Name] {
+			return fmt.Errorf("rules %s: name must be unique", r.Name)
+		}
+		names[r.Name] = true
+
+		if r.Match.Path == "" && len(r.Match.Topics) == 0 && r.Match.Language == "" {
+			return fmt.Errorf("rules %s: %v", r.Name, errRuleMatchMustBeSet)
+		}
+		if r.Match.Path != "" {
+			re, err := regexp.Compile(globPattern(r.Match.Path))
+			if err != nil {
+				return fmt.Errorf("rules %s: invalid match.path: %v", r.Name, err)
+			}
+			r.Match.re = re
+		}
+
+		for section := range r.Settings {
+			if !stringslice.Contains(section, ruleSections) {
+				return fmt.Errorf("rules %s: settings.%s can't be set per project, only %s", r.Name, section, strings.Join(ruleSections, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// globPattern converts the path glob to an anchored regular expression
+func globPattern(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+
+	return b.String()
+}
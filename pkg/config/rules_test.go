@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "rules", content: `{"rules": [
+			{"name": "go", "match": {"language": "Go"}, "settings": {"project_settings": {"build_git_strategy": "clone"}}},
+			{"name": "services", "match": {"path": "example/services/**", "topics": ["service"]}, "settings": {"protected_tags": [{"name": "v*", "create_access_level": "maintainer"}]}}
+		]}`},
+		{name: "missing name", content: `{"rules": [{"match": {"language": "Go"}}]}`, wantErr: true},
+		{name: "duplicate name", content: `{"rules": [{"name": "go", "match": {"language": "Go"}}, {"name": "go", "match": {"topics": ["go"]}}]}`, wantErr: true},
+		{name: "missing match", content: `{"rules": [{"name": "all", "settings": {"project_settings": {"wiki_enabled": false}}}]}`, wantErr: true},
+		{name: "group section", content: `{"rules": [{"name": "go", "match": {"language": "Go"}, "settings": {"group_name": "other"}}]}`, wantErr: true},
+		{name: "invalid settings", content: `{"rules": [{"name": "go", "match": {"language": "Go"}, "settings": {"project_settings": {"build_git_strategy": "none"}}}]}`, wantErr: true},
+		// The default branch of the rule contradicts the one of the config
+		{name: "invalid merged", content: `{"default_branch": {"name": "main"}, "rules": [{"name": "go", "match": {"language": "Go"}, "settings": {"project_settings": {"default_branch": "master"}}}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(writeConfig(t, tt.content))
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRuleMatchMatches(t *testing.T) {
+	cfg, err := Parse(writeConfig(t, `{"rules": [
+		{"name": "direct", "match": {"path": "example/*"}},
+		{"name": "nested", "match": {"path": "example/**"}},
+		{"name": "go service", "match": {"topics": ["go", "service"], "language": "go"}}
+	]}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	direct, nested, goService := cfg.Rules[0].Match, cfg.Rules[1].Match, cfg.Rules[2].Match
+
+	tests := []struct {
+		match    RuleMatch
+		path     string
+		topics   []string
+		language string
+		expected bool
+	}{
+		{match: direct, path: "example/foo", expected: true},
+		{match: direct, path: "example/sub/bar"},
+		{match: direct, path: "other/foo"},
+		{match: nested, path: "example/sub/bar", expected: true},
+		{match: goService, topics: []string{"service", "go", "api"}, language: "Go", expected: true},
+		{match: goService, topics: []string{"go"}, language: "Go"},
+		{match: goService, topics: []string{"go", "service"}, language: "JavaScript"},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.match.Matches(tt.path, tt.topics, tt.language); actual != tt.expected {
+			t.Errorf("Expected %+v to match %s %v %s: %v, got %v", tt.match, tt.path, tt.topics, tt.language, tt.expected, actual)
+		}
+	}
+}
+
+func TestForRules(t *testing.T) {
+	cfg, err := Parse(writeConfig(t, `{
+		"group_name": "example",
+		"project_settings": {"wiki_enabled": true, "build_git_strategy": "fetch"},
+		"protected_branches": [{"name": "main", "push_access_level": "maintainer", "merge_access_level": "developer"}],
+		"rules": [
+			{"name": "go", "match": {"language": "Go"}, "settings": {"project_settings": {"build_git_strategy": "clone", "ci_separated_caches": true}}},
+			{"name": "strict", "match": {"topics": ["strict"]}, "settings": {"project_settings": {"ci_separated_caches": false, "wiki_enabled": null}}}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cfg.Strict = true
+
+	effective, err := cfg.ForRules(cfg.Rules)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !effective.Strict {
+		t.Errorf("Expected --strict to apply to the effective config")
+	}
+
+	changes, err := Diff(cfg, effective)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	actual := make(map[string]string)
+	for _, c := range changes {
+		actual[c.Path] = fmt.Sprintf("%s %v -> %v", c.Type, c.From, c.To)
+	}
+	// The later rule overrides ci_separated_caches and removes wiki_enabled
+	expected := map[string]string{
+		"project_settings.build_git_strategy":  "update fetch -> clone",
+		"project_settings.ci_separated_caches": "update <nil> -> false",
+		"project_settings.wiki_enabled":        "update true -> <nil>",
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected changes %v, got %v", expected, actual)
+	}
+	for path, change := range expected {
+		if actual[path] != change {
+			t.Errorf("Expected %s: %s, got %q", path, change, actual[path])
+		}
+	}
+
+	if same, _ := cfg.ForRules(nil); same != cfg {
+		t.Errorf("Expected the config itself without rules")
+	}
+}
+
+func TestForRulesAfterDropEnterpriseSections(t *testing.T) {
+	cfg, err := Parse(writeConfig(t, `{
+		"group_name": "example",
+		"approval_settings": {"approvals_before_merge": 2},
+		"protected_branches": [{"name": "main", "push_access_level": "maintainer", "merge_access_level": "developer", "code_owner_approval_required": true}],
+		"rules": [
+			{"name": "go", "match": {"language": "Go"}, "settings": {"project_settings": {"build_git_strategy": "clone"}}},
+			{"name": "reviewed", "match": {"topics": ["reviewed"]}, "settings": {"approval_settings": {"approvals_before_merge": 3}}}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cfg.DropEnterpriseSections()
+
+	for _, rule := range cfg.Rules {
+		effective, err := cfg.ForRules([]Rule{rule})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if sections := effective.EnterpriseSections(); len(sections) > 0 {
+			t.Errorf("Expected the dropped sections to stay dropped with rule %s, got %v", rule.Name, sections)
+		}
+	}
+
+	effective, err := cfg.ForRules(cfg.Rules[:1])
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if effective.ProjectSettings == nil || effective.ProjectSettings.BuildGitStrategy == nil || *effective.ProjectSettings.BuildGitStrategy != "clone" {
+		t.Errorf("Expected the rule to apply, got %+v", effective.ProjectSettings)
+	}
+}
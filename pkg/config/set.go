@@ -0,0 +1,248 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// setToken is a step of the path of a --set override: the key of an object, or the index of
+// an array if isIndex is set
+type setToken struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// ParseOverridden reads the config like Parse, applies the patch file like ParsePatched if
+// patchFilePath is set, and then the --set overrides, before the result is validated like any
+// config.
+func ParseOverridden(configFilePath, patchFilePath string, sets []string) (*Config, error) {
+	b, name, err := readConfigFile(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if patchFilePath != "" {
+		if b, err = applyPatchFile(b, patchFilePath); err != nil {
+			return nil, err
+		}
+		name += " patched with " + patchFilePath
+	}
+
+	if len(sets) > 0 {
+		if b, err = ApplySet(b, sets); err != nil {
+			return nil, err
+		}
+		name += " with --set overrides"
+	}
+
+	return parseJSON(b, name)
+}
+
+// ApplySet applies the overrides, each given as key.path=value like
+// approval_settings.approvals_before_merge=3, to the JSON document in order and returns the
+// changed document. Array elements are addressed by index, e.g. protected_branches[0].name;
+// the index after the last element appends one. The path must exist in the Config, apart from
+// the keys of free-form sections like compliance.mandatory. The value is read as JSON if it
+// is valid JSON, e.g. 3, true, null or ["go"], otherwise as string; null removes the field.
+func ApplySet(doc []byte, sets []string) ([]byte, error) {
+	var target interface{}
+	if err := decodeJSON(doc, &target); err != nil {
+		return nil, err
+	}
+
+	for _, set := range sets {
+		key, raw, ok := strings.Cut(set, "=")
+		if !ok {
+			return nil, fmt.Errorf("--set %s: must be key.path=value", set)
+		}
+
+		path, err := parseSetPath(key)
+		if err != nil {
+			return nil, fmt.Errorf("--set %s: %v", set, err)
+		}
+		if err := checkSetPath(reflect.TypeOf(Config{}), path); err != nil {
+			return nil, fmt.Errorf("--set %s: %v", set, err)
+		}
+
+		if target, err = setValue(target, path, setValueOf(raw)); err != nil {
+			return nil, fmt.Errorf("--set %s: %v", set, err)
+		}
+	}
+
+	if _, ok := target.(map[string]interface{}); !ok {
+		return nil, errConfigMustBeObject
+	}
+
+	return json.Marshal(target)
+}
+
+// parseSetPath splits the key of an override into its object keys and array indices
+func parseSetPath(key string) ([]setToken, error) {
+	var path []setToken
+	for _, segment := range strings.Split(key, ".") {
+		name := segment
+		var indices []string
+		if i := strings.Index(segment, "["); i >= 0 {
+			name = segment[:i]
+			rest := segment[i:]
+			for rest != "" {
+				end := strings.Index(rest, "]")
+				if !strings.HasPrefix(rest, "[") || end < 0 {
+					return nil, fmt.Errorf("invalid index in %q", segment)
+				}
+				indices = append(indices, rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("empty key in %q", key)
+		}
+
+		path = append(path, setToken{key: name})
+		for _, index := range indices {
+			i, err := strconv.Atoi(index)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid index %q in %q", index, segment)
+			}
+			path = append(path, setToken{index: i, isIndex: true})
+		}
+	}
+
+	return path, nil
+}
+
+// checkSetPath reports an error if the path doesn't exist in the type, e.g. due to a typo,
+// which would otherwise be ignored when unmarshaling the config. Paths into maps and free-form
+// values are not checked past their keys.
+func checkSetPath(t reflect.Type, path []setToken) error {
+	for i, token := range path {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			if token.isIndex {
+				return fmt.Errorf("%s is no array", formatSetPath(path[:i]))
+			}
+			field, ok := fieldByJSONName(t, token.key)
+			if !ok {
+				return fmt.Errorf("unknown field %s", formatSetPath(path[:i+1]))
+			}
+			t = field.Type
+		case reflect.Slice, reflect.Array:
+			if !token.isIndex {
+				return fmt.Errorf("%s is an array, address its elements by index", formatSetPath(path[:i]))
+			}
+			t = t.Elem()
+		case reflect.Map:
+			if token.isIndex {
+				return fmt.Errorf("%s is no array", formatSetPath(path[:i]))
+			}
+			t = t.Elem()
+		case reflect.Interface:
+			return nil
+		default:
+			return fmt.Errorf("%s has no fields", formatSetPath(path[:i]))
+		}
+	}
+
+	return nil
+}
+
+// fieldByJSONName returns the field of the struct with the json name
+func fieldByJSONName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		if tag == name || (tag == "" && strings.EqualFold(field.Name, name)) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// setValueOf returns the value of an override, decoded as JSON if possible and as string
+// otherwise
+func setValueOf(raw string) interface{} {
+	var v interface{}
+	if err := decodeJSON([]byte(raw), &v); err != nil {
+		return raw
+	}
+
+	return v
+}
+
+// setValue sets the value at the path of the decoded JSON document, creating missing objects
+// and arrays on the way, and returns the changed document. A nil value removes the field.
+func setValue(doc interface{}, path []setToken, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+
+	if token.isIndex {
+		array, ok := doc.([]interface{})
+		if doc != nil && !ok {
+			return nil, fmt.Errorf("%s is no array", mustMarshal(doc))
+		}
+		if token.index > len(array) {
+			return nil, fmt.Errorf("index %d is out of range of the %d element(s)", token.index, len(array))
+		}
+		if token.index == len(array) {
+			array = append(array, nil)
+		}
+
+		elem, err := setValue(array[token.index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		array[token.index] = elem
+		return array, nil
+	}
+
+	object, ok := doc.(map[string]interface{})
+	if doc != nil && !ok {
+		return nil, fmt.Errorf("%s is no object", mustMarshal(doc))
+	}
+	if object == nil {
+		object = make(map[string]interface{})
+	}
+	if value == nil && len(path) == 1 {
+		delete(object, token.key)
+		return object, nil
+	}
+
+	member, err := setValue(object[token.key], path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	object[token.key] = member
+
+	return object, nil
+}
+
+// formatSetPath joins the tokens to the key of an override again
+func formatSetPath(path []setToken) string {
+	var b strings.Builder
+	for i, token := range path {
+		switch {
+		case token.isIndex:
+			fmt.Fprintf(&b, "[%d]", token.index)
+		case i > 0:
+			b.WriteString("." + token.key)
+		default:
+			b.WriteString(token.key)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplySet(t *testing.T) {
+	base := `{"group_name": "example", "project_blacklist": ["a", "b"], "protected_branches": [{"name": "master", "push_access_level": "noone"}], "post_run": {"url": "https://example.com/hook"}}`
+
+	tests := []struct {
+		name     string
+		sets     []string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "string, number and bool",
+			sets:     []string{"group_name=other", "approval_settings.approvals_before_merge=3", "post_run.fail_on_error=true"},
+			expected: `{"group_name": "other", "project_blacklist": ["a", "b"], "protected_branches": [{"name": "master", "push_access_level": "noone"}], "post_run": {"url": "https://example.com/hook", "fail_on_error": true}, "approval_settings": {"approvals_before_merge": 3}}`,
+		},
+		{
+			name:     "array elements",
+			sets:     []string{"project_blacklist[1]=z", "project_blacklist[2]=c", "protected_branches[0].push_access_level=maintainer"},
+			expected: `{"group_name": "example", "project_blacklist": ["a", "z", "c"], "protected_branches": [{"name": "master", "push_access_level": "maintainer"}], "post_run": {"url": "https://example.com/hook"}}`,
+		},
+		{
+			name:     "json values and removal",
+			sets:     []string{`project_topics=["go", "ci"]`, `group_name="42"`, "post_run=null", "compliance.mandatory.project_settings.visibility=private"},
+			expected: `{"group_name": "42", "project_blacklist": ["a", "b"], "protected_branches": [{"name": "master", "push_access_level": "noone"}], "project_topics": ["go", "ci"], "compliance": {"mandatory": {"project_settings": {"visibility": "private"}}}}`,
+		},
+		{
+			name:     "later overrides win",
+			sets:     []string{"group_name=one", "group_name=two=three"},
+			expected: `{"group_name": "two=three", "project_blacklist": ["a", "b"], "protected_branches": [{"name": "master", "push_access_level": "noone"}], "post_run": {"url": "https://example.com/hook"}}`,
+		},
+		{name: "missing value", sets: []string{"group_name"}, wantErr: true},
+		{name: "unknown field", sets: []string{"group_nam=other"}, wantErr: true},
+		{name: "unknown nested field", sets: []string{"project_settings.visibilty=private"}, wantErr: true},
+		{name: "array without index", sets: []string{"protected_branches.name=main"}, wantErr: true},
+		{name: "index into object", sets: []string{"post_run[0]=x"}, wantErr: true},
+		{name: "path past a value", sets: []string{"group_name.sub=x"}, wantErr: true},
+		{name: "index out of range", sets: []string{"project_blacklist[3]=c"}, wantErr: true},
+		{name: "invalid index", sets: []string{"project_blacklist[-1]=c"}, wantErr: true},
+		{name: "unclosed index", sets: []string{"project_blacklist[0=c"}, wantErr: true},
+		{name: "empty key", sets: []string{"post_run..url=x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ApplySet([]byte(base), tt.sets)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %s", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var actual, expected interface{}
+			if err := json.Unmarshal(b, &actual); err != nil {
+				t.Fatalf("Expected the overridden config to be JSON, got %v", err)
+			}
+			if err := json.Unmarshal([]byte(tt.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("Expected %s, got %s", tt.expected, b)
+			}
+		})
+	}
+}
+
+func TestParseOverridden(t *testing.T) {
+	configPath := writeConfig(t, "group_name: example\nproject_settings:\n  merge_method: merge\n")
+
+	cfg, err := ParseOverridden(configPath, "", []string{"project_settings.merge_method=ff", "approval_settings.approvals_before_merge=2"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.GroupName != "example" || !cfg.IncludeSubgroups || string(*cfg.ProjectSettings.MergeMethod) != "ff" {
+		t.Errorf("Expected the overridden config with defaults, got %+v", cfg)
+	}
+	if cfg.ApprovalSettings == nil || cfg.ApprovalSettings.ApprovalsBeforeMerge == nil || *cfg.ApprovalSettings.ApprovalsBeforeMerge != 2 {
+		t.Errorf("Expected 2 approvals before merge, got %+v", cfg.ApprovalSettings)
+	}
+
+	// The overridden config is validated like any config
+	_, err = ParseOverridden(configPath, "", []string{"project_settings.merge_method=squash"})
+	if err == nil || !strings.Contains(err.Error(), "merge_method") {
+		t.Errorf("Expected the invalid merge method to be rejected, got %v", err)
+	}
+
+	// A value of the wrong type is rejected when the config is parsed
+	if _, err := ParseOverridden(configPath, "", []string{"approval_settings.approvals_before_merge=many"}); err == nil {
+		t.Errorf("Expected an error for a string as number, got none")
+	}
+}
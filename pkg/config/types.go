@@ -2,77 +2,650 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
 
 	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/internal/stringslice"
 )
 
 // GitLab AccessLevel string aliases used in the config
 const (
+	AccessLevelGuest      = "guest"
+	AccessLevelReporter   = "reporter"
 	AccessLevelDeveloper  = "developer"
 	AccessLevelMaintainer = "maintainer"
+	AccessLevelOwner      = "owner"
+)
+
+// Description modes of the metadata config
+const (
+	DescriptionModeExact    = "exact"
+	DescriptionModeNonEmpty = "non_empty"
+)
+
+// Handling of projects which are still being imported or have an empty repository
+const (
+	NotReadyProjectsSkip  = "skip"
+	NotReadyProjectsError = "error"
+)
+
+// Handling of group members without two-factor authentication when group_settings enable
+// require_two_factor_authentication
+const (
+	TwoFactorMembersWarn  = "warn"
+	TwoFactorMembersSkip  = "skip"
+	TwoFactorMembersError = "error"
 )
 
+// Stdin is the config file path which reads the config from stdin
+const Stdin = "-"
+
 var (
-	errFileDoesNotExist                      = errors.New("given config file does not exist")
-	errOnlyOneOfBlacklistAndWhitelistAllowed = errors.New("only one is allowed: project_blacklist / project_whitelist")
-	errProjectSettingsNameMustBeEmpty        = errors.New("project_settings.name must be empty")
+	errFileDoesNotExist                        = errors.New("given config file does not exist")
+	errOnlyOneOfBlacklistAndWhitelistAllowed   = errors.New("only one is allowed: project_blacklist / project_whitelist")
+	errProjectSettingsNameMustBeEmpty          = errors.New("project_settings.name must not be set, it would rename every project")
+	errProjectSettingsPathMustBeEmpty          = errors.New("project_settings.path must not be set, it would move every project")
+	errInvalidDescriptionMode                  = errors.New("metadata.description.mode must be one of: exact, non_empty")
+	errDescriptionValueMustBeSet               = errors.New("metadata.description.value must be set in non_empty mode")
+	errTagPermissionMustBeUnique               = errors.New("exactly one of user_id, group_id and access_level must be set")
+	errOnlyOneOfManagedAndImmutableAllowed     = errors.New("only one is allowed: managed_fields / immutable_fields")
+	errTokenNameMustBeSet                      = errors.New("project_access_tokens: name must be set")
+	errTokenScopesMustBeSet                    = errors.New("project_access_tokens: scopes must be set")
+	errTokenSinkMustBeSet                      = errors.New("project_access_tokens: sink.path must be set")
+	errInvalidTokenSinkFormat                  = errors.New("project_access_tokens: sink.format must be one of: plain, env")
+	errDefaultBranchNameMustBeSet              = errors.New("default_branch.name must be set")
+	errInvalidAutoDevopsDeployStrategy         = errors.New("project_settings.auto_devops_deploy_strategy must be one of: continuous, manual, timed_incremental")
+	errInvalidBuildGitStrategy                 = errors.New("project_settings.build_git_strategy must be one of: fetch, clone")
+	errMergeTrainsRequireMergePipelines        = errors.New("project_settings.merge_trains_enabled requires merge_pipelines_enabled to be true")
+	errInvalidSendOnSuccess                    = errors.New("compliance.email.send_on_success must be one of: report, summary, none")
+	errInvalidMandatoryTopics                  = errors.New("compliance.mandatory.project_settings.topics must be a list of topics")
+	errInvalidMandatoryWeight                  = errors.New("weight must be a positive number")
+	errInvalidMergeMethod                      = errors.New("project_settings.merge_method must be one of: merge, rebase_merge, ff")
+	errInvalidSquashOption                     = errors.New("project_settings.squash_option must be one of: never, always, default_on, default_off")
+	errMergeCommitTemplateWithFastForward      = errors.New("project_settings.merge_commit_template has no effect with merge_method ff")
+	errSquashCommitTemplateWithoutSquash       = errors.New("project_settings.squash_commit_template has no effect with squash_option never")
+	errSkippedPipelineRequiresPipelineSucceeds = errors.New("project_settings.allow_merge_on_skipped_pipeline requires only_allow_merge_if_pipeline_succeeds to be true")
+	errBranchPatternMustBeSet                  = errors.New("protected_branch_patterns: pattern must be set")
+	errApprovalRuleNameMustBeSet               = errors.New("protected_branches: approval_rule.name must be set")
+	errRequiredFilePathMustBeSet               = errors.New("required_files: path must be set")
+	errPostRunTargetMustBeUnique               = errors.New("post_run: exactly one of command and url must be set")
+	errDefaultBranchMismatch                   = errors.New("default_branch.name and project_settings.default_branch must not differ")
+	errDefaultBranchProtectionConflict         = errors.New("default_branch.protection must not be set for a branch configured in protected_branches")
+	errInvalidNotReadyProjects                 = errors.New("not_ready_projects must be one of: skip, error")
+	errInvalidTwoFactorMembers                 = errors.New("two_factor_noncompliant_members must be one of: warn, skip, error")
+	errGroupMemberMustBeUnique                 = errors.New("group_members: exactly one of user_id and group_id must be set")
+	errCIVariableKeyMustBeSet                  = errors.New("key must be set")
+	errServiceDeskSuffixRequiresEnabled        = errors.New("service_desk.address_suffix requires service_desk.enabled to be true")
+	errServiceDeskMismatch                     = errors.New("service_desk.enabled and project_settings.service_desk_enabled must not differ")
+	errRemoteMirrorBranchFilterMustBeUnique    = errors.New("remote_mirrors: only one of only_protected_branches and mirror_branch_regex may be set")
+	errInvalidCIVariableType                   = errors.New("variable_type must be one of: env_var, file")
+	errConfigMustBeObject                      = errors.New("config must be an object")
+	errUnprotectedExceptionsRequireWildcard    = errors.New("protected_branches: unprotected_exceptions may only be set on the wildcard branch *")
+	errStatsDAddressMustBeSet                  = errors.New("metrics.statsd: address must be set")
+	errInvalidStatsDDialect                    = errors.New("metrics.statsd: dialect must be one of: plain, dogstatsd")
+	errPatchMustBeObjectOrArray                = errors.New("patch must be a JSON Merge Patch object or a JSON Patch array")
+	errTemplatesSourceProjectMustBeSet         = errors.New("templates_source: project must be set")
+	errArtifactsExpireInNotPerProject          = errors.New("project_settings: GitLab has no project setting for the artifacts expiration, set artifacts:expire_in in the CI config instead")
+	errRuleNameMustBeSet                       = errors.New("rules: name must be set")
+	errRuleMatchMustBeSet                      = errors.New("match must set at least one of path, topics and language")
 )
 
 // Config stores the root group name and some additional configuration values
 // settings documented at https://godoc.org/github.com/xanzy/go-gitlab#CreateProjectOptions
 type Config struct {
-	GroupName           string `json:"group_name"`
-	IncludeSubgroups    bool   `json:"include_subgroups"`
-	CreateDefaultBranch bool   `json:"create_default_branch"`
-	Error               bool
-	ProjectBlacklist    []string          `json:"project_blacklist"`
-	ProjectWhitelist    []string          `json:"project_whitelist"`
-	ProtectedBranches   []ProtectedBranch `json:"protected_branches"`
-	ProtectedTags       []ProtectedTag    `json:"protected_tags"`
+	GroupName               string `json:"group_name"`
+	IncludeSubgroups        bool   `json:"include_subgroups"`
+	CreateDefaultBranch     bool   `json:"create_default_branch"`
+	PipelineRequiresCI      bool   `json:"pipeline_succeeds_requires_ci"`
+	Strict                  bool   `json:"strict"`
+	Error                   bool
+	ProjectBlacklist        []string                 `json:"project_blacklist"`
+	ProjectWhitelist        []string                 `json:"project_whitelist"`
+	ProjectTopics           []string                 `json:"project_topics"`
+	ProtectedBranches       []ProtectedBranch        `json:"protected_branches"`
+	ProtectedBranchPatterns []ProtectedBranchPattern `json:"protected_branch_patterns"`
+	ProtectedTags           []ProtectedTag           `json:"protected_tags"`
+	ProjectAccessTokens     []ProjectAccessToken     `json:"project_access_tokens"`
+	DefaultBranch           *DefaultBranchSettings   `json:"default_branch"`
+	RequiredFiles           []RequiredFile           `json:"required_files"`
+	TemplatesSource         *TemplatesSource         `json:"templates_source"`
+	ComplianceFramework     string                   `json:"compliance_framework"`
+	ServiceDesk             *ServiceDeskSettings     `json:"service_desk"`
+	RemoteMirrors           *RemoteMirrorSettings    `json:"remote_mirrors"`
+	NotReadyProjects        string                   `json:"not_ready_projects"`
+	TwoFactorMembers        string                   `json:"two_factor_noncompliant_members"`
+	GroupCIVariables        *GroupCIVariables        `json:"group_ci_variables"`
+	ProjectCIVariables      *ProjectCIVariables      `json:"project_ci_variables"`
+	GroupMembers            *GroupMembers            `json:"group_members"`
+	PostRun                 *PostRunSettings         `json:"post_run"`
+	Metrics                 *MetricsSettings         `json:"metrics"`
+	ManagedFields           []string                 `json:"managed_fields"`
+	ImmutableFields         []string                 `json:"immutable_fields"`
 
 	ApprovalSettings *gitlab.ChangeApprovalConfigurationOptions `json:"approval_settings"`
 	ProjectSettings  *gitlab.EditProjectOptions                 `json:"project_settings"`
+	GroupSettings    *gitlab.UpdateGroupOptions                 `json:"group_settings"`
 	Compliance       *ComplianceSettings                        `json:"compliance"`
+	Metadata         *MetadataSettings                          `json:"metadata"`
+	Rules            []Rule                                     `json:"rules"`
+	SyncOrder        []string                                   `json:"sync_order"`
+
+	// enterpriseDropped is set by DropEnterpriseSections, so the sections are dropped from the
+	// effective configs of rules as well
+	enterpriseDropped bool `diff:"-"`
+}
+
+// FieldAllowed reports whether sync may change the given key of the settings section
+// (project_settings or approval_settings). Fields are referenced as <section>.<key>, e.g.
+// project_settings.visibility. With managed_fields only the listed fields may be changed,
+// with immutable_fields all but the listed ones.
+func (c *Config) FieldAllowed(section, key string) bool {
+	field := section + "." + key
+
+	if len(c.ManagedFields) > 0 {
+		return stringslice.Contains(field, c.ManagedFields)
+	}
+
+	return !stringslice.Contains(field, c.ImmutableFields)
+}
+
+// EmailConfigured reports whether compliance.email sets the sender and the SMTP server
+// needed to email reports
+func (c *Config) EmailConfigured() bool {
+	return c.Compliance != nil && c.Compliance.Email.From != "" && c.Compliance.Email.Server != "" && c.Compliance.Email.Port != 0
+}
+
+// DefaultBranchSettings defines the default branch every project is migrated to, e.g. from
+// master to main. With DeleteOldDefault the previous default branch is deleted afterwards.
+// With Protection the default branch is protected with these access levels instead of those
+// of the old default branch, also in projects already using it.
+type DefaultBranchSettings struct {
+	Name             string                   `json:"name"`
+	DeleteOldDefault bool                     `json:"delete_old_default"`
+	Protection       *DefaultBranchProtection `json:"protection"`
+}
+
+// DefaultBranchProtection defines the access levels protecting the default branch
+type DefaultBranchProtection struct {
+	PushAccessLevel  AccessLevel `json:"push_access_level"`
+	MergeAccessLevel AccessLevel `json:"merge_access_level"`
+}
+
+// ServiceDeskSettings defines whether Service Desk is enabled on every project. Enabled
+// projects must have an email address ending in the AddressSuffix, if set.
+type ServiceDeskSettings struct {
+	Enabled       bool   `json:"enabled"`
+	AddressSuffix string `json:"address_suffix"`
+}
+
+// RemoteMirrorSettings defines the options of the existing remote mirrors of every project.
+// Only set options are enforced. Branches are mirrored either if protected or if matching
+// MirrorBranchRegex (RE2 syntax, like GitLab uses).
+type RemoteMirrorSettings struct {
+	OnlyProtectedBranches     *bool   `json:"only_protected_branches"`
+	MirrorBranchRegex         *string `json:"mirror_branch_regex"`
+	OverwriteDivergedBranches *bool   `json:"overwrite_diverged_branches"`
+}
+
+// PostRunSettings defines the command or webhook URL notified once a sync run completed,
+// with the run summary as JSON on stdin or as request body. Failures are only logged, unless
+// fail_on_error is set.
+type PostRunSettings struct {
+	Command     []string `json:"command"`
+	URL         string   `json:"url"`
+	FailOnError bool     `json:"fail_on_error"`
+}
+
+// MetricsSettings defines where the metrics of sync and compliance runs are sent to
+type MetricsSettings struct {
+	StatsD *StatsDSettings `json:"statsd"`
+}
+
+// StatsD dialects
+const (
+	StatsDDialectPlain     = "plain"
+	StatsDDialectDogStatsD = "dogstatsd"
+)
+
+// StatsDSettings defines the StatsD server given as host:port and the prefix of all metric
+// names. Metrics are tagged with the group and command in the dogstatsd dialect only, plain
+// StatsD has no tags.
+type StatsDSettings struct {
+	Address string `json:"address"`
+	Prefix  string `json:"prefix"`
+	Dialect string `json:"dialect"`
+}
+
+// GroupCIVariables defines the CI/CD variables of the group given by group_name, which all
+// its projects inherit. Variables are matched by key; with prune, variables of the group which
+// are not configured are removed.
+type GroupCIVariables struct {
+	Variables []CIVariable `json:"variables"`
+	Prune     bool         `json:"prune"`
+}
+
+// ProjectCIVariables defines the CI/CD variables every project must have, matched by key.
+// Variables an ancestor group of the project already provides identically are inherited and
+// not created in the project.
+type ProjectCIVariables struct {
+	Variables []CIVariable `json:"variables"`
+}
+
+// GroupMembers defines the direct members of the group given by group_name: users by user_id,
+// and groups the group is shared with by group_id. With prune, other direct members and
+// shares are removed, but never the last owner of the group.
+type GroupMembers struct {
+	Members []GroupMember `json:"members"`
+	Prune   bool          `json:"prune"`
+}
+
+// GroupMember defines the access level of a user or a group in the group
+type GroupMember struct {
+	UserID      int         `json:"user_id"`
+	GroupID     int         `json:"group_id"`
+	AccessLevel AccessLevel `json:"access_level"`
+}
+
+// Key identifies the member, e.g. user:42 or group:7
+func (m GroupMember) Key() string {
+	if m.GroupID != 0 {
+		return fmt.Sprintf("group:%d", m.GroupID)
+	}
+
+	return fmt.Sprintf("user:%d", m.UserID)
+}
+
+// memberAccessLevels lists the access levels a member of a group can have
+var memberAccessLevels = []gitlab.AccessLevelValue{
+	gitlab.MinimalAccessPermissions,
+	gitlab.GuestPermissions,
+	gitlab.ReporterPermissions,
+	gitlab.DeveloperPermissions,
+	gitlab.MaintainerPermissions,
+	gitlab.OwnerPermissions,
+}
+
+// Validate checks that the member references exactly one of a user or a group, with an access
+// level members can have
+func (m GroupMember) Validate() error {
+	if (m.UserID != 0) == (m.GroupID != 0) {
+		return errGroupMemberMustBeUnique
+	}
+
+	level := *m.AccessLevel.Value()
+	for _, known := range memberAccessLevels {
+		if level == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("group_members: invalid access_level %q, must be one of: guest, reporter, developer, maintainer, owner or a numeric GitLab access level like \"50\"", m.AccessLevel)
+}
+
+// CIVariable defines a CI/CD variable. Values of masked variables are never logged.
+type CIVariable struct {
+	Key              string `json:"key" diff:"key,identifier"`
+	Value            string `json:"value"`
+	VariableType     string `json:"variable_type"`
+	Protected        bool   `json:"protected"`
+	Masked           bool   `json:"masked"`
+	Raw              bool   `json:"raw"`
+	EnvironmentScope string `json:"environment_scope"`
+}
+
+// CI/CD variable types
+const (
+	CIVariableTypeEnv  = "env_var"
+	CIVariableTypeFile = "file"
+)
+
+// RequiredFile defines a file which must exist in the repository of every project, e.g. a
+// CODEOWNERS file. Its content is either given as content, or rendered from the Go
+// text/template file at template with the gitlab.Project as context. The file is committed to
+// branch (default: the default branch of the project); existing files are only replaced with
+// overwrite set.
+type RequiredFile struct {
+	Path          string `json:"path" diff:"path,identifier"`
+	Content       string `json:"content"`
+	Template      string `json:"template"`
+	Overwrite     bool   `json:"overwrite"`
+	Branch        string `json:"branch"`
+	CommitMessage string `json:"commit_message"`
+
+	tmpl *texttemplate.Template `diff:"-"`
+}
+
+// TemplatesSource defines the central repository holding the description templates of issues
+// and merge requests. The markdown files in the issue_templates and merge_request_templates
+// directories below path are committed to the same directories below .gitlab in the default
+// branch of every project, replacing changed ones.
+type TemplatesSource struct {
+	Project       string `json:"project"`
+	Ref           string `json:"ref"`
+	Path          string `json:"path"`
+	CommitMessage string `json:"commit_message"`
+}
+
+// Render returns the content of the file for the project
+func (f RequiredFile) Render(project interface{}) (string, error) {
+	if f.tmpl == nil {
+		return f.Content, nil
+	}
+
+	var content strings.Builder
+	if err := f.tmpl.Execute(&content, project); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %v", f.Template, err)
+	}
+
+	return content.String(), nil
+}
+
+// MetadataSettings defines the required descriptive metadata of each project
+type MetadataSettings struct {
+	Description *DescriptionSettings `json:"description"`
+	Avatar      string               `json:"avatar"`
 }
 
-// ComplianceSettings defines what is displayed and mandatory settings.
+// DescriptionSettings defines the required project description. In exact mode the
+// description must equal the value, in non_empty mode the value is only set on projects
+// without a description. The value is a Go template rendered per project, see Render.
+type DescriptionSettings struct {
+	Mode  string `json:"mode"`
+	Value string `json:"value"`
+
+	tmpl *texttemplate.Template `diff:"-"`
+}
+
+// Render returns the description of the project. The template gets the project as .Project,
+// its .Name, .Path, .PathWithNamespace, .Namespace (the full path of its group) and .Topics,
+// and the value of each key:value topic under the title-cased key, e.g. team:payments as
+// .Team. Referencing a key no topic of the project sets fails.
+func (d DescriptionSettings) Render(project gitlab.Project) (string, error) {
+	if d.tmpl == nil {
+		return d.Value, nil
+	}
+
+	context := map[string]interface{}{}
+	for _, topic := range project.Topics {
+		key, value, ok := strings.Cut(topic, ":")
+		if ok && key != "" {
+			context[strings.ToUpper(key[:1])+key[1:]] = strings.TrimSpace(value)
+		}
+	}
+	context["Project"] = project
+	context["Name"] = project.Name
+	context["Path"] = project.Path
+	context["PathWithNamespace"] = project.PathWithNamespace
+	context["Namespace"] = path.Dir(project.PathWithNamespace)
+	context["Topics"] = project.Topics
+
+	var description strings.Builder
+	if err := d.tmpl.Execute(&description, context); err != nil {
+		return "", fmt.Errorf("failed to render metadata.description.value: %v", err)
+	}
+
+	return description.String(), nil
+}
+
+// ComplianceSettings defines what is displayed and mandatory settings. A mandatory setting
+// given as {"value": ..., "weight": 3} counts with that weight in the compliance score, the
+// config validation moves its value to Mandatory and its weight to Weights.
 type ComplianceSettings struct {
 	Email     EmailConfig                       `json:"email"`
 	Mandatory map[string]map[string]interface{} `json:"mandatory"`
+	Weights   map[string]map[string]float64     `json:"-"`
 }
 
-// EmailConfig
+// Weight returns the weight of the mandatory setting in the compliance score, 1 by default
+func (c ComplianceSettings) Weight(subsection string, setting string) float64 {
+	if weight, ok := c.Weights[subsection][setting]; ok {
+		return weight
+	}
+
+	return 1
+}
+
+// EmailConfig defines how the compliance report is emailed. The optional templates are Go
+// templates (text/template for the subject, html/template for the body) which get the
+// report data passed as context.
 type EmailConfig struct {
-	From   string
-	Port   int
-	Server string
-	To     []string
+	From            string
+	Port            int
+	Server          string
+	To              []string
+	SubjectTemplate string `json:"subject_template"`
+	BodyTemplate    string `json:"body_template"`
+	HeloHostname    string `json:"helo_hostname"`
+	SendOnSuccess   string `json:"send_on_success"`
 }
 
-// ProtectedBranch defines who can act on a protected branch
+// send_on_success values, deciding what is emailed when all projects are compliant
+const (
+	SendOnSuccessReport  = "report"
+	SendOnSuccessSummary = "summary"
+	SendOnSuccessNone    = "none"
+)
+
+// WildcardBranch is the protected branch name matching every branch
+const WildcardBranch = "*"
+
+// ProtectedBranch defines who can act on a protected branch and, if set, whether code owner
+// approval is required for the branch. The name may be a GitLab wildcard like release/*. Only
+// the wildcard * may list unprotected_exceptions, patterns like feature/* of branches which
+// are exempt from its protection.
 type ProtectedBranch struct {
-	Name             string      `json:"name"`
-	PushAccessLevel  AccessLevel `json:"push_access_level"`
-	MergeAccessLevel AccessLevel `json:"merge_access_level"`
+	Name                      string        `json:"name" diff:"name,identifier"`
+	PushAccessLevel           AccessLevel   `json:"push_access_level"`
+	MergeAccessLevel          AccessLevel   `json:"merge_access_level"`
+	CodeOwnerApprovalRequired *bool         `json:"code_owner_approval_required"`
+	ApprovalRule              *ApprovalRule `json:"approval_rule"`
+	UnprotectedExceptions     []string      `json:"unprotected_exceptions"`
+}
+
+// Excepts reports whether the branch matches one of the unprotected exceptions, where * in an
+// exception matches any characters like in GitLab's wildcard protections
+func (b ProtectedBranch) Excepts(branch string) bool {
+	for _, exception := range b.UnprotectedExceptions {
+		pattern := strings.ReplaceAll(regexp.QuoteMeta(exception), `\*`, ".*")
+		if regexp.MustCompile("^" + pattern + "$").MatchString(branch) {
+			return true
+		}
+	}
+
+	return false
 }
 
-// ProtectedTag defines who can create a protected tag
+// ApprovalRule defines a project approval rule which only applies to merge requests into
+// its protected branch, e.g. two approvals from the security group for main. Rules are
+// identified by name, which must be unique across all protected branches.
+type ApprovalRule struct {
+	Name              string `json:"name"`
+	ApprovalsRequired int    `json:"approvals_required"`
+	UserIDs           []int  `json:"user_ids"`
+	GroupIDs          []int  `json:"group_ids"`
+}
+
+// ProtectedBranchPattern protects all existing branches whose name matches the regular
+// expression pattern as a whole, e.g. release/.* for all release branches. Unlike GitLab's
+// wildcard protection, branches created later are not protected.
+type ProtectedBranchPattern struct {
+	Pattern                   string      `json:"pattern" diff:"pattern,identifier"`
+	PushAccessLevel           AccessLevel `json:"push_access_level"`
+	MergeAccessLevel          AccessLevel `json:"merge_access_level"`
+	CodeOwnerApprovalRequired *bool       `json:"code_owner_approval_required"`
+
+	re *regexp.Regexp `diff:"-"`
+}
+
+// Match reports whether the branch name matches the pattern as a whole
+func (p ProtectedBranchPattern) Match(branch string) bool {
+	return p.re != nil && p.re.MatchString(branch)
+}
+
+// Protection returns the protection of the pattern for the branch
+func (p ProtectedBranchPattern) Protection(branch string) ProtectedBranch {
+	return ProtectedBranch{
+		Name:                      branch,
+		PushAccessLevel:           p.PushAccessLevel,
+		MergeAccessLevel:          p.MergeAccessLevel,
+		CodeOwnerApprovalRequired: p.CodeOwnerApprovalRequired,
+	}
+}
+
+// ProtectedTag defines who can create a protected tag. Besides the create access level,
+// creation can be granted to single users or groups with allowed_to_create.
 type ProtectedTag struct {
-	Name              string      `json:"name"`
-	CreateAccessLevel AccessLevel `json:"create_access_level"`
+	Name              string          `json:"name" diff:"name,identifier"`
+	CreateAccessLevel AccessLevel     `json:"create_access_level"`
+	AllowedToCreate   []TagPermission `json:"allowed_to_create"`
+}
+
+// TagPermission grants the creation of a protected tag to exactly one of a user, a group
+// or an access level
+type TagPermission struct {
+	UserID      int         `json:"user_id"`
+	GroupID     int         `json:"group_id"`
+	AccessLevel AccessLevel `json:"access_level"`
 }
 
-// AccessLevel wraps the numeric gitlab access level into a readable string
+// Options returns the gitlab permission option of the grant
+func (p TagPermission) Options() *gitlab.TagsPermissionOptions {
+	switch {
+	case p.UserID != 0:
+		return &gitlab.TagsPermissionOptions{UserID: gitlab.Int(p.UserID)}
+	case p.GroupID != 0:
+		return &gitlab.TagsPermissionOptions{GroupID: gitlab.Int(p.GroupID)}
+	default:
+		return &gitlab.TagsPermissionOptions{AccessLevel: p.AccessLevel.Value()}
+	}
+}
+
+// Validate checks that the grant references exactly one of a user, a group or an access level
+func (p TagPermission) Validate() error {
+	set := 0
+	for _, ok := range []bool{p.UserID != 0, p.GroupID != 0, p.AccessLevel != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return errTagPermissionMustBeUnique
+	}
+
+	return p.AccessLevel.Validate()
+}
+
+// Token sink formats
+const (
+	TokenSinkFormatPlain = "plain"
+	TokenSinkFormatEnv   = "env"
+)
+
+// ProjectSyncSections are the config sections sync enforces per project, in the default order
+// of the sync steps. project_settings comes before the files and the branch protection, so
+// both target the final default branch.
+var ProjectSyncSections = []string{
+	"default_branch", "project_settings", "required_files", "templates_source", "protected_branches",
+	"approval_rules", "compliance_framework", "service_desk", "remote_mirrors", "protected_tags",
+	"project_ci_variables", "metadata", "project_access_tokens", "approval_settings",
+}
+
+// ProjectSyncOrder returns the order of the per project sync steps: the sections listed in
+// sync_order first, followed by the others in their default order
+func (c *Config) ProjectSyncOrder() []string {
+	order := append([]string{}, c.SyncOrder...)
+	for _, section := range ProjectSyncSections {
+		if !stringslice.Contains(section, c.SyncOrder) {
+			order = append(order, section)
+		}
+	}
+
+	return order
+}
+
+// Defaults of the project access token lifetimes
+const (
+	DefaultTokenExpiresInDays   = 365
+	DefaultTokenRenewBeforeDays = 30
+)
+
+// ProjectAccessToken defines an access token which must exist in every project. A new token
+// is created if none with the name, scopes and access level exists or the existing one
+// expires within renew_before_days. Existing tokens are never revoked.
+type ProjectAccessToken struct {
+	Name            string      `json:"name" diff:"name,identifier"`
+	Scopes          []string    `json:"scopes"`
+	AccessLevel     AccessLevel `json:"access_level"`
+	ExpiresInDays   int         `json:"expires_in_days"`
+	RenewBeforeDays int         `json:"renew_before_days"`
+	Sink            TokenSink   `json:"sink"`
+}
+
+// TokenSink defines the file new token values are appended to, as GitLab only returns them
+// once. In plain format each line is "<project path> <token>", in env format an export of
+// a variable named after the token and project, e.g. CI_BOT_EXAMPLE_FOO.
+type TokenSink struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+}
+
+// knownAccessLevels lists the numeric access levels accepted in the config
+var knownAccessLevels = []gitlab.AccessLevelValue{
+	gitlab.NoPermissions,
+	gitlab.MinimalAccessPermissions,
+	gitlab.GuestPermissions,
+	gitlab.ReporterPermissions,
+	gitlab.DeveloperPermissions,
+	gitlab.MaintainerPermissions,
+	gitlab.OwnerPermissions,
+	gitlab.AdminPermissions,
+}
+
+// AccessLevel wraps the numeric gitlab access level into a readable string. Besides the
+// aliases, the numeric value can be given as a string (e.g. "40" for maintainer).
 type AccessLevel string
 
 // Value returns the gitlab numeric value of the access level
 func (a AccessLevel) Value() *gitlab.AccessLevelValue {
 	switch a {
+	case AccessLevelGuest:
+		return gitlab.AccessLevel(gitlab.GuestPermissions)
+	case AccessLevelReporter:
+		return gitlab.AccessLevel(gitlab.ReporterPermissions)
 	case AccessLevelDeveloper:
 		return gitlab.AccessLevel(gitlab.DeveloperPermissions)
 	case AccessLevelMaintainer:
 		return gitlab.AccessLevel(gitlab.MaintainerPermissions)
-	default:
-		return gitlab.AccessLevel(gitlab.NoPermissions)
+	case AccessLevelOwner:
+		return gitlab.AccessLevel(gitlab.OwnerPermissions)
 	}
+
+	if level, err := strconv.Atoi(string(a)); err == nil {
+		return gitlab.AccessLevel(gitlab.AccessLevelValue(level))
+	}
+
+	return gitlab.AccessLevel(gitlab.NoPermissions)
+}
+
+// Validate checks that a numeric access level is one known to gitlab
+func (a AccessLevel) Validate() error {
+	level, err := strconv.Atoi(string(a))
+	if err != nil {
+		// Aliases and unknown strings fall back to no permissions
+		return nil
+	}
+
+	for _, known := range knownAccessLevels {
+		if gitlab.AccessLevelValue(level) == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown access level %d", level)
 }
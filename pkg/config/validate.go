@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// relatedSections lists the sections validated against each other, so a change of either
+// validates both
+var relatedSections = map[string][]string{
+	"project_blacklist": {"project_whitelist"},
+	"project_whitelist": {"project_blacklist"},
+	"managed_fields":    {"immutable_fields"},
+	"immutable_fields":  {"managed_fields"},
+	"default_branch":    {"project_settings"},
+	"service_desk":      {"project_settings"},
+	"project_settings":  {"default_branch", "service_desk"},
+}
+
+// ValidateChanged validates only the top level sections of the config file which differ from
+// the previous config, JSON or YAML, e.g. the version of the file at git HEAD. The previous
+// config isn't validated, so an invalid one can be fixed. Sections validated against each
+// other, like default_branch and project_settings, are validated together if either changed.
+// It returns the validated sections, sorted.
+func ValidateChanged(configFilePath string, previous []byte) ([]string, error) {
+	b, name, err := readConfigFile(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+	current, err := decodeSections(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = readConfig(bytes.NewReader(previous), "previous config")
+	if err != nil {
+		return nil, err
+	}
+	old, err := decodeSections(b, "previous config")
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]interface{})
+	for key, value := range current {
+		if reflect.DeepEqual(value, old[key]) {
+			continue
+		}
+		changed[key] = value
+		for _, related := range relatedSections[key] {
+			if v, ok := current[related]; ok {
+				changed[related] = v
+			}
+		}
+	}
+
+	sections := make([]string, 0, len(changed))
+	for key := range changed {
+		sections = append(sections, key)
+	}
+	sort.Strings(sections)
+	if len(sections) == 0 {
+		return sections, nil
+	}
+
+	b, err = json.Marshal(changed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the changed sections of %q: %v", name, err)
+	}
+	if _, err := parseJSON(b, name); err != nil {
+		return nil, err
+	}
+
+	return sections, nil
+}
+
+// decodeSections decodes the top level sections of the JSON config
+func decodeSections(b []byte, name string) (map[string]interface{}, error) {
+	var sections map[string]interface{}
+	if err := decodeJSON(b, &sections); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config file %q: %v", name, err)
+	}
+	if sections == nil {
+		return nil, errConfigMustBeObject
+	}
+
+	return sections, nil
+}
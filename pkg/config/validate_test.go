@@ -0,0 +1,80 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateChanged(t *testing.T) {
+	// The invalid not_ready_projects is only reported once changed
+	previous := `{"group_name": "example", "not_ready_projects": "ignore", "project_settings": {"default_branch": "main"}, "default_branch": {"name": "main"}}`
+
+	tests := []struct {
+		name     string
+		previous string
+		content  string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "unchanged",
+			previous: previous,
+			content:  previous,
+			expected: []string{},
+		},
+		{
+			name:     "changed section",
+			previous: previous,
+			content:  `{"group_name": "other", "not_ready_projects": "ignore", "project_settings": {"default_branch": "main"}, "default_branch": {"name": "main"}}`,
+			expected: []string{"group_name"},
+		},
+		{
+			name:     "related sections",
+			previous: previous,
+			content:  `{"group_name": "example", "not_ready_projects": "ignore", "project_settings": {"default_branch": "main", "wiki_enabled": true}, "default_branch": {"name": "main"}}`,
+			expected: []string{"default_branch", "project_settings"},
+		},
+		{
+			name:     "related sections mismatch",
+			previous: previous,
+			content:  `{"group_name": "example", "not_ready_projects": "ignore", "project_settings": {"default_branch": "master"}, "default_branch": {"name": "main"}}`,
+			wantErr:  true,
+		},
+		{
+			name:     "invalid change",
+			previous: previous,
+			content:  `{"group_name": "example", "not_ready_projects": "fail", "project_settings": {"default_branch": "main"}, "default_branch": {"name": "main"}}`,
+			wantErr:  true,
+		},
+		{
+			name:     "yaml previous config",
+			previous: "group_name: example\nprotected_tags:\n  - name: v*\n    create_access_level: maintainer\n",
+			content:  `{"group_name": "example", "protected_tags": [{"name": "v*", "create_access_level": "developer"}]}`,
+			expected: []string{"protected_tags"},
+		},
+		{
+			name:     "new config",
+			previous: `{}`,
+			content:  `{"group_name": "example", "strict": true}`,
+			expected: []string{"group_name", "strict"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections, err := ValidateChanged(writeConfig(t, tt.content), []byte(tt.previous))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got sections %v", sections)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(sections, tt.expected) {
+				t.Errorf("Expected sections %v, got %v", tt.expected, sections)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package gitlab
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/internal/stringslice"
+)
+
+// nonAlphanumeric matches the characters replaced in env variable names
+var nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// EnsureProjectAccessTokens ensures that each configured project access token exists and
+// doesn't expire soon, creating a new one otherwise. New token values are written to the
+// sink of the token and never logged. GitLab returns a token value only once, so the sink is
+// opened before the token is created, and the token is revoked if writing it fails.
+func (m *ProjectManager) EnsureProjectAccessTokens(project gitlab.Project, dryrun bool) error {
+	if len(m.config.ProjectAccessTokens) == 0 {
+		return nil
+	}
+
+	tokens, resp, err := m.listProjectAccessTokens(project)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+			// Not available in older CE releases and for free projects on gitlab.com
+			m.warnf("project access tokens are not available for project %s: %v", project.PathWithNamespace, err)
+			return nil
+		}
+		return fmt.Errorf("failed to list project access tokens of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	now := m.now()
+	for _, t := range m.config.ProjectAccessTokens {
+		if existing := findProjectAccessToken(tokens, t, now); existing != nil {
+			m.logger.Debugf("Project access token %s [%d] of project %s is valid.", t.Name, existing.ID, project.PathWithNamespace)
+			continue
+		}
+
+		if dryrun {
+			m.skipAPICall("CreateProjectAccessToken", "for token %s.", t.Name)
+			continue
+		}
+
+		expiresAt := gitlab.ISOTime(now.AddDate(0, 0, t.ExpiresInDays))
+		opt := &gitlab.CreateProjectAccessTokenOptions{
+			Name:      gitlab.String(t.Name),
+			Scopes:    &t.Scopes,
+			ExpiresAt: &expiresAt,
+		}
+		if t.AccessLevel != "" {
+			opt.AccessLevel = t.AccessLevel.Value()
+		}
+
+		sink, err := os.OpenFile(t.Sink.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open the sink of project access token %s of project %s: %v", t.Name, project.PathWithNamespace, err)
+		}
+
+		created, _, err := m.accessTokensClient.CreateProjectAccessToken(project.ID, opt, m.withContext())
+		if err != nil {
+			sink.Close()
+			return fmt.Errorf("failed to create project access token %s of project %s: %v", t.Name, project.PathWithNamespace, err)
+		}
+		m.logger.Infof("Created project access token %s [%d] of project %s, expiring %s.", t.Name, created.ID, project.PathWithNamespace, expiresAt)
+
+		err = writeTokenToSink(sink, t, project, created.Token)
+		if closeErr := sink.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			// The value is lost, a token kept active would be taken as valid by later runs
+			if _, revokeErr := m.accessTokensClient.RevokeProjectAccessToken(project.ID, created.ID, m.withContext()); revokeErr != nil {
+				return fmt.Errorf("failed to write project access token %s of project %s: %v, and to revoke it [%d]: %v",
+					t.Name, project.PathWithNamespace, err, created.ID, revokeErr)
+			}
+			return fmt.Errorf("failed to write project access token %s of project %s, revoked it: %v", t.Name, project.PathWithNamespace, err)
+		}
+	}
+
+	return nil
+}
+
+// listProjectAccessTokens returns all access tokens of the project
+func (m *ProjectManager) listProjectAccessTokens(project gitlab.Project) ([]*gitlab.ProjectAccessToken, *gitlab.Response, error) {
+	var tokens []*gitlab.ProjectAccessToken
+
+	opt := &gitlab.ListProjectAccessTokensOptions{PerPage: 100}
+	for {
+		page, resp, err := m.accessTokensClient.ListProjectAccessTokens(project.ID, opt, m.withContext())
+		if err != nil {
+			return nil, resp, err
+		}
+		tokens = append(tokens, page...)
+
+		if resp.NextPage == 0 {
+			return tokens, resp, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// findProjectAccessToken returns the active token matching the config which doesn't expire
+// within the renewal period, or nil
+func findProjectAccessToken(tokens []*gitlab.ProjectAccessToken, t config.ProjectAccessToken, now time.Time) *gitlab.ProjectAccessToken {
+	renewAt := now.AddDate(0, 0, t.RenewBeforeDays)
+
+	for _, token := range tokens {
+		if token.Name != t.Name || !token.Active || token.Revoked || !stringslice.SameElements(token.Scopes, t.Scopes) {
+			continue
+		}
+		if t.AccessLevel != "" && token.AccessLevel != *t.AccessLevel.Value() {
+			continue
+		}
+		if token.ExpiresAt != nil && time.Time(*token.ExpiresAt).Before(renewAt) {
+			continue
+		}
+
+		return token
+	}
+
+	return nil
+}
+
+// writeTokenToSink appends the token value to the opened sink file of the token config
+func writeTokenToSink(f io.Writer, t config.ProjectAccessToken, project gitlab.Project, token string) error {
+	var line string
+	switch t.Sink.Format {
+	case config.TokenSinkFormatEnv:
+		name := strings.ToUpper(nonAlphanumeric.ReplaceAllString(t.Name+"_"+project.PathWithNamespace, "_"))
+		line = fmt.Sprintf("export %s=%q\n", name, token)
+	default:
+		line = fmt.Sprintf("%s %s\n", project.PathWithNamespace, token)
+	}
+
+	_, err := io.WriteString(f, line)
+	return err
+}
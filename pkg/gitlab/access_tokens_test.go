@@ -0,0 +1,158 @@
+package gitlab
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestEnsureProjectAccessTokens(t *testing.T) {
+	sink := filepath.Join(t.TempDir(), "tokens.env")
+	client := newTestClient()
+	manager := newTestManager(client, &config.Config{
+		ProjectAccessTokens: []config.ProjectAccessToken{{
+			Name:            "ci-bot",
+			Scopes:          []string{"read_api", "write_repository"},
+			ExpiresInDays:   365,
+			RenewBeforeDays: 30,
+			Sink:            config.TokenSink{Path: sink, Format: config.TokenSinkFormatEnv},
+		}},
+	})
+
+	// foo has a valid token, bar one which expires soon
+	valid := gitlab.ISOTime(time.Now().AddDate(0, 0, 100))
+	expiring := gitlab.ISOTime(time.Now().AddDate(0, 0, 5))
+	client.AddProjectAccessToken(10, &gitlab.ProjectAccessToken{
+		ID: 100, Name: "ci-bot", Active: true, Scopes: []string{"write_repository", "read_api"}, ExpiresAt: &valid,
+	})
+	client.AddProjectAccessToken(11, &gitlab.ProjectAccessToken{
+		ID: 101, Name: "ci-bot", Active: true, Scopes: []string{"read_api", "write_repository"}, ExpiresAt: &expiring,
+	})
+
+	for _, project := range []gitlab.Project{
+		{ID: 10, PathWithNamespace: "example/foo"},
+		{ID: 11, PathWithNamespace: "example/sub/bar"},
+	} {
+		if err := manager.EnsureProjectAccessTokens(project, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	fooTokens, _, _ := client.ProjectAccessTokens.ListProjectAccessTokens(10, nil)
+	if len(fooTokens) != 1 {
+		t.Errorf("Expected the valid token of example/foo to be kept, got %d tokens", len(fooTokens))
+	}
+	barTokens, _, _ := client.ProjectAccessTokens.ListProjectAccessTokens(11, nil)
+	if len(barTokens) != 2 {
+		t.Fatalf("Expected a new token for example/sub/bar, got %d tokens", len(barTokens))
+	}
+
+	b, err := ioutil.ReadFile(sink)
+	if err != nil {
+		t.Fatalf("Expected the new token to be written, got %v", err)
+	}
+	expected := `export CI_BOT_EXAMPLE_SUB_BAR="glpat-fake-1"` + "\n"
+	if string(b) != expected {
+		t.Errorf("Expected sink content %q, got %q", expected, string(b))
+	}
+	if strings.Contains(string(b), "EXAMPLE_FOO") {
+		t.Errorf("Expected no new token for example/foo")
+	}
+}
+
+func TestEnsureProjectAccessTokensPaged(t *testing.T) {
+	client := newTestClient()
+	manager := newTestManager(client, &config.Config{
+		ProjectAccessTokens: []config.ProjectAccessToken{{
+			Name:            "ci-bot",
+			Scopes:          []string{"read_api"},
+			ExpiresInDays:   365,
+			RenewBeforeDays: 30,
+			Sink:            config.TokenSink{Path: filepath.Join(t.TempDir(), "tokens")},
+		}},
+	})
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return now }
+
+	// The valid token of foo is listed after a full page of other tokens
+	for i := 0; i < 100; i++ {
+		client.AddProjectAccessToken(10, &gitlab.ProjectAccessToken{ID: 200 + i, Name: fmt.Sprintf("other-%d", i), Active: true, Scopes: []string{"read_api"}})
+	}
+	valid := gitlab.ISOTime(now.AddDate(0, 0, 100))
+	client.AddProjectAccessToken(10, &gitlab.ProjectAccessToken{ID: 100, Name: "ci-bot", Active: true, Scopes: []string{"read_api"}, ExpiresAt: &valid})
+
+	for _, project := range []gitlab.Project{
+		{ID: 10, PathWithNamespace: "example/foo"},
+		{ID: 11, PathWithNamespace: "example/sub/bar"},
+	} {
+		if err := manager.EnsureProjectAccessTokens(project, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	fooTokens, _, err := manager.listProjectAccessTokens(gitlab.Project{ID: 10})
+	if err != nil || len(fooTokens) != 101 {
+		t.Errorf("Expected the valid token on the second page to be kept, got %d tokens (%v)", len(fooTokens), err)
+	}
+	barTokens, _, _ := client.ProjectAccessTokens.ListProjectAccessTokens(11, nil)
+	if len(barTokens) != 1 || time.Time(*barTokens[0].ExpiresAt) != now.AddDate(0, 0, 365) {
+		t.Errorf("Expected a token expiring a year after the injected time, got %+v", barTokens)
+	}
+}
+
+func TestEnsureProjectAccessTokensSinkFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		sink          string
+		expectedToken bool
+	}{
+		// The sink is checked before a token is created
+		{name: "missing sink directory", sink: filepath.Join(t.TempDir(), "missing", "tokens")},
+		// A token whose value couldn't be written is revoked
+		{name: "failed write", sink: "/dev/full", expectedToken: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := os.Stat(filepath.Dir(tt.sink)); tt.expectedToken && err != nil {
+				t.Skipf("%s is not available", tt.sink)
+			}
+
+			client := newTestClient()
+			manager := newTestManager(client, &config.Config{
+				ProjectAccessTokens: []config.ProjectAccessToken{{
+					Name:          "ci-bot",
+					Scopes:        []string{"read_api"},
+					ExpiresInDays: 365,
+					Sink:          config.TokenSink{Path: tt.sink},
+				}},
+			})
+
+			if err := manager.EnsureProjectAccessTokens(gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}, false); err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			tokens, _, _ := client.ProjectAccessTokens.ListProjectAccessTokens(10, nil)
+			if !tt.expectedToken {
+				if len(tokens) != 0 {
+					t.Errorf("Expected no token to be created, got %+v", tokens)
+				}
+				return
+			}
+			if len(tokens) != 1 || tokens[0].Active || !tokens[0].Revoked {
+				t.Errorf("Expected the created token to be revoked, got %+v", tokens)
+			}
+			if findProjectAccessToken(tokens, manager.config.ProjectAccessTokens[0], time.Now()) != nil {
+				t.Errorf("Expected the revoked token not to be taken as valid")
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/r3labs/diff"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// ApprovalRuleSettings is the recorded state of an approval rule scoped to a protected branch
+type ApprovalRuleSettings struct {
+	ApprovalsRequired             int
+	Users                         []int
+	Groups                        []int
+	ProtectedBranches             []string
+	AppliesToAllProtectedBranches bool
+}
+
+// approvalRuleDiff holds the changes of the approval rules of a single protected branch
+type approvalRuleDiff struct {
+	branch   string
+	difflog  diff.Changelog
+	original map[string]*ApprovalRuleSettings
+	updated  map[string]*ApprovalRuleSettings
+}
+
+// EnsureApprovalRules ensures the approval rules configured on protected branches. Each rule
+// is created or updated to apply to its protected branch only. Rules are matched by name,
+// other rules of the project are left untouched.
+func (m *ProjectManager) EnsureApprovalRules(project gitlab.Project, dryrun bool) error {
+	var rules []*gitlab.ProjectApprovalRule
+	fetched := false
+
+	for _, b := range m.config.ProtectedBranches {
+		if b.ApprovalRule == nil {
+			continue
+		}
+
+		if !fetched {
+			var err error
+			if rules, err = m.listApprovalRules(project); err != nil {
+				return err
+			}
+			fetched = true
+		}
+
+		if err := m.ensureApprovalRule(project, b, rules, dryrun); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureApprovalRule creates or updates the approval rule of the protected branch
+func (m *ProjectManager) ensureApprovalRule(project gitlab.Project, b config.ProtectedBranch, rules []*gitlab.ProjectApprovalRule, dryrun bool) error {
+	r := b.ApprovalRule
+
+	// In dryrun the branch may only be protected by this run
+	branchID := 0
+	protectedBranch, resp, err := m.protectedBranchesClient.GetProtectedBranch(project.ID, b.Name, m.withContext())
+	switch {
+	case err == nil:
+		branchID = protectedBranch.ID
+	case resp != nil && resp.StatusCode == http.StatusNotFound && dryrun:
+		m.logger.Debugf("Branch %s is not protected yet.", b.Name)
+	default:
+		return fmt.Errorf("failed to get protected branch %s for approval rule %s: %v", b.Name, r.Name, err)
+	}
+
+	var existing *gitlab.ProjectApprovalRule
+	for _, rule := range rules {
+		if rule.Name == r.Name {
+			existing = rule
+			break
+		}
+	}
+
+	current := &ApprovalRuleSettings{Users: []int{}, Groups: []int{}, ProtectedBranches: []string{}}
+	if existing != nil {
+		current = approvalRuleSettings(existing)
+	}
+	desired := &ApprovalRuleSettings{
+		ApprovalsRequired: r.ApprovalsRequired,
+		Users:             sortedIDs(r.UserIDs),
+		Groups:            sortedIDs(r.GroupIDs),
+		ProtectedBranches: []string{b.Name},
+	}
+
+	m.recordApprovalRule(m.ApprovalRulesOriginal, project, b.Name, current)
+
+	if reflect.DeepEqual(current, desired) {
+		m.logger.Debugf("Approval rule %s of branch %s is up to date.", r.Name, b.Name)
+		m.recordApprovalRule(m.ApprovalRulesUpdated, project, b.Name, current)
+		return nil
+	}
+
+	if dryrun {
+		if existing == nil {
+			m.skipAPICall("CreateProjectApprovalRule", "for %s on %v branch.", r.Name, b.Name)
+		} else {
+			m.skipAPICall("UpdateProjectApprovalRule", "for %s on %v branch.", r.Name, b.Name)
+		}
+		m.recordApprovalRule(m.ApprovalRulesUpdated, project, b.Name, desired)
+		return nil
+	}
+
+	var applied *gitlab.ProjectApprovalRule
+	if existing == nil {
+		opt := &gitlab.CreateProjectLevelRuleOptions{
+			Name:               gitlab.String(r.Name),
+			ApprovalsRequired:  gitlab.Int(desired.ApprovalsRequired),
+			UserIDs:            &desired.Users,
+			GroupIDs:           &desired.Groups,
+			ProtectedBranchIDs: &[]int{branchID},
+		}
+		if applied, _, err = m.projectsClient.CreateProjectApprovalRule(project.ID, opt, m.withContext()); err != nil {
+			return fmt.Errorf("failed to create approval rule %s of branch %s: %v", r.Name, b.Name, err)
+		}
+		m.logger.Infof("Created approval rule %s of branch %s.", r.Name, b.Name)
+	} else {
+		opt := &gitlab.UpdateProjectLevelRuleOptions{
+			ApprovalsRequired:             gitlab.Int(desired.ApprovalsRequired),
+			UserIDs:                       &desired.Users,
+			GroupIDs:                      &desired.Groups,
+			ProtectedBranchIDs:            &[]int{branchID},
+			AppliesToAllProtectedBranches: gitlab.Bool(false),
+		}
+		if applied, _, err = m.projectsClient.UpdateProjectApprovalRule(project.ID, existing.ID, opt, m.withContext()); err != nil {
+			return fmt.Errorf("failed to update approval rule %s of branch %s: %v", r.Name, b.Name, err)
+		}
+		m.logger.Infof("Updated approval rule %s of branch %s.", r.Name, b.Name)
+	}
+
+	m.recordApprovalRule(m.ApprovalRulesUpdated, project, b.Name, approvalRuleSettings(applied))
+
+	return nil
+}
+
+// listApprovalRules returns all approval rules of the project
+func (m *ProjectManager) listApprovalRules(project gitlab.Project) ([]*gitlab.ProjectApprovalRule, error) {
+	var rules []*gitlab.ProjectApprovalRule
+
+	opt := &gitlab.GetProjectApprovalRulesListsOptions{PerPage: 100}
+	for {
+		page, resp, err := m.projectsClient.GetProjectApprovalRules(project.ID, opt, m.withContext())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list approval rules of project %s: %v", project.PathWithNamespace, err)
+		}
+		rules = append(rules, page...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return rules, nil
+}
+
+// recordApprovalRule stores the settings of the approval rule of the branch in the given
+// original or updated states
+func (m *ProjectManager) recordApprovalRule(states map[string]map[string]*ApprovalRuleSettings, project gitlab.Project, branch string, settings *ApprovalRuleSettings) {
+	if _, ok := states[project.PathWithNamespace]; !ok {
+		states[project.PathWithNamespace] = make(map[string]*ApprovalRuleSettings)
+	}
+	states[project.PathWithNamespace][branch] = settings
+}
+
+// approvalRuleDiffs returns the changes of the approval rules per protected branch, sorted by
+// branch. The states are regrouped by branch to diff them like the other settings.
+func (m *ProjectManager) approvalRuleDiffs() ([]approvalRuleDiff, error) {
+	byBranch := make(map[string]*approvalRuleDiff)
+	for project, branches := range m.ApprovalRulesOriginal {
+		for branch, settings := range branches {
+			if _, ok := byBranch[branch]; !ok {
+				byBranch[branch] = &approvalRuleDiff{
+					branch:   branch,
+					original: make(map[string]*ApprovalRuleSettings),
+					updated:  make(map[string]*ApprovalRuleSettings),
+				}
+			}
+			byBranch[branch].original[project] = settings
+			byBranch[branch].updated[project] = m.ApprovalRulesUpdated[project][branch]
+		}
+	}
+
+	diffs := make([]approvalRuleDiff, 0, len(byBranch))
+	for _, d := range byBranch {
+		difflog, err := diff.Diff(d.original, d.updated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff approval rules of branch %s: %v", d.branch, err)
+		}
+		d.difflog = difflog
+		diffs = append(diffs, *d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].branch < diffs[j].branch
+	})
+
+	return diffs, nil
+}
+
+// approvalRuleSettings returns the recorded state of the approval rule
+func approvalRuleSettings(rule *gitlab.ProjectApprovalRule) *ApprovalRuleSettings {
+	settings := &ApprovalRuleSettings{
+		ApprovalsRequired:             rule.ApprovalsRequired,
+		Users:                         []int{},
+		Groups:                        []int{},
+		ProtectedBranches:             []string{},
+		AppliesToAllProtectedBranches: rule.AppliesToAllProtectedBranches,
+	}
+	for _, u := range rule.Users {
+		settings.Users = append(settings.Users, u.ID)
+	}
+	for _, g := range rule.Groups {
+		settings.Groups = append(settings.Groups, g.ID)
+	}
+	for _, b := range rule.ProtectedBranches {
+		settings.ProtectedBranches = append(settings.ProtectedBranches, b.Name)
+	}
+	sort.Ints(settings.Users)
+	sort.Ints(settings.Groups)
+	sort.Strings(settings.ProtectedBranches)
+
+	return settings
+}
+
+// sortedIDs returns a sorted copy of the IDs, which is never nil
+func sortedIDs(ids []int) []int {
+	sorted := append([]int{}, ids...)
+	sort.Ints(sorted)
+
+	return sorted
+}
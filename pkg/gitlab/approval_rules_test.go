@@ -0,0 +1,105 @@
+package gitlab
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestEnsureApprovalRules(t *testing.T) {
+	for _, dryrun := range []bool{true, false} {
+		client := newTestClient()
+		client.AddProtectedBranch(10, &gitlab.ProtectedBranch{Name: "master"})
+		client.AddProtectedBranch(10, &gitlab.ProtectedBranch{Name: "stable"})
+		// The security rule exists, but applies to all protected branches with too few approvals
+		client.AddApprovalRule(10, &gitlab.ProjectApprovalRule{
+			Name:                          "security",
+			ApprovalsRequired:             1,
+			Groups:                        []*gitlab.Group{{ID: 7}},
+			AppliesToAllProtectedBranches: true,
+		})
+		manager := newTestManager(client, &config.Config{
+			ProtectedBranches: []config.ProtectedBranch{
+				{Name: "master", ApprovalRule: &config.ApprovalRule{Name: "security", ApprovalsRequired: 2, GroupIDs: []int{7}}},
+				{Name: "stable", ApprovalRule: &config.ApprovalRule{Name: "release", ApprovalsRequired: 1, UserIDs: []int{42}}},
+			},
+		})
+
+		project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+		if err := manager.EnsureApprovalRules(project, dryrun); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		entries, err := manager.ChangeLogEntries(true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		changed := make(map[string]interface{})
+		for _, e := range entries {
+			changed[e.Subsection+"."+e.Setting] = e.To
+		}
+		for key, to := range map[string]interface{}{
+			"approval_rules[master].approvals_required":                2,
+			"approval_rules[master].protected_branches":                []string{"master"},
+			"approval_rules[master].applies_to_all_protected_branches": false,
+			"approval_rules[stable].approvals_required":                1,
+			"approval_rules[stable].users":                             []string{"42"},
+		} {
+			if !reflect.DeepEqual(changed[key], to) {
+				t.Errorf("Expected %s to change to %v (dryrun %v), got %v", key, to, dryrun, changed[key])
+			}
+		}
+
+		rules, _, _ := client.Projects.GetProjectApprovalRules(10, nil)
+		if dryrun {
+			if len(rules) != 1 || rules[0].ApprovalsRequired != 1 {
+				t.Errorf("Expected a dryrun to leave the approval rules untouched, got %+v", rules)
+			}
+			continue
+		}
+
+		if len(rules) != 2 {
+			t.Fatalf("Expected 2 approval rules, got %d", len(rules))
+		}
+		for _, r := range rules {
+			settings := approvalRuleSettings(r)
+			if r.Name == "security" && (settings.ApprovalsRequired != 2 || settings.AppliesToAllProtectedBranches ||
+				!reflect.DeepEqual(settings.ProtectedBranches, []string{"master"})) {
+				t.Errorf("Expected the security rule to require 2 approvals on master only, got %+v", settings)
+			}
+			if r.Name == "release" && (!reflect.DeepEqual(settings.Users, []int{42}) ||
+				!reflect.DeepEqual(settings.ProtectedBranches, []string{"stable"})) {
+				t.Errorf("Expected the release rule to apply to stable, got %+v", settings)
+			}
+		}
+
+		// A second run has nothing left to do
+		second := newTestManager(client, manager.config)
+		if err := second.EnsureApprovalRules(project, false); err != nil {
+			t.Fatalf("Expected no error on the second run, got %v", err)
+		}
+		if changes, err := second.HasChanges(); err != nil || changes {
+			t.Errorf("Expected no changes on the second run, got %v (%v)", changes, err)
+		}
+	}
+}
+
+func TestEnsureApprovalRulesUnprotectedBranch(t *testing.T) {
+	client := newTestClient()
+	manager := newTestManager(client, &config.Config{
+		ProtectedBranches: []config.ProtectedBranch{
+			{Name: "master", ApprovalRule: &config.ApprovalRule{Name: "security", ApprovalsRequired: 2}},
+		},
+	})
+
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+	if err := manager.EnsureApprovalRules(project, true); err != nil {
+		t.Errorf("Expected a dryrun to plan the rule of a branch protected later, got %v", err)
+	}
+	if err := manager.EnsureApprovalRules(project, false); err == nil {
+		t.Errorf("Expected an error for an unprotected branch")
+	}
+}
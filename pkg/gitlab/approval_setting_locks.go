@@ -0,0 +1,132 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// ApprovalSettingLocksService fetches which merge request approval settings of a project are
+// locked by its group or the instance (GitLab Premium). GitLab acknowledges changes of locked
+// settings per project without applying them. go-gitlab has no support for this API yet.
+type ApprovalSettingLocksService struct {
+	client *gitlab.Client
+}
+
+// NewApprovalSettingLocksService returns a new ApprovalSettingLocksService using the client
+func NewApprovalSettingLocksService(client *gitlab.Client) *ApprovalSettingLocksService {
+	return &ApprovalSettingLocksService{client: client}
+}
+
+// approvalSettingLockKeys maps the keys of the merge request approval settings API to the
+// approval_settings keys they lock. Some are inverted, e.g. retain_approvals_on_push locks
+// reset_approvals_on_push.
+var approvalSettingLockKeys = map[string]string{
+	"allow_author_approval":                              "merge_requests_author_approval",
+	"allow_committer_approval":                           "merge_requests_disable_committers_approval",
+	"allow_overrides_to_approver_list_per_merge_request": "disable_overriding_approvers_per_merge_request",
+	"retain_approvals_on_push":                           "reset_approvals_on_push",
+	"selective_code_owner_removals":                      "selective_code_owner_removals",
+	"require_password_to_approve":                        "require_password_to_approve",
+}
+
+// ApprovalSettingLocks returns the locked approval_settings keys of the project, mapped to the
+// level they are inherited from, e.g. group or instance
+func (s *ApprovalSettingLocksService) ApprovalSettingLocks(pid interface{}, options ...gitlab.RequestOptionFunc) (map[string]string, *gitlab.Response, error) {
+	var project string
+	switch v := pid.(type) {
+	case int:
+		project = strconv.Itoa(v)
+	case string:
+		project = gitlab.PathEscape(v)
+	default:
+		return nil, nil, fmt.Errorf("invalid ID type %#v, the ID must be an int or a string", pid)
+	}
+
+	req, err := s.client.NewRequest(http.MethodGet, fmt.Sprintf("projects/%s/merge_request_approval_setting", project), nil, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var settings map[string]struct {
+		Locked        bool   `json:"locked"`
+		InheritedFrom string `json:"inherited_from"`
+	}
+	resp, err := s.client.Do(req, &settings)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	locks := make(map[string]string)
+	for key, setting := range settings {
+		if field, ok := approvalSettingLockKeys[key]; ok && setting.Locked {
+			if setting.InheritedFrom == "" {
+				setting.InheritedFrom = "group"
+			}
+			locks[field] = setting.InheritedFrom
+		}
+	}
+
+	return locks, resp, nil
+}
+
+// GetApprovalSettingLocks returns the approval_settings keys of the project locked by its group
+// or the instance, mapped to the level they are inherited from. Without support for the API,
+// i.e. on GitLab CE or the free tier, no settings are locked.
+func (m *ProjectManager) GetApprovalSettingLocks(project gitlab.Project) (map[string]string, error) {
+	locks, resp, err := m.approvalLocksClient.ApprovalSettingLocks(project.ID, m.withContext())
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+			m.logger.Debugf("Approval setting locks of project %s unavailable, assuming none: %v", project.PathWithNamespace, err)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get approval setting locks of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	return locks, nil
+}
+
+// skipLockedApprovalSettings returns a copy of the options without the approval settings
+// locked for the project, as changing them per project has no effect and would show up as a
+// change on every run. Locked settings which differ from the config are warned about.
+func (m *ProjectManager) skipLockedApprovalSettings(project gitlab.Project, current *gitlab.ProjectApprovals,
+	options *gitlab.ChangeApprovalConfigurationOptions) (*gitlab.ChangeApprovalConfigurationOptions, error) {
+	locks, err := m.GetApprovalSettingLocks(project)
+	if err != nil {
+		return nil, err
+	}
+	if len(locks) == 0 {
+		return options, nil
+	}
+	m.ApprovalSettingLocks[project.PathWithNamespace] = locks
+
+	desired, err := m.convertChangeApprovalConfigurationOptionsToProjectApprovals(*options)
+	if err != nil {
+		return nil, err
+	}
+
+	unlocked := *options
+	v := reflect.ValueOf(&unlocked).Elem()
+	for field := range configuredFields(options) {
+		structField, _ := v.Type().FieldByName(field)
+		key := strings.Split(structField.Tag.Get("json"), ",")[0]
+
+		inheritedFrom, ok := locks[key]
+		if !ok {
+			continue
+		}
+		v.FieldByName(field).Set(reflect.Zero(structField.Type))
+
+		if m.willChangeApprovalSettings(current, &desired, map[string]bool{field: true}) {
+			m.warnf("approval_settings.%s of project %s is inherited from the %s and can't be enforced per project", key, project.PathWithNamespace, inheritedFrom)
+		} else {
+			m.logger.Debugf("approval_settings.%s of project %s is inherited from the %s and already matches.", key, project.PathWithNamespace, inheritedFrom)
+		}
+	}
+
+	return &unlocked, nil
+}
@@ -0,0 +1,128 @@
+package gitlab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestApprovalSettingLocksService(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/10/merge_request_approval_setting" {
+			t.Errorf("Expected a request of the approval settings of project 10, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"allow_author_approval": {"value": false, "locked": true, "inherited_from": "group"},
+			"allow_committer_approval": {"value": true, "locked": false},
+			"retain_approvals_on_push": {"value": false, "locked": true, "inherited_from": "instance"},
+			"require_password_to_approve": {"value": false, "locked": true}
+		}`))
+	}))
+	defer server.Close()
+
+	client, err := gitlab.NewClient("secret", gitlab.WithBaseURL(server.URL+"/api/v4"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	locks, _, err := NewApprovalSettingLocksService(client).ApprovalSettingLocks(10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := map[string]string{
+		"merge_requests_author_approval": "group",
+		"reset_approvals_on_push":        "instance",
+		"require_password_to_approve":    "group",
+	}
+	if !reflect.DeepEqual(locks, expected) {
+		t.Errorf("Expected locks %v, got %v", expected, locks)
+	}
+}
+
+func TestUpdateProjectApprovalSettingsLocked(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		client := newTestClient()
+		client.LockApprovalSetting(10, "reset_approvals_on_push", "group")
+		cfg := &config.Config{
+			Strict: strict,
+			ApprovalSettings: &gitlab.ChangeApprovalConfigurationOptions{
+				ResetApprovalsOnPush:                   gitlab.Bool(true),
+				MergeRequestsDisableCommittersApproval: gitlab.Bool(true),
+			},
+		}
+		project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+		first := newTestManager(client, cfg)
+		if err := first.UpdateProjectApprovalSettings(project, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if first.GetError() != strict {
+			t.Errorf("Expected the error flag to be %v in strict mode %v, got %v", strict, strict, first.GetError())
+		}
+		if first.ApprovalSettingLocks["example/foo"]["reset_approvals_on_push"] != "group" {
+			t.Errorf("Expected the lock to be recorded, got %v", first.ApprovalSettingLocks)
+		}
+
+		entries, err := first.ChangeLogEntries(false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(entries) != 1 || entries[0].Setting != "merge_requests_disable_committers_approval" {
+			t.Errorf("Expected only the unlocked setting to change, got %+v", entries)
+		}
+
+		// The locked setting is skipped instead of drifting on every run
+		second := newTestManager(client, cfg)
+		if err := second.UpdateProjectApprovalSettings(project, true); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if changes, _ := second.HasChanges(); changes {
+			t.Errorf("Expected no changes once the unlocked settings are applied")
+		}
+	}
+}
+
+func TestComplianceResultsInherited(t *testing.T) {
+	manager := newTestManager(newTestClient(), &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"approval_settings": {"reset_approvals_on_push": true, "merge_requests_author_approval": false},
+			},
+		},
+	})
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{}
+	manager.ApprovalSettingsOriginal["example/foo"] = &gitlab.ProjectApprovals{}
+	manager.ApprovalSettingLocks["example/foo"] = map[string]string{
+		"reset_approvals_on_push":        "group",
+		"merge_requests_author_approval": "group",
+	}
+
+	results := manager.ComplianceResults()
+	statuses := make(map[string]string)
+	for _, result := range results {
+		statuses[result.Setting] = result.Status()
+	}
+	expected := map[string]string{"merge_requests_author_approval": "PASS", "reset_approvals_on_push": "INHERITED"}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected statuses %v, got %v", expected, statuses)
+	}
+
+	var text strings.Builder
+	manager.complianceText(&text, results, newComplianceScores(results))
+	if !strings.Contains(text.String(), "reset_approvals_on_push:        false (true) [inherited from group, not enforceable]") {
+		t.Errorf("Expected the inherited setting to be marked, got\n%s", text.String())
+	}
+
+	suites := newJUnitTestSuites(results)
+	if suites.Failures != 0 || suites.Skipped != 1 {
+		t.Errorf("Expected the inherited setting to be skipped instead of failed, got %d failures and %d skipped", suites.Failures, suites.Skipped)
+	}
+}
@@ -0,0 +1,69 @@
+package gitlab
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// CanaryProjects returns the canary subset of the projects: count projects, or percent of
+// them (rounded up) if count is 0. Projects are ranked by a hash of their ID, so reruns pick
+// the same canaries and adding projects rarely replaces existing ones. The projects keep
+// their order.
+func CanaryProjects(projects []gitlab.Project, percent int, count int) []gitlab.Project {
+	if count == 0 {
+		count = (len(projects)*percent + 99) / 100
+	}
+	if count >= len(projects) {
+		return projects
+	}
+
+	ranked := make([]int, len(projects))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return canaryRank(projects[ranked[i]]) < canaryRank(projects[ranked[j]])
+	})
+
+	chosen := make(map[int]bool, count)
+	for _, i := range ranked[:count] {
+		chosen[i] = true
+	}
+
+	canaries := make([]gitlab.Project, 0, count)
+	for i, p := range projects {
+		if chosen[i] {
+			canaries = append(canaries, p)
+		}
+	}
+
+	return canaries
+}
+
+// ValidateCanary checks that at most one of a percent between 0 and 100 and a non negative
+// count is given
+func ValidateCanary(percent int, count int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("invalid canary percent %d: must be between 0 and 100", percent)
+	}
+	if count < 0 {
+		return fmt.Errorf("invalid canary count %d: must not be negative", count)
+	}
+	if percent > 0 && count > 0 {
+		return fmt.Errorf("only one is allowed: canary percent / canary count")
+	}
+
+	return nil
+}
+
+// canaryRank returns the hash of the project ID the canaries are chosen by
+func canaryRank(p gitlab.Project) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(strconv.Itoa(p.ID)))
+
+	return h.Sum64()
+}
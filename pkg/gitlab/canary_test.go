@@ -0,0 +1,92 @@
+package gitlab
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestCanaryProjects(t *testing.T) {
+	var projects []gitlab.Project
+	for id := 1; id <= 100; id++ {
+		projects = append(projects, gitlab.Project{ID: id})
+	}
+
+	tests := []struct {
+		name     string
+		percent  int
+		count    int
+		expected int
+	}{
+		{name: "percent", percent: 5, expected: 5},
+		{name: "percent rounded up", percent: 1, expected: 1},
+		{name: "count", count: 7, expected: 7},
+		{name: "count above total", count: 200, expected: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canaries := CanaryProjects(projects, tt.percent, tt.count)
+			if len(canaries) != tt.expected {
+				t.Fatalf("Expected %d canaries, got %d", tt.expected, len(canaries))
+			}
+
+			for i := 1; i < len(canaries); i++ {
+				if canaries[i-1].ID >= canaries[i].ID {
+					t.Errorf("Expected the canaries to keep the project order, got %v before %v", canaries[i-1].ID, canaries[i].ID)
+				}
+			}
+		})
+	}
+
+	// Reruns pick the same canaries, also when the projects are listed in another order, and
+	// an added project replaces at most one of them
+	first := canaryIDs(CanaryProjects(projects, 0, 5))
+
+	reversed := make([]gitlab.Project, 0, len(projects))
+	for i := len(projects) - 1; i >= 0; i-- {
+		reversed = append(reversed, projects[i])
+	}
+	if rerun := canaryIDs(CanaryProjects(reversed, 0, 5)); !reflect.DeepEqual(rerun, first) {
+		t.Errorf("Expected the rerun to pick canaries %v, got %v", first, rerun)
+	}
+
+	kept := 0
+	for id := range canaryIDs(CanaryProjects(append(projects, gitlab.Project{ID: 1000}), 0, 5)) {
+		if first[id] {
+			kept++
+		}
+	}
+	if kept < 4 {
+		t.Errorf("Expected an added project to keep at least 4 canaries, kept %d", kept)
+	}
+}
+
+// canaryIDs returns the set of IDs of the canaries
+func canaryIDs(canaries []gitlab.Project) map[int]bool {
+	ids := make(map[int]bool)
+	for _, p := range canaries {
+		ids[p.ID] = true
+	}
+
+	return ids
+}
+
+func TestValidateCanary(t *testing.T) {
+	for _, tt := range []struct {
+		percent, count int
+		wantErr        bool
+	}{
+		{percent: 5},
+		{count: 3},
+		{},
+		{percent: 101, wantErr: true},
+		{count: -1, wantErr: true},
+		{percent: 5, count: 3, wantErr: true},
+	} {
+		if err := ValidateCanary(tt.percent, tt.count); (err != nil) != tt.wantErr {
+			t.Errorf("Expected error %v for percent %d and count %d, got %v", tt.wantErr, tt.percent, tt.count, err)
+		}
+	}
+}
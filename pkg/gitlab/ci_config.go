@@ -0,0 +1,71 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// defaultCIConfigPath is the CI config GitLab runs pipelines from if ci_config_path isn't set
+const defaultCIConfigPath = ".gitlab-ci.yml"
+
+// skipPipelineSucceedsWithoutCI returns the options without the
+// only_allow_merge_if_pipeline_succeeds project setting if pipeline_succeeds_requires_ci is
+// set and the project has no CI config, as requiring a successful pipeline without pipelines
+// blocks all merges. The project is reported in ProjectsWithoutCI, the other settings are
+// still applied.
+func (m *ProjectManager) skipPipelineSucceedsWithoutCI(project gitlab.Project, current *gitlab.Project, options *gitlab.EditProjectOptions) (*gitlab.EditProjectOptions, error) {
+	if !m.config.PipelineRequiresCI || options.OnlyAllowMergeIfPipelineSucceeds == nil ||
+		!*options.OnlyAllowMergeIfPipelineSucceeds || current.OnlyAllowMergeIfPipelineSucceeds {
+		return options, nil
+	}
+
+	// The CI config path set in the same update applies to the pipelines of the merges
+	path := current.CIConfigPath
+	if options.CIConfigPath != nil {
+		path = *options.CIConfigPath
+	}
+	hasCI, err := m.hasCIConfig(project, current.DefaultBranch, path)
+	if err != nil {
+		return nil, err
+	}
+	if hasCI {
+		return options, nil
+	}
+
+	m.warn(project.PathWithNamespace, "Project %s has no CI config, skipping project_settings.only_allow_merge_if_pipeline_succeeds.", project.PathWithNamespace)
+	m.ProjectsWithoutCI = append(m.ProjectsWithoutCI, project.PathWithNamespace)
+	skipped := *options
+	skipped.OnlyAllowMergeIfPipelineSucceeds = nil
+	skipped.AllowMergeOnSkippedPipeline = nil
+
+	return &skipped, nil
+}
+
+// hasCIConfig reports whether the CI config at the path exists on the default branch of the
+// project. Configs of other projects (path@group/project) and remote URLs are assumed to
+// exist, as they can't be checked with the permissions of the project.
+func (m *ProjectManager) hasCIConfig(project gitlab.Project, branch string, path string) (bool, error) {
+	if path == "" {
+		path = defaultCIConfigPath
+	}
+	if strings.Contains(path, "@") || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return true, nil
+	}
+	if branch == "" {
+		// Empty repositories have no default branch, thus no CI config
+		return false, nil
+	}
+
+	_, resp, err := m.repositoryFilesClient.GetFile(project.ID, path, &gitlab.GetFileOptions{Ref: gitlab.String(branch)}, m.withContext())
+	if err == nil {
+		return true, nil
+	}
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("failed to check for CI config %s of project %s: %v", path, project.PathWithNamespace, err)
+}
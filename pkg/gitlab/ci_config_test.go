@@ -0,0 +1,82 @@
+package gitlab
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestUpdateProjectSettingsPipelineRequiresCI(t *testing.T) {
+	cfg := &config.Config{
+		PipelineRequiresCI: true,
+		ProjectSettings: &gitlab.EditProjectOptions{
+			OnlyAllowMergeIfPipelineSucceeds: gitlab.Bool(true),
+			AllowMergeOnSkippedPipeline:      gitlab.Bool(true),
+			SuggestionCommitMessage:          gitlab.String("Apply suggestion"),
+		},
+	}
+
+	client := newTestClient()
+	client.AddFile(10, "master", ".gitlab-ci.yml", "test:\n  script: make test\n")
+	foo, _, _ := client.Projects.GetProject(10, nil)
+	bar, _, _ := client.Projects.GetProject(11, nil)
+
+	manager := newTestManager(client, cfg)
+	for _, project := range []*gitlab.Project{foo, bar} {
+		if err := manager.UpdateProjectSettings(*project, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	foo, _, _ = client.Projects.GetProject(10, nil)
+	if !foo.OnlyAllowMergeIfPipelineSucceeds || !foo.AllowMergeOnSkippedPipeline {
+		t.Errorf("Expected successful pipelines to be required in the project with CI, got %+v", foo)
+	}
+	bar, _, _ = client.Projects.GetProject(11, nil)
+	if bar.OnlyAllowMergeIfPipelineSucceeds || bar.AllowMergeOnSkippedPipeline || bar.SuggestionCommitMessage != "Apply suggestion" {
+		t.Errorf("Expected only the suggestion commit message to be applied to the project without CI, got %+v", bar)
+	}
+	if len(manager.ProjectsWithoutCI) != 1 || manager.ProjectsWithoutCI[0] != "example/sub/bar" {
+		t.Errorf("Expected example/sub/bar to be reported without CI, got %v", manager.ProjectsWithoutCI)
+	}
+
+	var b strings.Builder
+	manager.changeLogText(&b, nil)
+	if !strings.Contains(b.String(), "SKIPPED WITHOUT CI (only_allow_merge_if_pipeline_succeeds)\n  example/sub/bar\n") {
+		t.Errorf("Expected the change log to list the project without CI, got\n%s", b.String())
+	}
+}
+
+func TestHasCIConfig(t *testing.T) {
+	client := newTestClient()
+	client.AddFile(10, "master", "ci/pipeline.yml", "test:\n  script: make test\n")
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+	manager := newTestManager(client, &config.Config{})
+
+	tests := []struct {
+		name   string
+		branch string
+		path   string
+		want   bool
+	}{
+		{"default path missing", "master", "", false},
+		{"custom path", "master", "ci/pipeline.yml", true},
+		{"other project", "master", ".gitlab-ci.yml@example/ci-templates", true},
+		{"remote url", "master", "https://example.com/ci.yml", true},
+		{"empty repository", "", "ci/pipeline.yml", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := manager.hasCIConfig(project, tt.branch, tt.path)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// valueList is a list of values, rendered readably in the reports, e.g. [go, python]
+type valueList []string
+
+// String joins the values, instead of the space separated Go slice formatting
+func (l valueList) String() string {
+	return "[" + strings.Join(l, ", ") + "]"
+}
+
+// complianceEqual reports whether the actual value of a setting equals the mandatory value of
+// the compliance config. Both are compared in their JSON form, so pointers are compared by the
+// values they point to, slices and maps element-wise, and e.g. an int field equals the float64
+// decoded from the config.
+func complianceEqual(actual, expected interface{}) bool {
+	return reflect.DeepEqual(jsonValue(actual), jsonValue(expected))
+}
+
+// jsonValue returns the value as decoded from its JSON encoding, or the value itself if it
+// can't be encoded
+func jsonValue(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return v
+	}
+
+	return decoded
+}
+
+// readableValue returns the value for the reports: pointers are dereferenced, nil pointers
+// become nil and slices a valueList of their readable elements
+func readableValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return readableValue(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return valueList{}
+		}
+		list := make(valueList, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			list = append(list, fmt.Sprintf("%v", readableValue(rv.Index(i).Interface())))
+		}
+		return list
+	}
+
+	return v
+}
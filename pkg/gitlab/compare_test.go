@@ -0,0 +1,72 @@
+package gitlab
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestComplianceEqual(t *testing.T) {
+	tests := []struct {
+		name     string
+		actual   interface{}
+		expected interface{}
+		equal    bool
+		readable string
+	}{
+		{name: "bool", actual: true, expected: true, equal: true, readable: "true"},
+		{name: "*bool", actual: gitlab.Bool(true), expected: true, equal: true, readable: "true"},
+		{name: "*bool differs", actual: gitlab.Bool(false), expected: true, readable: "false"},
+		{name: "nil *bool", actual: (*bool)(nil), expected: false, readable: "<nil>"},
+		{name: "*string", actual: gitlab.String("main"), expected: "main", equal: true, readable: "main"},
+		{name: "*string differs", actual: gitlab.String("master"), expected: "main", readable: "master"},
+		{name: "named string", actual: gitlab.EnabledAccessControl, expected: "enabled", equal: true, readable: "enabled"},
+		{name: "int", actual: 30, expected: float64(30), equal: true, readable: "30"},
+		{name: "[]string", actual: []string{"go", "python"}, expected: []interface{}{"go", "python"}, equal: true, readable: "[go, python]"},
+		{name: "[]string differs", actual: []string{"go"}, expected: []interface{}{"go", "python"}, readable: "[go]"},
+		{name: "nil []string", actual: []string(nil), expected: []interface{}{}, readable: "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := complianceEqual(tt.actual, tt.expected); actual != tt.equal {
+				t.Errorf("Expected equal %v, got %v", tt.equal, actual)
+			}
+			if actual := fmt.Sprintf("%v", readableValue(tt.actual)); actual != tt.readable {
+				t.Errorf("Expected %q, got %q", tt.readable, actual)
+			}
+		})
+	}
+}
+
+func TestComplianceResultsSliceSetting(t *testing.T) {
+	manager := newTestManager(newTestClient(), &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"project_settings": {"tag_list": []interface{}{"go"}, "wiki_access_level": "disabled"},
+			},
+		},
+	})
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{TagList: []string{"docker"}, WikiAccessLevel: gitlab.DisabledAccessControl}
+
+	results := manager.ComplianceResults()
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].Setting != "tag_list" || results[0].Compliant {
+		t.Errorf("Expected the tag list to be non-compliant, got %+v", results[0])
+	}
+	if results[1].Setting != "wiki_access_level" || !results[1].Compliant {
+		t.Errorf("Expected the wiki access level to be compliant, got %+v", results[1])
+	}
+
+	var text strings.Builder
+	manager.complianceText(&text, results, newComplianceScores(results))
+	if !strings.Contains(text.String(), "tag_list:          [docker] ([go])") {
+		t.Errorf("Expected the tag lists to be rendered readably, got\n%s", text.String())
+	}
+}
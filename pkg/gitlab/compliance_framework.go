@@ -0,0 +1,87 @@
+package gitlab
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/internal/stringslice"
+)
+
+// EnsureComplianceFramework assigns the configured compliance framework to the project. The
+// framework is looked up by name in the top-level group. On GitLab instances without
+// compliance frameworks (CE and the free tier) the step is skipped.
+func (m *ProjectManager) EnsureComplianceFramework(project gitlab.Project, dryrun bool) error {
+	name := m.config.ComplianceFramework
+	if name == "" || m.frameworksUnavailable {
+		return nil
+	}
+
+	// Look up the framework once per run, before recording anything of skipped projects
+	if m.frameworkID == "" {
+		namespace := strings.Split(m.config.GroupName, "/")[0]
+		id, err := m.frameworksClient.ComplianceFrameworkID(namespace, name)
+		if isUnavailableFieldError(err) {
+			m.warn("", "Compliance frameworks are not available on this GitLab instance (Premium feature), skipping compliance_framework.")
+			m.frameworksUnavailable = true
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up compliance framework %s: %v", name, err)
+		}
+		if id == "" {
+			return fmt.Errorf("compliance framework %s not found in group %s", name, namespace)
+		}
+		m.frameworkID = id
+	}
+
+	projectSettings, err := m.GetProjectSettings(project)
+	if err != nil {
+		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	// Record current settings states, unless already recorded by UpdateProjectSettings
+	if _, ok := m.ProjectSettingsOriginal[project.PathWithNamespace]; !ok {
+		m.ProjectSettingsOriginal[project.PathWithNamespace] = projectSettings
+	}
+
+	if stringslice.Contains(name, projectSettings.ComplianceFrameworks) {
+		m.logger.Debugf("Project %s has compliance framework %s.", project.PathWithNamespace, name)
+
+		if _, ok := m.ProjectSettingsUpdated[project.PathWithNamespace]; !ok {
+			m.ProjectSettingsUpdated[project.PathWithNamespace] = projectSettings
+		}
+
+		return nil
+	}
+
+	if dryrun {
+		m.skipAPICall("projectSetComplianceFramework", "for %s.", name)
+
+		// Record the expected settings states on top of the planned project settings
+		planned, ok := m.ProjectSettingsUpdated[project.PathWithNamespace]
+		if !ok {
+			planned = projectSettings
+		}
+		projected := *planned
+		projected.ComplianceFrameworks = []string{name}
+		m.ProjectSettingsUpdated[project.PathWithNamespace] = &projected
+
+		return nil
+	}
+
+	if err := m.frameworksClient.SetProjectComplianceFramework(project.ID, m.frameworkID); err != nil {
+		return fmt.Errorf("failed to set compliance framework %s of project %s: %v", name, project.PathWithNamespace, err)
+	}
+	m.logger.Infof("Set compliance framework %s of project %s.", name, project.PathWithNamespace)
+
+	// Record new settings states
+	projectSettings, err = m.GetProjectSettings(project)
+	if err != nil {
+		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+	}
+	m.ProjectSettingsUpdated[project.PathWithNamespace] = projectSettings
+
+	return nil
+}
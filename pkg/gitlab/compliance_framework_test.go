@@ -0,0 +1,81 @@
+package gitlab
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestEnsureComplianceFramework(t *testing.T) {
+	for _, dryrun := range []bool{true, false} {
+		client := newTestClient()
+		client.AddComplianceFramework("example", "SOX")
+		cfg := &config.Config{GroupName: "example/sub", ComplianceFramework: "SOX"}
+		project := gitlab.Project{ID: 11, PathWithNamespace: "example/sub/bar"}
+
+		manager := newTestManager(client, cfg)
+		if err := manager.EnsureComplianceFramework(project, dryrun); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		entries, err := manager.ChangeLogEntries(false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(entries) != 1 || entries[0].Setting != "compliance_frameworks" ||
+			!reflect.DeepEqual(entries[0].Added, []string{"SOX"}) {
+			t.Errorf("Expected SOX to be added to compliance_frameworks (dryrun %v), got %+v", dryrun, entries)
+		}
+
+		p, _, _ := client.Projects.GetProject(11, nil)
+		if dryrun {
+			if len(p.ComplianceFrameworks) != 0 {
+				t.Errorf("Expected a dryrun to leave the compliance frameworks untouched, got %v", p.ComplianceFrameworks)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(p.ComplianceFrameworks, []string{"SOX"}) {
+			t.Errorf("Expected compliance framework SOX, got %v", p.ComplianceFrameworks)
+		}
+
+		// A second run has nothing left to do
+		second := newTestManager(client, cfg)
+		if err := second.EnsureComplianceFramework(project, false); err != nil {
+			t.Fatalf("Expected no error on the second run, got %v", err)
+		}
+		if changes, err := second.HasChanges(); err != nil || changes {
+			t.Errorf("Expected no changes on the second run, got %v (%v)", changes, err)
+		}
+	}
+}
+
+func TestEnsureComplianceFrameworkUnknown(t *testing.T) {
+	client := newTestClient()
+	client.AddComplianceFramework("example", "SOX")
+	manager := newTestManager(client, &config.Config{GroupName: "example", ComplianceFramework: "HIPAA"})
+
+	if err := manager.EnsureComplianceFramework(gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}, false); err == nil {
+		t.Errorf("Expected an error for an unknown compliance framework")
+	}
+}
+
+func TestEnsureComplianceFrameworkUnavailable(t *testing.T) {
+	client := newTestClient()
+	client.DisableComplianceFrameworks()
+	manager := newTestManager(client, &config.Config{GroupName: "example", ComplianceFramework: "SOX"})
+
+	for _, id := range []int{10, 11} {
+		if err := manager.EnsureComplianceFramework(gitlab.Project{ID: id}, false); err != nil {
+			t.Errorf("Expected compliance frameworks to be skipped on GitLab CE, got %v", err)
+		}
+	}
+	if !manager.frameworksUnavailable {
+		t.Errorf("Expected compliance frameworks to be marked unavailable")
+	}
+	if changes, err := manager.HasChanges(); err != nil || changes {
+		t.Errorf("Expected no changes, got %v (%v)", changes, err)
+	}
+}
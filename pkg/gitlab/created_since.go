@@ -0,0 +1,59 @@
+package gitlab
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/internal/stringslice"
+)
+
+// ParseCreatedSince returns the creation time projects must not be older than. The value is
+// a number of days like 30d or a duration like 12h before now, or a date like 2024-01-31 or
+// RFC 3339 time. The empty value returns the zero time, which disables the filter.
+func ParseCreatedSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && strings.HasSuffix(value, "d") {
+		if days <= 0 {
+			return time.Time{}, fmt.Errorf("invalid created since %q, must be positive", value)
+		}
+		return now.AddDate(0, 0, -days), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid created since %q, must be positive", value)
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid created since %q, must be a number of days like 30d, a duration like 12h or a date like 2024-01-31", value)
+}
+
+// SetCreatedSince restricts GetProjects to projects created at or after since, leaving
+// established projects untouched. Whitelisted projects are selected regardless of their age.
+// The zero time selects projects of any age.
+func (m *ProjectManager) SetCreatedSince(since time.Time) {
+	m.createdSince = since
+}
+
+// createdTooEarly reports whether the project was created before the --created-since time
+// and isn't whitelisted. Projects without a creation time are taken as established.
+func (m *ProjectManager) createdTooEarly(p *gitlab.Project) bool {
+	if m.createdSince.IsZero() || stringslice.Contains(p.PathWithNamespace, m.config.ProjectWhitelist) {
+		return false
+	}
+
+	return p.CreatedAt == nil || p.CreatedAt.Before(m.createdSince)
+}
@@ -0,0 +1,94 @@
+package gitlab
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestParseCreatedSince(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{value: "", expected: time.Time{}},
+		{value: "30d", expected: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{value: "12h", expected: time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-01-31", expected: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-01-31T08:00:00Z", expected: time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC)},
+		{value: "0d", wantErr: true},
+		{value: "-5h", wantErr: true},
+		{value: "30 days", wantErr: true},
+		{value: "d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		actual, err := ParseCreatedSince(tt.value, now)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: Expected an error, got %v", tt.value, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: Expected no error, got %v", tt.value, err)
+			continue
+		}
+		if !actual.Equal(tt.expected) {
+			t.Errorf("%q: Expected %v, got %v", tt.value, tt.expected, actual)
+		}
+	}
+}
+
+func TestGetProjectsCreatedSince(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	old := since.AddDate(-1, 0, 0)
+	recent := since.AddDate(0, 0, 10)
+
+	tests := []struct {
+		name      string
+		whitelist []string
+		expected  []string
+	}{
+		{name: "new projects only", expected: []string{"example/new"}},
+		{name: "whitelisted established project", whitelist: []string{"example/foo", "example/new"}, expected: []string{"example/foo", "example/new"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient()
+			// example/sub/bar has no creation time and is taken as established
+			client.AddProject(&gitlab.Project{ID: 12, PathWithNamespace: "example/new", CreatedAt: &recent, Namespace: &gitlab.ProjectNamespace{ID: 1}})
+			project, _, _ := client.Projects.GetProject(10, nil)
+			project.CreatedAt = &old
+			client.AddProject(project)
+
+			manager := newTestManager(client, &config.Config{GroupName: "example", IncludeSubgroups: true, ProjectWhitelist: tt.whitelist})
+			manager.SetCreatedSince(since)
+
+			projects, err := manager.GetProjects()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var actual []string
+			for _, p := range projects {
+				actual = append(actual, p.PathWithNamespace)
+			}
+			if len(actual) != len(tt.expected) {
+				t.Fatalf("Expected projects %v, got %v", tt.expected, actual)
+			}
+			for i := range actual {
+				if actual[i] != tt.expected[i] {
+					t.Errorf("Expected projects %v, got %v", tt.expected, actual)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// DefaultBranchProtectionSettings is the recorded protection of the default branch of a project
+type DefaultBranchProtectionSettings struct {
+	Branch           string             `json:"branch"`
+	Protected        bool               `json:"protected"`
+	PushAccessLevel  config.AccessLevel `json:"push_access_level"`
+	MergeAccessLevel config.AccessLevel `json:"merge_access_level"`
+}
+
+// EnsureDefaultBranch migrates the default branch of the project to the configured one. It
+//  1. creates the new default branch from the old one, if it doesn't exist
+//  2. sets it as default branch of the project
+//  3. protects it with the access levels of protection if set, otherwise like the old one,
+//     unless it is configured in protected_branches
+//  4. deletes the old default branch, if delete_old_default is set
+//
+// The change of the default branch is recorded in the project settings change log. The
+// protection is also ensured for projects already using the default branch.
+func (m *ProjectManager) EnsureDefaultBranch(project gitlab.Project, dryrun bool) error {
+	if m.config.DefaultBranch == nil {
+		return nil
+	}
+	target := m.config.DefaultBranch.Name
+
+	projectSettings, err := m.GetProjectSettings(project)
+	if err != nil {
+		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	oldDefault := projectSettings.DefaultBranch
+	if oldDefault == "" {
+		m.logger.Debugf("Project %s has no default branch (empty repository), skipping migration.", project.PathWithNamespace)
+		return nil
+	}
+	if oldDefault == target {
+		m.logger.Debugf("Default branch of project %s is already %s.", project.PathWithNamespace, target)
+		return m.ensureDefaultBranchProtection(project, target, dryrun)
+	}
+
+	m.logger.Infof("Migrating default branch of project %s from %s to %s ...", project.PathWithNamespace, oldDefault, target)
+
+	// Record current settings states
+	m.ProjectSettingsOriginal[project.PathWithNamespace] = projectSettings
+
+	if err := m.ensureBranchExists(project, target, oldDefault, dryrun); err != nil {
+		return err
+	}
+
+	if dryrun {
+		m.skipAPICall("EditProject", "to set default branch %s.", target)
+
+		// Record the expected settings states to show the planned change
+		projected := &gitlab.Project{}
+		if err := applyOptions(projectSettings, &gitlab.EditProjectOptions{DefaultBranch: gitlab.String(target)}, projected); err != nil {
+			return err
+		}
+		m.ProjectSettingsUpdated[project.PathWithNamespace] = projected
+	} else {
+		if _, _, err := m.projectsClient.EditProject(project.ID, &gitlab.EditProjectOptions{DefaultBranch: gitlab.String(target)}, m.withContext()); err != nil {
+			return fmt.Errorf("failed to set default branch %s of project %s: %v", target, project.PathWithNamespace, err)
+		}
+
+		// Record new settings states
+		projectSettings, err = m.GetProjectSettings(project)
+		if err != nil {
+			return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+		}
+		m.ProjectSettingsUpdated[project.PathWithNamespace] = projectSettings
+	}
+
+	if m.config.DefaultBranch.Protection != nil {
+		if err := m.ensureDefaultBranchProtection(project, target, dryrun); err != nil {
+			return err
+		}
+	} else if err := m.copyBranchProtection(project, oldDefault, target, dryrun); err != nil {
+		return err
+	}
+
+	if m.config.DefaultBranch.DeleteOldDefault {
+		if err := m.deleteBranch(project, oldDefault, dryrun); err != nil {
+			return err
+		}
+	}
+
+	m.logger.Infof("Migrating default branch of project %s from %s to %s done.", project.PathWithNamespace, oldDefault, target)
+
+	return nil
+}
+
+// ensureBranchExists creates the branch from ref, if it doesn't exist yet
+func (m *ProjectManager) ensureBranchExists(project gitlab.Project, branch string, ref string, dryrun bool) error {
+	_, resp, err := m.branchesClient.GetBranch(project.ID, branch, m.withContext())
+	if err == nil {
+		m.logger.Debugf("Branch %s already exists.", branch)
+		return nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to check for branch %s existence: %v", branch, err)
+	}
+
+	if dryrun {
+		m.skipAPICall("CreateBranch", "to create branch %s from %s.", branch, ref)
+		return nil
+	}
+
+	opt := &gitlab.CreateBranchOptions{
+		Branch: gitlab.String(branch),
+		Ref:    gitlab.String(ref),
+	}
+	if _, _, err := m.branchesClient.CreateBranch(project.ID, opt, m.withContext()); err != nil {
+		return fmt.Errorf("failed to create branch %s from %s: %v", branch, ref, err)
+	}
+	m.logger.Infof("Created branch %s from %s.", branch, ref)
+
+	return nil
+}
+
+// copyBranchProtection protects the branch with the access levels of the protected branch
+// from. Branches configured in protected_branches are left to EnsureBranchesAndProtection.
+func (m *ProjectManager) copyBranchProtection(project gitlab.Project, from string, to string, dryrun bool) error {
+	for _, b := range m.config.ProtectedBranches {
+		if b.Name == to {
+			m.logger.Debugf("Protection of branch %s is configured in protected_branches.", to)
+			return nil
+		}
+	}
+
+	protectedBranch, resp, err := m.protectedBranchesClient.GetProtectedBranch(project.ID, from, m.withContext())
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			m.logger.Debugf("Branch %s is not protected, nothing to copy.", from)
+			return nil
+		}
+		return fmt.Errorf("failed to get protected branch %s: %v", from, err)
+	}
+
+	if _, resp, err := m.protectedBranchesClient.GetProtectedBranch(project.ID, to, m.withContext()); err == nil {
+		m.logger.Debugf("Branch %s is already protected.", to)
+		return nil
+	} else if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to get protected branch %s: %v", to, err)
+	}
+
+	if dryrun {
+		m.skipAPICall("ProtectRepositoryBranches", "to protect branch %s like %s.", to, from)
+		return nil
+	}
+
+	opt := &gitlab.ProtectRepositoryBranchesOptions{
+		Name:                      gitlab.String(to),
+		CodeOwnerApprovalRequired: gitlab.Bool(protectedBranch.CodeOwnerApprovalRequired),
+	}
+	if len(protectedBranch.PushAccessLevels) > 0 {
+		opt.PushAccessLevel = gitlab.AccessLevel(protectedBranch.PushAccessLevels[0].AccessLevel)
+	}
+	if len(protectedBranch.MergeAccessLevels) > 0 {
+		opt.MergeAccessLevel = gitlab.AccessLevel(protectedBranch.MergeAccessLevels[0].AccessLevel)
+	}
+
+	if _, _, err := m.protectedBranchesClient.ProtectRepositoryBranches(project.ID, opt, m.withContext()); err != nil {
+		return fmt.Errorf("failed to protect branch %s: %v", to, err)
+	}
+	m.logger.Infof("Protected branch %s like %s.", to, from)
+
+	return nil
+}
+
+// ensureDefaultBranchProtection (re)protects the default branch with the access levels of
+// default_branch.protection, unless it is already protected with them. The protection before
+// and after is recorded for the change log.
+func (m *ProjectManager) ensureDefaultBranchProtection(project gitlab.Project, branch string, dryrun bool) error {
+	protection := m.config.DefaultBranch.Protection
+	if protection == nil {
+		return nil
+	}
+
+	current := &DefaultBranchProtectionSettings{Branch: branch}
+	protectedBranch, resp, err := m.protectedBranchesClient.GetProtectedBranch(project.ID, branch, m.withContext())
+	if err == nil {
+		current.Protected = true
+		current.PushAccessLevel = accessLevelName(firstAccessLevel(protectedBranch.PushAccessLevels))
+		current.MergeAccessLevel = accessLevelName(firstAccessLevel(protectedBranch.MergeAccessLevels))
+	} else if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to get protected branch %s: %v", branch, err)
+	}
+	m.DefaultBranchProtectionOriginal[project.PathWithNamespace] = current
+
+	if current.Protected &&
+		compareAccessLevels(protectedBranch.PushAccessLevels, protection.PushAccessLevel) &&
+		compareAccessLevels(protectedBranch.MergeAccessLevels, protection.MergeAccessLevel) {
+		m.logger.Debugf("Default branch %s of project %s is already protected as configured.", branch, project.PathWithNamespace)
+		m.DefaultBranchProtectionUpdated[project.PathWithNamespace] = current
+		return nil
+	}
+
+	b := config.ProtectedBranch{
+		Name:             branch,
+		PushAccessLevel:  protection.PushAccessLevel,
+		MergeAccessLevel: protection.MergeAccessLevel,
+	}
+	if err := m.ensureBranchProtection(project, b, dryrun); err != nil {
+		return err
+	}
+	if !dryrun {
+		m.logger.Infof("Protected default branch %s of project %s.", branch, project.PathWithNamespace)
+	}
+
+	m.DefaultBranchProtectionUpdated[project.PathWithNamespace] = &DefaultBranchProtectionSettings{
+		Branch:           branch,
+		Protected:        true,
+		PushAccessLevel:  accessLevelName(*protection.PushAccessLevel.Value()),
+		MergeAccessLevel: accessLevelName(*protection.MergeAccessLevel.Value()),
+	}
+
+	return nil
+}
+
+// deleteBranch removes the protection of the branch (if present) and deletes it
+func (m *ProjectManager) deleteBranch(project gitlab.Project, branch string, dryrun bool) error {
+	if dryrun {
+		m.skipAPICall("UnprotectRepositoryBranches", "on %v branch.", branch)
+		m.skipAPICall("DeleteBranch", "on %v branch.", branch)
+		return nil
+	}
+
+	if resp, err := m.protectedBranchesClient.UnprotectRepositoryBranches(project.ID, branch, m.withContext()); err != nil &&
+		(resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("failed to unprotect branch %s before deletion: %v", branch, err)
+	}
+
+	if resp, err := m.branchesClient.DeleteBranch(project.ID, branch, m.withContext()); err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			m.logger.Debugf("Branch %s is already deleted.", branch)
+			return nil
+		}
+		return fmt.Errorf("failed to delete branch %s: %v", branch, err)
+	}
+	m.logger.Infof("Deleted branch %s.", branch)
+
+	return nil
+}
+
+// skipMissingDefaultBranch returns the options without the default_branch project setting if
+// the configured branch doesn't exist in the project, as GitLab rejects unknown branches. The
+// other settings are still applied.
+func (m *ProjectManager) skipMissingDefaultBranch(project gitlab.Project, current *gitlab.Project, options *gitlab.EditProjectOptions) (*gitlab.EditProjectOptions, error) {
+	if options.DefaultBranch == nil || *options.DefaultBranch == current.DefaultBranch {
+		return options, nil
+	}
+
+	branch := *options.DefaultBranch
+	_, resp, err := m.branchesClient.GetBranch(project.ID, branch, m.withContext())
+	if err == nil {
+		return options, nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return nil, fmt.Errorf("failed to check for branch %s existence: %v", branch, err)
+	}
+
+	m.warnf("Branch %s does not exist in project %s, skipping project_settings.default_branch.", branch, project.PathWithNamespace)
+	skipped := *options
+	skipped.DefaultBranch = nil
+
+	return &skipped, nil
+}
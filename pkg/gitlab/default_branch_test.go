@@ -0,0 +1,167 @@
+package gitlab
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestEnsureDefaultBranch(t *testing.T) {
+	for _, dryrun := range []bool{true, false} {
+		client := newTestClient()
+		client.AddBranch(10, "master")
+		client.AddProtectedBranch(10, &gitlab.ProtectedBranch{
+			Name:              "master",
+			PushAccessLevels:  []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.NoPermissions}},
+			MergeAccessLevels: []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.MaintainerPermissions}},
+		})
+		manager := newTestManager(client, &config.Config{
+			DefaultBranch: &config.DefaultBranchSettings{Name: "main", DeleteOldDefault: true},
+		})
+
+		project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+		if err := manager.EnsureDefaultBranch(project, dryrun); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if updated := manager.ProjectSettingsUpdated["example/foo"]; updated == nil || updated.DefaultBranch != "main" {
+			t.Errorf("Expected the default branch change to be recorded (dryrun %v), got %+v", dryrun, updated)
+		}
+
+		current, _, _ := client.Projects.GetProject(10, nil)
+		_, _, mainErr := client.Branches.GetBranch(10, "main")
+		_, _, masterErr := client.Branches.GetBranch(10, "master")
+		protected, _, protectedErr := client.ProtectedBranches.GetProtectedBranch(10, "main")
+
+		if dryrun {
+			if current.DefaultBranch != "master" || mainErr == nil || masterErr != nil || protectedErr == nil {
+				t.Errorf("Expected a dryrun to leave the project untouched")
+			}
+			continue
+		}
+
+		if current.DefaultBranch != "main" {
+			t.Errorf("Expected default branch main, got %s", current.DefaultBranch)
+		}
+		if mainErr != nil {
+			t.Errorf("Expected branch main to be created, got %v", mainErr)
+		}
+		if masterErr == nil {
+			t.Errorf("Expected the old default branch to be deleted")
+		}
+		if protectedErr != nil || !compareAccessLevels(protected.PushAccessLevels, "noone") ||
+			!compareAccessLevels(protected.MergeAccessLevels, config.AccessLevelMaintainer) {
+			t.Errorf("Expected main to be protected like master, got %+v (%v)", protected, protectedErr)
+		}
+
+		// A second run has nothing left to do
+		if err := manager.EnsureDefaultBranch(project, false); err != nil {
+			t.Errorf("Expected no error on the second run, got %v", err)
+		}
+	}
+}
+
+func TestUpdateProjectSettingsMissingDefaultBranch(t *testing.T) {
+	cfg := &config.Config{ProjectSettings: &gitlab.EditProjectOptions{
+		DefaultBranch:           gitlab.String("develop"),
+		SuggestionCommitMessage: gitlab.String("Apply suggestion"),
+	}}
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	// Without the branch only the other settings are applied
+	client := newTestClient()
+	if err := newTestManager(client, cfg).UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected the missing branch to be skipped, got %v", err)
+	}
+	p, _, _ := client.Projects.GetProject(10, nil)
+	if p.DefaultBranch != "master" || p.SuggestionCommitMessage != "Apply suggestion" {
+		t.Errorf("Expected only the suggestion commit message to be applied, got %q and %q", p.DefaultBranch, p.SuggestionCommitMessage)
+	}
+
+	// Once the branch exists, it becomes the default branch
+	client.AddBranch(10, "develop")
+	if err := newTestManager(client, cfg).UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	p, _, _ = client.Projects.GetProject(10, nil)
+	if p.DefaultBranch != "develop" {
+		t.Errorf("Expected the existing branch to become the default branch, got %q", p.DefaultBranch)
+	}
+}
+
+func TestEnsureDefaultBranchProtection(t *testing.T) {
+	protection := &config.DefaultBranchProtection{PushAccessLevel: config.AccessLevelMaintainer, MergeAccessLevel: config.AccessLevelDeveloper}
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	for _, dryrun := range []bool{true, false} {
+		client := newTestClient()
+		client.AddBranch(10, "master")
+		client.AddProtectedBranch(10, &gitlab.ProtectedBranch{
+			Name:              "master",
+			PushAccessLevels:  []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.NoPermissions}},
+			MergeAccessLevels: []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.MaintainerPermissions}},
+		})
+		manager := newTestManager(client, &config.Config{
+			DefaultBranch: &config.DefaultBranchSettings{Name: "main", Protection: protection},
+		})
+
+		// The migrated branch is protected as configured instead of like master
+		if err := manager.EnsureDefaultBranch(project, dryrun); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := &DefaultBranchProtectionSettings{Branch: "main", Protected: true, PushAccessLevel: "maintainer", MergeAccessLevel: "developer"}
+		if updated := manager.DefaultBranchProtectionUpdated["example/foo"]; *updated != *expected {
+			t.Errorf("Expected the protection %+v to be recorded (dryrun %v), got %+v", expected, dryrun, updated)
+		}
+		if original := manager.DefaultBranchProtectionOriginal["example/foo"]; original.Protected {
+			t.Errorf("Expected main to be recorded as unprotected before, got %+v", original)
+		}
+
+		protected, _, err := client.ProtectedBranches.GetProtectedBranch(10, "main")
+		if dryrun {
+			if err == nil {
+				t.Errorf("Expected a dryrun to leave main unprotected")
+			}
+			continue
+		}
+		if err != nil || !compareAccessLevels(protected.PushAccessLevels, config.AccessLevelMaintainer) ||
+			!compareAccessLevels(protected.MergeAccessLevels, config.AccessLevelDeveloper) {
+			t.Errorf("Expected main to be protected as configured, got %+v (%v)", protected, err)
+		}
+
+		// A second run changes nothing
+		manager = newTestManager(client, manager.config)
+		if err := manager.EnsureDefaultBranch(project, false); err != nil {
+			t.Fatalf("Expected no error on the second run, got %v", err)
+		}
+		if changes, _ := manager.HasChanges(); changes {
+			t.Errorf("Expected no changes on the second run")
+		}
+	}
+
+	// Projects already using the default branch get its protection updated
+	client := newTestClient()
+	client.AddBranch(10, "master")
+	client.AddProtectedBranch(10, &gitlab.ProtectedBranch{
+		Name:              "master",
+		PushAccessLevels:  []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.DeveloperPermissions}},
+		MergeAccessLevels: []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.DeveloperPermissions}},
+	})
+	manager := newTestManager(client, &config.Config{
+		DefaultBranch: &config.DefaultBranchSettings{Name: "master", Protection: protection},
+	})
+	if err := manager.EnsureDefaultBranch(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	entries, err := manager.ChangeLogEntries(false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 1 || entries[0].Subsection != "default_branch.protection" || entries[0].Setting != "push_access_level" ||
+		fmt.Sprint(entries[0].From) != "developer" || fmt.Sprint(entries[0].To) != "maintainer" {
+		t.Errorf("Expected the push access level change in the change log, got %+v", entries)
+	}
+}
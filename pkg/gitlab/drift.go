@@ -0,0 +1,139 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/sink"
+)
+
+// ReadProjectStates reads the project states written by WriteStateFile, e.g. by the previous
+// run. A missing state, like on the first run, is returned as nil without an error.
+func ReadProjectStates(location string) ([]ProjectState, error) {
+	body, err := sink.Read(location)
+	if err == sink.ErrNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %s: %v", location, err)
+	}
+
+	var states []ProjectState
+	if err := json.Unmarshal(body, &states); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state file %s: %v", location, err)
+	}
+
+	return states, nil
+}
+
+// DriftEntries compares the settings each project had after the previous run with the ones
+// found by this run before applying anything. Differences were made out of band, e.g. in the
+// GitLab UI. Only the settings of the project_settings and approval_settings config are
+// compared, as others like the last activity change all the time. The entries are sorted by
+// project, subsection and setting.
+func (m *ProjectManager) DriftEntries(previous []ProjectState) []ChangeLogEntry {
+	projectFields := configuredFields(m.config.ProjectSettings)
+	approvalFields := configuredFields(m.config.ApprovalSettings)
+
+	entries := make([]ChangeLogEntry, 0)
+	for _, state := range previous {
+		if current := m.ProjectSettingsOriginal[state.Project]; current != nil && state.ProjectSettings != nil {
+			entries = append(entries, driftEntries(state.Project, "project_settings", state.ProjectSettings, current, projectFields)...)
+		}
+		if current := m.ApprovalSettingsOriginal[state.Project]; current != nil && state.ApprovalSettings != nil {
+			entries = append(entries, driftEntries(state.Project, "approval_settings", state.ApprovalSettings, current, approvalFields)...)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Project != entries[j].Project {
+			return entries[i].Project < entries[j].Project
+		}
+		if entries[i].Subsection != entries[j].Subsection {
+			return entries[i].Subsection < entries[j].Subsection
+		}
+		return entries[i].Setting < entries[j].Setting
+	})
+
+	return entries
+}
+
+// driftEntries returns the fields of the previous and current settings structs which differ
+func driftEntries(project string, subsection string, previous interface{}, current interface{}, fields map[string]bool) []ChangeLogEntry {
+	var entries []ChangeLogEntry
+
+	prev := reflect.ValueOf(previous).Elem()
+	cur := reflect.ValueOf(current).Elem()
+	for field := range fields {
+		structField, ok := prev.Type().FieldByName(field)
+		if !ok {
+			// Not part of the settings returned by the API
+			continue
+		}
+
+		from := prev.FieldByName(field).Interface()
+		to := cur.FieldByName(field).Interface()
+		if reflect.DeepEqual(from, to) {
+			continue
+		}
+
+		entries = append(entries, ChangeLogEntry{
+			Project:    project,
+			Subsection: subsection,
+			Setting:    strings.Split(structField.Tag.Get("json"), ",")[0],
+			From:       from,
+			To:         to,
+		})
+	}
+
+	return entries
+}
+
+// GenerateDriftReport prints the settings changed out of band since the previous run to
+// console and warns about each of them
+func (m *ProjectManager) GenerateDriftReport(previous []ProjectState) {
+	entries := m.DriftEntries(previous)
+	if len(entries) == 0 {
+		fmt.Fprintf(m.out, "\nNo out of band changes since the last run.\n")
+		return
+	}
+
+	longest := 0
+	for _, entry := range entries {
+		if len(entry.Subsection+"."+entry.Setting) > longest {
+			longest = len(entry.Subsection + "." + entry.Setting)
+		}
+	}
+
+	fmt.Fprintf(m.out, "\nDRIFTED OUT OF BAND SINCE THE LAST RUN\n")
+	for i, entry := range entries {
+		if i == 0 || entries[i-1].Project != entry.Project {
+			if i != 0 {
+				fmt.Fprintf(m.out, "\n")
+			}
+			fmt.Fprintf(m.out, "  %s\n", entry.Project)
+		}
+
+		setting := entry.Subsection + "." + entry.Setting
+		fmt.Fprintf(m.out, "    %-*s\"%v\" => \"%v\"\n", longest+2, setting+":", driftValue(entry.From), driftValue(entry.To))
+		m.warn(entry.Project, "Setting %s of project %s was changed out of band since the last run: %v => %v",
+			setting, entry.Project, driftValue(entry.From), driftValue(entry.To))
+	}
+	fmt.Fprintf(m.out, "\n")
+}
+
+// driftValue dereferences pointer settings, e.g. the access levels, for display
+func driftValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		return rv.Elem().Interface()
+	}
+
+	return v
+}
@@ -0,0 +1,77 @@
+package gitlab
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+func TestDriftEntries(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{
+		ProjectSettings:  &gitlab.EditProjectOptions{WikiEnabled: gitlab.Bool(false), Visibility: gitlab.Visibility(gitlab.PrivateVisibility)},
+		ApprovalSettings: &gitlab.ChangeApprovalConfigurationOptions{ResetApprovalsOnPush: gitlab.Bool(true)},
+	})
+
+	// The state written by the previous run
+	previous := []ProjectState{
+		{
+			Project:          "example/foo",
+			ProjectSettings:  &gitlab.Project{WikiEnabled: false, Visibility: gitlab.PrivateVisibility, StarCount: 1},
+			ApprovalSettings: &gitlab.ProjectApprovals{ResetApprovalsOnPush: true},
+		},
+		{Project: "example/gone", ProjectSettings: &gitlab.Project{WikiEnabled: true}},
+	}
+
+	// Found by this run: the wiki was enabled in the UI, the star count is not enforced
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: true, Visibility: gitlab.PrivateVisibility, StarCount: 3}
+	manager.ApprovalSettingsOriginal["example/foo"] = &gitlab.ProjectApprovals{ResetApprovalsOnPush: false}
+	manager.ProjectSettingsOriginal["example/new"] = &gitlab.Project{WikiEnabled: true}
+
+	entries := manager.DriftEntries(previous)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 drifted settings, got %+v", entries)
+	}
+	if e := entries[0]; e.Subsection != "approval_settings" || e.Setting != "reset_approvals_on_push" || e.From != true || e.To != false {
+		t.Errorf("Expected reset_approvals_on_push to have drifted, got %+v", e)
+	}
+	if e := entries[1]; e.Subsection != "project_settings" || e.Setting != "wiki_enabled" || e.From != false || e.To != true {
+		t.Errorf("Expected wiki_enabled to have drifted, got %+v", e)
+	}
+
+	out := &bytes.Buffer{}
+	manager.out = out
+	manager.GenerateDriftReport(previous)
+	if !strings.Contains(out.String(), "DRIFTED OUT OF BAND SINCE THE LAST RUN\n  example/foo\n") ||
+		!strings.Contains(out.String(), "project_settings.wiki_enabled:") {
+		t.Errorf("Expected the drift to be reported, got:\n%s", out.String())
+	}
+}
+
+func TestReadProjectStates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	states, err := ReadProjectStates(path)
+	if err != nil || states != nil {
+		t.Fatalf("Expected no states and no error on the first run, got %v (%v)", states, err)
+	}
+
+	manager := newTestManager(fake.NewClient(), &config.Config{})
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: true}
+	if err := manager.WriteStateFile(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	states, err = ReadProjectStates(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(states) != 1 || states[0].Project != "example/foo" || !states[0].ProjectSettings.WikiEnabled {
+		t.Errorf("Expected the written states to be read, got %+v", states)
+	}
+}
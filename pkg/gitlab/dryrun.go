@@ -0,0 +1,54 @@
+package gitlab
+
+import (
+	"fmt"
+	"sort"
+)
+
+// skipAPICall logs the write API call skipped in dryrun, followed by the optional formatted
+// details, and counts it for the GenerateDryrunCallReport
+func (m *ProjectManager) skipAPICall(call string, format string, args ...interface{}) {
+	message := fmt.Sprintf("DRYRUN: Skipped executing API call [%s]", call)
+	if format != "" {
+		message += " " + fmt.Sprintf(format, args...)
+	}
+	m.logger.Info(message)
+
+	m.skippedCalls[call]++
+}
+
+// SkippedAPICalls returns the number of write API calls skipped in dryrun, per call
+func (m *ProjectManager) SkippedAPICalls() map[string]int {
+	calls := make(map[string]int, len(m.skippedCalls))
+	for call, count := range m.skippedCalls {
+		calls[call] = count
+	}
+
+	return calls
+}
+
+// GenerateDryrunCallReport prints to console the write API calls skipped in dryrun per call,
+// i.e. the calls a real run would make, e.g. to estimate the impact on an API rate limit
+func (m *ProjectManager) GenerateDryrunCallReport() {
+	if len(m.skippedCalls) == 0 {
+		fmt.Fprintf(m.out, "\nNo API calls would be made.\n")
+		return
+	}
+
+	var calls []string
+	var longest, total int
+	for call, count := range m.skippedCalls {
+		calls = append(calls, call)
+		total += count
+		if len(call) > longest {
+			longest = len(call)
+		}
+	}
+	sort.Strings(calls)
+
+	fmt.Fprintf(m.out, "\nDRYRUN API CALLS\n")
+	for _, call := range calls {
+		fmt.Fprintf(m.out, "  %-*s%d\n", longest+2, call+":", m.skippedCalls[call])
+	}
+	fmt.Fprintf(m.out, "  %-*s%d\n", longest+2, "total:", total)
+}
@@ -0,0 +1,65 @@
+package gitlab
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestGenerateDryrunCallReport(t *testing.T) {
+	client := newTestClient()
+	cfg := &config.Config{
+		GroupName: "example",
+		ProtectedBranches: []config.ProtectedBranch{
+			{Name: "master", PushAccessLevel: config.AccessLevelMaintainer, MergeAccessLevel: config.AccessLevelDeveloper},
+		},
+		ProjectSettings: &gitlab.EditProjectOptions{
+			WikiEnabled: gitlab.Bool(false),
+		},
+	}
+	manager := newTestManager(client, cfg)
+	out := &bytes.Buffer{}
+	manager.out = out
+
+	manager.GenerateDryrunCallReport()
+	if !strings.Contains(out.String(), "No API calls would be made.") {
+		t.Errorf("Expected no API calls before the sync, got %q", out.String())
+	}
+
+	projects, err := manager.GetProjects()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, project := range projects {
+		if err := manager.EnsureBranchesAndProtection(project, true); err != nil {
+			t.Errorf("Expected no error ensuring branches of %s, got %v", project.PathWithNamespace, err)
+		}
+		if err := manager.UpdateProjectSettings(project, true); err != nil {
+			t.Errorf("Expected no error updating settings of %s, got %v", project.PathWithNamespace, err)
+		}
+	}
+
+	// Protecting a branch unprotects it first, in case it exists with other access levels
+	n := len(projects)
+	expected := map[string]int{"EditProject": n, "ProtectRepositoryBranches": n, "UnprotectRepositoryBranches": n}
+	if calls := manager.SkippedAPICalls(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected skipped calls %v, got %v", expected, calls)
+	}
+
+	out.Reset()
+	manager.GenerateDryrunCallReport()
+	report := fmt.Sprintf("\nDRYRUN API CALLS\n"+
+		"  EditProject:                 %d\n"+
+		"  ProtectRepositoryBranches:   %d\n"+
+		"  UnprotectRepositoryBranches: %d\n"+
+		"  total:                       %d\n", n, n, n, 3*n)
+	if out.String() != report {
+		t.Errorf("Expected report\n%s\ngot\n%s", report, out.String())
+	}
+}
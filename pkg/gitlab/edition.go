@@ -0,0 +1,18 @@
+package gitlab
+
+import (
+	"fmt"
+)
+
+// IsEnterpriseEdition reports whether the GitLab instance runs the enterprise edition (EE),
+// returning its version as well. The edition is taken from the instance metadata, as the
+// version doesn't always tell, e.g. GitLab.com reports versions like 17.0.0-pre. Whether an
+// EE instance is licensed can only be checked by admins, so it is not.
+func IsEnterpriseEdition(client metadataClient) (bool, string, error) {
+	metadata, _, err := client.GetMetadata()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get GitLab metadata: %v", err)
+	}
+
+	return metadata.Enterprise, metadata.Version, nil
+}
@@ -0,0 +1,35 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+func TestIsEnterpriseEdition(t *testing.T) {
+	tests := []struct {
+		version    string
+		enterprise bool
+	}{
+		{version: "16.0.0-ee", enterprise: true},
+		{version: "16.0.0"},
+		{version: "15.11.3-pre"},
+		// GitLab.com runs EE without the -ee suffix
+		{version: "17.1.0-pre", enterprise: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			client := fake.NewClient()
+			client.SetVersion(tt.version, tt.enterprise)
+
+			enterprise, version, err := IsEnterpriseEdition(client.Metadata)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if enterprise != tt.enterprise || version != tt.version {
+				t.Errorf("Expected enterprise %v for %s, got %v (%s)", tt.enterprise, tt.version, enterprise, version)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package gitlab
+
+import (
+	"fmt"
+	"html"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// EmailSender sends html emails, e.g. the compliance report
+type EmailSender interface {
+	SendEmail(from string, to []string, subject string, body string) error
+}
+
+// SetEmailSender replaces the default sender, which uses the SMTP server of compliance.email
+func (m *ProjectManager) SetEmailSender(sender EmailSender) {
+	m.emailSender = sender
+}
+
+// smtpSender sends emails via the SMTP server of compliance.email, read when sending
+type smtpSender struct {
+	config *config.Config
+}
+
+// SendEmail sends the html body to the recipients
+func (s *smtpSender) SendEmail(from string, to []string, subject string, body string) error {
+	email := s.config.Compliance.Email
+
+	// Connect to remote SMTP server
+	smtpServer, err := smtp.Dial(email.Server + ":" + strconv.Itoa(email.Port))
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %v", err)
+	}
+	defer smtpServer.Close()
+
+	// Introduce with a resolvable hostname for relays with strict HELO checks, net/smtp
+	// defaults to localhost
+	if email.HeloHostname != "" {
+		if err := smtpServer.Hello(email.HeloHostname); err != nil {
+			return fmt.Errorf("failed to greet smtp server as %s: %v", email.HeloHostname, err)
+		}
+	}
+
+	// Set the sender
+	if err := smtpServer.Mail(from); err != nil {
+		return fmt.Errorf("failed to set sender %s: %v", from, err)
+	}
+
+	// Set the recipient
+	if err := smtpServer.Rcpt(strings.Join(to, ",")); err != nil {
+		return fmt.Errorf("failed to set recipients %v: %v", to, err)
+	}
+
+	// Send the email body
+	smtpWriter, err := smtpServer.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start email data: %v", err)
+	}
+
+	message := "Content-Type: text/html; charset=UTF-8\r\n"
+	message += fmt.Sprintf("From: %s\r\n", from)
+	message += fmt.Sprintf("To: %s\r\n", strings.Join(to, ","))
+	message += fmt.Sprintf("Subject: %s\r\n", subject)
+	message += "<html>\r\n"
+	message += " <head>\r\n"
+	message += fmt.Sprintf("  <title>%s</title>\r\n", subject)
+	message += " </head>\r\n"
+	message += " <body>\r\n"
+	message += fmt.Sprintf("\r\n%s\r\n", body)
+	message += " </body>\r\n"
+	message += "</html>"
+
+	if _, err := smtpWriter.Write([]byte(message)); err != nil {
+		return fmt.Errorf("failed to write email: %v", err)
+	}
+	if err := smtpWriter.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	// Send the QUIT command and close the connection.
+	return smtpServer.Quit()
+}
+
+// complianceSummaryEmail returns the subject and html body of the short email sent instead of
+// the compliance report with compliance.email.send_on_success set to summary. It only confirms
+// the run, with its time and the number of checked projects and settings.
+func (m *ProjectManager) complianceSummaryEmail(results []ComplianceResult) (string, string) {
+	projects := make(map[string]bool)
+	for _, result := range results {
+		projects[result.Project] = true
+	}
+
+	subject := fmt.Sprintf("Compliance Report: all %d projects compliant", len(projects))
+	body := fmt.Sprintf("<h2>Compliance Report</h2>\n"+
+		"<p>All %d projects are compliant, %d mandatory settings checked.</p>\n"+
+		"<p>Group: %s<br>Run at: %s</p>\n",
+		len(projects), len(results), html.EscapeString(m.config.GroupName), m.now().UTC().Format(time.RFC3339))
+
+	return subject, body
+}
+
+// allCompliant reports whether none of the compliance results is non-compliant
+func allCompliant(results []ComplianceResult) bool {
+	for _, result := range results {
+		if !result.Compliant {
+			return false
+		}
+	}
+
+	return true
+}
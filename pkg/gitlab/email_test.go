@@ -0,0 +1,197 @@
+package gitlab
+
+import (
+	"errors"
+	"net"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+func TestGenerateComplianceEmail(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Email: config.EmailConfig{
+				From:   "enforcer@example.com",
+				Server: "smtp.example.com",
+				Port:   25,
+				To:     []string{"team@example.com", "security@example.com"},
+			},
+			Mandatory: map[string]map[string]interface{}{
+				"project_settings": {"wiki_enabled": false},
+			},
+		},
+	})
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: true}
+	sender := &fake.EmailSender{}
+	manager.SetEmailSender(sender)
+
+	if err := manager.GenerateComplianceEmail(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(sender.Sent) != 1 {
+		t.Fatalf("Expected one email, got %d", len(sender.Sent))
+	}
+	email := sender.Sent[0]
+	if email.From != "enforcer@example.com" || !reflect.DeepEqual(email.To, []string{"team@example.com", "security@example.com"}) {
+		t.Errorf("Expected the email from and to the configured addresses, got %+v", email)
+	}
+	if email.Subject != "Compliance Report" || !strings.Contains(email.Body, "example/foo") {
+		t.Errorf("Expected the compliance report of example/foo, got %q: %s", email.Subject, email.Body)
+	}
+}
+
+func TestGenerateComplianceEmailFailure(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Email: config.EmailConfig{From: "enforcer@example.com", Server: "smtp.example.com", Port: 25},
+		},
+	})
+	manager.SetEmailSender(&fake.EmailSender{Err: errors.New("554 relay denied")})
+
+	if err := manager.GenerateComplianceEmail(); err == nil || !strings.Contains(err.Error(), "554 relay denied") {
+		t.Errorf("Expected the error of the sender, got %v", err)
+	}
+}
+
+func TestGenerateComplianceEmailSendOnSuccess(t *testing.T) {
+	tests := []struct {
+		sendOnSuccess string
+		wikiEnabled   bool
+		subject       string
+		body          string
+	}{
+		{sendOnSuccess: "", subject: "Compliance Report", body: "wiki_enabled"},
+		{sendOnSuccess: config.SendOnSuccessSummary, subject: "Compliance Report: all 2 projects compliant", body: "Run at: 2026-10-15T06:00:00Z"},
+		{sendOnSuccess: config.SendOnSuccessNone},
+		// The full report is sent as long as a setting is non-compliant
+		{sendOnSuccess: config.SendOnSuccessNone, wikiEnabled: true, subject: "Compliance Report", body: "wiki_enabled"},
+	}
+
+	for _, tt := range tests {
+		manager := newTestManager(fake.NewClient(), &config.Config{
+			GroupName: "example",
+			Compliance: &config.ComplianceSettings{
+				Email: config.EmailConfig{
+					From:          "enforcer@example.com",
+					Server:        "smtp.example.com",
+					Port:          25,
+					To:            []string{"team@example.com"},
+					SendOnSuccess: tt.sendOnSuccess,
+				},
+				Mandatory: map[string]map[string]interface{}{
+					"project_settings": {"wiki_enabled": false},
+				},
+			},
+		})
+		manager.now = func() time.Time { return time.Date(2026, 10, 15, 8, 0, 0, 0, time.FixedZone("CEST", 2*60*60)) }
+		manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: tt.wikiEnabled}
+		manager.ProjectSettingsOriginal["example/sub/bar"] = &gitlab.Project{}
+		sender := &fake.EmailSender{}
+		manager.SetEmailSender(sender)
+
+		if err := manager.GenerateComplianceEmail(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if tt.subject == "" {
+			if len(sender.Sent) != 0 {
+				t.Errorf("Expected no email with send_on_success %q, got %+v", tt.sendOnSuccess, sender.Sent)
+			}
+			continue
+		}
+		if len(sender.Sent) != 1 {
+			t.Fatalf("Expected one email with send_on_success %q, got %d", tt.sendOnSuccess, len(sender.Sent))
+		}
+		if email := sender.Sent[0]; email.Subject != tt.subject || !strings.Contains(email.Body, tt.body) {
+			t.Errorf("Expected the email %q containing %q with send_on_success %q, got %q: %s",
+				tt.subject, tt.body, tt.sendOnSuccess, email.Subject, email.Body)
+		}
+	}
+}
+
+// serveSMTP accepts a single SMTP session on a local port, answering every command with
+// success, and sends the received commands to the returned channel once the session ends
+func serveSMTP(t *testing.T) (int, <-chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	commands := make(chan []string, 1)
+	go func() {
+		var received []string
+		defer func() { commands <- received }()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 smtp.example.com ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			received = append(received, line)
+
+			switch command := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); command {
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				if _, err := text.ReadDotLines(); err != nil {
+					return
+				}
+				text.PrintfLine("250 queued")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, commands
+}
+
+func TestSendEmailHeloHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		expected string
+	}{
+		{hostname: "", expected: "EHLO localhost"},
+		{hostname: "enforcer.example.com", expected: "EHLO enforcer.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			port, commands := serveSMTP(t)
+			manager := newTestManager(fake.NewClient(), &config.Config{
+				Compliance: &config.ComplianceSettings{
+					Email: config.EmailConfig{Server: "127.0.0.1", Port: port, HeloHostname: tt.hostname},
+				},
+			})
+
+			if err := manager.SendEmail([]string{"team@example.com"}, "enforcer@example.com", "Compliance Report", "<p>ok</p>"); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			received := <-commands
+			if len(received) == 0 || received[0] != tt.expected {
+				t.Errorf("Expected the session to start with %q, got %q", tt.expected, received)
+			}
+		})
+	}
+}
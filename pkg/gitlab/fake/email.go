@@ -0,0 +1,31 @@
+package fake
+
+import "sync"
+
+// Email is an email sent by an EmailSender
+type Email struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// EmailSender records the emails sent instead of sending them. With Err set sending fails.
+type EmailSender struct {
+	mu   sync.Mutex
+	Sent []Email
+	Err  error
+}
+
+// SendEmail records the email, unless Err is set
+func (s *EmailSender) SendEmail(from string, to []string, subject string, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+	s.Sent = append(s.Sent, Email{From: from, To: append([]string{}, to...), Subject: subject, Body: body})
+
+	return nil
+}
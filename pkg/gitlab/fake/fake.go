@@ -0,0 +1,475 @@
+// Package fake provides an in-memory GitLab client that satisfies the client
+// interfaces consumed by the gitlab.ProjectManager. It is meant to be used in
+// tests only.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// Client bundles the fake services in the same layout as *gitlab.Client, so
+// the services can be handed to gitlab.NewProjectManager the same way.
+type Client struct {
+	Groups              *GroupsService
+	Projects            *ProjectsService
+	ProtectedBranches   *ProtectedBranchesService
+	ProtectedTags       *ProtectedTagsService
+	Branches            *BranchesService
+	ProjectAccessTokens *ProjectAccessTokensService
+	RepositoryFiles     *RepositoryFilesService
+	Repositories        *RepositoriesService
+	// ComplianceFrameworks fakes the GraphQL API used to assign compliance frameworks
+	ComplianceFrameworks *ComplianceFrameworksService
+	Metadata             *MetadataService
+	GroupVariables       *GroupVariablesService
+	ProjectVariables     *ProjectVariablesService
+	// ApprovalSettingLocks fakes the merge request approval settings API, which go-gitlab lacks
+	ApprovalSettingLocks *ApprovalSettingLocksService
+	ProjectMirrors       *ProjectMirrorsService
+	GroupMembers         *GroupMembersService
+	Users                *UsersService
+
+	store *store
+}
+
+// store holds the state shared between all services of a Client
+type store struct {
+	mu                sync.Mutex
+	groups            map[int]*gitlab.Group
+	projects          map[int]*gitlab.Project
+	approvals         map[int]*gitlab.ProjectApprovals
+	languages         map[int]gitlab.ProjectLanguages
+	branches          map[int]map[string]*gitlab.Branch
+	protectedBranches map[int]map[string]*gitlab.ProtectedBranch
+	protectedTags     map[int]map[string]*gitlab.ProtectedTag
+	accessTokens      map[int][]*gitlab.ProjectAccessToken
+	files             map[int]map[string]map[string]string
+	approvalRules     map[int][]*gitlab.ProjectApprovalRule
+	frameworks        map[string]map[string]string
+	noFrameworks      bool
+	noServiceDesk     bool
+	legacyEmails      bool
+	version           string
+	enterprise        bool
+	groupVariables    map[int][]*gitlab.GroupVariable
+	projectVariables  map[int][]*gitlab.ProjectVariable
+	approvalLocks     map[int]map[string]string
+	mirrors           map[int][]*gitlab.ProjectMirror
+	groupMembers      map[int][]*gitlab.GroupMember
+	users             map[int]*gitlab.User
+	admin             bool
+	nextTokenID       int
+	nextID            int
+}
+
+// NewClient returns a new, empty fake Client
+func NewClient() *Client {
+	s := &store{
+		groups:            make(map[int]*gitlab.Group),
+		projects:          make(map[int]*gitlab.Project),
+		approvals:         make(map[int]*gitlab.ProjectApprovals),
+		languages:         make(map[int]gitlab.ProjectLanguages),
+		branches:          make(map[int]map[string]*gitlab.Branch),
+		protectedBranches: make(map[int]map[string]*gitlab.ProtectedBranch),
+		protectedTags:     make(map[int]map[string]*gitlab.ProtectedTag),
+		accessTokens:      make(map[int][]*gitlab.ProjectAccessToken),
+		files:             make(map[int]map[string]map[string]string),
+		approvalRules:     make(map[int][]*gitlab.ProjectApprovalRule),
+		frameworks:        make(map[string]map[string]string),
+		version:           "16.0.0-ee",
+		enterprise:        true,
+		groupVariables:    make(map[int][]*gitlab.GroupVariable),
+		projectVariables:  make(map[int][]*gitlab.ProjectVariable),
+		approvalLocks:     make(map[int]map[string]string),
+		mirrors:           make(map[int][]*gitlab.ProjectMirror),
+		groupMembers:      make(map[int][]*gitlab.GroupMember),
+		users:             make(map[int]*gitlab.User),
+		nextTokenID:       1,
+		nextID:            1,
+	}
+
+	return &Client{
+		Groups:               &GroupsService{store: s},
+		Projects:             &ProjectsService{store: s},
+		ProtectedBranches:    &ProtectedBranchesService{store: s},
+		ProtectedTags:        &ProtectedTagsService{store: s},
+		Branches:             &BranchesService{store: s},
+		ProjectAccessTokens:  &ProjectAccessTokensService{store: s},
+		RepositoryFiles:      &RepositoryFilesService{store: s},
+		Repositories:         &RepositoriesService{store: s},
+		ComplianceFrameworks: &ComplianceFrameworksService{store: s},
+		Metadata:             &MetadataService{store: s},
+		GroupVariables:       &GroupVariablesService{store: s},
+		ProjectVariables:     &ProjectVariablesService{store: s},
+		ApprovalSettingLocks: &ApprovalSettingLocksService{store: s},
+		ProjectMirrors:       &ProjectMirrorsService{store: s},
+		GroupMembers:         &GroupMembersService{store: s},
+		Users:                &UsersService{store: s},
+		store:                s,
+	}
+}
+
+// AddGroup registers a group. The FullPath of the group is used to resolve it by name,
+// ParentID to find its subgroups.
+func (c *Client) AddGroup(group *gitlab.Group) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.groups[group.ID] = group
+}
+
+// AddProject registers a project. Its Namespace.ID must reference the group the project
+// belongs to. Unless already present, the default branch of the project is created and
+// empty approval settings are initialized.
+func (c *Client) AddProject(project *gitlab.Project) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.projects[project.ID] = project
+
+	if _, ok := c.store.approvals[project.ID]; !ok {
+		c.store.approvals[project.ID] = &gitlab.ProjectApprovals{}
+	}
+	if _, ok := c.store.branches[project.ID]; !ok {
+		c.store.branches[project.ID] = make(map[string]*gitlab.Branch)
+	}
+	if project.DefaultBranch != "" {
+		c.store.branches[project.ID][project.DefaultBranch] = &gitlab.Branch{Name: project.DefaultBranch, Default: true}
+	}
+	if _, ok := c.store.protectedBranches[project.ID]; !ok {
+		c.store.protectedBranches[project.ID] = make(map[string]*gitlab.ProtectedBranch)
+	}
+	if _, ok := c.store.protectedTags[project.ID]; !ok {
+		c.store.protectedTags[project.ID] = make(map[string]*gitlab.ProtectedTag)
+	}
+}
+
+// SetApprovals replaces the approval settings of the given project
+func (c *Client) SetApprovals(pid int, approvals *gitlab.ProjectApprovals) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.approvals[pid] = approvals
+}
+
+// SetLanguages replaces the detected languages of the given project, by percentage
+func (c *Client) SetLanguages(pid int, languages gitlab.ProjectLanguages) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.languages[pid] = languages
+}
+
+// LockApprovalSetting locks the approval setting with the approval_settings key (e.g.
+// reset_approvals_on_push) of the project, as inherited from the given level. Like GitLab,
+// changes of locked settings are acknowledged but not applied.
+func (c *Client) LockApprovalSetting(pid int, key string, inheritedFrom string) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	if c.store.approvalLocks[pid] == nil {
+		c.store.approvalLocks[pid] = make(map[string]string)
+	}
+	c.store.approvalLocks[pid][key] = inheritedFrom
+}
+
+// AddBranch creates a branch in the given project
+func (c *Client) AddBranch(pid int, name string) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	if _, ok := c.store.branches[pid]; !ok {
+		c.store.branches[pid] = make(map[string]*gitlab.Branch)
+	}
+	c.store.branches[pid][name] = &gitlab.Branch{Name: name}
+}
+
+// AddProtectedBranch protects a branch in the given project. Unless set, the protected
+// branch is assigned an ID.
+func (c *Client) AddProtectedBranch(pid int, branch *gitlab.ProtectedBranch) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	if _, ok := c.store.protectedBranches[pid]; !ok {
+		c.store.protectedBranches[pid] = make(map[string]*gitlab.ProtectedBranch)
+	}
+	if branch.ID == 0 {
+		branch.ID = c.store.newID()
+	}
+	c.store.assignAccessLevelIDs(branch)
+	c.store.protectedBranches[pid][branch.Name] = branch
+}
+
+// AddProtectedTag protects a tag in the given project
+func (c *Client) AddProtectedTag(pid int, tag *gitlab.ProtectedTag) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	if _, ok := c.store.protectedTags[pid]; !ok {
+		c.store.protectedTags[pid] = make(map[string]*gitlab.ProtectedTag)
+	}
+	c.store.protectedTags[pid][tag.Name] = tag
+}
+
+// AddProjectAccessToken adds an access token to the given project
+func (c *Client) AddProjectAccessToken(pid int, token *gitlab.ProjectAccessToken) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.accessTokens[pid] = append(c.store.accessTokens[pid], token)
+}
+
+// AddApprovalRule adds a project approval rule to the given project and assigns it an ID
+func (c *Client) AddApprovalRule(pid int, rule *gitlab.ProjectApprovalRule) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	rule.ID = c.store.newID()
+	c.store.approvalRules[pid] = append(c.store.approvalRules[pid], rule)
+}
+
+// AddProjectMirror adds a remote mirror to the project
+func (c *Client) AddProjectMirror(pid int, mirror *gitlab.ProjectMirror) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	mirror.ID = c.store.newID()
+	c.store.mirrors[pid] = append(c.store.mirrors[pid], mirror)
+}
+
+// AddComplianceFramework adds a compliance framework to the namespace and returns its
+// global ID
+func (c *Client) AddComplianceFramework(namespace string, name string) string {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	if _, ok := c.store.frameworks[namespace]; !ok {
+		c.store.frameworks[namespace] = make(map[string]string)
+	}
+	id := fmt.Sprintf("gid://gitlab/ComplianceManagement::Framework/%d", c.store.newID())
+	c.store.frameworks[namespace][name] = id
+
+	return id
+}
+
+// AddGroupVariable adds a CI/CD variable to the group
+func (c *Client) AddGroupVariable(groupID int, v *gitlab.GroupVariable) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.groupVariables[groupID] = append(c.store.groupVariables[groupID], v)
+}
+
+// AddProjectVariable adds a CI/CD variable to the project
+func (c *Client) AddProjectVariable(projectID int, v *gitlab.ProjectVariable) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.projectVariables[projectID] = append(c.store.projectVariables[projectID], v)
+}
+
+// AddGroupMember adds a user as direct member to the group
+func (c *Client) AddGroupMember(groupID int, member *gitlab.GroupMember) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.groupMembers[groupID] = append(c.store.groupMembers[groupID], member)
+}
+
+// AddUser registers a user, e.g. with TwoFactorEnabled, which only administrators can read
+func (c *Client) AddUser(user *gitlab.User) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.users[user.ID] = user
+}
+
+// SetAdmin makes the user of the client an administrator, who can read the two-factor
+// authentication state of users
+func (c *Client) SetAdmin(admin bool) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.admin = admin
+}
+
+// SetVersion sets the GitLab version and edition, e.g. 16.0.0 for GitLab CE (default:
+// 16.0.0-ee, enterprise)
+func (c *Client) SetVersion(version string, enterprise bool) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.version = version
+	c.store.enterprise = enterprise
+}
+
+// DisableComplianceFrameworks makes the GraphQL API fail like on GitLab CE, which lacks
+// compliance frameworks
+func (c *Client) DisableComplianceFrameworks() {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.noFrameworks = true
+}
+
+// DisableServiceDesk makes enabling Service Desk have no effect, like on GitLab instances
+// without incoming email
+func (c *Client) DisableServiceDesk() {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.noServiceDesk = true
+}
+
+// UseLegacyEmailSettings makes the projects only know emails_disabled, like on GitLab
+// instances before 16.5, which ignore emails_enabled and don't return it
+func (c *Client) UseLegacyEmailSettings() {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	c.store.legacyEmails = true
+}
+
+// AddFile adds a file with the content to the branch of the given project. The branch
+// is created if it doesn't exist.
+func (c *Client) AddFile(pid int, branch string, path string, content string) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	if _, ok := c.store.branches[pid]; !ok {
+		c.store.branches[pid] = make(map[string]*gitlab.Branch)
+	}
+	if _, ok := c.store.branches[pid][branch]; !ok {
+		c.store.branches[pid][branch] = &gitlab.Branch{Name: branch}
+	}
+	c.store.setFile(pid, branch, path, content)
+}
+
+// newID returns a new ID for protected branches and approval rules. The caller must hold
+// the lock.
+func (s *store) newID() int {
+	id := s.nextID
+	s.nextID++
+
+	return id
+}
+
+// setFile stores the content of the file in the branch. The caller must hold the lock.
+func (s *store) setFile(pid int, branch string, path string, content string) {
+	if _, ok := s.files[pid]; !ok {
+		s.files[pid] = make(map[string]map[string]string)
+	}
+	if _, ok := s.files[pid][branch]; !ok {
+		s.files[pid][branch] = make(map[string]string)
+	}
+	s.files[pid][branch][path] = content
+}
+
+// findGroup resolves a group by ID or by its (possibly escaped) full path. The caller
+// must hold the lock.
+func (s *store) findGroup(gid interface{}) (*gitlab.Group, bool) {
+	switch v := gid.(type) {
+	case int:
+		g, ok := s.groups[v]
+		return g, ok
+	case string:
+		if id, err := strconv.Atoi(v); err == nil {
+			g, ok := s.groups[id]
+			return g, ok
+		}
+
+		path, err := url.PathUnescape(v)
+		if err != nil {
+			return nil, false
+		}
+		for _, g := range s.groups {
+			if g.FullPath == path {
+				return g, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// findProject resolves a project by ID or by its path with namespace. The caller must
+// hold the lock.
+func (s *store) findProject(pid interface{}) (*gitlab.Project, bool) {
+	switch v := pid.(type) {
+	case int:
+		p, ok := s.projects[v]
+		return p, ok
+	case string:
+		if id, err := strconv.Atoi(v); err == nil {
+			p, ok := s.projects[id]
+			return p, ok
+		}
+
+		path, err := url.PathUnescape(v)
+		if err != nil {
+			return nil, false
+		}
+		for _, p := range s.projects {
+			if p.PathWithNamespace == path {
+				return p, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// hasTopics reports whether the project is tagged with all of the topics, like the topic
+// parameter of the project lists
+func hasTopics(p *gitlab.Project, topics []string) bool {
+	for _, topic := range topics {
+		found := false
+		for _, t := range p.Topics {
+			found = found || t == topic
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// clone deep copies src into dst using their JSON representation, so callers never
+// share pointers with the store (which is what a real API client guarantees as well).
+func clone(src, dst interface{}) {
+	b, err := json.Marshal(src)
+	if err != nil {
+		panic(fmt.Sprintf("fake: failed to marshal %T: %v", src, err))
+	}
+	if err := json.Unmarshal(b, dst); err != nil {
+		panic(fmt.Sprintf("fake: failed to unmarshal into %T: %v", dst, err))
+	}
+}
+
+func newResponse(method, path string, statusCode int) *gitlab.Response {
+	return &gitlab.Response{
+		Response: &http.Response{
+			Status:     http.StatusText(statusCode),
+			StatusCode: statusCode,
+			Request: &http.Request{
+				Method: method,
+				URL:    &url.URL{Scheme: "https", Host: "gitlab.fake", Path: "/api/v4/" + path},
+			},
+		},
+		TotalPages:  1,
+		CurrentPage: 1,
+	}
+}
+
+func errorResponse(method, path string, statusCode int, message string) (*gitlab.Response, error) {
+	resp := newResponse(method, path, statusCode)
+	return resp, &gitlab.ErrorResponse{Response: resp.Response, Message: message}
+}
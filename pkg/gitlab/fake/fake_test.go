@@ -0,0 +1,60 @@
+package fake
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestGetProjectNotFound(t *testing.T) {
+	client := NewClient()
+
+	_, resp, err := client.Projects.GetProject(42, nil)
+	if err == nil {
+		t.Fatalf("Expected an error for an unknown project, got none")
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 response, got %v", resp)
+	}
+	if err.Error() == "" {
+		t.Errorf("Expected a descriptive error message")
+	}
+}
+
+func TestEditProjectDoesNotShareState(t *testing.T) {
+	client := NewClient()
+	client.AddProject(&gitlab.Project{ID: 1, PathWithNamespace: "example/foo", WikiEnabled: true})
+
+	before, _, err := client.Projects.GetProject("example%2Ffoo", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, _, err := client.Projects.EditProject(1, &gitlab.EditProjectOptions{WikiEnabled: gitlab.Bool(false)}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	after, _, _ := client.Projects.GetProject(1, nil)
+	if !before.WikiEnabled {
+		t.Errorf("Expected previously returned project to be unaffected by the edit")
+	}
+	if after.WikiEnabled {
+		t.Errorf("Expected wiki to be disabled after the edit")
+	}
+}
+
+func TestProtectRepositoryBranchesConflict(t *testing.T) {
+	client := NewClient()
+	client.AddProject(&gitlab.Project{ID: 1, DefaultBranch: "master"})
+
+	opt := &gitlab.ProtectRepositoryBranchesOptions{Name: gitlab.String("master")}
+	if _, _, err := client.ProtectedBranches.ProtectRepositoryBranches(1, opt); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, resp, err := client.ProtectedBranches.ProtectRepositoryBranches(1, opt)
+	if err == nil || resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a 409 when protecting a branch twice, got %v", err)
+	}
+}
@@ -0,0 +1,1680 @@
+package fake
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// GroupsService fakes the parts of gitlab.GroupsService used by the enforcer
+type GroupsService struct {
+	store *store
+}
+
+// GetGroup returns the group identified by ID or full path
+func (s *GroupsService) GetGroup(gid interface{}, opt *gitlab.GetGroupOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Group, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v", gid)
+	g, ok := s.store.findGroup(gid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Group Not Found}")
+		return nil, resp, err
+	}
+
+	group := &gitlab.Group{}
+	clone(g, group)
+
+	return group, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// UpdateGroup applies the options to the group
+func (s *GroupsService) UpdateGroup(gid interface{}, opt *gitlab.UpdateGroupOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Group, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v", gid)
+	g, ok := s.store.findGroup(gid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPut, path, http.StatusNotFound, "{message: 404 Group Not Found}")
+		return nil, resp, err
+	}
+
+	// Options and group share their json field names
+	clone(opt, g)
+
+	group := &gitlab.Group{}
+	clone(g, group)
+
+	return group, newResponse(http.MethodPut, path, http.StatusOK), nil
+}
+
+// ListGroupProjects returns all projects of the group, honoring the Archived and
+// IncludeSubgroups options. All results are returned on a single page.
+func (s *GroupsService) ListGroupProjects(gid interface{}, opt *gitlab.ListGroupProjectsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/projects", gid)
+	g, ok := s.store.findGroup(gid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Group Not Found}")
+		return nil, resp, err
+	}
+
+	groupIDs := map[int]bool{g.ID: true}
+	if opt != nil && opt.IncludeSubGroups != nil && *opt.IncludeSubGroups {
+		for _, id := range s.store.descendants(g.ID) {
+			groupIDs[id] = true
+		}
+	}
+
+	projects := make([]*gitlab.Project, 0)
+	for _, id := range s.store.projectIDs() {
+		p := s.store.projects[id]
+		if p.Namespace == nil || !groupIDs[p.Namespace.ID] {
+			continue
+		}
+		if opt != nil && opt.Archived != nil && *opt.Archived != p.Archived {
+			continue
+		}
+		if opt != nil && opt.Topic != nil && !hasTopics(p, strings.Split(*opt.Topic, ",")) {
+			continue
+		}
+
+		project := &gitlab.Project{}
+		clone(p, project)
+		projects = append(projects, project)
+	}
+
+	return projects, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// ListSubGroups returns the direct subgroups of the group
+func (s *GroupsService) ListSubGroups(gid interface{}, opt *gitlab.ListSubGroupsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Group, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/subgroups", gid)
+	g, ok := s.store.findGroup(gid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Group Not Found}")
+		return nil, resp, err
+	}
+
+	groups := make([]*gitlab.Group, 0)
+	for _, id := range s.store.groupIDs() {
+		if s.store.groups[id].ParentID != g.ID {
+			continue
+		}
+
+		group := &gitlab.Group{}
+		clone(s.store.groups[id], group)
+		groups = append(groups, group)
+	}
+
+	return groups, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// ListGroupMembers returns the direct members of the group on a single page
+func (s *GroupsService) ListGroupMembers(gid interface{}, opt *gitlab.ListGroupMembersOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.GroupMember, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/members", gid)
+	g, ok := s.store.findGroup(gid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Group Not Found}")
+		return nil, resp, err
+	}
+
+	members := []*gitlab.GroupMember{}
+	clone(s.store.groupMembers[g.ID], &members)
+
+	return members, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// ProjectsService fakes the parts of gitlab.ProjectsService used by the enforcer
+type ProjectsService struct {
+	store *store
+}
+
+// ListUserProjects returns the projects in the personal namespace of the user, identified
+// by username or by the ID of the project owner. Users without projects are unknown. All
+// results are returned on a single page.
+func (s *ProjectsService) ListUserProjects(uid interface{}, opt *gitlab.ListProjectsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("users/%v/projects", uid)
+	projects := make([]*gitlab.Project, 0)
+	for _, id := range s.store.projectIDs() {
+		p := s.store.projects[id]
+		if p.Namespace == nil || p.Namespace.Kind != "user" {
+			continue
+		}
+		if p.Namespace.Path != fmt.Sprint(uid) && (p.Owner == nil || fmt.Sprint(p.Owner.ID) != fmt.Sprint(uid)) {
+			continue
+		}
+		if opt != nil && opt.Archived != nil && *opt.Archived != p.Archived {
+			continue
+		}
+
+		project := &gitlab.Project{}
+		clone(p, project)
+		projects = append(projects, project)
+	}
+
+	if len(projects) == 0 {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 User Not Found}")
+		return nil, resp, err
+	}
+
+	return projects, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// GetProject returns the project identified by ID or path with namespace
+func (s *ProjectsService) GetProject(pid interface{}, opt *gitlab.GetProjectOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	project := &gitlab.Project{}
+	clone(p, project)
+
+	return project, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// GetProjectLanguages returns the detected languages of the project, none by default
+func (s *ProjectsService) GetProjectLanguages(pid interface{}, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectLanguages, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/languages", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	languages := gitlab.ProjectLanguages{}
+	for language, percentage := range s.store.languages[p.ID] {
+		languages[language] = percentage
+	}
+
+	return &languages, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// EditProject applies all set options onto the stored project
+func (s *ProjectsService) EditProject(pid interface{}, opt *gitlab.EditProjectOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPut, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	// Uploads can't be represented as json, GitLab serves them from an uploads URL
+	// ending in the file name.
+	if opt.Avatar != nil {
+		p.AvatarURL = fmt.Sprintf("https://gitlab.fake/uploads/-/system/project/avatar/%d/%s", p.ID, opt.Avatar.Filename)
+		withoutAvatar := *opt
+		withoutAvatar.Avatar = nil
+		opt = &withoutAvatar
+	}
+
+	// Without incoming email GitLab accepts enabling Service Desk, but keeps it disabled
+	if s.store.noServiceDesk && opt.ServiceDeskEnabled != nil {
+		withoutServiceDesk := *opt
+		withoutServiceDesk.ServiceDeskEnabled = nil
+		opt = &withoutServiceDesk
+	}
+
+	if s.store.legacyEmails && opt.EmailsEnabled != nil {
+		withoutEmailsEnabled := *opt
+		withoutEmailsEnabled.EmailsEnabled = nil
+		opt = &withoutEmailsEnabled
+	}
+
+	// Options and project share their json field names, so unset (omitted) options
+	// leave the stored values untouched.
+	clone(opt, p)
+
+	project := &gitlab.Project{}
+	clone(p, project)
+
+	return project, newResponse(http.MethodPut, path, http.StatusOK), nil
+}
+
+// GetApprovalConfiguration returns the approval settings of the project
+func (s *ProjectsService) GetApprovalConfiguration(pid interface{}, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovals, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/approvals", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	approvals := &gitlab.ProjectApprovals{}
+	clone(s.store.approvals[p.ID], approvals)
+
+	return approvals, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// ChangeApprovalConfiguration applies all set options onto the stored approval settings
+func (s *ProjectsService) ChangeApprovalConfiguration(pid interface{}, opt *gitlab.ChangeApprovalConfigurationOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovals, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/approvals", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	if s.store.approvals[p.ID] == nil {
+		s.store.approvals[p.ID] = &gitlab.ProjectApprovals{}
+	}
+
+	// Changes of locked settings are silently dropped
+	changes := make(map[string]interface{})
+	clone(opt, &changes)
+	for key := range s.store.approvalLocks[p.ID] {
+		delete(changes, key)
+	}
+	clone(changes, s.store.approvals[p.ID])
+
+	// Like GitLab, negative approval counts are clamped
+	if s.store.approvals[p.ID].ApprovalsBeforeMerge < 0 {
+		s.store.approvals[p.ID].ApprovalsBeforeMerge = 0
+	}
+
+	approvals := &gitlab.ProjectApprovals{}
+	clone(s.store.approvals[p.ID], approvals)
+
+	return approvals, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// GetProjectApprovalRules returns the approval rules of the project, without pagination
+func (s *ProjectsService) GetProjectApprovalRules(pid interface{}, opt *gitlab.GetProjectApprovalRulesListsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.ProjectApprovalRule, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/approval_rules", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	rules := []*gitlab.ProjectApprovalRule{}
+	clone(s.store.approvalRules[p.ID], &rules)
+
+	return rules, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// CreateProjectApprovalRule creates an approval rule, failing if one with the name exists
+func (s *ProjectsService) CreateProjectApprovalRule(pid interface{}, opt *gitlab.CreateProjectLevelRuleOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovalRule, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/approval_rules", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	r := &gitlab.ProjectApprovalRule{ID: s.store.newID(), RuleType: "regular"}
+	if opt.Name != nil {
+		r.Name = *opt.Name
+	}
+	for _, existing := range s.store.approvalRules[p.ID] {
+		if existing.Name == r.Name {
+			resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: {name: [has already been taken]}}")
+			return nil, resp, err
+		}
+	}
+	s.store.applyApprovalRuleOptions(p.ID, r, opt.ApprovalsRequired, opt.UserIDs, opt.GroupIDs, opt.ProtectedBranchIDs, opt.AppliesToAllProtectedBranches)
+	s.store.approvalRules[p.ID] = append(s.store.approvalRules[p.ID], r)
+
+	rule := &gitlab.ProjectApprovalRule{}
+	clone(r, rule)
+
+	return rule, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// UpdateProjectApprovalRule applies all set options onto the stored approval rule
+func (s *ProjectsService) UpdateProjectApprovalRule(pid interface{}, approvalRule int, opt *gitlab.UpdateProjectLevelRuleOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovalRule, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/approval_rules/%d", pid, approvalRule)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPut, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	for _, r := range s.store.approvalRules[p.ID] {
+		if r.ID != approvalRule {
+			continue
+		}
+
+		if opt.Name != nil {
+			r.Name = *opt.Name
+		}
+		s.store.applyApprovalRuleOptions(p.ID, r, opt.ApprovalsRequired, opt.UserIDs, opt.GroupIDs, opt.ProtectedBranchIDs, opt.AppliesToAllProtectedBranches)
+
+		rule := &gitlab.ProjectApprovalRule{}
+		clone(r, rule)
+
+		return rule, newResponse(http.MethodPut, path, http.StatusOK), nil
+	}
+
+	resp, err := errorResponse(http.MethodPut, path, http.StatusNotFound, "{message: 404 Not found}")
+	return nil, resp, err
+}
+
+// applyApprovalRuleOptions sets the given options of an approval rule. Users and groups are
+// only stored by ID, protected branches are resolved in the project. The caller must hold
+// the lock.
+func (s *store) applyApprovalRuleOptions(pid int, r *gitlab.ProjectApprovalRule, approvalsRequired *int, userIDs *[]int, groupIDs *[]int, protectedBranchIDs *[]int, appliesToAll *bool) {
+	if approvalsRequired != nil {
+		r.ApprovalsRequired = *approvalsRequired
+	}
+	if userIDs != nil {
+		r.Users = []*gitlab.BasicUser{}
+		for _, id := range *userIDs {
+			r.Users = append(r.Users, &gitlab.BasicUser{ID: id})
+		}
+	}
+	if groupIDs != nil {
+		r.Groups = []*gitlab.Group{}
+		for _, id := range *groupIDs {
+			r.Groups = append(r.Groups, &gitlab.Group{ID: id})
+		}
+	}
+	if protectedBranchIDs != nil {
+		r.ProtectedBranches = []*gitlab.ProtectedBranch{}
+		for _, id := range *protectedBranchIDs {
+			for _, b := range s.protectedBranches[pid] {
+				if b.ID == id {
+					protectedBranch := &gitlab.ProtectedBranch{}
+					clone(b, protectedBranch)
+					r.ProtectedBranches = append(r.ProtectedBranches, protectedBranch)
+				}
+			}
+		}
+	}
+	if appliesToAll != nil {
+		r.AppliesToAllProtectedBranches = *appliesToAll
+	}
+}
+
+// ProtectedBranchesService fakes the parts of gitlab.ProtectedBranchesService used by the enforcer
+type ProtectedBranchesService struct {
+	store *store
+}
+
+// ListProtectedBranches returns all protected branches of the project on a single page,
+// sorted by name
+func (s *ProtectedBranchesService) ListProtectedBranches(pid interface{}, opt *gitlab.ListProtectedBranchesOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.ProtectedBranch, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/protected_branches", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	branches := []*gitlab.ProtectedBranch{}
+	for _, b := range s.store.protectedBranches[p.ID] {
+		protectedBranch := &gitlab.ProtectedBranch{}
+		clone(b, protectedBranch)
+		branches = append(branches, protectedBranch)
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		return branches[i].Name < branches[j].Name
+	})
+
+	return branches, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// GetProtectedBranch returns the protected branch of the project
+func (s *ProtectedBranchesService) GetProtectedBranch(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/protected_branches/%s", pid, branch)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	b, ok := s.store.protectedBranches[p.ID][branch]
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Not found}")
+		return nil, resp, err
+	}
+
+	protectedBranch := &gitlab.ProtectedBranch{}
+	clone(b, protectedBranch)
+
+	return protectedBranch, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// ProtectRepositoryBranches protects a branch, failing if it is already protected
+func (s *ProtectedBranchesService) ProtectRepositoryBranches(pid interface{}, opt *gitlab.ProtectRepositoryBranchesOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/protected_branches", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	var name string
+	if opt.Name != nil {
+		name = *opt.Name
+	}
+	if _, ok := s.store.protectedBranches[p.ID][name]; ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusConflict, "{message: Protected branch '"+name+"' already exists}")
+		return nil, resp, err
+	}
+
+	b := &gitlab.ProtectedBranch{
+		ID:                s.store.newID(),
+		Name:              name,
+		PushAccessLevels:  branchAccessDescriptions(opt.PushAccessLevel),
+		MergeAccessLevels: branchAccessDescriptions(opt.MergeAccessLevel),
+	}
+	s.store.assignAccessLevelIDs(b)
+	if opt.AllowForcePush != nil {
+		b.AllowForcePush = *opt.AllowForcePush
+	}
+	if opt.CodeOwnerApprovalRequired != nil {
+		b.CodeOwnerApprovalRequired = *opt.CodeOwnerApprovalRequired
+	}
+	s.store.protectedBranches[p.ID][name] = b
+
+	protectedBranch := &gitlab.ProtectedBranch{}
+	clone(b, protectedBranch)
+
+	return protectedBranch, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// UpdateProtectedBranch updates the settings of a protected branch in place
+func (s *ProtectedBranchesService) UpdateProtectedBranch(pid interface{}, branch string, opt *gitlab.UpdateProtectedBranchOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/protected_branches/%s", pid, branch)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPatch, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	b, ok := s.store.protectedBranches[p.ID][branch]
+	if !ok {
+		resp, err := errorResponse(http.MethodPatch, path, http.StatusNotFound, "{message: 404 Not found}")
+		return nil, resp, err
+	}
+
+	if opt.AllowForcePush != nil {
+		b.AllowForcePush = *opt.AllowForcePush
+	}
+	if opt.CodeOwnerApprovalRequired != nil {
+		b.CodeOwnerApprovalRequired = *opt.CodeOwnerApprovalRequired
+	}
+	if opt.AllowedToPush != nil {
+		b.PushAccessLevels = s.store.patchAccessLevels(b.PushAccessLevels, *opt.AllowedToPush)
+	}
+	if opt.AllowedToMerge != nil {
+		b.MergeAccessLevels = s.store.patchAccessLevels(b.MergeAccessLevels, *opt.AllowedToMerge)
+	}
+
+	protectedBranch := &gitlab.ProtectedBranch{}
+	clone(b, protectedBranch)
+
+	return protectedBranch, newResponse(http.MethodPatch, path, http.StatusOK), nil
+}
+
+// UnprotectRepositoryBranches removes the protection of a branch
+func (s *ProtectedBranchesService) UnprotectRepositoryBranches(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/protected_branches/%s", pid, branch)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		return errorResponse(http.MethodDelete, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+	}
+
+	protected, ok := s.store.protectedBranches[p.ID][branch]
+	if !ok {
+		return errorResponse(http.MethodDelete, path, http.StatusNotFound, "{message: 404 Not found}")
+	}
+	delete(s.store.protectedBranches[p.ID], branch)
+
+	// Approval rules scoped to the protected branch lose it
+	for _, rule := range s.store.approvalRules[p.ID] {
+		for i, b := range rule.ProtectedBranches {
+			if b.ID == protected.ID {
+				rule.ProtectedBranches = append(rule.ProtectedBranches[:i:i], rule.ProtectedBranches[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return newResponse(http.MethodDelete, path, http.StatusNoContent), nil
+}
+
+// ProtectedTagsService fakes the parts of gitlab.ProtectedTagsService used by the enforcer
+type ProtectedTagsService struct {
+	store *store
+}
+
+// GetProtectedTag returns the protected tag of the project
+func (s *ProtectedTagsService) GetProtectedTag(pid interface{}, tag string, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedTag, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/protected_tags/%s", pid, tag)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	t, ok := s.store.protectedTags[p.ID][tag]
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Not found}")
+		return nil, resp, err
+	}
+
+	protectedTag := &gitlab.ProtectedTag{}
+	clone(t, protectedTag)
+
+	return protectedTag, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// ProtectRepositoryTags protects a tag, failing if it is already protected
+func (s *ProtectedTagsService) ProtectRepositoryTags(pid interface{}, opt *gitlab.ProtectRepositoryTagsOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedTag, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/protected_tags", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	var name string
+	if opt.Name != nil {
+		name = *opt.Name
+	}
+	if _, ok := s.store.protectedTags[p.ID][name]; ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusConflict, "{message: Protected tag '"+name+"' already exists}")
+		return nil, resp, err
+	}
+
+	t := &gitlab.ProtectedTag{Name: name}
+	if opt.CreateAccessLevel != nil {
+		t.CreateAccessLevels = []*gitlab.TagAccessDescription{{AccessLevel: *opt.CreateAccessLevel}}
+	}
+	if opt.AllowedToCreate != nil {
+		for _, a := range *opt.AllowedToCreate {
+			// Like GitLab, user and group grants are reported with the maintainer level
+			d := &gitlab.TagAccessDescription{AccessLevel: gitlab.MaintainerPermissions}
+			if a.UserID != nil {
+				d.UserID = *a.UserID
+			}
+			if a.GroupID != nil {
+				d.GroupID = *a.GroupID
+			}
+			if a.AccessLevel != nil {
+				d.AccessLevel = *a.AccessLevel
+			}
+			t.CreateAccessLevels = append(t.CreateAccessLevels, d)
+		}
+	}
+	s.store.protectedTags[p.ID][name] = t
+
+	protectedTag := &gitlab.ProtectedTag{}
+	clone(t, protectedTag)
+
+	return protectedTag, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// UnprotectRepositoryTags removes the protection of a tag
+func (s *ProtectedTagsService) UnprotectRepositoryTags(pid interface{}, tag string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/protected_tags/%s", pid, tag)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		return errorResponse(http.MethodDelete, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+	}
+
+	if _, ok := s.store.protectedTags[p.ID][tag]; !ok {
+		return errorResponse(http.MethodDelete, path, http.StatusNotFound, "{message: 404 Not found}")
+	}
+	delete(s.store.protectedTags[p.ID], tag)
+
+	return newResponse(http.MethodDelete, path, http.StatusNoContent), nil
+}
+
+// BranchesService fakes the parts of gitlab.BranchesService used by the enforcer
+type BranchesService struct {
+	store *store
+}
+
+// GetBranch returns the branch of the project
+func (s *BranchesService) GetBranch(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.Branch, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/repository/branches/%s", pid, branch)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	b, ok := s.store.branches[p.ID][branch]
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Branch Not Found}")
+		return nil, resp, err
+	}
+
+	result := &gitlab.Branch{}
+	clone(b, result)
+
+	return result, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// CreateBranch creates a branch from an existing ref of the project
+func (s *BranchesService) CreateBranch(pid interface{}, opt *gitlab.CreateBranchOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Branch, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/repository/branches", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	if opt.Branch == nil || opt.Ref == nil {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: branch and ref are required}")
+		return nil, resp, err
+	}
+	if _, ok := s.store.branches[p.ID][*opt.Ref]; !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: Invalid reference name: "+*opt.Ref+"}")
+		return nil, resp, err
+	}
+	if _, ok := s.store.branches[p.ID][*opt.Branch]; ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: Branch already exists}")
+		return nil, resp, err
+	}
+
+	b := &gitlab.Branch{Name: *opt.Branch}
+	s.store.branches[p.ID][*opt.Branch] = b
+	for filePath, content := range s.store.files[p.ID][*opt.Ref] {
+		s.store.setFile(p.ID, *opt.Branch, filePath, content)
+	}
+
+	result := &gitlab.Branch{}
+	clone(b, result)
+
+	return result, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// ListBranches returns a page of the branches of the project, sorted by name. Like GitLab,
+// a page holds 20 branches unless PerPage is set.
+func (s *BranchesService) ListBranches(pid interface{}, opt *gitlab.ListBranchesOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Branch, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/repository/branches", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	var names []string
+	for name := range s.store.branches[p.ID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	page, perPage := 1, 20
+	if opt != nil && opt.Page > 0 {
+		page = opt.Page
+	}
+	if opt != nil && opt.PerPage > 0 {
+		perPage = opt.PerPage
+	}
+
+	branches := make([]*gitlab.Branch, 0)
+	for i := (page - 1) * perPage; i < len(names) && i < page*perPage; i++ {
+		b := &gitlab.Branch{}
+		clone(s.store.branches[p.ID][names[i]], b)
+		branches = append(branches, b)
+	}
+
+	resp := newResponse(http.MethodGet, path, http.StatusOK)
+	resp.CurrentPage = page
+	resp.TotalPages = (len(names) + perPage - 1) / perPage
+	if resp.TotalPages == 0 {
+		resp.TotalPages = 1
+	}
+	if page < resp.TotalPages {
+		resp.NextPage = page + 1
+	}
+
+	return branches, resp, nil
+}
+
+// DeleteBranch deletes a branch of the project. Like GitLab, it refuses to delete the
+// default branch and protected branches.
+func (s *BranchesService) DeleteBranch(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/repository/branches/%s", pid, branch)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		return errorResponse(http.MethodDelete, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+	}
+
+	if _, ok := s.store.branches[p.ID][branch]; !ok {
+		return errorResponse(http.MethodDelete, path, http.StatusNotFound, "{message: 404 Branch Not Found}")
+	}
+	if p.DefaultBranch == branch {
+		return errorResponse(http.MethodDelete, path, http.StatusBadRequest, "{message: The default branch of a project cannot be deleted.}")
+	}
+	if _, ok := s.store.protectedBranches[p.ID][branch]; ok {
+		return errorResponse(http.MethodDelete, path, http.StatusForbidden, "{message: 403 Forbidden}")
+	}
+	delete(s.store.branches[p.ID], branch)
+
+	return newResponse(http.MethodDelete, path, http.StatusNoContent), nil
+}
+
+// branchAccessDescriptions converts an optional access level into the list GitLab returns
+func branchAccessDescriptions(level *gitlab.AccessLevelValue) []*gitlab.BranchAccessDescription {
+	if level == nil {
+		return nil
+	}
+
+	return []*gitlab.BranchAccessDescription{{AccessLevel: *level}}
+}
+
+// assignAccessLevelIDs assigns IDs to the access levels of the protected branch, which
+// updates address them by. The caller must hold the lock.
+func (s *store) assignAccessLevelIDs(b *gitlab.ProtectedBranch) {
+	for _, levels := range [][]*gitlab.BranchAccessDescription{b.PushAccessLevels, b.MergeAccessLevels, b.UnprotectAccessLevels} {
+		for _, level := range levels {
+			if level.ID == 0 {
+				level.ID = s.newID()
+			}
+		}
+	}
+}
+
+// patchAccessLevels applies the allowed_to_push or allowed_to_merge options of a protected
+// branch update: entries with an ID are destroyed or changed, the others are added. The caller
+// must hold the lock.
+func (s *store) patchAccessLevels(levels []*gitlab.BranchAccessDescription, patch []*gitlab.BranchPermissionOptions) []*gitlab.BranchAccessDescription {
+	for _, p := range patch {
+		if p.ID == nil {
+			level := &gitlab.BranchAccessDescription{ID: s.newID()}
+			if p.AccessLevel != nil {
+				level.AccessLevel = *p.AccessLevel
+			}
+			if p.UserID != nil {
+				level.UserID = *p.UserID
+			}
+			if p.GroupID != nil {
+				level.GroupID = *p.GroupID
+			}
+			levels = append(levels, level)
+			continue
+		}
+
+		for i, level := range levels {
+			if level.ID != *p.ID {
+				continue
+			}
+			if p.Destroy != nil && *p.Destroy {
+				levels = append(levels[:i:i], levels[i+1:]...)
+			} else if p.AccessLevel != nil {
+				level.AccessLevel = *p.AccessLevel
+			}
+			break
+		}
+	}
+
+	return levels
+}
+
+// descendants returns the IDs of all (nested) subgroups of the group. The caller must
+// hold the lock.
+func (s *store) descendants(groupID int) []int {
+	var ids []int
+	for _, id := range s.groupIDs() {
+		if s.groups[id].ParentID == groupID {
+			ids = append(ids, id)
+			ids = append(ids, s.descendants(id)...)
+		}
+	}
+
+	return ids
+}
+
+// groupIDs returns the sorted IDs of all groups. The caller must hold the lock.
+func (s *store) groupIDs() []int {
+	ids := make([]int, 0, len(s.groups))
+	for id := range s.groups {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// projectIDs returns the sorted IDs of all projects. The caller must hold the lock.
+func (s *store) projectIDs() []int {
+	ids := make([]int, 0, len(s.projects))
+	for id := range s.projects {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// ProjectAccessTokensService fakes the parts of gitlab.ProjectAccessTokensService used by the enforcer
+type ProjectAccessTokensService struct {
+	store *store
+}
+
+// ListProjectAccessTokens returns the access tokens of the project, without their token values
+func (s *ProjectAccessTokensService) ListProjectAccessTokens(pid interface{}, opt *gitlab.ListProjectAccessTokensOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.ProjectAccessToken, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/access_tokens", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	all := []*gitlab.ProjectAccessToken{}
+	clone(s.store.accessTokens[p.ID], &all)
+
+	page, perPage := 1, 20
+	if opt != nil && opt.Page > 0 {
+		page = opt.Page
+	}
+	if opt != nil && opt.PerPage > 0 {
+		perPage = opt.PerPage
+	}
+
+	tokens := []*gitlab.ProjectAccessToken{}
+	for i := (page - 1) * perPage; i < len(all) && i < page*perPage; i++ {
+		all[i].Token = ""
+		tokens = append(tokens, all[i])
+	}
+
+	resp := newResponse(http.MethodGet, path, http.StatusOK)
+	resp.CurrentPage = page
+	resp.TotalPages = (len(all) + perPage - 1) / perPage
+	if resp.TotalPages == 0 {
+		resp.TotalPages = 1
+	}
+	if page < resp.TotalPages {
+		resp.NextPage = page + 1
+	}
+
+	return tokens, resp, nil
+}
+
+// CreateProjectAccessToken creates an active access token. Like GitLab, the token value is
+// only returned here.
+func (s *ProjectAccessTokensService) CreateProjectAccessToken(pid interface{}, opt *gitlab.CreateProjectAccessTokenOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectAccessToken, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/access_tokens", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	t := &gitlab.ProjectAccessToken{ID: s.store.nextTokenID, Active: true, AccessLevel: gitlab.MaintainerPermissions}
+	s.store.nextTokenID++
+	t.Token = fmt.Sprintf("glpat-fake-%d", t.ID)
+	if opt.Name != nil {
+		t.Name = *opt.Name
+	}
+	if opt.Scopes != nil {
+		t.Scopes = *opt.Scopes
+	}
+	if opt.AccessLevel != nil {
+		t.AccessLevel = *opt.AccessLevel
+	}
+	t.ExpiresAt = opt.ExpiresAt
+	s.store.accessTokens[p.ID] = append(s.store.accessTokens[p.ID], t)
+
+	token := &gitlab.ProjectAccessToken{}
+	clone(t, token)
+
+	return token, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// RevokeProjectAccessToken revokes the access token of the project
+func (s *ProjectAccessTokensService) RevokeProjectAccessToken(pid interface{}, id int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/access_tokens/%d", pid, id)
+	if p, ok := s.store.findProject(pid); ok {
+		for _, t := range s.store.accessTokens[p.ID] {
+			if t.ID == id {
+				t.Active = false
+				t.Revoked = true
+				return newResponse(http.MethodDelete, path, http.StatusNoContent), nil
+			}
+		}
+	}
+
+	return errorResponse(http.MethodDelete, path, http.StatusNotFound, "{message: 404 Not Found}")
+}
+
+// RepositoryFilesService fakes the parts of gitlab.RepositoryFilesService used by the enforcer
+type RepositoryFilesService struct {
+	store *store
+}
+
+// GetFile returns the base64 encoded file of the branch given as ref
+func (s *RepositoryFilesService) GetFile(pid interface{}, fileName string, opt *gitlab.GetFileOptions, options ...gitlab.RequestOptionFunc) (*gitlab.File, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/repository/files/%s", pid, url.PathEscape(fileName))
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	ref := p.DefaultBranch
+	if opt != nil && opt.Ref != nil {
+		ref = *opt.Ref
+	}
+	content, ok := s.store.files[p.ID][ref][fileName]
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 File Not Found}")
+		return nil, resp, err
+	}
+
+	file := &gitlab.File{
+		FileName: fileName,
+		FilePath: fileName,
+		Size:     len(content),
+		Encoding: "base64",
+		Content:  base64.StdEncoding.EncodeToString([]byte(content)),
+		Ref:      ref,
+	}
+
+	return file, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// CreateFile commits a new file to the branch. Like GitLab, the branch is created from
+// the start branch if it doesn't exist.
+func (s *RepositoryFilesService) CreateFile(pid interface{}, fileName string, opt *gitlab.CreateFileOptions, options ...gitlab.RequestOptionFunc) (*gitlab.FileInfo, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/repository/files/%s", pid, url.PathEscape(fileName))
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	if opt.Branch == nil || opt.Content == nil || opt.CommitMessage == nil {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: branch, content and commit_message are required}")
+		return nil, resp, err
+	}
+	branch := *opt.Branch
+
+	if _, ok := s.store.branches[p.ID][branch]; ok && opt.StartBranch != nil && *opt.StartBranch != branch {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: A branch called '"+branch+"' already exists}")
+		return nil, resp, err
+	} else if !ok {
+		if opt.StartBranch == nil {
+			resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: You can only create or edit files when you are on a branch}")
+			return nil, resp, err
+		}
+		if _, ok := s.store.branches[p.ID][*opt.StartBranch]; !ok {
+			resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: Invalid start branch}")
+			return nil, resp, err
+		}
+		s.store.branches[p.ID][branch] = &gitlab.Branch{Name: branch}
+		for filePath, content := range s.store.files[p.ID][*opt.StartBranch] {
+			s.store.setFile(p.ID, branch, filePath, content)
+		}
+	}
+
+	if _, ok := s.store.files[p.ID][branch][fileName]; ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: A file with this name already exists}")
+		return nil, resp, err
+	}
+	s.store.setFile(p.ID, branch, fileName, *opt.Content)
+
+	return &gitlab.FileInfo{FilePath: fileName, Branch: branch}, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// UpdateFile commits new content of an existing file to the branch
+func (s *RepositoryFilesService) UpdateFile(pid interface{}, fileName string, opt *gitlab.UpdateFileOptions, options ...gitlab.RequestOptionFunc) (*gitlab.FileInfo, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/repository/files/%s", pid, url.PathEscape(fileName))
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPut, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	if opt.Branch == nil || opt.Content == nil || opt.CommitMessage == nil {
+		resp, err := errorResponse(http.MethodPut, path, http.StatusBadRequest, "{message: branch, content and commit_message are required}")
+		return nil, resp, err
+	}
+	if _, ok := s.store.files[p.ID][*opt.Branch][fileName]; !ok {
+		resp, err := errorResponse(http.MethodPut, path, http.StatusBadRequest, "{message: A file with this name doesn't exist}")
+		return nil, resp, err
+	}
+	s.store.setFile(p.ID, *opt.Branch, fileName, *opt.Content)
+
+	return &gitlab.FileInfo{FilePath: fileName, Branch: *opt.Branch}, newResponse(http.MethodPut, path, http.StatusOK), nil
+}
+
+// RepositoriesService fakes the parts of gitlab.RepositoriesService used by the enforcer
+type RepositoriesService struct {
+	store *store
+}
+
+// ListTree lists the files and directories below the path in the ref (default: the default
+// branch) of the project, sorted by path. Directories exist implicitly by the files they hold.
+func (s *RepositoriesService) ListTree(pid interface{}, opt *gitlab.ListTreeOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.TreeNode, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/repository/tree", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	ref := p.DefaultBranch
+	prefix := ""
+	recursive := false
+	if opt != nil {
+		if opt.Ref != nil {
+			ref = *opt.Ref
+		}
+		if opt.Path != nil && *opt.Path != "" {
+			prefix = strings.Trim(*opt.Path, "/") + "/"
+		}
+		recursive = opt.Recursive != nil && *opt.Recursive
+	}
+
+	nodes := make(map[string]*gitlab.TreeNode)
+	for filePath := range s.store.files[p.ID][ref] {
+		if !strings.HasPrefix(filePath, prefix) {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(filePath, prefix), "/")
+		for i := range parts {
+			if i > 0 && !recursive {
+				break
+			}
+			nodeType := "tree"
+			if i == len(parts)-1 {
+				nodeType = "blob"
+			}
+			nodePath := prefix + strings.Join(parts[:i+1], "/")
+			nodes[nodePath] = &gitlab.TreeNode{Name: parts[i], Type: nodeType, Path: nodePath}
+		}
+	}
+	if len(nodes) == 0 && prefix != "" {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Tree Not Found}")
+		return nil, resp, err
+	}
+
+	tree := make([]*gitlab.TreeNode, 0, len(nodes))
+	for _, node := range nodes {
+		tree = append(tree, node)
+	}
+	sort.Slice(tree, func(i, j int) bool { return tree[i].Path < tree[j].Path })
+
+	return tree, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// ComplianceFrameworksService fakes the GraphQL queries of gitlab.ComplianceFrameworksService
+type ComplianceFrameworksService struct {
+	store *store
+}
+
+// ComplianceFrameworkID returns the global ID of the named compliance framework in the
+// namespace, or an empty ID if there is none
+func (s *ComplianceFrameworksService) ComplianceFrameworkID(namespace string, name string) (string, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	if s.store.noFrameworks {
+		return "", fmt.Errorf("graphql: Field 'complianceFrameworks' doesn't exist on type 'Namespace'")
+	}
+
+	return s.store.frameworks[namespace][name], nil
+}
+
+// SetProjectComplianceFramework replaces the compliance frameworks of the project with the
+// framework of the global ID
+func (s *ComplianceFrameworksService) SetProjectComplianceFramework(projectID int, frameworkID string) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	p, ok := s.store.projects[projectID]
+	if !ok {
+		return fmt.Errorf("graphql: The resource that you are attempting to access does not exist")
+	}
+
+	for _, frameworks := range s.store.frameworks {
+		for name, id := range frameworks {
+			if id == frameworkID {
+				p.ComplianceFrameworks = []string{name}
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("graphql: The resource that you are attempting to access does not exist")
+}
+
+// MetadataService fakes gitlab.MetadataService
+type MetadataService struct {
+	store *store
+}
+
+// GetMetadata returns the GitLab version and edition of the instance
+func (s *MetadataService) GetMetadata(options ...gitlab.RequestOptionFunc) (*gitlab.Metadata, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	metadata := &gitlab.Metadata{Version: s.store.version, Revision: "fake", Enterprise: s.store.enterprise}
+	return metadata, newResponse(http.MethodGet, "metadata", http.StatusOK), nil
+}
+
+// GroupVariablesService fakes gitlab.GroupVariablesService
+type GroupVariablesService struct {
+	store *store
+}
+
+// ListVariables returns all CI/CD variables of the group on a single page
+func (s *GroupVariablesService) ListVariables(gid interface{}, opt *gitlab.ListGroupVariablesOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.GroupVariable, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/variables", gid)
+	g, ok := s.store.findGroup(gid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Group Not Found}")
+		return nil, resp, err
+	}
+
+	variables := []*gitlab.GroupVariable{}
+	clone(s.store.groupVariables[g.ID], &variables)
+
+	return variables, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// CreateVariable adds a CI/CD variable to the group, failing if the key exists already
+func (s *GroupVariablesService) CreateVariable(gid interface{}, opt *gitlab.CreateGroupVariableOptions, options ...gitlab.RequestOptionFunc) (*gitlab.GroupVariable, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/variables", gid)
+	g, ok := s.store.findGroup(gid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Group Not Found}")
+		return nil, resp, err
+	}
+
+	v := &gitlab.GroupVariable{}
+	clone(opt, v)
+	for _, existing := range s.store.groupVariables[g.ID] {
+		if existing.Key == v.Key {
+			resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: {key: [has already been taken]}}")
+			return nil, resp, err
+		}
+	}
+	s.store.groupVariables[g.ID] = append(s.store.groupVariables[g.ID], v)
+
+	created := &gitlab.GroupVariable{}
+	clone(v, created)
+
+	return created, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// UpdateVariable applies the options to the CI/CD variable of the group
+func (s *GroupVariablesService) UpdateVariable(gid interface{}, key string, opt *gitlab.UpdateGroupVariableOptions, options ...gitlab.RequestOptionFunc) (*gitlab.GroupVariable, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/variables/%s", gid, key)
+	if g, ok := s.store.findGroup(gid); ok {
+		for _, v := range s.store.groupVariables[g.ID] {
+			if v.Key == key {
+				clone(opt, v)
+
+				updated := &gitlab.GroupVariable{}
+				clone(v, updated)
+
+				return updated, newResponse(http.MethodPut, path, http.StatusOK), nil
+			}
+		}
+	}
+
+	resp, err := errorResponse(http.MethodPut, path, http.StatusNotFound, "{message: 404 Variable Not Found}")
+	return nil, resp, err
+}
+
+// RemoveVariable deletes the CI/CD variable of the group
+func (s *GroupVariablesService) RemoveVariable(gid interface{}, key string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/variables/%s", gid, key)
+	if g, ok := s.store.findGroup(gid); ok {
+		for i, v := range s.store.groupVariables[g.ID] {
+			if v.Key == key {
+				s.store.groupVariables[g.ID] = append(s.store.groupVariables[g.ID][:i], s.store.groupVariables[g.ID][i+1:]...)
+				return newResponse(http.MethodDelete, path, http.StatusNoContent), nil
+			}
+		}
+	}
+
+	return errorResponse(http.MethodDelete, path, http.StatusNotFound, "{message: 404 Variable Not Found}")
+}
+
+// ProjectVariablesService fakes gitlab.ProjectVariablesService
+type ProjectVariablesService struct {
+	store *store
+}
+
+// ListVariables returns all CI/CD variables of the project on a single page
+func (s *ProjectVariablesService) ListVariables(pid interface{}, opt *gitlab.ListProjectVariablesOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.ProjectVariable, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/variables", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	variables := []*gitlab.ProjectVariable{}
+	clone(s.store.projectVariables[p.ID], &variables)
+
+	return variables, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// CreateVariable adds a CI/CD variable to the project, failing if the key exists already
+func (s *ProjectVariablesService) CreateVariable(pid interface{}, opt *gitlab.CreateProjectVariableOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectVariable, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/variables", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	v := &gitlab.ProjectVariable{}
+	clone(opt, v)
+	for _, existing := range s.store.projectVariables[p.ID] {
+		if existing.Key == v.Key {
+			resp, err := errorResponse(http.MethodPost, path, http.StatusBadRequest, "{message: {key: [has already been taken]}}")
+			return nil, resp, err
+		}
+	}
+	s.store.projectVariables[p.ID] = append(s.store.projectVariables[p.ID], v)
+
+	created := &gitlab.ProjectVariable{}
+	clone(v, created)
+
+	return created, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// UpdateVariable applies the options to the CI/CD variable of the project
+func (s *ProjectVariablesService) UpdateVariable(pid interface{}, key string, opt *gitlab.UpdateProjectVariableOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectVariable, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/variables/%s", pid, key)
+	if p, ok := s.store.findProject(pid); ok {
+		for _, v := range s.store.projectVariables[p.ID] {
+			if v.Key == key {
+				clone(opt, v)
+
+				updated := &gitlab.ProjectVariable{}
+				clone(v, updated)
+
+				return updated, newResponse(http.MethodPut, path, http.StatusOK), nil
+			}
+		}
+	}
+
+	resp, err := errorResponse(http.MethodPut, path, http.StatusNotFound, "{message: 404 Variable Not Found}")
+	return nil, resp, err
+}
+
+// ApprovalSettingLocksService fakes the merge request approval settings API
+type ApprovalSettingLocksService struct {
+	store *store
+}
+
+// ApprovalSettingLocks returns the locked approval settings of the project, see
+// Client.LockApprovalSetting
+func (s *ApprovalSettingLocksService) ApprovalSettingLocks(pid interface{}, options ...gitlab.RequestOptionFunc) (map[string]string, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/merge_request_approval_setting", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	locks := make(map[string]string)
+	for key, inheritedFrom := range s.store.approvalLocks[p.ID] {
+		locks[key] = inheritedFrom
+	}
+
+	return locks, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// ProjectMirrorsService fakes the remote mirrors API
+type ProjectMirrorsService struct {
+	store *store
+}
+
+// ListProjectMirror returns the remote mirrors of the project
+func (s *ProjectMirrorsService) ListProjectMirror(pid interface{}, opt *gitlab.ListProjectMirrorOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.ProjectMirror, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/remote_mirrors", pid)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	var mirrors []*gitlab.ProjectMirror
+	for _, m := range s.store.mirrors[p.ID] {
+		mirror := &gitlab.ProjectMirror{}
+		clone(m, mirror)
+		mirrors = append(mirrors, mirror)
+	}
+
+	return mirrors, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// EditProjectMirror updates the set options of the remote mirror
+func (s *ProjectMirrorsService) EditProjectMirror(pid interface{}, mirror int, opt *gitlab.EditProjectMirrorOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectMirror, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("projects/%v/remote_mirrors/%d", pid, mirror)
+	p, ok := s.store.findProject(pid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPut, path, http.StatusNotFound, "{message: 404 Project Not Found}")
+		return nil, resp, err
+	}
+
+	for _, m := range s.store.mirrors[p.ID] {
+		if m.ID != mirror {
+			continue
+		}
+
+		// Options and mirror share their json field names
+		clone(opt, m)
+
+		updated := &gitlab.ProjectMirror{}
+		clone(m, updated)
+		return updated, newResponse(http.MethodPut, path, http.StatusOK), nil
+	}
+
+	resp, err := errorResponse(http.MethodPut, path, http.StatusNotFound, "{message: 404 Not found}")
+	return nil, resp, err
+}
+
+// GroupMembersService fakes the parts of gitlab.GroupMembersService used by the enforcer.
+// Shares are stored in the SharedWithGroups of the group.
+type GroupMembersService struct {
+	store *store
+}
+
+// AddGroupMember adds the user to the group, failing if it is a member already
+func (s *GroupMembersService) AddGroupMember(gid interface{}, opt *gitlab.AddGroupMemberOptions, options ...gitlab.RequestOptionFunc) (*gitlab.GroupMember, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/members", gid)
+	g, ok := s.store.findGroup(gid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Group Not Found}")
+		return nil, resp, err
+	}
+	for _, m := range s.store.groupMembers[g.ID] {
+		if m.ID == *opt.UserID {
+			resp, err := errorResponse(http.MethodPost, path, http.StatusConflict, "{message: Member already exists}")
+			return nil, resp, err
+		}
+	}
+
+	member := &gitlab.GroupMember{ID: *opt.UserID, AccessLevel: *opt.AccessLevel}
+	s.store.groupMembers[g.ID] = append(s.store.groupMembers[g.ID], member)
+
+	added := &gitlab.GroupMember{}
+	clone(member, added)
+
+	return added, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// EditGroupMember changes the access level of the member of the group
+func (s *GroupMembersService) EditGroupMember(gid interface{}, user int, opt *gitlab.EditGroupMemberOptions, options ...gitlab.RequestOptionFunc) (*gitlab.GroupMember, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/members/%d", gid, user)
+	if g, ok := s.store.findGroup(gid); ok {
+		for _, m := range s.store.groupMembers[g.ID] {
+			if m.ID == user {
+				if *opt.AccessLevel != gitlab.OwnerPermissions && s.store.isLastOwner(g.ID, m) {
+					resp, err := errorResponse(http.MethodPut, path, http.StatusForbidden, "{message: 403 Forbidden - A group must have at least one owner}")
+					return nil, resp, err
+				}
+				m.AccessLevel = *opt.AccessLevel
+
+				updated := &gitlab.GroupMember{}
+				clone(m, updated)
+
+				return updated, newResponse(http.MethodPut, path, http.StatusOK), nil
+			}
+		}
+	}
+
+	resp, err := errorResponse(http.MethodPut, path, http.StatusNotFound, "{message: 404 Member Not Found}")
+	return nil, resp, err
+}
+
+// RemoveGroupMember removes the user from the group
+func (s *GroupMembersService) RemoveGroupMember(gid interface{}, user int, opt *gitlab.RemoveGroupMemberOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/members/%d", gid, user)
+	if g, ok := s.store.findGroup(gid); ok {
+		for i, m := range s.store.groupMembers[g.ID] {
+			if m.ID == user {
+				if s.store.isLastOwner(g.ID, m) {
+					return errorResponse(http.MethodDelete, path, http.StatusForbidden, "{message: 403 Forbidden - A group must have at least one owner}")
+				}
+				s.store.groupMembers[g.ID] = append(s.store.groupMembers[g.ID][:i], s.store.groupMembers[g.ID][i+1:]...)
+				return newResponse(http.MethodDelete, path, http.StatusNoContent), nil
+			}
+		}
+	}
+
+	return errorResponse(http.MethodDelete, path, http.StatusNotFound, "{message: 404 Member Not Found}")
+}
+
+// isLastOwner reports whether the member is the only owner of the group, whom GitLab refuses
+// to remove or demote
+func (s *store) isLastOwner(gid int, member *gitlab.GroupMember) bool {
+	if member.AccessLevel != gitlab.OwnerPermissions {
+		return false
+	}
+	for _, m := range s.groupMembers[gid] {
+		if m != member && m.AccessLevel == gitlab.OwnerPermissions {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ShareWithGroup shares the group with another group, failing if it is shared already
+func (s *GroupMembersService) ShareWithGroup(gid interface{}, opt *gitlab.ShareWithGroupOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Group, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/share", gid)
+	g, ok := s.store.findGroup(gid)
+	if !ok {
+		resp, err := errorResponse(http.MethodPost, path, http.StatusNotFound, "{message: 404 Group Not Found}")
+		return nil, resp, err
+	}
+	for _, share := range g.SharedWithGroups {
+		if share.GroupID == *opt.GroupID {
+			resp, err := errorResponse(http.MethodPost, path, http.StatusConflict, "{message: Shared group has already been taken}")
+			return nil, resp, err
+		}
+	}
+
+	// The shares are of an anonymous struct type, append them via their json representation
+	var shares []map[string]interface{}
+	clone(g.SharedWithGroups, &shares)
+	shares = append(shares, map[string]interface{}{"group_id": *opt.GroupID, "group_access_level": int(*opt.GroupAccess)})
+	clone(shares, &g.SharedWithGroups)
+
+	group := &gitlab.Group{}
+	clone(g, group)
+
+	return group, newResponse(http.MethodPost, path, http.StatusCreated), nil
+}
+
+// DeleteShareWithGroup removes the share of the group with another group
+func (s *GroupMembersService) DeleteShareWithGroup(gid interface{}, groupID int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("groups/%v/share/%d", gid, groupID)
+	if g, ok := s.store.findGroup(gid); ok {
+		for i, share := range g.SharedWithGroups {
+			if share.GroupID == groupID {
+				g.SharedWithGroups = append(g.SharedWithGroups[:i], g.SharedWithGroups[i+1:]...)
+				return newResponse(http.MethodDelete, path, http.StatusNoContent), nil
+			}
+		}
+	}
+
+	return errorResponse(http.MethodDelete, path, http.StatusNotFound, "{message: 404 Not found}")
+}
+
+// UsersService fakes the parts of gitlab.UsersService used by the enforcer
+type UsersService struct {
+	store *store
+}
+
+// GetUser returns the user. Like GitLab, only administrators see whether two-factor
+// authentication is enabled.
+func (s *UsersService) GetUser(user int, opt gitlab.GetUsersOptions, options ...gitlab.RequestOptionFunc) (*gitlab.User, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	path := fmt.Sprintf("users/%d", user)
+	u, ok := s.store.users[user]
+	if !ok {
+		resp, err := errorResponse(http.MethodGet, path, http.StatusNotFound, "{message: 404 User Not Found}")
+		return nil, resp, err
+	}
+
+	result := &gitlab.User{}
+	clone(u, result)
+	if !s.store.admin {
+		result.TwoFactorEnabled = false
+	}
+
+	return result, newResponse(http.MethodGet, path, http.StatusOK), nil
+}
+
+// CurrentUser returns the user of the client, an administrator if set by SetAdmin
+func (s *UsersService) CurrentUser(options ...gitlab.RequestOptionFunc) (*gitlab.User, *gitlab.Response, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	return &gitlab.User{ID: 1, Username: "enforcer", IsAdmin: s.store.admin}, newResponse(http.MethodGet, "user", http.StatusOK), nil
+}
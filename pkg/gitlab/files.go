@@ -0,0 +1,126 @@
+package gitlab
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// EnsureFiles ensures that each required file exists in the repository of the project,
+// committing missing files. Existing files are only replaced if overwrite is set and their
+// content differs.
+func (m *ProjectManager) EnsureFiles(project gitlab.Project, dryrun bool) error {
+	if len(m.config.RequiredFiles) == 0 {
+		return nil
+	}
+
+	// The default branch may have been migrated earlier in this run
+	projectSettings, err := m.GetProjectSettings(project)
+	if err != nil {
+		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	if projectSettings.DefaultBranch == "" {
+		m.logger.Infof("Project %s has no default branch (empty repository), skipping required files.", project.PathWithNamespace)
+		return nil
+	}
+
+	for _, f := range m.config.RequiredFiles {
+		if err := m.ensureFile(project, projectSettings.DefaultBranch, f, dryrun); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureFile creates or, with overwrite set, updates a single required file
+func (m *ProjectManager) ensureFile(project gitlab.Project, defaultBranch string, f config.RequiredFile, dryrun bool) error {
+	branch := f.Branch
+	if branch == "" {
+		branch = defaultBranch
+	}
+
+	content, err := f.Render(project)
+	if err != nil {
+		return fmt.Errorf("failed to render file %s of project %s: %v", f.Path, project.PathWithNamespace, err)
+	}
+
+	existing, resp, err := m.repositoryFilesClient.GetFile(project.ID, f.Path, &gitlab.GetFileOptions{Ref: gitlab.String(branch)}, m.withContext())
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("failed to get file %s of project %s: %v", f.Path, project.PathWithNamespace, err)
+	}
+
+	if err == nil {
+		if !f.Overwrite {
+			m.logger.Debugf("File %s of project %s exists.", f.Path, project.PathWithNamespace)
+			return nil
+		}
+
+		current, err := base64.StdEncoding.DecodeString(existing.Content)
+		if err != nil {
+			return fmt.Errorf("failed to decode file %s of project %s: %v", f.Path, project.PathWithNamespace, err)
+		}
+		if string(current) == content {
+			m.logger.Debugf("File %s of project %s is up to date.", f.Path, project.PathWithNamespace)
+			return nil
+		}
+
+		if dryrun {
+			m.skipAPICall("UpdateFile", "on %s in branch %s.", f.Path, branch)
+			return nil
+		}
+
+		opt := &gitlab.UpdateFileOptions{
+			Branch:        gitlab.String(branch),
+			Content:       gitlab.String(content),
+			CommitMessage: gitlab.String(commitMessage(f, "Update")),
+		}
+		if _, _, err := m.repositoryFilesClient.UpdateFile(project.ID, f.Path, opt, m.withContext()); err != nil {
+			return fmt.Errorf("failed to update file %s of project %s: %v", f.Path, project.PathWithNamespace, err)
+		}
+		m.logger.Infof("Updated file %s of project %s in branch %s.", f.Path, project.PathWithNamespace, branch)
+
+		return nil
+	}
+
+	if dryrun {
+		m.skipAPICall("CreateFile", "on %s in branch %s.", f.Path, branch)
+		return nil
+	}
+
+	opt := &gitlab.CreateFileOptions{
+		Branch:        gitlab.String(branch),
+		Content:       gitlab.String(content),
+		CommitMessage: gitlab.String(commitMessage(f, "Add")),
+	}
+	if branch != defaultBranch {
+		if _, resp, err := m.branchesClient.GetBranch(project.ID, branch, m.withContext()); err != nil {
+			if resp == nil || resp.StatusCode != http.StatusNotFound {
+				return fmt.Errorf("failed to check for branch %s existence: %v", branch, err)
+			}
+			// Let GitLab create the branch from the default branch
+			opt.StartBranch = gitlab.String(defaultBranch)
+		}
+	}
+	if _, _, err := m.repositoryFilesClient.CreateFile(project.ID, f.Path, opt, m.withContext()); err != nil {
+		return fmt.Errorf("failed to create file %s of project %s: %v", f.Path, project.PathWithNamespace, err)
+	}
+	m.logger.Infof("Created file %s of project %s in branch %s.", f.Path, project.PathWithNamespace, branch)
+
+	return nil
+}
+
+// commitMessage returns the configured commit message of the file, or a default one
+// starting with the verb
+func commitMessage(f config.RequiredFile, verb string) string {
+	if f.CommitMessage != "" {
+		return f.CommitMessage
+	}
+
+	return fmt.Sprintf("%s %s", verb, f.Path)
+}
@@ -0,0 +1,97 @@
+package gitlab
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+// fileContent returns the decoded content of the file, or an empty string if it is missing
+func fileContent(t *testing.T, client *fake.Client, pid int, branch string, path string) string {
+	t.Helper()
+
+	f, _, err := client.RepositoryFiles.GetFile(pid, path, &gitlab.GetFileOptions{Ref: gitlab.String(branch)})
+	if err != nil {
+		return ""
+	}
+	content, err := base64.StdEncoding.DecodeString(f.Content)
+	if err != nil {
+		t.Fatalf("failed to decode file %s: %v", path, err)
+	}
+
+	return string(content)
+}
+
+func TestEnsureFiles(t *testing.T) {
+	template := writeTestFile(t, "CODEOWNERS.tmpl", "* @{{.Namespace.FullPath}}/maintainers\n")
+	configFile := writeTestFile(t, "config.json", `{"required_files": [
+		{"path": "CODEOWNERS", "template": "`+template+`"},
+		{"path": ".gitlab-ci.yml", "content": "include: ci.yml\n", "overwrite": true},
+		{"path": "README.md", "content": "# New\n"}
+	]}`)
+	cfg, err := config.Parse(configFile)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	client := fake.NewClient()
+	client.AddProject(&gitlab.Project{
+		ID: 10, PathWithNamespace: "example/foo", DefaultBranch: "main",
+		Namespace: &gitlab.ProjectNamespace{ID: 1, FullPath: "example"},
+	})
+	client.AddProject(&gitlab.Project{ID: 12, PathWithNamespace: "example/empty"})
+	client.AddFile(10, "main", ".gitlab-ci.yml", "stages: []\n")
+	client.AddFile(10, "main", "README.md", "# Existing\n")
+	manager := newTestManager(client, cfg)
+
+	project, _, _ := client.Projects.GetProject(10, nil)
+	if err := manager.EnsureFiles(*project, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if content := fileContent(t, client, 10, "main", "CODEOWNERS"); content != "" {
+		t.Errorf("Expected a dryrun to create no files, got %q", content)
+	}
+
+	if err := manager.EnsureFiles(*project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := map[string]string{
+		"CODEOWNERS":     "* @example/maintainers\n",
+		".gitlab-ci.yml": "include: ci.yml\n",
+		"README.md":      "# Existing\n",
+	}
+	for path, content := range expected {
+		if actual := fileContent(t, client, 10, "main", path); actual != content {
+			t.Errorf("Expected %s to contain %q, got %q", path, content, actual)
+		}
+	}
+
+	empty, _, _ := client.Projects.GetProject(12, nil)
+	if err := manager.EnsureFiles(*empty, false); err != nil {
+		t.Errorf("Expected projects without default branch to be skipped, got %v", err)
+	}
+}
+
+func TestEnsureFilesOnBranch(t *testing.T) {
+	client := newTestClient()
+	manager := newTestManager(client, &config.Config{
+		RequiredFiles: []config.RequiredFile{{Path: "CODEOWNERS", Content: "* @admins\n", Branch: "codeowners"}},
+	})
+
+	project, _, _ := client.Projects.GetProject(10, nil)
+	if err := manager.EnsureFiles(*project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if content := fileContent(t, client, 10, "codeowners", "CODEOWNERS"); content != "* @admins\n" {
+		t.Errorf("Expected the file to be committed to a new branch, got %q", content)
+	}
+	if content := fileContent(t, client, 10, "master", "CODEOWNERS"); content != "" {
+		t.Errorf("Expected the default branch to be untouched, got %q", content)
+	}
+}
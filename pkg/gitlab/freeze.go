@@ -0,0 +1,277 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/r3labs/diff"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// FreezeState holds the merge access levels of the protected branches before a freeze, so
+// unfreeze can restore them
+type FreezeState struct {
+	Branches []FrozenBranch `json:"branches"`
+}
+
+// FrozenBranch is the pre-freeze merge access level of a single protected branch
+type FrozenBranch struct {
+	Project          string             `json:"project"`
+	ProjectID        int                `json:"project_id"`
+	Branch           string             `json:"branch"`
+	MergeAccessLevel config.AccessLevel `json:"merge_access_level"`
+}
+
+// BranchFreezeSettings is the recorded merge access level of a protected branch
+type BranchFreezeSettings struct {
+	MergeAccessLevel config.AccessLevel
+}
+
+// branchFreezeDiff holds the merge access level changes of a single protected branch
+type branchFreezeDiff struct {
+	branch   string
+	difflog  diff.Changelog
+	original map[string]*BranchFreezeSettings
+	updated  map[string]*BranchFreezeSettings
+}
+
+// FreezeBranches sets the merge access level of the configured protected branches of the
+// project to no one, e.g. during a release freeze. The pre-freeze level of each branch is
+// flushed to the state file opened by CreateFreezeState before the branch is changed, so an
+// aborted freeze can still be undone. Branches which are not protected are left untouched.
+func (m *ProjectManager) FreezeBranches(project gitlab.Project, dryrun bool) error {
+	noone := gitlab.NoPermissions
+
+	for _, b := range m.config.ProtectedBranches {
+		protectedBranch, resp, err := m.protectedBranchesClient.GetProtectedBranch(project.ID, b.Name, m.withContext())
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				m.logger.Debugf("Branch %v of project %s is not protected, not freezing it.", b.Name, project.PathWithNamespace)
+				continue
+			}
+			return fmt.Errorf("failed to get protected branch %v: %v", b.Name, err)
+		}
+
+		current := accessLevelName(firstAccessLevel(protectedBranch.MergeAccessLevels))
+		m.frozenBranches = append(m.frozenBranches, FrozenBranch{
+			Project:          project.PathWithNamespace,
+			ProjectID:        project.ID,
+			Branch:           b.Name,
+			MergeAccessLevel: current,
+		})
+		if err := m.flushFreezeState(); err != nil {
+			return err
+		}
+		m.recordBranchFreeze(m.BranchFreezeOriginal, project, b.Name, current)
+		m.recordBranchFreeze(m.BranchFreezeUpdated, project, b.Name, accessLevelName(noone))
+
+		if compareAccessLevels(protectedBranch.MergeAccessLevels, accessLevelName(noone)) {
+			m.logger.Debugf("Branch %v of project %s is frozen already.", b.Name, project.PathWithNamespace)
+			continue
+		}
+
+		if err := m.setMergeAccessLevel(project, protectedBranch, noone, dryrun); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnfreezeBranch restores the pre-freeze merge access level of the protected branch
+func (m *ProjectManager) UnfreezeBranch(b FrozenBranch, dryrun bool) error {
+	project := gitlab.Project{ID: b.ProjectID, PathWithNamespace: b.Project}
+
+	protectedBranch, _, err := m.protectedBranchesClient.GetProtectedBranch(project.ID, b.Branch, m.withContext())
+	if err != nil {
+		return fmt.Errorf("failed to get protected branch %v: %v", b.Branch, err)
+	}
+
+	current := accessLevelName(firstAccessLevel(protectedBranch.MergeAccessLevels))
+	m.recordBranchFreeze(m.BranchFreezeOriginal, project, b.Branch, current)
+	m.recordBranchFreeze(m.BranchFreezeUpdated, project, b.Branch, b.MergeAccessLevel)
+
+	if compareAccessLevels(protectedBranch.MergeAccessLevels, b.MergeAccessLevel) {
+		m.logger.Debugf("Branch %v of project %s has its pre-freeze merge access level.", b.Branch, project.PathWithNamespace)
+		return nil
+	}
+
+	return m.setMergeAccessLevel(project, protectedBranch, *b.MergeAccessLevel.Value(), dryrun)
+}
+
+// setMergeAccessLevel replaces the role based merge access level of the protected branch in
+// place. Its ID, push access levels, allowed force push, code owner approval and the users and
+// groups allowed to merge are kept, and so are the approval rules scoped to the branch.
+func (m *ProjectManager) setMergeAccessLevel(project gitlab.Project, protectedBranch *gitlab.ProtectedBranch, level gitlab.AccessLevelValue, dryrun bool) error {
+	name := protectedBranch.Name
+
+	if dryrun {
+		m.skipAPICall("UpdateProtectedBranch", "on %v branch.", name)
+		return nil
+	}
+
+	var allowed []*gitlab.BranchPermissionOptions
+	for _, a := range protectedBranch.MergeAccessLevels {
+		if a.UserID == 0 && a.GroupID == 0 && a.DeployKeyID == 0 {
+			allowed = append(allowed, &gitlab.BranchPermissionOptions{ID: gitlab.Int(a.ID), Destroy: gitlab.Bool(true)})
+		}
+	}
+	allowed = append(allowed, &gitlab.BranchPermissionOptions{AccessLevel: gitlab.AccessLevel(level)})
+
+	opt := &gitlab.UpdateProtectedBranchOptions{AllowedToMerge: &allowed}
+	if _, _, err := m.protectedBranchesClient.UpdateProtectedBranch(project.ID, name, opt, m.withContext()); err != nil {
+		return fmt.Errorf("failed to update protected branch %s: %v", name, err)
+	}
+	m.logger.Infof("Set merge access level of branch %s of project %s to %s.", name, project.PathWithNamespace, accessLevelName(level))
+
+	return nil
+}
+
+// CreateFreezeState creates the freeze state file at the given path with no branches, and
+// has FreezeBranches flush the pre-freeze merge access levels to it. An existing state file
+// is never overwritten, as a second freeze would record the frozen levels.
+func (m *ProjectManager) CreateFreezeState(path string) error {
+	// nolint: gosec
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("freeze state file %s exists already, unfreeze first", path)
+		}
+		return fmt.Errorf("failed to create freeze state file %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to create freeze state file %s: %v", path, err)
+	}
+
+	m.freezeStatePath = path
+	return m.flushFreezeState()
+}
+
+// flushFreezeState writes the pre-freeze merge access levels recorded so far as JSON to the
+// state file opened by CreateFreezeState, if any. The file is replaced by a rename, so an
+// interrupted write keeps the previous state.
+func (m *ProjectManager) flushFreezeState() error {
+	if m.freezeStatePath == "" {
+		return nil
+	}
+
+	state := FreezeState{Branches: m.frozenBranches}
+	if state.Branches == nil {
+		state.Branches = []FrozenBranch{}
+	}
+	body, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to convert freeze state to json: %v", err)
+	}
+
+	tmp := m.freezeStatePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(body, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write freeze state file %s: %v", m.freezeStatePath, err)
+	}
+	if err := os.Rename(tmp, m.freezeStatePath); err != nil {
+		return fmt.Errorf("failed to write freeze state file %s: %v", m.freezeStatePath, err)
+	}
+
+	return nil
+}
+
+// ReadFreezeState reads the freeze state file written by FreezeBranches
+func ReadFreezeState(path string) (*FreezeState, error) {
+	// nolint: gosec
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read freeze state file %s: %v", path, err)
+	}
+
+	state := &FreezeState{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal freeze state file %s: %v", path, err)
+	}
+
+	return state, nil
+}
+
+// recordBranchFreeze stores the merge access level of the branch of the project in the
+// given original or updated states
+func (m *ProjectManager) recordBranchFreeze(states map[string]map[string]*BranchFreezeSettings, project gitlab.Project, branch string, level config.AccessLevel) {
+	if _, ok := states[project.PathWithNamespace]; !ok {
+		states[project.PathWithNamespace] = make(map[string]*BranchFreezeSettings)
+	}
+	states[project.PathWithNamespace][branch] = &BranchFreezeSettings{MergeAccessLevel: level}
+}
+
+// branchFreezeDiffs returns the merge access level changes of the freeze per protected
+// branch, sorted by branch
+func (m *ProjectManager) branchFreezeDiffs() ([]branchFreezeDiff, error) {
+	byBranch := make(map[string]*branchFreezeDiff)
+	for project, branches := range m.BranchFreezeOriginal {
+		for branch, settings := range branches {
+			if _, ok := byBranch[branch]; !ok {
+				byBranch[branch] = &branchFreezeDiff{
+					branch:   branch,
+					original: make(map[string]*BranchFreezeSettings),
+					updated:  make(map[string]*BranchFreezeSettings),
+				}
+			}
+			byBranch[branch].original[project] = settings
+			byBranch[branch].updated[project] = m.BranchFreezeUpdated[project][branch]
+		}
+	}
+
+	diffs := make([]branchFreezeDiff, 0, len(byBranch))
+	for _, d := range byBranch {
+		difflog, err := diff.Diff(d.original, d.updated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff merge access level of branch %s: %v", d.branch, err)
+		}
+		d.difflog = difflog
+		diffs = append(diffs, *d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].branch < diffs[j].branch
+	})
+
+	return diffs, nil
+}
+
+// firstAccessLevel returns the first of the role based access levels of a protected branch,
+// no one if there is none. Users, groups and deploy keys granted access in addition are
+// ignored.
+func firstAccessLevel(levels []*gitlab.BranchAccessDescription) gitlab.AccessLevelValue {
+	for _, level := range levels {
+		if level.UserID == 0 && level.GroupID == 0 && level.DeployKeyID == 0 {
+			return level.AccessLevel
+		}
+	}
+
+	return gitlab.NoPermissions
+}
+
+// accessLevelName returns the config alias of the access level, e.g. maintainer, or its
+// numeric value
+func accessLevelName(level gitlab.AccessLevelValue) config.AccessLevel {
+	switch level {
+	case gitlab.NoPermissions:
+		return "noone"
+	case gitlab.GuestPermissions:
+		return config.AccessLevelGuest
+	case gitlab.ReporterPermissions:
+		return config.AccessLevelReporter
+	case gitlab.DeveloperPermissions:
+		return config.AccessLevelDeveloper
+	case gitlab.MaintainerPermissions:
+		return config.AccessLevelMaintainer
+	case gitlab.OwnerPermissions:
+		return config.AccessLevelOwner
+	}
+
+	return config.AccessLevel(strconv.Itoa(int(level)))
+}
@@ -0,0 +1,207 @@
+package gitlab
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+func TestFreezeBranches(t *testing.T) {
+	cfg := &config.Config{ProtectedBranches: []config.ProtectedBranch{
+		{Name: "master", PushAccessLevel: config.AccessLevelMaintainer, MergeAccessLevel: config.AccessLevelDeveloper},
+		{Name: "release", PushAccessLevel: config.AccessLevelMaintainer, MergeAccessLevel: config.AccessLevelMaintainer},
+	}}
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	for _, dryrun := range []bool{true, false} {
+		client := newTestClient()
+		client.AddProtectedBranch(10, &gitlab.ProtectedBranch{
+			Name:                      "master",
+			PushAccessLevels:          []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.MaintainerPermissions}},
+			MergeAccessLevels:         []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.DeveloperPermissions}},
+			CodeOwnerApprovalRequired: true,
+		})
+
+		manager := newTestManager(client, cfg)
+		path := filepath.Join(t.TempDir(), "freeze-state.json")
+		if !dryrun {
+			if err := manager.CreateFreezeState(path); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if err := newTestManager(client, cfg).CreateFreezeState(path); err == nil {
+				t.Errorf("Expected an existing freeze state file not to be overwritten")
+			}
+		}
+		if err := manager.FreezeBranches(project, dryrun); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		entries, err := manager.ChangeLogEntries(false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(entries) != 1 || entries[0].Subsection != "protected_branches[master]" || entries[0].Setting != "merge_access_level" ||
+			fmt.Sprint(entries[0].From) != config.AccessLevelDeveloper || fmt.Sprint(entries[0].To) != "noone" {
+			t.Errorf("Expected the merge access level of master to be frozen (dryrun %v), got %+v", dryrun, entries)
+		}
+
+		branch, _, _ := client.ProtectedBranches.GetProtectedBranch(10, "master")
+		if dryrun {
+			if branch.MergeAccessLevels[0].AccessLevel != gitlab.DeveloperPermissions {
+				t.Errorf("Expected a dryrun to leave the branch untouched, got %d", branch.MergeAccessLevels[0].AccessLevel)
+			}
+			continue
+		}
+		if branch.MergeAccessLevels[0].AccessLevel != gitlab.NoPermissions ||
+			branch.PushAccessLevels[0].AccessLevel != gitlab.MaintainerPermissions || !branch.CodeOwnerApprovalRequired {
+			t.Errorf("Expected only the merge access level to be frozen, got %+v", branch)
+		}
+
+		state, err := ReadFreezeState(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(state.Branches) != 1 || state.Branches[0].Branch != "master" || state.Branches[0].MergeAccessLevel != config.AccessLevelDeveloper {
+			t.Fatalf("Expected the pre-freeze level of master to be recorded, got %+v", state.Branches)
+		}
+
+		unfreeze := newTestManager(client, cfg)
+		for _, b := range state.Branches {
+			if err := unfreeze.UnfreezeBranch(b, false); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		branch, _, _ = client.ProtectedBranches.GetProtectedBranch(10, "master")
+		if branch.MergeAccessLevels[0].AccessLevel != gitlab.DeveloperPermissions || !branch.CodeOwnerApprovalRequired {
+			t.Errorf("Expected the pre-freeze merge access level to be restored, got %+v", branch)
+		}
+		if changes, err := unfreeze.HasChanges(); err != nil || !changes {
+			t.Errorf("Expected the unfreeze to be reported, got %v (%v)", changes, err)
+		}
+	}
+}
+
+// failingUpdateProtectedBranches fails to update protected branches after checking that
+// their pre-freeze level is in the freeze state file
+type failingUpdateProtectedBranches struct {
+	*fake.ProtectedBranchesService
+	path   string
+	failed []string
+}
+
+func (f *failingUpdateProtectedBranches) UpdateProtectedBranch(pid interface{}, branch string, opt *gitlab.UpdateProtectedBranchOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch, *gitlab.Response, error) {
+	state, err := ReadFreezeState(f.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, b := range state.Branches {
+		if b.ProjectID == pid && b.Branch == branch {
+			f.failed = append(f.failed, branch)
+			return nil, &gitlab.Response{Response: &http.Response{StatusCode: http.StatusInternalServerError}}, errors.New("500 Internal Server Error")
+		}
+	}
+
+	return nil, nil, fmt.Errorf("branch %s is not in the freeze state file", branch)
+}
+
+func TestFreezeBranchesFlushesState(t *testing.T) {
+	cfg := &config.Config{ProtectedBranches: []config.ProtectedBranch{
+		{Name: "master", PushAccessLevel: config.AccessLevelMaintainer, MergeAccessLevel: config.AccessLevelDeveloper},
+	}}
+
+	client := newTestClient()
+	client.AddProtectedBranch(10, &gitlab.ProtectedBranch{
+		Name:              "master",
+		PushAccessLevels:  []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.MaintainerPermissions}},
+		MergeAccessLevels: []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.DeveloperPermissions}},
+	})
+
+	path := filepath.Join(t.TempDir(), "freeze-state.json")
+	manager := newTestManager(client, cfg)
+	if err := manager.CreateFreezeState(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if state, err := ReadFreezeState(path); err != nil || len(state.Branches) != 0 {
+		t.Fatalf("Expected an empty freeze state file before the freeze, got %+v (%v)", state, err)
+	}
+
+	branches := &failingUpdateProtectedBranches{ProtectedBranchesService: client.ProtectedBranches, path: path}
+	manager.protectedBranchesClient = branches
+	if err := manager.FreezeBranches(gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}, false); err == nil {
+		t.Fatalf("Expected the failed update to be reported")
+	}
+	if len(branches.failed) != 1 || branches.failed[0] != "master" {
+		t.Fatalf("Expected master to be in the freeze state file before its update, got %v", branches.failed)
+	}
+
+	state, err := ReadFreezeState(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(state.Branches) != 1 || state.Branches[0].MergeAccessLevel != config.AccessLevelDeveloper {
+		t.Errorf("Expected the pre-freeze level of master to be kept after the failed update, got %+v", state.Branches)
+	}
+}
+
+func TestFreezeBranchesKeepsProtection(t *testing.T) {
+	cfg := &config.Config{ProtectedBranches: []config.ProtectedBranch{
+		{Name: "master", PushAccessLevel: config.AccessLevelMaintainer, MergeAccessLevel: config.AccessLevelDeveloper},
+	}}
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	client := newTestClient()
+	client.AddProtectedBranch(10, &gitlab.ProtectedBranch{
+		Name:              "master",
+		PushAccessLevels:  []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.MaintainerPermissions}, {AccessLevel: gitlab.DeveloperPermissions, UserID: 5}},
+		MergeAccessLevels: []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.DeveloperPermissions}, {AccessLevel: gitlab.DeveloperPermissions, GroupID: 7}},
+		AllowForcePush:    true,
+	})
+	before, _, _ := client.ProtectedBranches.GetProtectedBranch(10, "master")
+	client.AddApprovalRule(10, &gitlab.ProjectApprovalRule{Name: "code review", ApprovalsRequired: 1, ProtectedBranches: []*gitlab.ProtectedBranch{{ID: before.ID, Name: "master"}}})
+
+	freeze := newTestManager(client, cfg)
+	if err := freeze.FreezeBranches(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	frozen, _, _ := client.ProtectedBranches.GetProtectedBranch(10, "master")
+	if firstAccessLevel(frozen.MergeAccessLevels) != gitlab.NoPermissions {
+		t.Errorf("Expected the role based merge access level to be frozen, got %+v", frozen.MergeAccessLevels)
+	}
+
+	unfreeze := newTestManager(client, cfg)
+	for _, b := range freeze.frozenBranches {
+		if err := unfreeze.UnfreezeBranch(b, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	after, _, _ := client.ProtectedBranches.GetProtectedBranch(10, "master")
+	if after.ID != before.ID || !after.AllowForcePush {
+		t.Errorf("Expected the protection to be updated in place, got ID %d (was %d) and allow force push %v", after.ID, before.ID, after.AllowForcePush)
+	}
+	levels := func(descriptions []*gitlab.BranchAccessDescription) string {
+		var s []string
+		for _, d := range descriptions {
+			s = append(s, fmt.Sprintf("%d/user:%d/group:%d", d.AccessLevel, d.UserID, d.GroupID))
+		}
+		sort.Strings(s)
+		return strings.Join(s, " ")
+	}
+	if levels(after.PushAccessLevels) != levels(before.PushAccessLevels) || levels(after.MergeAccessLevels) != levels(before.MergeAccessLevels) {
+		t.Errorf("Expected the access levels to be restored, got push %s and merge %s", levels(after.PushAccessLevels), levels(after.MergeAccessLevels))
+	}
+
+	rules, _, _ := client.Projects.GetProjectApprovalRules(10, nil)
+	if len(rules) != 1 || len(rules[0].ProtectedBranches) != 1 || rules[0].ProtectedBranches[0].ID != before.ID {
+		t.Errorf("Expected the approval rule to stay scoped to protected branch %d, got %+v", before.ID, rules)
+	}
+}
@@ -0,0 +1,144 @@
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ComplianceFrameworksService looks up and assigns compliance frameworks via the GitLab
+// GraphQL API, as the REST API only lists the frameworks of a project
+type ComplianceFrameworksService struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewComplianceFrameworksService returns a new ComplianceFrameworksService for the GitLab
+// instance of the REST API baseURL (e.g. https://gitlab.com/api/v4/)
+func NewComplianceFrameworksService(baseURL *url.URL, token string, httpClient *http.Client) *ComplianceFrameworksService {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &ComplianceFrameworksService{
+		url:        baseURL.ResolveReference(&url.URL{Path: "../graphql"}).String(),
+		token:      token,
+		httpClient: httpClient,
+	}
+}
+
+const complianceFrameworksQuery = `query($fullPath: ID!, $name: String) {
+  namespace(fullPath: $fullPath) {
+    complianceFrameworks(search: $name) { nodes { id name } }
+  }
+}`
+
+const setComplianceFrameworkMutation = `mutation($input: ProjectSetComplianceFrameworkInput!) {
+  projectSetComplianceFramework(input: $input) { errors }
+}`
+
+// ComplianceFrameworkID returns the global ID of the compliance framework with the name in
+// the namespace, or an empty ID if there is none
+func (s *ComplianceFrameworksService) ComplianceFrameworkID(namespace string, name string) (string, error) {
+	var data struct {
+		Namespace *struct {
+			ComplianceFrameworks struct {
+				Nodes []struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"nodes"`
+			} `json:"complianceFrameworks"`
+		} `json:"namespace"`
+	}
+	if err := s.do(complianceFrameworksQuery, map[string]interface{}{"fullPath": namespace, "name": name}, &data); err != nil {
+		return "", err
+	}
+	if data.Namespace == nil {
+		return "", fmt.Errorf("namespace %s not found", namespace)
+	}
+
+	// The search also matches partial names
+	for _, f := range data.Namespace.ComplianceFrameworks.Nodes {
+		if f.Name == name {
+			return f.ID, nil
+		}
+	}
+
+	return "", nil
+}
+
+// SetProjectComplianceFramework assigns the compliance framework with the global ID to the
+// project, replacing the current one
+func (s *ComplianceFrameworksService) SetProjectComplianceFramework(projectID int, frameworkID string) error {
+	var data struct {
+		ProjectSetComplianceFramework struct {
+			Errors []string `json:"errors"`
+		} `json:"projectSetComplianceFramework"`
+	}
+	input := map[string]interface{}{
+		"projectId":             fmt.Sprintf("gid://gitlab/Project/%d", projectID),
+		"complianceFrameworkId": frameworkID,
+	}
+	if err := s.do(setComplianceFrameworkMutation, map[string]interface{}{"input": input}, &data); err != nil {
+		return err
+	}
+	if errs := data.ProjectSetComplianceFramework.Errors; len(errs) > 0 {
+		return fmt.Errorf("graphql: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// do executes the GraphQL query with the variables and decodes the data of the response
+func (s *ComplianceFrameworksService) do(query string, variables map[string]interface{}, data interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return fmt.Errorf("failed to convert graphql request to json: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("graphql request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("graphql request failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode graphql response: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		var messages []string
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("graphql: %s", strings.Join(messages, "; "))
+	}
+
+	return json.Unmarshal(result.Data, data)
+}
+
+// isUnavailableFieldError reports whether the GraphQL error is caused by a field missing in
+// the schema, e.g. EE features queried on GitLab CE
+func isUnavailableFieldError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "doesn't exist on type")
+}
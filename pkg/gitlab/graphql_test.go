@@ -0,0 +1,62 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestComplianceFrameworksService(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/graphql" {
+			t.Errorf("Expected a request to /api/graphql, got %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Expected bearer authentication, got %q", auth)
+		}
+
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+
+		switch len(requests) {
+		case 1:
+			w.Write([]byte(`{"data": {"namespace": {"complianceFrameworks": {"nodes": [
+				{"id": "gid://gitlab/ComplianceManagement::Framework/1", "name": "SOX 2"},
+				{"id": "gid://gitlab/ComplianceManagement::Framework/2", "name": "SOX"}
+			]}}}}`))
+		case 2:
+			w.Write([]byte(`{"data": {"projectSetComplianceFramework": {"errors": []}}}`))
+		default:
+			w.Write([]byte(`{"errors": [{"message": "Field 'complianceFrameworks' doesn't exist on type 'Namespace'"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	baseURL, _ := url.Parse(server.URL + "/api/v4/")
+	s := NewComplianceFrameworksService(baseURL, "secret", nil)
+
+	id, err := s.ComplianceFrameworkID("example", "SOX")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if id != "gid://gitlab/ComplianceManagement::Framework/2" {
+		t.Errorf("Expected the framework with the exact name, got %s", id)
+	}
+
+	if err := s.SetProjectComplianceFramework(10, id); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	input := requests[1]["variables"].(map[string]interface{})["input"].(map[string]interface{})
+	if input["projectId"] != "gid://gitlab/Project/10" || input["complianceFrameworkId"] != id {
+		t.Errorf("Expected the project and framework global IDs, got %v", input)
+	}
+
+	_, err = s.ComplianceFrameworkID("example", "SOX")
+	if !isUnavailableFieldError(err) {
+		t.Errorf("Expected an unavailable field error, got %v", err)
+	}
+}
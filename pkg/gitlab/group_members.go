@@ -0,0 +1,291 @@
+package gitlab
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/r3labs/diff"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// GroupMemberSettings is the recorded state of a direct member of the group, a user or a
+// group the group is shared with
+type GroupMemberSettings struct {
+	Exists      bool
+	AccessLevel config.AccessLevel
+}
+
+// groupMemberDiff holds the changes of a single group member
+type groupMemberDiff struct {
+	key      string
+	difflog  diff.Changelog
+	original map[string]*GroupMemberSettings
+	updated  map[string]*GroupMemberSettings
+}
+
+// groupMember is a user or a group with its access level in the group, see
+// config.GroupMember.Key for its key
+type groupMember struct {
+	userID  int
+	groupID int
+	level   gitlab.AccessLevelValue
+}
+
+// EnsureGroupMembers ensures the members configured in group_members on the group given by
+// group_name. Users are matched by user_id, shared groups by group_id, and added or changed
+// to the configured access level as needed. With prune, other direct members and shares of the
+// group are removed. Owners are kept if the group would be left without one. Additions and
+// promotions are applied before removals and demotions, so replacing the only owner works.
+func (m *ProjectManager) EnsureGroupMembers(dryrun bool) error {
+	if m.config.GroupMembers == nil {
+		return nil
+	}
+
+	group := m.config.GroupName
+	current, err := m.listGroupMembers(group)
+	if err != nil {
+		return err
+	}
+
+	desired := make(map[string]groupMember)
+	for _, member := range m.config.GroupMembers.Members {
+		desired[member.Key()] = groupMember{userID: member.UserID, groupID: member.GroupID, level: *member.AccessLevel.Value()}
+	}
+	if !m.config.GroupMembers.Prune {
+		for key, member := range current {
+			if _, ok := desired[key]; !ok {
+				desired[key] = member
+			}
+		}
+	}
+
+	// GitLab refuses to remove or demote the last owner, don't even try
+	if countOwners(desired) == 0 {
+		for key, member := range current {
+			if member.userID != 0 && member.level == gitlab.OwnerPermissions {
+				m.warnf("keeping %s as owner of group %s, it would be left without owner", key, group)
+				desired[key] = member
+			}
+		}
+	}
+
+	keys := make(map[string]bool)
+	for key := range current {
+		keys[key] = true
+	}
+	for key := range desired {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, reducing := range []bool{false, true} {
+		for _, key := range sorted {
+			existing, exists := current[key]
+			member, wanted := desired[key]
+			if reducesAccess(existing, exists, member, wanted) != reducing {
+				continue
+			}
+			if err := m.ensureGroupMember(group, key, existing, exists, member, wanted, dryrun); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// reducesAccess reports whether ensuring the member removes or demotes it
+func reducesAccess(existing groupMember, exists bool, member groupMember, wanted bool) bool {
+	return exists && (!wanted || member.level < existing.level)
+}
+
+// ensureGroupMember adds, changes or removes the member of the group
+func (m *ProjectManager) ensureGroupMember(group string, key string, existing groupMember, exists bool, member groupMember, wanted bool, dryrun bool) error {
+	current := &GroupMemberSettings{}
+	if exists {
+		current = &GroupMemberSettings{Exists: true, AccessLevel: accessLevelName(existing.level)}
+	}
+	m.recordGroupMember(m.GroupMembersOriginal, group, key, current)
+
+	if exists == wanted && (!exists || existing.level == member.level) {
+		m.logger.Debugf("Member %s of group %s is up to date.", key, group)
+		m.recordGroupMember(m.GroupMembersUpdated, group, key, current)
+		return nil
+	}
+
+	desired := &GroupMemberSettings{}
+	if wanted {
+		desired = &GroupMemberSettings{Exists: true, AccessLevel: accessLevelName(member.level)}
+	}
+	m.recordGroupMember(m.GroupMembersUpdated, group, key, desired)
+
+	if !wanted {
+		return m.removeGroupMember(group, key, existing, dryrun)
+	}
+
+	if member.groupID != 0 {
+		// Shares can't be changed, they are replaced instead
+		if exists {
+			if err := m.removeGroupMember(group, key, existing, dryrun); err != nil {
+				return err
+			}
+		}
+		if dryrun {
+			m.skipAPICall("ShareWithGroup", "for %s.", key)
+			return nil
+		}
+		opt := &gitlab.ShareWithGroupOptions{GroupID: gitlab.Int(member.groupID), GroupAccess: gitlab.AccessLevel(member.level)}
+		if _, _, err := m.groupMembersClient.ShareWithGroup(group, opt); err != nil {
+			return fmt.Errorf("failed to share group %s with %s: %v", group, key, err)
+		}
+		m.logger.Infof("Shared group %s with %s.", group, key)
+		return nil
+	}
+
+	if exists {
+		if dryrun {
+			m.skipAPICall("EditGroupMember", "for %s.", key)
+			return nil
+		}
+		opt := &gitlab.EditGroupMemberOptions{AccessLevel: gitlab.AccessLevel(member.level)}
+		if _, _, err := m.groupMembersClient.EditGroupMember(group, member.userID, opt); err != nil {
+			return fmt.Errorf("failed to update member %s of group %s: %v", key, group, err)
+		}
+		m.logger.Infof("Updated member %s of group %s.", key, group)
+		return nil
+	}
+
+	if dryrun {
+		m.skipAPICall("AddGroupMember", "for %s.", key)
+		return nil
+	}
+	opt := &gitlab.AddGroupMemberOptions{UserID: gitlab.Int(member.userID), AccessLevel: gitlab.AccessLevel(member.level)}
+	if _, _, err := m.groupMembersClient.AddGroupMember(group, opt); err != nil {
+		return fmt.Errorf("failed to add member %s to group %s: %v", key, group, err)
+	}
+	m.logger.Infof("Added member %s to group %s.", key, group)
+
+	return nil
+}
+
+// removeGroupMember removes the user from the group, or the share with the group
+func (m *ProjectManager) removeGroupMember(group string, key string, member groupMember, dryrun bool) error {
+	if member.groupID != 0 {
+		if dryrun {
+			m.skipAPICall("DeleteShareWithGroup", "for %s.", key)
+			return nil
+		}
+		if _, err := m.groupMembersClient.DeleteShareWithGroup(group, member.groupID); err != nil {
+			return fmt.Errorf("failed to remove share of group %s with %s: %v", group, key, err)
+		}
+		m.logger.Infof("Removed share of group %s with %s.", group, key)
+		return nil
+	}
+
+	if dryrun {
+		m.skipAPICall("RemoveGroupMember", "for %s.", key)
+		return nil
+	}
+	if _, err := m.groupMembersClient.RemoveGroupMember(group, member.userID, nil); err != nil {
+		return fmt.Errorf("failed to remove member %s of group %s: %v", key, group, err)
+	}
+	m.logger.Infof("Removed member %s of group %s.", key, group)
+
+	return nil
+}
+
+// listGroupMembers returns the direct members of the group and the groups it is shared with,
+// by key. Members inherited from parent groups are not included.
+func (m *ProjectManager) listGroupMembers(group string) (map[string]groupMember, error) {
+	members := make(map[string]groupMember)
+
+	opt := &gitlab.ListGroupMembersOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := m.groupsClient.ListGroupMembers(group, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list members of group %s: %v", group, err)
+		}
+		for _, user := range page {
+			member := config.GroupMember{UserID: user.ID}
+			members[member.Key()] = groupMember{userID: user.ID, level: user.AccessLevel}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	g, _, err := m.groupsClient.GetGroup(group, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group %s: %v", group, err)
+	}
+	for _, share := range g.SharedWithGroups {
+		member := config.GroupMember{GroupID: share.GroupID}
+		members[member.Key()] = groupMember{groupID: share.GroupID, level: gitlab.AccessLevelValue(share.GroupAccessLevel)}
+	}
+
+	return members, nil
+}
+
+// countOwners returns the number of users among the members which are owners
+func countOwners(members map[string]groupMember) int {
+	var owners int
+	for _, member := range members {
+		if member.userID != 0 && member.level == gitlab.OwnerPermissions {
+			owners++
+		}
+	}
+
+	return owners
+}
+
+// recordGroupMember stores the settings of the member of the group in the given original or
+// updated states
+func (m *ProjectManager) recordGroupMember(states map[string]map[string]*GroupMemberSettings, group string, key string, settings *GroupMemberSettings) {
+	if _, ok := states[group]; !ok {
+		states[group] = make(map[string]*GroupMemberSettings)
+	}
+	states[group][key] = settings
+}
+
+// groupMemberDiffs returns the changes of the group members per key, sorted by key. The states
+// are regrouped by key to diff them like the other settings.
+func (m *ProjectManager) groupMemberDiffs() ([]groupMemberDiff, error) {
+	byKey := make(map[string]*groupMemberDiff)
+	for group, members := range m.GroupMembersOriginal {
+		for key, settings := range members {
+			if _, ok := byKey[key]; !ok {
+				byKey[key] = &groupMemberDiff{
+					key:      key,
+					original: make(map[string]*GroupMemberSettings),
+					updated:  make(map[string]*GroupMemberSettings),
+				}
+			}
+			byKey[key].original[group] = settings
+			byKey[key].updated[group] = m.GroupMembersUpdated[group][key]
+		}
+	}
+
+	diffs := make([]groupMemberDiff, 0, len(byKey))
+	for _, d := range byKey {
+		difflog, err := diff.Diff(d.original, d.updated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff member %s: %v", d.key, err)
+		}
+		d.difflog = difflog
+		diffs = append(diffs, *d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].key < diffs[j].key
+	})
+
+	return diffs, nil
+}
@@ -0,0 +1,179 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestEnsureGroupMembers(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"group_name": "example/sub",
+		"group_members": {
+			"members": [
+				{"user_id": 1, "access_level": "owner"},
+				{"user_id": 2, "access_level": "maintainer"},
+				{"group_id": 7, "access_level": "developer"}
+			],
+			"prune": true
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, dryrun := range []bool{true, false} {
+		client := newTestClient()
+		client.AddGroupMember(2, &gitlab.GroupMember{ID: 2, AccessLevel: gitlab.DeveloperPermissions})
+		client.AddGroupMember(2, &gitlab.GroupMember{ID: 3, AccessLevel: gitlab.OwnerPermissions})
+		client.GroupMembers.ShareWithGroup(2, &gitlab.ShareWithGroupOptions{GroupID: gitlab.Int(7), GroupAccess: gitlab.AccessLevel(gitlab.ReporterPermissions)})
+
+		manager := newTestManager(client, cfg)
+		if err := manager.EnsureGroupMembers(dryrun); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		entries, err := manager.ChangeLogEntries(false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		changed := make(map[string]interface{})
+		for _, e := range entries {
+			changed[e.Subsection+"."+e.Setting] = e.To
+		}
+		expected := map[string]interface{}{
+			"group_members[user:1].exists":        true,
+			"group_members[user:1].access_level":  "owner",
+			"group_members[user:2].access_level":  "maintainer",
+			"group_members[user:3].exists":        false,
+			"group_members[user:3].access_level":  "",
+			"group_members[group:7].access_level": "developer",
+		}
+		for setting, to := range expected {
+			if changed[setting] != to {
+				t.Errorf("Expected %s to change to %q (dryrun %v), got %v", setting, to, dryrun, changed)
+			}
+		}
+
+		members, _, _ := client.Groups.ListGroupMembers(2, nil)
+		levels := make(map[int]gitlab.AccessLevelValue)
+		for _, member := range members {
+			levels[member.ID] = member.AccessLevel
+		}
+		group, _, _ := client.Groups.GetGroup(2, nil)
+		if dryrun {
+			if len(levels) != 2 || levels[2] != gitlab.DeveloperPermissions || group.SharedWithGroups[0].GroupAccessLevel != int(gitlab.ReporterPermissions) {
+				t.Errorf("Expected a dryrun to leave the members untouched, got %v and %+v", levels, group.SharedWithGroups)
+			}
+			continue
+		}
+		if len(levels) != 2 || levels[1] != gitlab.OwnerPermissions || levels[2] != gitlab.MaintainerPermissions {
+			t.Errorf("Expected the configured members only, got %v", levels)
+		}
+		if len(group.SharedWithGroups) != 1 || group.SharedWithGroups[0].GroupAccessLevel != int(gitlab.DeveloperPermissions) {
+			t.Errorf("Expected the group to be shared with developer access, got %+v", group.SharedWithGroups)
+		}
+
+		// A second run has nothing left to do
+		second := newTestManager(client, cfg)
+		if err := second.EnsureGroupMembers(false); err != nil {
+			t.Fatalf("Expected no error on the second run, got %v", err)
+		}
+		if changes, err := second.HasChanges(); err != nil || changes {
+			t.Errorf("Expected no changes on the second run, got %v (%v)", changes, err)
+		}
+	}
+}
+
+func TestEnsureGroupMembersKeepsLastOwner(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"group_name": "example/sub",
+		"strict": true,
+		"group_members": {
+			"members": [{"user_id": 2, "access_level": "maintainer"}, {"user_id": 3, "access_level": "developer"}],
+			"prune": true
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	client := newTestClient()
+	client.AddGroupMember(2, &gitlab.GroupMember{ID: 1, AccessLevel: gitlab.OwnerPermissions})
+	client.AddGroupMember(2, &gitlab.GroupMember{ID: 3, AccessLevel: gitlab.OwnerPermissions})
+
+	manager := newTestManager(client, cfg)
+	if err := manager.EnsureGroupMembers(false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !manager.GetError() {
+		t.Errorf("Expected keeping the owners to be reported as error in strict mode")
+	}
+
+	members, _, _ := client.Groups.ListGroupMembers(2, nil)
+	levels := make(map[int]gitlab.AccessLevelValue)
+	for _, member := range members {
+		levels[member.ID] = member.AccessLevel
+	}
+	expected := map[int]gitlab.AccessLevelValue{1: gitlab.OwnerPermissions, 2: gitlab.MaintainerPermissions, 3: gitlab.OwnerPermissions}
+	if len(levels) != len(expected) {
+		t.Fatalf("Expected members %v, got %v", expected, levels)
+	}
+	for id, level := range expected {
+		if levels[id] != level {
+			t.Errorf("Expected user %d with access level %d, got %d", id, level, levels[id])
+		}
+	}
+}
+
+func TestEnsureGroupMembersReplacesSoleOwner(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"group_name": "example/sub",
+		"group_members": {
+			"members": [{"user_id": 5, "access_level": "owner"}, {"user_id": 1, "access_level": "developer"}],
+			"prune": true
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, members := range []string{"removed", "demoted"} {
+		t.Run(members, func(t *testing.T) {
+			cfg := *cfg
+			if members == "removed" {
+				cfg.GroupMembers = &config.GroupMembers{Members: cfg.GroupMembers.Members[:1], Prune: true}
+			}
+
+			client := newTestClient()
+			client.AddGroupMember(2, &gitlab.GroupMember{ID: 1, AccessLevel: gitlab.OwnerPermissions})
+
+			manager := newTestManager(client, &cfg)
+			if err := manager.EnsureGroupMembers(false); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if manager.GetError() {
+				t.Errorf("Expected no error to be reported")
+			}
+
+			list, _, _ := client.Groups.ListGroupMembers(2, nil)
+			levels := make(map[int]gitlab.AccessLevelValue)
+			for _, member := range list {
+				levels[member.ID] = member.AccessLevel
+			}
+			expected := map[int]gitlab.AccessLevelValue{5: gitlab.OwnerPermissions}
+			if members == "demoted" {
+				expected[1] = gitlab.DeveloperPermissions
+			}
+			if len(levels) != len(expected) {
+				t.Fatalf("Expected members %v, got %v", expected, levels)
+			}
+			for id, level := range expected {
+				if levels[id] != level {
+					t.Errorf("Expected user %d with access level %d, got %d", id, level, levels[id])
+				}
+			}
+		})
+	}
+}
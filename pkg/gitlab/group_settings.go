@@ -0,0 +1,101 @@
+package gitlab
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/iancoleman/strcase"
+	"github.com/r3labs/diff"
+	"github.com/xanzy/go-gitlab"
+)
+
+// EnsureGroupSettings updates the settings of the group given by group_name, e.g. the default
+// branch protection or the file template project new projects start with. Changes are listed
+// in the change log under the group path.
+func (m *ProjectManager) EnsureGroupSettings(dryrun bool) error {
+	if m.config.GroupSettings == nil {
+		m.logger.Debugf("No group_settings section provided in config")
+		return nil
+	}
+
+	path := m.config.GroupName
+	m.logger.Debugf("Updating group settings of group %s ...", path)
+
+	group, resp, err := m.groupsClient.GetGroup(path, nil)
+	if err != nil {
+		return groupError(path, resp, err)
+	}
+
+	// Record current settings states
+	m.GroupSettingsOriginal[path] = group
+
+	settings, err := m.checkTwoFactorMembers(group, m.config.GroupSettings)
+	if err != nil {
+		return err
+	}
+
+	desired := &gitlab.Group{}
+	if err := applyOptions(&gitlab.Group{}, settings, desired); err != nil {
+		return err
+	}
+
+	if !m.willChangeGroupSettings(group, desired, configuredFields(settings)) {
+		m.logger.Debugf("No action required.")
+
+		// Record current settings states
+		m.GroupSettingsUpdated[path] = group
+
+		return nil
+	}
+
+	if dryrun {
+		m.skipAPICall("UpdateGroup", "")
+
+		// Record the expected settings states to show the planned changes
+		projected := &gitlab.Group{}
+		if err := applyOptions(group, settings, projected); err != nil {
+			return err
+		}
+		m.GroupSettingsUpdated[path] = projected
+
+		return nil
+	}
+
+	if _, _, err := m.groupsClient.UpdateGroup(group.ID, settings); err != nil {
+		return fmt.Errorf("failed to update settings of group %s: %v", path, err)
+	}
+	m.logger.Infof("Updated settings of group %s.", path)
+
+	// Record new settings states
+	group, resp, err = m.groupsClient.GetGroup(path, nil)
+	if err != nil {
+		return groupError(path, resp, err)
+	}
+	m.GroupSettingsUpdated[path] = group
+
+	return nil
+}
+
+// willChangeGroupSettings reports whether the configured fields differ from the current group
+// settings, like willChangeProjectSettings
+func (m *ProjectManager) willChangeGroupSettings(current *gitlab.Group, changes *gitlab.Group, fields map[string]bool) bool {
+	changelog, _ := diff.Diff(current, changes)
+
+	for _, change := range changelog {
+		if fields[change.Path[0]] {
+			return true
+		}
+	}
+
+	// Settings which are not part of the group representation can't be compared, so
+	// assume they need to be applied.
+	groupType := reflect.TypeOf(gitlab.Group{})
+	for field := range fields {
+		if _, ok := groupType.FieldByName(field); !ok {
+			m.logger.Debugf("Setting %s is not returned by the API, assuming a change.", strcase.ToSnake(field))
+			return true
+		}
+	}
+
+	return false
+}
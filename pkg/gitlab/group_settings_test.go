@@ -0,0 +1,73 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestEnsureGroupSettings(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"group_name": "example/sub",
+		"group_settings": {"default_branch_protection": 2, "file_template_project_id": 42}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, dryrun := range []bool{true, false} {
+		client := newTestClient()
+		manager := newTestManager(client, cfg)
+		if err := manager.EnsureGroupSettings(dryrun); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		entries, err := manager.ChangeLogEntries(false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		changed := make(map[string]interface{})
+		for _, e := range entries {
+			if e.Project != "example/sub" || e.Subsection != "group_settings" {
+				t.Errorf("Expected only group_settings of example/sub to change, got %+v", e)
+			}
+			changed[e.Setting] = e.To
+		}
+		if changed["default_branch_protection"] != 2 || changed["file_template_project_id"] != 42 || len(changed) != 2 {
+			t.Errorf("Expected the default branch protection and file template project to change (dryrun %v), got %v", dryrun, changed)
+		}
+
+		group, _, _ := client.Groups.GetGroup(2, nil)
+		if dryrun {
+			if group.DefaultBranchProtection != 0 {
+				t.Errorf("Expected a dryrun to leave the group untouched, got %d", group.DefaultBranchProtection)
+			}
+			continue
+		}
+		if group.DefaultBranchProtection != 2 || group.FileTemplateProjectID != 42 {
+			t.Errorf("Expected the group settings to be updated, got %+v", group)
+		}
+
+		// A second run has nothing left to do
+		second := newTestManager(client, cfg)
+		if err := second.EnsureGroupSettings(false); err != nil {
+			t.Fatalf("Expected no error on the second run, got %v", err)
+		}
+		if changes, err := second.HasChanges(); err != nil || changes {
+			t.Errorf("Expected no changes on the second run, got %v (%v)", changes, err)
+		}
+	}
+}
+
+func TestEnsureGroupSettingsMissingGroup(t *testing.T) {
+	manager := newTestManager(newTestClient(), &config.Config{
+		GroupName:     "missing",
+		GroupSettings: &gitlab.UpdateGroupOptions{DefaultBranchProtection: gitlab.Int(2)},
+	})
+
+	if err := manager.EnsureGroupSettings(false); err == nil {
+		t.Errorf("Expected an error for a missing group")
+	}
+}
@@ -0,0 +1,263 @@
+package gitlab
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/r3labs/diff"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+const (
+	// maskedValue replaces the values of masked variables in the recorded states
+	maskedValue = "[MASKED]"
+
+	// maskedValueChanged replaces the new values of masked variables whose value changed
+	maskedValueChanged = "[MASKED] (changed)"
+)
+
+// GroupVariableSettings is the recorded state of a CI/CD variable of a group or a project.
+// Values of masked variables are replaced, so they never show up in logs or reports.
+type GroupVariableSettings struct {
+	Exists           bool
+	Value            string
+	VariableType     string
+	Protected        bool
+	Masked           bool
+	Raw              bool
+	EnvironmentScope string
+}
+
+// variableDiff holds the changes of a single group or project variable
+type variableDiff struct {
+	key      string
+	difflog  diff.Changelog
+	original map[string]*GroupVariableSettings
+	updated  map[string]*GroupVariableSettings
+}
+
+// EnsureGroupVariables ensures the CI/CD variables configured in group_ci_variables on the
+// group given by group_name. Variables are matched by key and created or updated as needed.
+// With prune, other variables of the group are removed.
+func (m *ProjectManager) EnsureGroupVariables(dryrun bool) error {
+	if m.config.GroupCIVariables == nil {
+		return nil
+	}
+
+	group := m.config.GroupName
+	existing, err := m.listGroupVariables(group)
+	if err != nil {
+		return err
+	}
+
+	configured := make(map[string]bool)
+	for _, v := range m.config.GroupCIVariables.Variables {
+		configured[v.Key] = true
+		if err := m.ensureGroupVariable(group, v, existing[v.Key], dryrun); err != nil {
+			return err
+		}
+	}
+
+	if !m.config.GroupCIVariables.Prune {
+		return nil
+	}
+
+	var keys []string
+	for key := range existing {
+		if !configured[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		recordVariable(m.GroupVariablesOriginal, group, key, groupVariableSettings(existing[key]))
+		recordVariable(m.GroupVariablesUpdated, group, key, &GroupVariableSettings{})
+
+		if dryrun {
+			m.skipAPICall("RemoveVariable", "for %s.", key)
+			continue
+		}
+		if _, err := m.groupVariablesClient.RemoveVariable(group, key); err != nil {
+			return fmt.Errorf("failed to remove variable %s of group %s: %v", key, group, err)
+		}
+		m.logger.Infof("Removed variable %s of group %s.", key, group)
+	}
+
+	return nil
+}
+
+// ensureGroupVariable creates or updates the variable of the group
+func (m *ProjectManager) ensureGroupVariable(group string, v config.CIVariable, existing *gitlab.GroupVariable, dryrun bool) error {
+	current := &GroupVariableSettings{}
+	if existing != nil {
+		current = groupVariableSettings(existing)
+	}
+	recordVariable(m.GroupVariablesOriginal, group, v.Key, current)
+
+	if existing != nil && groupCIVariable(existing) == v {
+		m.logger.Debugf("Variable %s of group %s is up to date.", v.Key, group)
+		recordVariable(m.GroupVariablesUpdated, group, v.Key, current)
+		return nil
+	}
+
+	desired := &GroupVariableSettings{
+		Exists:           true,
+		Value:            v.Value,
+		VariableType:     v.VariableType,
+		Protected:        v.Protected,
+		Masked:           v.Masked,
+		Raw:              v.Raw,
+		EnvironmentScope: v.EnvironmentScope,
+	}
+	if v.Masked {
+		desired.Value = maskedValue
+		if existing != nil && existing.Value != v.Value {
+			desired.Value = maskedValueChanged
+		}
+	}
+
+	if dryrun {
+		if existing == nil {
+			m.skipAPICall("CreateVariable", "for %s.", v.Key)
+		} else {
+			m.skipAPICall("UpdateVariable", "for %s.", v.Key)
+		}
+		recordVariable(m.GroupVariablesUpdated, group, v.Key, desired)
+		return nil
+	}
+
+	variableType := gitlab.VariableTypeValue(v.VariableType)
+	if existing == nil {
+		opt := &gitlab.CreateGroupVariableOptions{
+			Key:              gitlab.String(v.Key),
+			Value:            gitlab.String(v.Value),
+			VariableType:     &variableType,
+			Protected:        gitlab.Bool(v.Protected),
+			Masked:           gitlab.Bool(v.Masked),
+			Raw:              gitlab.Bool(v.Raw),
+			EnvironmentScope: gitlab.String(v.EnvironmentScope),
+		}
+		if _, _, err := m.groupVariablesClient.CreateVariable(group, opt); err != nil {
+			return fmt.Errorf("failed to create variable %s of group %s: %v", v.Key, group, err)
+		}
+		m.logger.Infof("Created variable %s of group %s.", v.Key, group)
+	} else {
+		opt := &gitlab.UpdateGroupVariableOptions{
+			Value:            gitlab.String(v.Value),
+			VariableType:     &variableType,
+			Protected:        gitlab.Bool(v.Protected),
+			Masked:           gitlab.Bool(v.Masked),
+			Raw:              gitlab.Bool(v.Raw),
+			EnvironmentScope: gitlab.String(v.EnvironmentScope),
+		}
+		if _, _, err := m.groupVariablesClient.UpdateVariable(group, v.Key, opt); err != nil {
+			return fmt.Errorf("failed to update variable %s of group %s: %v", v.Key, group, err)
+		}
+		m.logger.Infof("Updated variable %s of group %s.", v.Key, group)
+	}
+
+	recordVariable(m.GroupVariablesUpdated, group, v.Key, desired)
+
+	return nil
+}
+
+// listGroupVariables returns all variables of the group by key
+func (m *ProjectManager) listGroupVariables(group string) (map[string]*gitlab.GroupVariable, error) {
+	variables := make(map[string]*gitlab.GroupVariable)
+
+	opt := &gitlab.ListGroupVariablesOptions{PerPage: 100}
+	for {
+		page, resp, err := m.groupVariablesClient.ListVariables(group, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list variables of group %s: %v", group, err)
+		}
+		for _, v := range page {
+			variables[v.Key] = v
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return variables, nil
+}
+
+// groupCIVariable returns the existing variable of the group as configured
+func groupCIVariable(v *gitlab.GroupVariable) config.CIVariable {
+	return config.CIVariable{
+		Key:              v.Key,
+		Value:            v.Value,
+		VariableType:     string(v.VariableType),
+		Protected:        v.Protected,
+		Masked:           v.Masked,
+		Raw:              v.Raw,
+		EnvironmentScope: v.EnvironmentScope,
+	}
+}
+
+// groupVariableSettings returns the recorded state of the existing variable
+func groupVariableSettings(v *gitlab.GroupVariable) *GroupVariableSettings {
+	settings := &GroupVariableSettings{
+		Exists:           true,
+		Value:            v.Value,
+		VariableType:     string(v.VariableType),
+		Protected:        v.Protected,
+		Masked:           v.Masked,
+		Raw:              v.Raw,
+		EnvironmentScope: v.EnvironmentScope,
+	}
+	if v.Masked {
+		settings.Value = maskedValue
+	}
+
+	return settings
+}
+
+// recordVariable stores the settings of the variable of the group or project given by its
+// path in the given original or updated states
+func recordVariable(states map[string]map[string]*GroupVariableSettings, path string, key string, settings *GroupVariableSettings) {
+	if _, ok := states[path]; !ok {
+		states[path] = make(map[string]*GroupVariableSettings)
+	}
+	states[path][key] = settings
+}
+
+// variableDiffs returns the changes of the group or project variables per key, sorted by key.
+// The states are regrouped by key to diff them like the other settings.
+func variableDiffs(original, updated map[string]map[string]*GroupVariableSettings) ([]variableDiff, error) {
+	byKey := make(map[string]*variableDiff)
+	for path, variables := range original {
+		for key, settings := range variables {
+			if _, ok := byKey[key]; !ok {
+				byKey[key] = &variableDiff{
+					key:      key,
+					original: make(map[string]*GroupVariableSettings),
+					updated:  make(map[string]*GroupVariableSettings),
+				}
+			}
+			byKey[key].original[path] = settings
+			byKey[key].updated[path] = updated[path][key]
+		}
+	}
+
+	diffs := make([]variableDiff, 0, len(byKey))
+	for _, d := range byKey {
+		difflog, err := diff.Diff(d.original, d.updated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff variable %s: %v", d.key, err)
+		}
+		d.difflog = difflog
+		diffs = append(diffs, *d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].key < diffs[j].key
+	})
+
+	return diffs, nil
+}
@@ -0,0 +1,112 @@
+package gitlab
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestEnsureGroupVariables(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"group_name": "example/sub",
+		"group_ci_variables": {
+			"variables": [
+				{"key": "DEPLOY_TOKEN", "value": "s3cr3t", "masked": true, "protected": true},
+				{"key": "REGISTRY", "value": "registry.example.com"}
+			],
+			"prune": true
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, dryrun := range []bool{true, false} {
+		client := newTestClient()
+		client.AddGroupVariable(2, &gitlab.GroupVariable{Key: "REGISTRY", Value: "old.example.com", VariableType: gitlab.EnvVariableType, EnvironmentScope: "*"})
+		client.AddGroupVariable(2, &gitlab.GroupVariable{Key: "LEGACY", Value: "legacy", VariableType: gitlab.EnvVariableType, EnvironmentScope: "*"})
+
+		manager := newTestManager(client, cfg)
+		if err := manager.EnsureGroupVariables(dryrun); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		entries, err := manager.ChangeLogEntries(false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		changed := make(map[string]interface{})
+		for _, e := range entries {
+			if strings.Contains(fmt.Sprint(e.From, e.To), "s3cr3t") {
+				t.Errorf("Expected the masked value to be redacted, got %+v", e)
+			}
+			changed[e.Subsection+"."+e.Setting] = e.To
+		}
+		if changed["group_ci_variables[DEPLOY_TOKEN].exists"] != true || changed["group_ci_variables[DEPLOY_TOKEN].value"] != maskedValue {
+			t.Errorf("Expected DEPLOY_TOKEN to be created with a redacted value (dryrun %v), got %v", dryrun, changed)
+		}
+		if changed["group_ci_variables[REGISTRY].value"] != "registry.example.com" {
+			t.Errorf("Expected REGISTRY to be updated (dryrun %v), got %v", dryrun, changed)
+		}
+		if changed["group_ci_variables[LEGACY].exists"] != false {
+			t.Errorf("Expected LEGACY to be removed (dryrun %v), got %v", dryrun, changed)
+		}
+
+		variables, _, _ := client.GroupVariables.ListVariables(2, nil)
+		values := make(map[string]string)
+		for _, v := range variables {
+			values[v.Key] = v.Value
+		}
+		if dryrun {
+			if len(values) != 2 || values["REGISTRY"] != "old.example.com" {
+				t.Errorf("Expected a dryrun to leave the variables untouched, got %v", values)
+			}
+			continue
+		}
+		if len(values) != 2 || values["DEPLOY_TOKEN"] != "s3cr3t" || values["REGISTRY"] != "registry.example.com" {
+			t.Errorf("Expected the configured variables only, got %v", values)
+		}
+
+		// A second run has nothing left to do
+		second := newTestManager(client, cfg)
+		if err := second.EnsureGroupVariables(false); err != nil {
+			t.Fatalf("Expected no error on the second run, got %v", err)
+		}
+		if changes, err := second.HasChanges(); err != nil || changes {
+			t.Errorf("Expected no changes on the second run, got %v (%v)", changes, err)
+		}
+	}
+}
+
+func TestEnsureGroupVariablesMaskedValueChanged(t *testing.T) {
+	client := newTestClient()
+	client.AddGroupVariable(2, &gitlab.GroupVariable{Key: "TOKEN", Value: "old-secret", VariableType: gitlab.EnvVariableType, Masked: true, EnvironmentScope: "*"})
+	client.AddGroupVariable(2, &gitlab.GroupVariable{Key: "UNMANAGED", Value: "kept", VariableType: gitlab.EnvVariableType, EnvironmentScope: "*"})
+
+	manager := newTestManager(client, &config.Config{
+		GroupName: "example/sub",
+		GroupCIVariables: &config.GroupCIVariables{Variables: []config.CIVariable{
+			{Key: "TOKEN", Value: "new-secret", VariableType: config.CIVariableTypeEnv, Masked: true, EnvironmentScope: "*"},
+		}},
+	})
+	if err := manager.EnsureGroupVariables(false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	entries, err := manager.ChangeLogEntries(false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 1 || entries[0].From != maskedValue || entries[0].To != maskedValueChanged {
+		t.Errorf("Expected only a redacted value change, got %+v", entries)
+	}
+
+	variables, _, _ := client.GroupVariables.ListVariables(2, nil)
+	if len(variables) != 2 {
+		t.Errorf("Expected unconfigured variables to be kept without prune, got %d", len(variables))
+	}
+}
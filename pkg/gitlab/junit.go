@@ -0,0 +1,91 @@
+package gitlab
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// junitTestSuites is the root element of a JUnit XML report, as understood by GitLab's
+// test report UI (https://docs.gitlab.com/ee/ci/unit_test_reports.html)
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// newJUnitTestSuites converts the sorted compliance results into one test suite per project.
+// Non-compliant settings inherited from the group or instance are skipped test cases.
+func newJUnitTestSuites(results []ComplianceResult) junitTestSuites {
+	suites := junitTestSuites{Name: "compliance"}
+
+	for _, result := range results {
+		if len(suites.Suites) == 0 || suites.Suites[len(suites.Suites)-1].Name != result.Project {
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: result.Project})
+		}
+		suite := &suites.Suites[len(suites.Suites)-1]
+
+		testCase := junitTestCase{
+			Name:      result.Setting,
+			ClassName: result.Project + "." + result.Subsection,
+		}
+		if result.Unavailable {
+			testCase.Failure = &junitFailure{
+				Message: "settings unavailable",
+				Type:    "Unavailable",
+				Text:    fmt.Sprintf("%s of %s could not be fetched", result.Subsection, result.Project),
+			}
+			suite.Failures++
+			suites.Failures++
+		} else if !result.Compliant && result.Inherited != "" {
+			// Not enforceable per project, so reported apart from the failures
+			testCase.Skipped = &junitSkipped{
+				Message: fmt.Sprintf("expected %s, got %v, inherited from %s and not enforceable per project", result.ExpectedText(), result.Actual, result.Inherited),
+			}
+			suite.Skipped++
+			suites.Skipped++
+		} else if !result.Compliant {
+			message := fmt.Sprintf("expected %s, got %v", result.ExpectedText(), result.Actual)
+			testCase.Failure = &junitFailure{
+				Message: message,
+				Type:    "NonCompliant",
+				Text:    fmt.Sprintf("%s.%s of %s: %s", result.Subsection, result.Setting, result.Project, message),
+			}
+			suite.Failures++
+			suites.Failures++
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+		suite.Tests++
+		suites.Tests++
+	}
+
+	return suites
+}
@@ -0,0 +1,58 @@
+package gitlab
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+func TestWriteComplianceJUnitReport(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"approval_settings": {"reset_approvals_on_push": true},
+				"project_settings":  {"wiki_enabled": false},
+			},
+		},
+	})
+	manager.ApprovalSettingsOriginal["example/bar"] = &gitlab.ProjectApprovals{ResetApprovalsOnPush: true}
+	manager.ProjectSettingsOriginal["example/bar"] = &gitlab.Project{WikiEnabled: false}
+	manager.ApprovalSettingsOriginal["example/foo"] = &gitlab.ProjectApprovals{ResetApprovalsOnPush: false}
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: false}
+
+	path := filepath.Join(t.TempDir(), "compliance.xml")
+	if err := manager.WriteComplianceJUnitReport(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected report to be written, got %v", err)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(b, &report); err != nil {
+		t.Fatalf("Expected valid XML, got %v", err)
+	}
+
+	if report.Tests != 4 || report.Failures != 1 {
+		t.Errorf("Expected 4 tests with 1 failure, got %d tests with %d failures", report.Tests, report.Failures)
+	}
+	if len(report.Suites) != 2 || report.Suites[0].Name != "example/bar" || report.Suites[1].Name != "example/foo" {
+		t.Fatalf("Expected one sorted suite per project, got %+v", report.Suites)
+	}
+
+	failed := report.Suites[1].TestCases[0]
+	if failed.Name != "reset_approvals_on_push" || failed.ClassName != "example/foo.approval_settings" || failed.Failure == nil {
+		t.Errorf("Expected reset_approvals_on_push of example/foo to fail, got %+v", failed)
+	}
+	if report.Suites[1].TestCases[1].Failure != nil {
+		t.Errorf("Expected wiki_enabled of example/foo to pass, got %+v", report.Suites[1].TestCases[1].Failure)
+	}
+}
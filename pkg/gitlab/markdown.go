@@ -0,0 +1,144 @@
+package gitlab
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxMarkdownCommentSize stays below GitLab's limit of 1,000,000 characters per note
+	maxMarkdownCommentSize = 900000
+
+	// markdownCollapseThreshold is the number of changes of a project above which its
+	// table is collapsed into a <details> section
+	markdownCollapseThreshold = 10
+)
+
+// WriteChangeLogMarkdown writes the change log as markdown suitable for a GitLab merge request
+// comment to the given path. In dryrun the changes are listed as planned.
+func (m *ProjectManager) WriteChangeLogMarkdown(path string, fullDiff bool, dryrun bool) error {
+	entries, err := m.ChangeLogEntries(fullDiff)
+	if err != nil {
+		return err
+	}
+
+	output := Output{Sink: OutputFile, Format: FormatMarkdown, Path: path}
+	if err := m.writeOutput(output, changeLogReport{entries: m.reportOptions.changeLogEntries(entries), dryrun: dryrun}); err != nil {
+		return fmt.Errorf("failed to write markdown report to %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// changeLogMarkdown renders the sorted change log entries as one table per project
+func (m *ProjectManager) changeLogMarkdown(entries []ChangeLogEntry, dryrun bool) string {
+	var b strings.Builder
+
+	title := "Changes"
+	if dryrun {
+		title = "Planned changes (dry run)"
+	}
+	fmt.Fprintf(&b, "### %s\n\n", title)
+
+	var projects [][]ChangeLogEntry
+	for i, entry := range entries {
+		if i == 0 || entries[i-1].Project != entry.Project {
+			projects = append(projects, nil)
+		}
+		projects[len(projects)-1] = append(projects[len(projects)-1], entry)
+	}
+
+	if len(entries) == 0 {
+		b.WriteString("No changes discovered.\n")
+	} else {
+		fmt.Fprintf(&b, "%d setting(s) in %d project(s).\n\n", len(entries), len(projects))
+	}
+
+	for _, changes := range projects {
+		var section strings.Builder
+		collapse := len(changes) > markdownCollapseThreshold
+
+		if collapse {
+			fmt.Fprintf(&section, "<details>\n<summary><code>%s</code> (%d changes)</summary>\n\n", changes[0].Project, len(changes))
+		} else {
+			fmt.Fprintf(&section, "#### `%s`\n\n", changes[0].Project)
+		}
+
+		section.WriteString("| Setting | From | To |\n|---|---|---|\n")
+		for _, change := range changes {
+			from, to := change.From, change.To
+			if change.ListDiff {
+				from, to = fmt.Sprintf("-%v", change.Removed), fmt.Sprintf("+%v", change.Added)
+			}
+			fmt.Fprintf(&section, "| %s.%s | %s | %s |\n", change.Subsection, change.Setting, markdownValue(from), markdownValue(to))
+		}
+
+		if collapse {
+			section.WriteString("\n</details>\n")
+		}
+		section.WriteString("\n")
+
+		if b.Len()+section.Len() > maxMarkdownCommentSize {
+			b.WriteString("_The change log was truncated to fit into a comment._\n")
+			return b.String()
+		}
+		b.WriteString(section.String())
+	}
+
+	if len(m.BlockedChanges) != 0 {
+		b.WriteString("#### Blocked by policy\n\n")
+		for _, name := range m.blockedProjects() {
+			fmt.Fprintf(&b, "- `%s`: %s\n", name, strings.Join(m.BlockedChanges[name], ", "))
+		}
+	}
+	if len(m.ProjectsWithoutCI) != 0 {
+		b.WriteString("#### Skipped without CI\n\n")
+		b.WriteString("`only_allow_merge_if_pipeline_succeeds` was not enforced, as these projects have no CI config:\n\n")
+		for _, name := range m.ProjectsWithoutCI {
+			fmt.Fprintf(&b, "- `%s`\n", name)
+		}
+	}
+
+	return b.String()
+}
+
+// complianceMarkdown renders the sorted compliance results as one table per project
+func complianceMarkdown(results []ComplianceResult, scores ComplianceScores) string {
+	var b strings.Builder
+
+	data := newComplianceReportData(results, scores)
+	b.WriteString("### Compliance report\n\n")
+	fmt.Fprintf(&b, "%d of %d setting(s) non-compliant, compliance score %s.\n\n", data.NonCompliant, data.Total, formatScore(data.Score))
+
+	for _, project := range data.Projects {
+		fmt.Fprintf(&b, "#### `%s` (%s)\n\n", project.Name, formatScore(project.Score))
+		b.WriteString("| Setting | Actual | Expected | Status |\n|---|---|---|---|\n")
+		for _, subsection := range project.Subsections {
+			for _, result := range subsection.Settings {
+				status := result.Status()
+				if status == "FAIL" {
+					status = "**FAIL**"
+				}
+				actual := markdownValue(result.Actual)
+				if result.Unavailable {
+					actual = "_unavailable_"
+				}
+				fmt.Fprintf(&b, "| %s.%s | %s | %s | %s |\n", result.Subsection, result.Setting, actual, markdownValue(result.ExpectedText()), status)
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// markdownValue formats the value as inline code that is safe to use in a table cell
+func markdownValue(v interface{}) string {
+	s := fmt.Sprintf("%v", v)
+	if s == "" {
+		return "_empty_"
+	}
+
+	s = strings.NewReplacer("|", "\\|", "\r\n", " ", "\n", " ", "`", "'").Replace(s)
+	return "`" + s + "`"
+}
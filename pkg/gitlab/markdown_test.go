@@ -0,0 +1,54 @@
+package gitlab
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+func TestWriteChangeLogMarkdown(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{})
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: true, Description: "a|b"}
+	manager.ProjectSettingsUpdated["example/foo"] = &gitlab.Project{WikiEnabled: false, Description: "c"}
+
+	path := filepath.Join(t.TempDir(), "plan.md")
+	if err := manager.WriteChangeLogMarkdown(path, false, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected the report to be written, got %v", err)
+	}
+
+	expected := "### Planned changes (dry run)\n\n" +
+		"2 setting(s) in 1 project(s).\n\n" +
+		"#### `example/foo`\n\n" +
+		"| Setting | From | To |\n|---|---|---|\n" +
+		"| project_settings.description | `a\\|b` | `c` |\n" +
+		"| project_settings.wiki_enabled | `true` | `false` |\n\n"
+	if string(b) != expected {
+		t.Errorf("Expected markdown\n%s\ngot\n%s", expected, string(b))
+	}
+}
+
+func TestChangeLogMarkdownCollapsesLargeDiffs(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{})
+
+	var entries []ChangeLogEntry
+	for i := 0; i <= markdownCollapseThreshold; i++ {
+		entries = append(entries, ChangeLogEntry{Project: "example/foo", Subsection: "project_settings", Setting: fmt.Sprintf("s%02d", i), From: 1, To: 2})
+	}
+
+	markdown := manager.changeLogMarkdown(entries, false)
+	if !strings.Contains(markdown, "<details>\n<summary><code>example/foo</code> (11 changes)</summary>") {
+		t.Errorf("Expected large diffs to be collapsed, got\n%s", markdown)
+	}
+}
@@ -0,0 +1,365 @@
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/internal/stringslice"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/sink"
+)
+
+// Output sinks
+const (
+	OutputConsole = "console"
+	OutputFile    = "file"
+	OutputEmail   = "email"
+)
+
+// Output formats
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+	FormatJUnit    = "junit"
+	FormatHTML     = "html"
+	FormatDiff     = "diff"
+)
+
+// outputFormats lists the formats each sink accepts, the first one being its default
+var outputFormats = map[string][]string{
+	OutputConsole: {FormatText, FormatJSON, FormatMarkdown, FormatDiff},
+	OutputFile:    {FormatJSON, FormatText, FormatMarkdown, FormatJUnit, FormatHTML, FormatDiff},
+	OutputEmail:   {FormatHTML, FormatText},
+}
+
+// Output is a destination a report is rendered to: the console, a file (a path or s3:// URL)
+// or an email to the recipients of compliance.email.
+type Output struct {
+	Sink   string
+	Format string
+	Path   string
+}
+
+// ParseOutput parses an output given as SINK[:FORMAT][=PATH], e.g. console, file:json=report.json
+// or email:html. Without a format the default format of the sink is used.
+func ParseOutput(spec string) (Output, error) {
+	var o Output
+	target, path, _ := strings.Cut(spec, "=")
+	o.Sink, o.Format, _ = strings.Cut(target, ":")
+	o.Path = path
+
+	formats, ok := outputFormats[o.Sink]
+	if !ok {
+		return o, fmt.Errorf("unknown sink %q of output %q, must be one of: %s, %s, %s", o.Sink, spec, OutputConsole, OutputFile, OutputEmail)
+	}
+	if o.Format == "" {
+		o.Format = formats[0]
+	}
+	if !stringslice.Contains(o.Format, formats) {
+		return o, fmt.Errorf("unknown format %q of output %q, %s outputs support: %s", o.Format, spec, o.Sink, strings.Join(formats, ", "))
+	}
+
+	if o.Sink == OutputFile && o.Path == "" {
+		return o, fmt.Errorf("output %q needs a path, e.g. %s:%s=report.%s", spec, o.Sink, o.Format, o.Format)
+	}
+	if o.Sink != OutputFile && o.Path != "" {
+		return o, fmt.Errorf("output %q takes no path, only %s outputs do", spec, OutputFile)
+	}
+
+	return o, nil
+}
+
+// String returns the output in the form accepted by ParseOutput
+func (o Output) String() string {
+	s := o.Sink + ":" + o.Format
+	if o.Path != "" {
+		s += "=" + o.Path
+	}
+
+	return s
+}
+
+// report is the data of the change log or the compliance report. It is computed once and
+// rendered to each output in the format of the output.
+type report interface {
+	render(m *ProjectManager, format string) ([]byte, error)
+	subject(m *ProjectManager) (string, error)
+}
+
+// WriteChangeLogOutputs renders the change log to each of the outputs. Unless fullDiff is set,
+// changes of list settings only show the added and removed elements. In dryrun the changes are
+// listed as planned.
+func (m *ProjectManager) WriteChangeLogOutputs(outputs []Output, fullDiff bool, dryrun bool) error {
+	entries, err := m.ChangeLogEntries(fullDiff)
+	if err != nil {
+		return err
+	}
+
+	return m.writeOutputs(outputs, changeLogReport{entries: m.reportOptions.changeLogEntries(entries), dryrun: dryrun})
+}
+
+// WriteComplianceOutputs renders the compliance state of mandatory settings to each of the outputs
+func (m *ProjectManager) WriteComplianceOutputs(outputs []Output) error {
+	results := m.ComplianceResults()
+	return m.writeOutputs(outputs, complianceReport{results: results, scores: newComplianceScores(results)})
+}
+
+// writeOutputs renders the report to each of the outputs. A failing output doesn't keep the
+// report from the others.
+func (m *ProjectManager) writeOutputs(outputs []Output, r report) error {
+	var failed int
+	for _, output := range outputs {
+		if err := m.writeOutput(output, r); err != nil {
+			m.logger.Errorf("failed to write the report to %s: %v", output, err)
+			failed++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("failed to write the report to %d of %d output(s)", failed, len(outputs))
+	}
+
+	return nil
+}
+
+// writeOutput renders the report in the format of the output and writes it to its sink
+func (m *ProjectManager) writeOutput(output Output, r report) error {
+	body, err := r.render(m, output.Format)
+	if err != nil {
+		return err
+	}
+
+	switch output.Sink {
+	case OutputConsole:
+		_, err := m.out.Write(body)
+		return err
+	case OutputFile:
+		return sink.Write(output.Path, body)
+	case OutputEmail:
+		if !m.config.EmailConfigured() {
+			return fmt.Errorf("email outputs need compliance.email.from, server and port")
+		}
+
+		email := m.config.Compliance.Email
+
+		// Spare the recipients the full report if there is nothing to act on
+		if c, ok := r.(complianceReport); ok && allCompliant(c.results) {
+			switch email.SendOnSuccess {
+			case config.SendOnSuccessNone:
+				m.logger.Infof("All projects are compliant, not sending the compliance email.")
+				return nil
+			case config.SendOnSuccessSummary:
+				subject, body := m.complianceSummaryEmail(c.results)
+				return m.SendEmail(email.To, email.From, subject, body)
+			}
+		}
+
+		subject, err := r.subject(m)
+		if err != nil {
+			return err
+		}
+		if output.Format == FormatText {
+			body = []byte("<pre>" + html.EscapeString(string(body)) + "</pre>")
+		}
+
+		return m.SendEmail(email.To, email.From, subject, string(body))
+	default:
+		return fmt.Errorf("unknown sink %q", output.Sink)
+	}
+}
+
+// changeLogReport is the sorted change log of a sync
+type changeLogReport struct {
+	entries []ChangeLogEntry
+	dryrun  bool
+}
+
+func (r changeLogReport) render(m *ProjectManager, format string) ([]byte, error) {
+	var b bytes.Buffer
+
+	switch format {
+	case FormatText:
+		m.changeLogText(&b, r.entries)
+	case FormatMarkdown:
+		b.WriteString(m.changeLogMarkdown(r.entries, r.dryrun))
+	case FormatDiff:
+		b.WriteString(changeLogUnifiedDiff(r.entries))
+	case FormatJSON:
+		return marshalReport(struct {
+			Dryrun    bool                `json:"dryrun"`
+			Changes   []ChangeLogEntry    `json:"changes"`
+			Blocked   map[string][]string `json:"blocked,omitempty"`
+			WithoutCI []string            `json:"without_ci,omitempty"`
+		}{r.dryrun, append([]ChangeLogEntry{}, r.entries...), m.BlockedChanges, m.ProjectsWithoutCI})
+	case FormatHTML:
+		if err := changeLogHTMLTemplate.Execute(&b, newChangeLogReportData(r.entries, r.dryrun, m)); err != nil {
+			return nil, fmt.Errorf("failed to render html change log: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("the %s format is not available for the change log", format)
+	}
+
+	return b.Bytes(), nil
+}
+
+func (r changeLogReport) subject(m *ProjectManager) (string, error) {
+	if r.dryrun {
+		return "Planned changes (dry run)", nil
+	}
+
+	return "Change Log", nil
+}
+
+// complianceReport holds the compliance results of all mandatory settings and their scores.
+// The report options apply to all formats but JUnit, which lists every setting as a test case.
+type complianceReport struct {
+	results []ComplianceResult
+	scores  ComplianceScores
+}
+
+func (r complianceReport) render(m *ProjectManager, format string) ([]byte, error) {
+	var b bytes.Buffer
+	results := m.reportOptions.complianceResults(r.results)
+
+	switch format {
+	case FormatText:
+		m.complianceText(&b, results, r.scores)
+	case FormatMarkdown:
+		b.WriteString(complianceMarkdown(results, r.scores))
+	case FormatJSON:
+		return marshalReport(struct {
+			Results []ComplianceResult `json:"results"`
+			Scores  ComplianceScores   `json:"scores"`
+		}{append([]ComplianceResult{}, results...), r.scores})
+	case FormatJUnit:
+		body, err := xml.MarshalIndent(newJUnitTestSuites(r.results), "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal junit report: %v", err)
+		}
+		b.WriteString(xml.Header)
+		b.Write(body)
+	case FormatHTML:
+		_, body, err := m.complianceEmail(results, r.scores)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(body)
+	default:
+		return nil, fmt.Errorf("the %s format is not available for the compliance report", format)
+	}
+
+	return b.Bytes(), nil
+}
+
+func (r complianceReport) subject(m *ProjectManager) (string, error) {
+	subject, _, err := m.complianceEmail(m.reportOptions.complianceResults(r.results), r.scores)
+	return subject, err
+}
+
+// marshalReport converts the report to indented json
+func marshalReport(v interface{}) ([]byte, error) {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert report to json: %v", err)
+	}
+
+	return append(body, '\n'), nil
+}
+
+// changeLogReportData groups the change log entries by project, as context of the html
+// change log
+type changeLogReportData struct {
+	Title    string
+	Projects []changeLogProject
+	Blocked  []changeLogBlocked
+}
+
+type changeLogProject struct {
+	Name    string
+	Changes []changeLogChange
+}
+
+type changeLogChange struct {
+	Setting string
+	From    string
+	To      string
+}
+
+type changeLogBlocked struct {
+	Name   string
+	Fields []string
+}
+
+// newChangeLogReportData groups the sorted change log entries
+func newChangeLogReportData(entries []ChangeLogEntry, dryrun bool, m *ProjectManager) changeLogReportData {
+	data := changeLogReportData{Title: "Changes"}
+	if dryrun {
+		data.Title = "Planned changes (dry run)"
+	}
+
+	for i, entry := range entries {
+		if i == 0 || entries[i-1].Project != entry.Project {
+			data.Projects = append(data.Projects, changeLogProject{Name: entry.Project})
+		}
+		project := &data.Projects[len(data.Projects)-1]
+
+		change := changeLogChange{
+			Setting: entry.Subsection + "." + entry.Setting,
+			From:    fmt.Sprintf("%v", entry.From),
+			To:      fmt.Sprintf("%v", entry.To),
+		}
+		if entry.ListDiff {
+			change.From, change.To = fmt.Sprintf("-%v", entry.Removed), fmt.Sprintf("+%v", entry.Added)
+		}
+		project.Changes = append(project.Changes, change)
+	}
+
+	for _, name := range m.blockedProjects() {
+		data.Blocked = append(data.Blocked, changeLogBlocked{Name: name, Fields: m.BlockedChanges[name]})
+	}
+
+	return data
+}
+
+// changeLogHTMLTemplate renders the change log as a single table with a row per setting, in
+// the layout of the compliance email
+var changeLogHTMLTemplate = template.Must(template.New("changelog").Parse(`
+<h2>{{.Title}}</h2>
+{{- if not .Projects}}
+<p>No changes discovered.</p>
+{{- else}}
+<table style="border-collapse:collapse">
+ <tr>
+  <th style="text-align:left;padding:2px 8px">Setting</th>
+  <th style="text-align:left;padding:2px 8px">From</th>
+  <th style="text-align:left;padding:2px 8px">To</th>
+ </tr>
+{{- range .Projects}}
+ <tr>
+  <td colspan="3" style="padding:8px 8px 2px"><b>{{.Name}}</b></td>
+ </tr>
+{{- range .Changes}}
+ <tr>
+  <td style="padding:2px 8px 2px 20px">{{.Setting}}</td>
+  <td style="padding:2px 8px">{{.From}}</td>
+  <td style="padding:2px 8px">{{.To}}</td>
+ </tr>
+{{- end}}
+{{- end}}
+</table>
+{{- end}}
+{{- if .Blocked}}
+<h3>Blocked by policy</h3>
+<ul>
+{{- range .Blocked}}
+ <li><b>{{.Name}}</b>: {{range $i, $f := .Fields}}{{if $i}}, {{end}}{{$f}}{{end}}</li>
+{{- end}}
+</ul>
+{{- end}}
+`))
@@ -0,0 +1,155 @@
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected Output
+		err      string
+	}{
+		{spec: "console", expected: Output{Sink: OutputConsole, Format: FormatText}},
+		{spec: "console:json", expected: Output{Sink: OutputConsole, Format: FormatJSON}},
+		{spec: "file=report.json", expected: Output{Sink: OutputFile, Format: FormatJSON, Path: "report.json"}},
+		{spec: "file:markdown=s3://bucket/plan.md", expected: Output{Sink: OutputFile, Format: FormatMarkdown, Path: "s3://bucket/plan.md"}},
+		{spec: "file:diff=plan.diff", expected: Output{Sink: OutputFile, Format: FormatDiff, Path: "plan.diff"}},
+		{spec: "file:text=C:\\reports\\plan.txt", expected: Output{Sink: OutputFile, Format: FormatText, Path: "C:\\reports\\plan.txt"}},
+		{spec: "email", expected: Output{Sink: OutputEmail, Format: FormatHTML}},
+		{spec: "slack", err: `unknown sink "slack"`},
+		{spec: "console:junit", err: `unknown format "junit"`},
+		{spec: "file:json", err: `output "file:json" needs a path`},
+		{spec: "email=team@example.com", err: `output "email=team@example.com" takes no path`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			output, err := ParseOutput(tt.spec)
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("Expected an error starting with %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestWriteChangeLogOutputs(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{})
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: true}
+	manager.ProjectSettingsUpdated["example/foo"] = &gitlab.Project{WikiEnabled: false}
+	out := &bytes.Buffer{}
+	manager.out = out
+
+	dir := t.TempDir()
+	outputs := []Output{
+		{Sink: OutputConsole, Format: FormatText},
+		{Sink: OutputFile, Format: FormatJSON, Path: filepath.Join(dir, "plan.json")},
+		{Sink: OutputFile, Format: FormatHTML, Path: filepath.Join(dir, "plan.html")},
+	}
+	if err := manager.WriteChangeLogOutputs(outputs, false, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !strings.Contains(out.String(), `wiki_enabled: "true" => "false"`) {
+		t.Errorf("Expected the change on the console, got\n%s", out.String())
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "plan.json"))
+	if err != nil {
+		t.Fatalf("Expected the json report to be written, got %v", err)
+	}
+	var report struct {
+		Dryrun  bool
+		Changes []ChangeLogEntry
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatalf("Expected valid json, got %v", err)
+	}
+	if !report.Dryrun || len(report.Changes) != 1 || report.Changes[0].Setting != "wiki_enabled" || report.Changes[0].To != false {
+		t.Errorf("Expected the planned wiki_enabled change, got %s", b)
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(dir, "plan.html"))
+	if err != nil {
+		t.Fatalf("Expected the html report to be written, got %v", err)
+	}
+	if !strings.Contains(string(b), "<h2>Planned changes (dry run)</h2>") || !strings.Contains(string(b), "project_settings.wiki_enabled") {
+		t.Errorf("Expected the planned change in the html report, got\n%s", b)
+	}
+}
+
+func TestWriteComplianceOutputs(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"project_settings": {"wiki_enabled": false},
+			},
+		},
+	})
+	manager.ProjectSettingsOriginal["example/bar"] = &gitlab.Project{WikiEnabled: false}
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: true}
+	manager.SetReportOptions(ReportOptions{OnlyNonCompliant: true})
+
+	dir := t.TempDir()
+	outputs := []Output{
+		{Sink: OutputFile, Format: FormatMarkdown, Path: filepath.Join(dir, "compliance.md")},
+		{Sink: OutputFile, Format: FormatJUnit, Path: filepath.Join(dir, "compliance.xml")},
+	}
+	if err := manager.WriteComplianceOutputs(outputs); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "compliance.md"))
+	if err != nil {
+		t.Fatalf("Expected the markdown report to be written, got %v", err)
+	}
+	if strings.Contains(string(b), "example/bar") || !strings.Contains(string(b), "| project_settings.wiki_enabled | `true` | `false` | **FAIL** |") {
+		t.Errorf("Expected only the non-compliant project in the markdown report, got\n%s", b)
+	}
+
+	// JUnit lists every setting as test case
+	b, err = ioutil.ReadFile(filepath.Join(dir, "compliance.xml"))
+	if err != nil {
+		t.Fatalf("Expected the junit report to be written, got %v", err)
+	}
+	if !strings.Contains(string(b), `tests="2" failures="1"`) {
+		t.Errorf("Expected both projects in the junit report, got\n%s", b)
+	}
+}
+
+func TestWriteOutputsContinuesAfterFailure(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{})
+	out := &bytes.Buffer{}
+	manager.out = out
+
+	outputs := []Output{
+		{Sink: OutputEmail, Format: FormatHTML},
+		{Sink: OutputConsole, Format: FormatText},
+	}
+	err := manager.WriteChangeLogOutputs(outputs, false, false)
+	if err == nil || err.Error() != "failed to write the report to 1 of 2 output(s)" {
+		t.Errorf("Expected the unconfigured email to fail, got %v", err)
+	}
+	if !strings.Contains(out.String(), "No changes discovered.") {
+		t.Errorf("Expected the console output to be written anyway, got %q", out.String())
+	}
+}
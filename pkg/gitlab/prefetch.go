@@ -0,0 +1,271 @@
+package gitlab
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// prefetchConcurrency limits the concurrent read calls of PrefetchProjectState
+const prefetchConcurrency = 4
+
+// prefetchCache holds the results of the read calls prefetched for one project. Each result
+// is handed out once, so reads after a write always go to the API. Writes also drop the
+// results they make stale.
+type prefetchCache struct {
+	mu        sync.Mutex
+	projectID int
+	settings  *gitlab.Project
+	approvals *gitlab.ProjectApprovals
+	branches  map[string]prefetchedBranch
+	tags      map[string]prefetchedTag
+}
+
+type prefetchedBranch struct {
+	branch *gitlab.ProtectedBranch
+	resp   *gitlab.Response
+	err    error
+}
+
+type prefetchedTag struct {
+	tag  *gitlab.ProtectedTag
+	resp *gitlab.Response
+	err  error
+}
+
+// reset drops all results and prepares the cache for the project
+func (c *prefetchCache) reset(projectID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.projectID = projectID
+	c.settings = nil
+	c.approvals = nil
+	c.branches = make(map[string]prefetchedBranch)
+	c.tags = make(map[string]prefetchedTag)
+}
+
+// forProject reports whether the cache holds results of the project, given as ID
+func (c *prefetchCache) forProject(pid interface{}) bool {
+	id, ok := pid.(int)
+	return ok && id != 0 && id == c.projectID
+}
+
+// PrefetchProjectState fetches the project settings, approval settings and the configured
+// protected branches and tags of the project concurrently. The following reads of the sync
+// steps are served from these results, while writes stay in order. Branches and tags which
+// are not protected are cached as not found, other failed reads are not cached, so the sync
+// steps retry them and report their errors as usual.
+func (m *ProjectManager) PrefetchProjectState(project gitlab.Project) {
+	cache := m.prefetch
+	cache.reset(project.ID)
+
+	var reads []func()
+	reads = append(reads, func() {
+		settings, _, err := m.prefetchProjects.GetProject(project.ID, &gitlab.GetProjectOptions{}, m.withContext())
+		if err == nil {
+			cache.mu.Lock()
+			cache.settings = settings
+			cache.mu.Unlock()
+		}
+	})
+	if m.config.ApprovalSettings != nil {
+		reads = append(reads, func() {
+			approvals, _, err := m.prefetchProjects.GetApprovalConfiguration(project.ID, m.withContext())
+			if err == nil {
+				cache.mu.Lock()
+				cache.approvals = approvals
+				cache.mu.Unlock()
+			}
+		})
+	}
+	for _, b := range m.config.ProtectedBranches {
+		name := b.Name
+		reads = append(reads, func() {
+			branch, resp, err := m.prefetchBranches.GetProtectedBranch(project.ID, name, m.withContext())
+			if cacheable(resp, err) {
+				cache.mu.Lock()
+				cache.branches[name] = prefetchedBranch{branch: branch, resp: resp, err: err}
+				cache.mu.Unlock()
+			}
+		})
+	}
+	for _, t := range m.config.ProtectedTags {
+		name := t.Name
+		reads = append(reads, func() {
+			tag, resp, err := m.prefetchTags.GetProtectedTag(project.ID, name, m.withContext())
+			if cacheable(resp, err) {
+				cache.mu.Lock()
+				cache.tags[name] = prefetchedTag{tag: tag, resp: resp, err: err}
+				cache.mu.Unlock()
+			}
+		})
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, prefetchConcurrency)
+	for _, read := range reads {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(read func()) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			read()
+		}(read)
+	}
+	wg.Wait()
+
+	m.logger.Debugf("Prefetched %d read(s) of project %s.", len(reads), project.PathWithNamespace)
+}
+
+// cacheable reports whether a prefetched read is cached: successful reads and not found
+// responses, which are results rather than failures
+func cacheable(resp *gitlab.Response, err error) bool {
+	return err == nil || resp != nil && resp.StatusCode == http.StatusNotFound
+}
+
+// prefetchingProjects serves GetProject and GetApprovalConfiguration from the prefetch cache
+type prefetchingProjects struct {
+	projectsClient
+	cache *prefetchCache
+}
+
+func (p *prefetchingProjects) GetProject(pid interface{}, opt *gitlab.GetProjectOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error) {
+	p.cache.mu.Lock()
+	settings := p.cache.settings
+	if p.cache.forProject(pid) {
+		p.cache.settings = nil
+	} else {
+		settings = nil
+	}
+	p.cache.mu.Unlock()
+
+	if settings != nil {
+		return settings, nil, nil
+	}
+	return p.projectsClient.GetProject(pid, opt, options...)
+}
+
+func (p *prefetchingProjects) EditProject(pid interface{}, opt *gitlab.EditProjectOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error) {
+	p.cache.mu.Lock()
+	p.cache.settings = nil
+	p.cache.mu.Unlock()
+
+	return p.projectsClient.EditProject(pid, opt, options...)
+}
+
+func (p *prefetchingProjects) GetApprovalConfiguration(pid interface{}, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovals, *gitlab.Response, error) {
+	p.cache.mu.Lock()
+	approvals := p.cache.approvals
+	if p.cache.forProject(pid) {
+		p.cache.approvals = nil
+	} else {
+		approvals = nil
+	}
+	p.cache.mu.Unlock()
+
+	if approvals != nil {
+		return approvals, nil, nil
+	}
+	return p.projectsClient.GetApprovalConfiguration(pid, options...)
+}
+
+func (p *prefetchingProjects) ChangeApprovalConfiguration(pid interface{}, opt *gitlab.ChangeApprovalConfigurationOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovals,
+	*gitlab.Response, error) {
+	p.cache.mu.Lock()
+	p.cache.approvals = nil
+	p.cache.mu.Unlock()
+
+	return p.projectsClient.ChangeApprovalConfiguration(pid, opt, options...)
+}
+
+// prefetchingProtectedBranches serves GetProtectedBranch from the prefetch cache
+type prefetchingProtectedBranches struct {
+	protectedBranchesClient
+	cache *prefetchCache
+}
+
+func (p *prefetchingProtectedBranches) GetProtectedBranch(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch, *gitlab.Response, error) {
+	p.cache.mu.Lock()
+	result, ok := p.cache.branches[branch]
+	if ok && p.cache.forProject(pid) {
+		delete(p.cache.branches, branch)
+	} else {
+		ok = false
+	}
+	p.cache.mu.Unlock()
+
+	if ok {
+		return result.branch, result.resp, result.err
+	}
+	return p.protectedBranchesClient.GetProtectedBranch(pid, branch, options...)
+}
+
+func (p *prefetchingProtectedBranches) ProtectRepositoryBranches(pid interface{}, opt *gitlab.ProtectRepositoryBranchesOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch,
+	*gitlab.Response, error) {
+	p.drop(opt.Name)
+	return p.protectedBranchesClient.ProtectRepositoryBranches(pid, opt, options...)
+}
+
+func (p *prefetchingProtectedBranches) UnprotectRepositoryBranches(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	p.drop(&branch)
+	return p.protectedBranchesClient.UnprotectRepositoryBranches(pid, branch, options...)
+}
+
+func (p *prefetchingProtectedBranches) UpdateProtectedBranch(pid interface{}, branch string, opt *gitlab.UpdateProtectedBranchOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch,
+	*gitlab.Response, error) {
+	p.drop(&branch)
+	return p.protectedBranchesClient.UpdateProtectedBranch(pid, branch, opt, options...)
+}
+
+func (p *prefetchingProtectedBranches) drop(branch *string) {
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+
+	if branch != nil {
+		delete(p.cache.branches, *branch)
+	}
+}
+
+// prefetchingProtectedTags serves GetProtectedTag from the prefetch cache
+type prefetchingProtectedTags struct {
+	protectedTagsClient
+	cache *prefetchCache
+}
+
+func (p *prefetchingProtectedTags) GetProtectedTag(pid interface{}, tag string, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedTag, *gitlab.Response, error) {
+	p.cache.mu.Lock()
+	result, ok := p.cache.tags[tag]
+	if ok && p.cache.forProject(pid) {
+		delete(p.cache.tags, tag)
+	} else {
+		ok = false
+	}
+	p.cache.mu.Unlock()
+
+	if ok {
+		return result.tag, result.resp, result.err
+	}
+	return p.protectedTagsClient.GetProtectedTag(pid, tag, options...)
+}
+
+func (p *prefetchingProtectedTags) ProtectRepositoryTags(pid interface{}, opt *gitlab.ProtectRepositoryTagsOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedTag,
+	*gitlab.Response, error) {
+	p.drop(opt.Name)
+	return p.protectedTagsClient.ProtectRepositoryTags(pid, opt, options...)
+}
+
+func (p *prefetchingProtectedTags) UnprotectRepositoryTags(pid interface{}, tag string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	p.drop(&tag)
+	return p.protectedTagsClient.UnprotectRepositoryTags(pid, tag, options...)
+}
+
+func (p *prefetchingProtectedTags) drop(tag *string) {
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+
+	if tag != nil {
+		delete(p.cache.tags, *tag)
+	}
+}
@@ -0,0 +1,106 @@
+package gitlab
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestPrefetchProjectState(t *testing.T) {
+	client := newTestClient()
+	client.AddProtectedBranch(10, &gitlab.ProtectedBranch{
+		Name:             "master",
+		PushAccessLevels: []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.DeveloperPermissions}},
+	})
+	cfg := &config.Config{
+		ApprovalSettings:  &gitlab.ChangeApprovalConfigurationOptions{ResetApprovalsOnPush: gitlab.Bool(true)},
+		ProjectSettings:   &gitlab.EditProjectOptions{WikiEnabled: gitlab.Bool(false)},
+		ProtectedBranches: []config.ProtectedBranch{{Name: "master", PushAccessLevel: "maintainer", MergeAccessLevel: "maintainer"}},
+		ProtectedTags:     []config.ProtectedTag{{Name: "v*", CreateAccessLevel: "maintainer"}},
+	}
+	manager := newTestManager(client, cfg)
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	manager.PrefetchProjectState(project)
+	if manager.prefetch.settings == nil || manager.prefetch.approvals == nil ||
+		len(manager.prefetch.branches) != 1 || len(manager.prefetch.tags) != 1 {
+		t.Fatalf("Expected all reads to be prefetched, got %+v", manager.prefetch)
+	}
+
+	// Reads are served from the prefetched results once
+	if _, err := manager.GetProjectSettings(project); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if manager.prefetch.settings != nil {
+		t.Errorf("Expected the prefetched settings to be handed out once")
+	}
+
+	// Writes drop the results they make stale
+	client.Projects.EditProject(10, &gitlab.EditProjectOptions{Description: gitlab.String("changed")})
+	if _, _, err := manager.protectedBranchesClient.UpdateProtectedBranch(10, "master", &gitlab.UpdateProtectedBranchOptions{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := manager.prefetch.branches["master"]; ok {
+		t.Errorf("Expected the write to drop the prefetched protected branch")
+	}
+	settings, err := manager.GetProjectSettings(project)
+	if err != nil || settings.Description != "changed" {
+		t.Errorf("Expected reads after the prefetched one to go to the API, got %+v (%v)", settings, err)
+	}
+
+	// Syncing with the prefetched state has the same outcome as without
+	manager.PrefetchProjectState(project)
+	if err := manager.EnsureBranchesAndProtection(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := manager.UpdateProjectApprovalSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := manager.UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := manager.EnsureTagsProtection(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	p, _, _ := client.Projects.GetProject(10, nil)
+	branch, _, _ := client.ProtectedBranches.GetProtectedBranch(10, "master")
+	_, _, tagErr := client.ProtectedTags.GetProtectedTag(10, "v*")
+	if p.WikiEnabled || branch.PushAccessLevels[0].AccessLevel != gitlab.MaintainerPermissions || tagErr != nil {
+		t.Errorf("Expected the project to be synced, got wiki %v, push level %v, tag %v",
+			p.WikiEnabled, branch.PushAccessLevels[0].AccessLevel, tagErr)
+	}
+}
+
+func TestPrefetchProjectStateFailedReads(t *testing.T) {
+	client := newTestClient()
+	client.AddProtectedBranch(10, &gitlab.ProtectedBranch{
+		Name:             "master",
+		PushAccessLevels: []*gitlab.BranchAccessDescription{{AccessLevel: gitlab.MaintainerPermissions}},
+	})
+	manager := newTestManager(client, &config.Config{
+		ProtectedBranches: []config.ProtectedBranch{{Name: "master", PushAccessLevel: "maintainer", MergeAccessLevel: "maintainer"}},
+		ProtectedTags:     []config.ProtectedTag{{Name: "v*", CreateAccessLevel: "maintainer"}},
+	})
+	manager.prefetchBranches = failingProtectedBranches{client.ProtectedBranches}
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	manager.PrefetchProjectState(project)
+
+	// The unprotected tag is a result, the server error is not
+	if result, ok := manager.prefetch.tags["v*"]; !ok || result.resp == nil || result.resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the unprotected tag to be cached as not found, got %+v", result)
+	}
+	if result, ok := manager.prefetch.branches["master"]; ok {
+		t.Errorf("Expected the failed read not to be cached, got %+v", result)
+	}
+
+	// The sync step reads the branch again instead of failing with the prefetched error
+	branch, _, err := manager.protectedBranchesClient.GetProtectedBranch(10, "master")
+	if err != nil || branch.Name != "master" {
+		t.Errorf("Expected the failed read to go to the API, got %+v (%v)", branch, err)
+	}
+}
@@ -0,0 +1,35 @@
+package gitlab
+
+import (
+	"github.com/xanzy/go-gitlab"
+)
+
+// GitLab 16.5 renamed the project setting emails_disabled to emails_enabled. Newer instances
+// accept and return both, while older instances only know emails_disabled, so the config may
+// use either name and both are sent and compared.
+
+// normalizeEmailSettings makes emails_enabled and emails_disabled of the project consistent,
+// whichever of them the instance returned. Instances before GitLab 16.5 only return
+// emails_disabled, leaving emails_enabled false even if emails are enabled.
+func normalizeEmailSettings(p *gitlab.Project) {
+	p.EmailsEnabled = p.EmailsEnabled || !p.EmailsDisabled
+	p.EmailsDisabled = !p.EmailsEnabled
+}
+
+// withEmailSettings returns a copy of the options with the counterpart of the configured
+// emails_enabled or emails_disabled set too, so instances of either GitLab version apply it and
+// the settings compare against the normalized project
+func withEmailSettings(options *gitlab.EditProjectOptions) *gitlab.EditProjectOptions {
+	switch {
+	case options.EmailsEnabled != nil:
+		mirrored := *options
+		mirrored.EmailsDisabled = gitlab.Bool(!*options.EmailsEnabled)
+		return &mirrored
+	case options.EmailsDisabled != nil:
+		mirrored := *options
+		mirrored.EmailsEnabled = gitlab.Bool(!*options.EmailsDisabled)
+		return &mirrored
+	}
+
+	return options
+}
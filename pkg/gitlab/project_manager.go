@@ -1,16 +1,23 @@
 package gitlab
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
-	"net/smtp"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	texttemplate "text/template"
+	"time"
 
 	"github.com/iancoleman/strcase"
 	"github.com/r3labs/diff"
@@ -23,41 +30,154 @@ import (
 
 // ProjectManager fetches a list of repositories from GitLab
 type ProjectManager struct {
-	logger                   *logrus.Entry
-	groupsClient             groupsClient
-	projectsClient           projectsClient
-	protectedBranchesClient  protectedBranchesClient
-	protectedTagsClient      protectedTagsClient
-	branchesClient           branchesClient
-	config                   *config.Config
-	ApprovalSettingsOriginal map[string]*gitlab.ProjectApprovals
-	ApprovalSettingsUpdated  map[string]*gitlab.ProjectApprovals
-	ProjectSettingsOriginal  map[string]*gitlab.Project
-	ProjectSettingsUpdated   map[string]*gitlab.Project
+	logger                          *logrus.Entry
+	groupsClient                    groupsClient
+	projectsClient                  projectsClient
+	protectedBranchesClient         protectedBranchesClient
+	protectedTagsClient             protectedTagsClient
+	branchesClient                  branchesClient
+	accessTokensClient              projectAccessTokensClient
+	repositoryFilesClient           repositoryFilesClient
+	repositoriesClient              repositoriesClient
+	frameworksClient                complianceFrameworksClient
+	groupVariablesClient            groupVariablesClient
+	projectVariablesClient          projectVariablesClient
+	approvalLocksClient             approvalSettingLocksClient
+	mirrorsClient                   projectMirrorsClient
+	groupMembersClient              groupMembersClient
+	config                          *config.Config
+	baseConfig                      *config.Config
+	ruleConfigs                     map[string]*config.Config
+	out                             io.Writer
+	errorCount                      int
+	reportOptions                   ReportOptions
+	homogeneousApprovals            bool
+	approvalSnapshots               map[string]*gitlab.ProjectApprovals
+	frameworkID                     string
+	frameworksUnavailable           bool
+	serviceDeskUnavailable          bool
+	emailSender                     EmailSender
+	prefetch                        *prefetchCache
+	prefetchProjects                projectsClient
+	prefetchBranches                protectedBranchesClient
+	prefetchTags                    protectedTagsClient
+	frozenBranches                  []FrozenBranch
+	freezeStatePath                 string
+	templateFiles                   []config.RequiredFile
+	inheritedVariables              map[string]map[string]*gitlab.GroupVariable
+	ctx                             context.Context
+	personalProjectUsers            []string
+	usersClient                     usersClient
+	createdSince                    time.Time
+	skippedCalls                    map[string]int
+	warnings                        []Warning
+	currentProject                  string
+	now                             func() time.Time
+	ApprovalSettingsOriginal        map[string]*gitlab.ProjectApprovals
+	ApprovalSettingsUpdated         map[string]*gitlab.ProjectApprovals
+	ProjectSettingsOriginal         map[string]*gitlab.Project
+	ProjectSettingsUpdated          map[string]*gitlab.Project
+	ApprovalRulesOriginal           map[string]map[string]*ApprovalRuleSettings
+	ApprovalRulesUpdated            map[string]map[string]*ApprovalRuleSettings
+	GroupSettingsOriginal           map[string]*gitlab.Group
+	GroupSettingsUpdated            map[string]*gitlab.Group
+	GroupVariablesOriginal          map[string]map[string]*GroupVariableSettings
+	GroupVariablesUpdated           map[string]map[string]*GroupVariableSettings
+	ProjectVariablesOriginal        map[string]map[string]*GroupVariableSettings
+	ProjectVariablesUpdated         map[string]map[string]*GroupVariableSettings
+	BranchFreezeOriginal            map[string]map[string]*BranchFreezeSettings
+	BranchFreezeUpdated             map[string]map[string]*BranchFreezeSettings
+	RemoteMirrorsOriginal           map[string]map[string]*RemoteMirrorSettings
+	RemoteMirrorsUpdated            map[string]map[string]*RemoteMirrorSettings
+	GroupMembersOriginal            map[string]map[string]*GroupMemberSettings
+	GroupMembersUpdated             map[string]map[string]*GroupMemberSettings
+	DefaultBranchProtectionOriginal map[string]*DefaultBranchProtectionSettings
+	DefaultBranchProtectionUpdated  map[string]*DefaultBranchProtectionSettings
+	ApprovalSettingLocks            map[string]map[string]string
+	BlockedChanges                  map[string][]string
+	ProjectRules                    map[string][]string
+	ProjectsWithoutCI               []string
+}
+
+// Clients holds the GitLab API clients of a ProjectManager
+type Clients struct {
+	Groups               groupsClient
+	Projects             projectsClient
+	ProtectedBranches    protectedBranchesClient
+	ProtectedTags        protectedTagsClient
+	Branches             branchesClient
+	AccessTokens         projectAccessTokensClient
+	RepositoryFiles      repositoryFilesClient
+	Repositories         repositoriesClient
+	ComplianceFrameworks complianceFrameworksClient
+	GroupVariables       groupVariablesClient
+	ProjectVariables     projectVariablesClient
+	ApprovalSettingLocks approvalSettingLocksClient
+	ProjectMirrors       projectMirrorsClient
+	GroupMembers         groupMembersClient
+
+	// Users reads the two-factor authentication state of the group members before
+	// group_settings require it. Only administrators can read the state, it is not checked
+	// without the client.
+	Users usersClient
 }
 
 // NewProjectManager returns a new ProjectManager instance
-func NewProjectManager(
-	logger *logrus.Entry,
-	groupsClient groupsClient,
-	projectsClient projectsClient,
-	protectedBranchesClient protectedBranchesClient,
-	protectedTagsClient protectedTagsClient,
-	branchesClient branchesClient,
-	config *config.Config,
-) *ProjectManager {
+func NewProjectManager(logger *logrus.Entry, clients Clients, config *config.Config) *ProjectManager {
+	// Reads are served from the results of PrefetchProjectState, once called
+	prefetch := &prefetchCache{}
+
 	return &ProjectManager{
-		logger:                   logger,
-		groupsClient:             groupsClient,
-		projectsClient:           projectsClient,
-		protectedBranchesClient:  protectedBranchesClient,
-		protectedTagsClient:      protectedTagsClient,
-		branchesClient:           branchesClient,
-		config:                   config,
-		ApprovalSettingsOriginal: make(map[string]*gitlab.ProjectApprovals),
-		ApprovalSettingsUpdated:  make(map[string]*gitlab.ProjectApprovals),
-		ProjectSettingsOriginal:  make(map[string]*gitlab.Project),
-		ProjectSettingsUpdated:   make(map[string]*gitlab.Project),
+		logger:                          logger,
+		groupsClient:                    clients.Groups,
+		projectsClient:                  &prefetchingProjects{projectsClient: clients.Projects, cache: prefetch},
+		protectedBranchesClient:         &prefetchingProtectedBranches{protectedBranchesClient: clients.ProtectedBranches, cache: prefetch},
+		protectedTagsClient:             &prefetchingProtectedTags{protectedTagsClient: clients.ProtectedTags, cache: prefetch},
+		branchesClient:                  clients.Branches,
+		accessTokensClient:              clients.AccessTokens,
+		repositoryFilesClient:           clients.RepositoryFiles,
+		repositoriesClient:              clients.Repositories,
+		frameworksClient:                clients.ComplianceFrameworks,
+		groupVariablesClient:            clients.GroupVariables,
+		projectVariablesClient:          clients.ProjectVariables,
+		approvalLocksClient:             clients.ApprovalSettingLocks,
+		mirrorsClient:                   clients.ProjectMirrors,
+		groupMembersClient:              clients.GroupMembers,
+		usersClient:                     clients.Users,
+		prefetch:                        prefetch,
+		prefetchProjects:                clients.Projects,
+		prefetchBranches:                clients.ProtectedBranches,
+		prefetchTags:                    clients.ProtectedTags,
+		config:                          config,
+		baseConfig:                      config,
+		emailSender:                     &smtpSender{config: config},
+		ctx:                             context.Background(),
+		out:                             os.Stdout,
+		skippedCalls:                    make(map[string]int),
+		now:                             time.Now,
+		ApprovalSettingsOriginal:        make(map[string]*gitlab.ProjectApprovals),
+		ApprovalSettingsUpdated:         make(map[string]*gitlab.ProjectApprovals),
+		ProjectSettingsOriginal:         make(map[string]*gitlab.Project),
+		ProjectSettingsUpdated:          make(map[string]*gitlab.Project),
+		ApprovalRulesOriginal:           make(map[string]map[string]*ApprovalRuleSettings),
+		ApprovalRulesUpdated:            make(map[string]map[string]*ApprovalRuleSettings),
+		GroupSettingsOriginal:           make(map[string]*gitlab.Group),
+		GroupSettingsUpdated:            make(map[string]*gitlab.Group),
+		GroupVariablesOriginal:          make(map[string]map[string]*GroupVariableSettings),
+		GroupVariablesUpdated:           make(map[string]map[string]*GroupVariableSettings),
+		ProjectVariablesOriginal:        make(map[string]map[string]*GroupVariableSettings),
+		ProjectVariablesUpdated:         make(map[string]map[string]*GroupVariableSettings),
+		BranchFreezeOriginal:            make(map[string]map[string]*BranchFreezeSettings),
+		BranchFreezeUpdated:             make(map[string]map[string]*BranchFreezeSettings),
+		RemoteMirrorsOriginal:           make(map[string]map[string]*RemoteMirrorSettings),
+		RemoteMirrorsUpdated:            make(map[string]map[string]*RemoteMirrorSettings),
+		GroupMembersOriginal:            make(map[string]map[string]*GroupMemberSettings),
+		GroupMembersUpdated:             make(map[string]map[string]*GroupMemberSettings),
+		DefaultBranchProtectionOriginal: make(map[string]*DefaultBranchProtectionSettings),
+		DefaultBranchProtectionUpdated:  make(map[string]*DefaultBranchProtectionSettings),
+		ApprovalSettingLocks:            make(map[string]map[string]string),
+		BlockedChanges:                  make(map[string][]string),
+		ProjectRules:                    make(map[string][]string),
 	}
 }
 
@@ -79,76 +199,336 @@ func (m *ProjectManager) ComplianceReady() bool {
 }
 
 // EnsureBranchesAndProtection ensures that
-//  1) the default branch exists
-//  2) all of the protected branches are configured correctly
+//  1) all of the protected branches are configured correctly
+//  2) the unprotected exceptions of the wildcard * are exempt from its protection
+//  3) all existing branches matching a protected branch pattern are protected
 func (m *ProjectManager) EnsureBranchesAndProtection(project gitlab.Project, dryrun bool) error {
-	if err := m.ensureDefaultBranch(project, dryrun); err != nil {
+	configured := make(map[string]bool)
+	var wildcard *config.ProtectedBranch
+	for i, b := range m.config.ProtectedBranches {
+		configured[b.Name] = true
+		if b.Name == config.WildcardBranch {
+			wildcard = &m.config.ProtectedBranches[i]
+		}
+
+		// Exempt the exceptions first, so they are never locked by a new wildcard protection
+		for _, exception := range b.UnprotectedExceptions {
+			if err := m.ensureUnprotectedException(project, exception, dryrun); err != nil {
+				return err
+			}
+		}
+
+		if err := m.ensureBranchProtection(project, b, dryrun); err != nil {
+			return err
+		}
+	}
+
+	if len(m.config.ProtectedBranchPatterns) == 0 {
+		return nil
+	}
+
+	branches, err := m.listBranches(project)
+	if err != nil {
 		return err
 	}
 
-	for _, b := range m.config.ProtectedBranches {
-		protectedBranch, _, err := m.protectedBranchesClient.GetProtectedBranch(project.ID, b.Name)
-		if err != nil {
-			m.logger.Warnf("failed to get protected branch %v: %v", b.Name, err)
-		} else {
-			if protectedBranch != nil &&
-				compareAccessLevels(protectedBranch.MergeAccessLevels, b.MergeAccessLevel) &&
-				compareAccessLevels(protectedBranch.PushAccessLevels, b.PushAccessLevel) {
+	for _, branch := range branches {
+		if configured[branch.Name] {
+			continue
+		}
+		if wildcard != nil && wildcard.Excepts(branch.Name) {
+			m.logger.Debugf("Branch %s is an unprotected exception of %s, skipping protected branch patterns.", branch.Name, config.WildcardBranch)
+			continue
+		}
+
+		for _, p := range m.config.ProtectedBranchPatterns {
+			if !p.Match(branch.Name) {
 				continue
 			}
+
+			m.logger.Debugf("Branch %s matches protected branch pattern %s.", branch.Name, p.Pattern)
+			if err := m.ensureBranchProtection(project, p.Protection(branch.Name), dryrun); err != nil {
+				return err
+			}
+			break
 		}
+	}
 
-		if dryrun {
-			m.logger.Infof("DRYRUN: Skipped executing API call [UnprotectRepositoryBranches] on %v branch.", b.Name)
-			m.logger.Infof("DRYRUN: Skipped executing API call [ProtectRepositoryBranches] on %v branch.", b.Name)
-			continue
+	return nil
+}
+
+// ensureBranchProtection (re)protects the branch, unless it is already protected as configured
+func (m *ProjectManager) ensureBranchProtection(project gitlab.Project, b config.ProtectedBranch, dryrun bool) error {
+	protectedBranch, resp, err := m.protectedBranchesClient.GetProtectedBranch(project.ID, b.Name, m.withContext())
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			m.logger.Debugf("Branch %v is not protected yet.", b.Name)
+		} else {
+			m.warnf("failed to get protected branch %v: %v", b.Name, err)
 		}
+	} else {
+		if protectedBranch != nil &&
+			compareAccessLevels(protectedBranch.MergeAccessLevels, b.MergeAccessLevel) &&
+			compareAccessLevels(protectedBranch.PushAccessLevels, b.PushAccessLevel) {
+			return m.ensureCodeOwnerApproval(project, protectedBranch, b, dryrun)
+		}
+	}
 
-		// Remove protections (if present)
-		if resp, err := m.protectedBranchesClient.UnprotectRepositoryBranches(project.ID, b.Name); err != nil &&
-			(resp == nil || resp.StatusCode != http.StatusNotFound) {
-			return fmt.Errorf("failed to unprotect branch %v before protection: %v", b.Name, err)
+	if dryrun {
+		m.skipAPICall("UnprotectRepositoryBranches", "on %v branch.", b.Name)
+		m.skipAPICall("ProtectRepositoryBranches", "on %v branch.", b.Name)
+		return nil
+	}
+
+	// Remove protections (if present)
+	if resp, err := m.protectedBranchesClient.UnprotectRepositoryBranches(project.ID, b.Name, m.withContext()); err != nil &&
+		(resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("failed to unprotect branch %v before protection: %v", b.Name, err)
+	}
+
+	opt := &gitlab.ProtectRepositoryBranchesOptions{
+		Name:                      gitlab.String(b.Name),
+		PushAccessLevel:           b.PushAccessLevel.Value(),
+		MergeAccessLevel:          b.MergeAccessLevel.Value(),
+		CodeOwnerApprovalRequired: b.CodeOwnerApprovalRequired,
+	}
+
+	// (Re)add protections
+	if _, _, err := m.protectedBranchesClient.ProtectRepositoryBranches(project.ID, opt, m.withContext()); err != nil {
+		return fmt.Errorf("failed to protect branch %s: %v", b.Name, err)
+	}
+
+	return nil
+}
+
+// ensureUnprotectedException exempts the branches matching the exception from the wildcard *
+// protection. GitLab can't exclude branches from a wildcard protection, but applies the most
+// permissive of all protections matching a branch. The exception is therefore protected with
+// the least restrictive settings: developers may push, merge and force push.
+func (m *ProjectManager) ensureUnprotectedException(project gitlab.Project, exception string, dryrun bool) error {
+	protectedBranch, resp, err := m.protectedBranchesClient.GetProtectedBranch(project.ID, exception, m.withContext())
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			m.logger.Debugf("Unprotected exception %v is not exempt yet.", exception)
+		} else {
+			m.warnf("failed to get protected branch %v: %v", exception, err)
 		}
+	} else if protectedBranch != nil && protectedBranch.AllowForcePush &&
+		compareAccessLevels(protectedBranch.MergeAccessLevels, config.AccessLevelDeveloper) &&
+		compareAccessLevels(protectedBranch.PushAccessLevels, config.AccessLevelDeveloper) {
+		return nil
+	}
+
+	if dryrun {
+		m.skipAPICall("UnprotectRepositoryBranches", "on %v branch.", exception)
+		m.skipAPICall("ProtectRepositoryBranches", "on %v branch.", exception)
+		return nil
+	}
 
-		opt := &gitlab.ProtectRepositoryBranchesOptions{
-			Name:             gitlab.String(b.Name),
-			PushAccessLevel:  b.PushAccessLevel.Value(),
-			MergeAccessLevel: b.MergeAccessLevel.Value(),
+	if resp, err := m.protectedBranchesClient.UnprotectRepositoryBranches(project.ID, exception, m.withContext()); err != nil &&
+		(resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return fmt.Errorf("failed to unprotect branch %v before exempting it: %v", exception, err)
+	}
+
+	developer := config.AccessLevel(config.AccessLevelDeveloper)
+	opt := &gitlab.ProtectRepositoryBranchesOptions{
+		Name:             gitlab.String(exception),
+		PushAccessLevel:  developer.Value(),
+		MergeAccessLevel: developer.Value(),
+		AllowForcePush:   gitlab.Bool(true),
+	}
+	if _, _, err := m.protectedBranchesClient.ProtectRepositoryBranches(project.ID, opt, m.withContext()); err != nil {
+		return fmt.Errorf("failed to exempt branch %s from the %s protection: %v", exception, config.WildcardBranch, err)
+	}
+	m.logger.Infof("Exempted branch %s of project %s from the %s protection.", exception, project.PathWithNamespace, config.WildcardBranch)
+
+	return nil
+}
+
+// listBranches returns all branches of the project
+func (m *ProjectManager) listBranches(project gitlab.Project) ([]*gitlab.Branch, error) {
+	var branches []*gitlab.Branch
+
+	opt := &gitlab.ListBranchesOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := m.branchesClient.ListBranches(project.ID, opt, m.withContext())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list branches of project %s: %v", project.PathWithNamespace, err)
 		}
+		branches = append(branches, page...)
 
-		// (Re)add protections
-		if _, _, err := m.protectedBranchesClient.ProtectRepositoryBranches(project.ID, opt); err != nil {
-			return fmt.Errorf("failed to protect branch %s: %v", b.Name, err)
+		if resp.NextPage == 0 {
+			break
 		}
+		opt.Page = resp.NextPage
+	}
+
+	return branches, nil
+}
+
+// ensureCodeOwnerApproval flips the code owner approval of an otherwise correctly protected
+// branch in place, without unprotecting it
+func (m *ProjectManager) ensureCodeOwnerApproval(project gitlab.Project, protectedBranch *gitlab.ProtectedBranch, b config.ProtectedBranch, dryrun bool) error {
+	if b.CodeOwnerApprovalRequired == nil || protectedBranch.CodeOwnerApprovalRequired == *b.CodeOwnerApprovalRequired {
+		return nil
+	}
+
+	if dryrun {
+		m.skipAPICall("UpdateProtectedBranch", "on %v branch.", b.Name)
+		return nil
+	}
+
+	opt := &gitlab.UpdateProtectedBranchOptions{CodeOwnerApprovalRequired: b.CodeOwnerApprovalRequired}
+	if _, _, err := m.protectedBranchesClient.UpdateProtectedBranch(project.ID, b.Name, opt, m.withContext()); err != nil {
+		return fmt.Errorf("failed to update code owner approval of branch %s: %v", b.Name, err)
 	}
 
 	return nil
 }
 
+// compareAccessLevels reports whether the role based access level of the protection is the
+// configured one. Users, groups and deploy keys granted access in addition (GitLab EE) are
+// ignored, so protections with such grants are not recreated on every run.
 func compareAccessLevels(branchLevel []*gitlab.BranchAccessDescription, configLevel config.AccessLevel) bool {
-	return len(branchLevel) == 1 && branchLevel[0].AccessLevel == *configLevel.Value()
+	var roles []*gitlab.BranchAccessDescription
+	for _, level := range branchLevel {
+		if level.UserID == 0 && level.GroupID == 0 && level.DeployKeyID == 0 {
+			roles = append(roles, level)
+		}
+	}
+
+	return len(roles) == 1 && roles[0].AccessLevel == *configLevel.Value()
+}
+
+// EnsureMetadata ensures the description and avatar of the project as configured in the
+// metadata section. In non_empty mode existing descriptions are left untouched.
+func (m *ProjectManager) EnsureMetadata(project gitlab.Project, dryrun bool) error {
+	m.logger.Debugf("Ensuring metadata of project %s ...", project.PathWithNamespace)
+
+	// Exit if nothing to configure
+	if m.config.Metadata == nil {
+		m.logger.Debugf("No metadata section provided in config")
+		return nil
+	}
+
+	// Get current settings states
+	projectSettings, err := m.GetProjectSettings(project)
+	if err != nil {
+		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	// Record current settings states, unless already recorded by UpdateProjectSettings
+	if _, ok := m.ProjectSettingsOriginal[project.PathWithNamespace]; !ok {
+		m.ProjectSettingsOriginal[project.PathWithNamespace] = projectSettings
+	}
+
+	opt := &gitlab.EditProjectOptions{}
+	changeExpected := false
+
+	if d := m.config.Metadata.Description; d != nil {
+		// Projects without the topics the template references keep their description
+		description, err := d.Render(*projectSettings)
+		if err != nil {
+			m.warnf("Skipping the description of project %s: %v", project.PathWithNamespace, err)
+		} else {
+			switch d.Mode {
+			case config.DescriptionModeExact:
+				changeExpected = projectSettings.Description != description
+			case config.DescriptionModeNonEmpty:
+				changeExpected = strings.TrimSpace(projectSettings.Description) == ""
+			}
+		}
+
+		if changeExpected {
+			opt.Description = gitlab.String(description)
+		}
+	}
+
+	// GitLab keeps the file name of uploaded avatars, which is used to detect a differing avatar.
+	avatarName := filepath.Base(m.config.Metadata.Avatar)
+	if m.config.Metadata.Avatar != "" && path.Base(projectSettings.AvatarURL) != avatarName {
+		changeExpected = true
+
+		if !dryrun {
+			avatar, err := os.Open(m.config.Metadata.Avatar)
+			if err != nil {
+				return fmt.Errorf("failed to open avatar %s: %v", m.config.Metadata.Avatar, err)
+			}
+			defer avatar.Close()
+
+			opt.Avatar = &gitlab.ProjectAvatar{Filename: avatarName, Image: avatar}
+		}
+	}
+
+	if !changeExpected {
+		m.logger.Debugf("No action required.")
+
+		// Record current settings states, unless already recorded by UpdateProjectSettings
+		if _, ok := m.ProjectSettingsUpdated[project.PathWithNamespace]; !ok {
+			m.ProjectSettingsUpdated[project.PathWithNamespace] = projectSettings
+		}
+
+		return nil
+	}
+
+	if dryrun {
+		m.skipAPICall("EditProject", "for metadata")
+
+		// Record the expected settings states on top of the planned project settings
+		planned, ok := m.ProjectSettingsUpdated[project.PathWithNamespace]
+		if !ok {
+			planned = projectSettings
+		}
+		projected := &gitlab.Project{}
+		if err := applyOptions(planned, opt, projected); err != nil {
+			return err
+		}
+		m.ProjectSettingsUpdated[project.PathWithNamespace] = projected
+
+		return nil
+	}
+
+	if _, _, err := m.projectsClient.EditProject(project.ID, opt, m.withContext()); err != nil {
+		return fmt.Errorf("failed to update metadata of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	// Get new settings states
+	projectSettings, err = m.GetProjectSettings(project)
+	if err != nil {
+		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	// Record current settings states
+	m.ProjectSettingsUpdated[project.PathWithNamespace] = projectSettings
+
+	m.logger.Debugf("Ensuring metadata of project %s done.", project.PathWithNamespace)
+
+	return nil
 }
 
 func (m *ProjectManager) EnsureTagsProtection(project gitlab.Project, dryrun bool) error {
 	for _, t := range m.config.ProtectedTags {
-		protectedTag, _, err := m.protectedTagsClient.GetProtectedTag(project.ID, t.Name)
+		protectedTag, resp, err := m.protectedTagsClient.GetProtectedTag(project.ID, t.Name, m.withContext())
 		if err != nil {
-			m.logger.Warnf("failed to get protected tag %v: %v", t.Name, err)
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				m.logger.Debugf("Tag %v is not protected yet.", t.Name)
+			} else {
+				m.warnf("failed to get protected tag %v: %v", t.Name, err)
+			}
 		} else {
-			if protectedTag != nil &&
-				len(protectedTag.CreateAccessLevels) == 1 && protectedTag.CreateAccessLevels[0].AccessLevel == *t.CreateAccessLevel.Value() {
+			if protectedTag != nil && tagPermissionsMatch(protectedTag.CreateAccessLevels, t) {
 				continue
 			}
 		}
 
 		if dryrun {
-			m.logger.Infof("DRYRUN: Skipped executing API call [UnprotectRepositoryTags] on %v tag.", t.Name)
-			m.logger.Infof("DRYRUN: Skipped executing API call [ProtectRepositoryTags] on %v tag.", t.Name)
+			m.skipAPICall("UnprotectRepositoryTags", "on %v tag.", t.Name)
+			m.skipAPICall("ProtectRepositoryTags", "on %v tag.", t.Name)
 			continue
 		}
 
 		// Remove protections (if present)
-		if resp, err := m.protectedTagsClient.UnprotectRepositoryTags(project.ID, t.Name); err != nil &&
+		if resp, err := m.protectedTagsClient.UnprotectRepositoryTags(project.ID, t.Name, m.withContext()); err != nil &&
 			(resp == nil || resp.StatusCode != http.StatusNotFound) {
 			return fmt.Errorf("failed to unprotect branch %v before protection: %v", t.Name, err)
 		}
@@ -157,9 +537,16 @@ func (m *ProjectManager) EnsureTagsProtection(project gitlab.Project, dryrun boo
 			Name:              gitlab.String(t.Name),
 			CreateAccessLevel: t.CreateAccessLevel.Value(),
 		}
+		if len(t.AllowedToCreate) > 0 {
+			allowed := make([]*gitlab.TagsPermissionOptions, 0, len(t.AllowedToCreate))
+			for _, a := range t.AllowedToCreate {
+				allowed = append(allowed, a.Options())
+			}
+			opt.AllowedToCreate = &allowed
+		}
 
 		// (Re)add protections
-		if _, _, err := m.protectedTagsClient.ProtectRepositoryTags(project.ID, opt); err != nil {
+		if _, _, err := m.protectedTagsClient.ProtectRepositoryTags(project.ID, opt, m.withContext()); err != nil {
 			return fmt.Errorf("failed to protect branch %s: %v", t.Name, err)
 		}
 	}
@@ -167,27 +554,187 @@ func (m *ProjectManager) EnsureTagsProtection(project gitlab.Project, dryrun boo
 	return nil
 }
 
+// tagPermissionsMatch reports whether the create access levels of a protected tag are
+// exactly the create access level and allowed_to_create grants of the config. User and group
+// grants are matched by their ID only, as GitLab reports them with an access level as well.
+func tagPermissionsMatch(actual []*gitlab.TagAccessDescription, t config.ProtectedTag) bool {
+	key := func(userID, groupID int, level gitlab.AccessLevelValue) string {
+		switch {
+		case userID != 0:
+			return fmt.Sprintf("user:%d", userID)
+		case groupID != 0:
+			return fmt.Sprintf("group:%d", groupID)
+		default:
+			return fmt.Sprintf("level:%d", level)
+		}
+	}
+
+	expected := map[string]bool{key(0, 0, *t.CreateAccessLevel.Value()): true}
+	for _, a := range t.AllowedToCreate {
+		expected[key(a.UserID, a.GroupID, *a.AccessLevel.Value())] = true
+	}
+
+	found := map[string]bool{}
+	for _, d := range actual {
+		k := key(d.UserID, d.GroupID, d.AccessLevel)
+		if !expected[k] {
+			return false
+		}
+		found[k] = true
+	}
+
+	return len(found) == len(expected)
+}
+
+// HasChanges reports whether any of the recorded settings were (or, in dryrun, would be)
+// changed
+func (m *ProjectManager) HasChanges() (bool, error) {
+	approvalDifflog, err := diff.Diff(m.ApprovalSettingsOriginal, m.ApprovalSettingsUpdated)
+	if err != nil {
+		return false, fmt.Errorf("failed to diff approval settings: %v", err)
+	}
+	projectDifflog, err := diff.Diff(m.ProjectSettingsOriginal, m.ProjectSettingsUpdated)
+	if err != nil {
+		return false, fmt.Errorf("failed to diff project settings: %v", err)
+	}
+	approvalRuleDiffs, err := m.approvalRuleDiffs()
+	if err != nil {
+		return false, err
+	}
+	groupDifflog, err := diff.Diff(m.GroupSettingsOriginal, m.GroupSettingsUpdated)
+	if err != nil {
+		return false, fmt.Errorf("failed to diff group settings: %v", err)
+	}
+	groupVariableDiffs, err := variableDiffs(m.GroupVariablesOriginal, m.GroupVariablesUpdated)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range groupVariableDiffs {
+		if len(d.difflog) > 0 {
+			return true, nil
+		}
+	}
+	projectVariableDiffs, err := variableDiffs(m.ProjectVariablesOriginal, m.ProjectVariablesUpdated)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range projectVariableDiffs {
+		if len(d.difflog) > 0 {
+			return true, nil
+		}
+	}
+	branchFreezeDiffs, err := m.branchFreezeDiffs()
+	if err != nil {
+		return false, err
+	}
+	for _, d := range branchFreezeDiffs {
+		if len(d.difflog) > 0 {
+			return true, nil
+		}
+	}
+	for _, d := range approvalRuleDiffs {
+		if len(d.difflog) > 0 {
+			return true, nil
+		}
+	}
+	remoteMirrorDiffs, err := m.remoteMirrorDiffs()
+	if err != nil {
+		return false, err
+	}
+	for _, d := range remoteMirrorDiffs {
+		if len(d.difflog) > 0 {
+			return true, nil
+		}
+	}
+	groupMemberDiffs, err := m.groupMemberDiffs()
+	if err != nil {
+		return false, err
+	}
+	for _, d := range groupMemberDiffs {
+		if len(d.difflog) > 0 {
+			return true, nil
+		}
+	}
+	defaultBranchProtectionDifflog, err := diff.Diff(m.DefaultBranchProtectionOriginal, m.DefaultBranchProtectionUpdated)
+	if err != nil {
+		return false, fmt.Errorf("failed to diff default branch protections: %v", err)
+	}
+
+	return len(approvalDifflog) > 0 || len(projectDifflog) > 0 || len(groupDifflog) > 0 || len(defaultBranchProtectionDifflog) > 0, nil
+}
+
+// RunSummary returns the summary of a sync run over the given number of projects, listing
+// the projects with (planned) settings changes
+func (m *ProjectManager) RunSummary(projects int, dryrun bool) (RunSummary, error) {
+	entries, err := m.ChangeLogEntries(false)
+	if err != nil {
+		return RunSummary{}, err
+	}
+
+	summary := RunSummary{Dryrun: dryrun, Projects: projects, Errors: m.errorCount, ChangedProjects: []string{}}
+	for _, entry := range entries {
+		// Entries are sorted by project
+		if n := len(summary.ChangedProjects); n == 0 || summary.ChangedProjects[n-1] != entry.Project {
+			summary.ChangedProjects = append(summary.ChangedProjects, entry.Project)
+		}
+	}
+
+	return summary, nil
+}
+
 // GetError returns the Error status
 func (m *ProjectManager) GetError() bool {
-	return m.config.Error
+	return m.baseConfig.Error
 }
 
-// GenerateChangeLogReport to console the altered project settings
-func (m *ProjectManager) GenerateChangeLogReport() error {
-	m.logger.Debugf("Generate Change Log Report")
-
+// ChangeLogEntries returns the altered settings of all projects, sorted by project, subsection
+// and setting. Unless fullDiff is set, changes of list settings (e.g. approvers) only contain
+// the added and removed elements.
+func (m *ProjectManager) ChangeLogEntries(fullDiff bool) ([]ChangeLogEntry, error) {
 	if err := m.debugPrintAllSettings(); err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	// Get differences
 	approvalDifflog, err := diff.Diff(m.ApprovalSettingsOriginal, m.ApprovalSettingsUpdated)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to diff approval settings: %v", err)
 	}
 	projectDifflog, err := diff.Diff(m.ProjectSettingsOriginal, m.ProjectSettingsUpdated)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to diff project settings: %v", err)
+	}
+	approvalRuleDiffs, err := m.approvalRuleDiffs()
+	if err != nil {
+		return nil, err
+	}
+	groupDifflog, err := diff.Diff(m.GroupSettingsOriginal, m.GroupSettingsUpdated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff group settings: %v", err)
+	}
+	groupVariableDiffs, err := variableDiffs(m.GroupVariablesOriginal, m.GroupVariablesUpdated)
+	if err != nil {
+		return nil, err
+	}
+	projectVariableDiffs, err := variableDiffs(m.ProjectVariablesOriginal, m.ProjectVariablesUpdated)
+	if err != nil {
+		return nil, err
+	}
+	branchFreezeDiffs, err := m.branchFreezeDiffs()
+	if err != nil {
+		return nil, err
+	}
+	remoteMirrorDiffs, err := m.remoteMirrorDiffs()
+	if err != nil {
+		return nil, err
+	}
+	groupMemberDiffs, err := m.groupMemberDiffs()
+	if err != nil {
+		return nil, err
+	}
+	defaultBranchProtectionDifflog, err := diff.Diff(m.DefaultBranchProtectionOriginal, m.DefaultBranchProtectionUpdated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff default branch protections: %v", err)
 	}
 
 	m.logger.Debugf("---[ Approval Diff Log ]---")
@@ -199,120 +746,191 @@ func (m *ProjectManager) GenerateChangeLogReport() error {
 
 	// Process Approvals
 	m.logger.Debugf("Process Approval Diff Log")
-	for _, v := range approvalDifflog {
-		// If REPO doesn't exist in map, make it.
-		if _, ok := changelog[v.Path[0]]; !ok {
-			changelog[v.Path[0]] = make(map[string]map[string]map[string]interface{})
-		}
-		if _, ok := changelog[v.Path[0]]["approval_settings"]; !ok {
-			changelog[v.Path[0]]["approval_settings"] = make(map[string]map[string]interface{})
-		}
-
-		setting_name := strcase.ToSnake(v.Path[len(v.Path)-1])
-		changelog[v.Path[0]]["approval_settings"][setting_name] = make(map[string]interface{})
-		changelog[v.Path[0]]["approval_settings"][setting_name]["From"] = v.From
-		changelog[v.Path[0]]["approval_settings"][setting_name]["To"] = v.To
-	}
+	addChangeLogEntries(changelog, "approval_settings", approvalDifflog, m.ApprovalSettingsOriginal, m.ApprovalSettingsUpdated, fullDiff)
 
 	// Process Projects
 	m.logger.Debugf("Process Project Diff Log")
-	for _, v := range projectDifflog {
-		// If REPO doesn't exist in map, make it.
-		if _, ok := changelog[v.Path[0]]; !ok {
-			changelog[v.Path[0]] = make(map[string]map[string]map[string]interface{})
-		}
-		if _, ok := changelog[v.Path[0]]["project_settings"]; !ok {
-			changelog[v.Path[0]]["project_settings"] = make(map[string]map[string]interface{})
-		}
+	addChangeLogEntries(changelog, "project_settings", projectDifflog, m.ProjectSettingsOriginal, m.ProjectSettingsUpdated, fullDiff)
 
-		setting_name := strcase.ToSnake(v.Path[len(v.Path)-1])
-		changelog[v.Path[0]]["project_settings"][setting_name] = make(map[string]interface{})
-		changelog[v.Path[0]]["project_settings"][setting_name]["From"] = v.From
-		changelog[v.Path[0]]["project_settings"][setting_name]["To"] = v.To
+	// Process Approval Rules, in a subsection per protected branch
+	m.logger.Debugf("Process Approval Rule Diff Logs")
+	for _, d := range approvalRuleDiffs {
+		addChangeLogEntries(changelog, fmt.Sprintf("approval_rules[%s]", d.branch), d.difflog, d.original, d.updated, fullDiff)
 	}
 
+	// Process Groups, listed under the group path
+	m.logger.Debugf("Process Group Diff Log")
+	addChangeLogEntries(changelog, "group_settings", groupDifflog, m.GroupSettingsOriginal, m.GroupSettingsUpdated, fullDiff)
+
+	// Process Group Variables, in a subsection per key
+	m.logger.Debugf("Process Group Variable Diff Logs")
+	for _, d := range groupVariableDiffs {
+		addChangeLogEntries(changelog, fmt.Sprintf("group_ci_variables[%s]", d.key), d.difflog, d.original, d.updated, fullDiff)
+	}
+
+	// Process Project Variables, in a subsection per key
+	m.logger.Debugf("Process Project Variable Diff Logs")
+	for _, d := range projectVariableDiffs {
+		addChangeLogEntries(changelog, fmt.Sprintf("project_ci_variables[%s]", d.key), d.difflog, d.original, d.updated, fullDiff)
+	}
+
+	// Process Group Members, in a subsection per member
+	m.logger.Debugf("Process Group Member Diff Logs")
+	for _, d := range groupMemberDiffs {
+		addChangeLogEntries(changelog, fmt.Sprintf("group_members[%s]", d.key), d.difflog, d.original, d.updated, fullDiff)
+	}
+
+	// Process Branch Freezes, in a subsection per protected branch
+	m.logger.Debugf("Process Branch Freeze Diff Logs")
+	for _, d := range branchFreezeDiffs {
+		addChangeLogEntries(changelog, fmt.Sprintf("protected_branches[%s]", d.branch), d.difflog, d.original, d.updated, fullDiff)
+	}
+
+	// Process Remote Mirrors, in a subsection per mirror URL
+	m.logger.Debugf("Process Remote Mirror Diff Logs")
+	for _, d := range remoteMirrorDiffs {
+		addChangeLogEntries(changelog, fmt.Sprintf("remote_mirrors[%s]", d.url), d.difflog, d.original, d.updated, fullDiff)
+	}
+
+	// Process Default Branch Protections
+	m.logger.Debugf("Process Default Branch Protection Diff Log")
+	addChangeLogEntries(changelog, "default_branch.protection", defaultBranchProtectionDifflog, m.DefaultBranchProtectionOriginal, m.DefaultBranchProtectionUpdated, fullDiff)
+
 	// Output Raw JSON
 	body, err := json.MarshalIndent(changelog, "", "  ")
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to convert change log to json: %v", err)
 	}
 	m.logger.Debugf("---[ Change Log (JSON) ]---")
 	m.logger.Debugf("%s\n", string(body))
 
-	if len(changelog) != 0 {
-		// Get longest length of setting name
-		var longest_setting_name int
-		var project_names []string
-		for project_name, subsections := range changelog {
-			// Add to list of project names to allow sorting
-			project_names = append(project_names, project_name)
-
-			for _, data := range subsections {
-				for setting := range data {
-					if len(setting) > longest_setting_name {
-						longest_setting_name = len(setting)
-					}
+	var entries []ChangeLogEntry
+	for project, subsections := range changelog {
+		for subsection, settings := range subsections {
+			for setting, change := range settings {
+				entry := ChangeLogEntry{
+					Project:    project,
+					Subsection: subsection,
+					Setting:    setting,
+					From:       change["From"],
+					To:         change["To"],
 				}
+				if _, ok := change["Added"]; ok {
+					entry.ListDiff = true
+					entry.Removed = change["Removed"].([]string)
+					entry.Added = change["Added"].([]string)
+				}
+				entries = append(entries, entry)
 			}
 		}
-		sort.Strings(project_names)
+	}
 
-		// Output Formated Report
-		fmt.Printf("\nCHANGE LOG\n")
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Project != entries[j].Project {
+			return entries[i].Project < entries[j].Project
+		}
+		if entries[i].Subsection != entries[j].Subsection {
+			return entries[i].Subsection < entries[j].Subsection
+		}
+		return entries[i].Setting < entries[j].Setting
+	})
+
+	return entries, nil
+}
+
+// GenerateChangeLogReport to console the altered project settings. Unless fullDiff is set,
+// changes of list settings (e.g. approvers) only show the added and removed elements.
+func (m *ProjectManager) GenerateChangeLogReport(fullDiff bool) error {
+	m.logger.Debugf("Generate Change Log Report")
+
+	entries, err := m.ChangeLogEntries(fullDiff)
+	if err != nil {
+		return err
+	}
+	m.changeLogText(m.out, m.reportOptions.changeLogEntries(entries))
 
-		for _, name := range project_names {
-			fmt.Printf("  %s\n", name)
+	return nil
+}
 
-			var subsections []string
-			for subsection := range changelog[name] {
-				subsections = append(subsections, subsection)
+// changeLogText renders the sorted change log entries and the changes blocked by policy as
+// the console report
+func (m *ProjectManager) changeLogText(w io.Writer, entries []ChangeLogEntry) {
+	if len(entries) != 0 {
+		// Get longest length of setting name
+		var longest_setting_name int
+		for _, entry := range entries {
+			if len(entry.Setting) > longest_setting_name {
+				longest_setting_name = len(entry.Setting)
 			}
-			sort.Strings(subsections)
+		}
 
-			for _, subsection := range subsections {
-				var settings []string
-				for setting := range changelog[name][subsection] {
-					settings = append(settings, setting)
-				}
-				sort.Strings(settings)
+		// Output Formated Report
+		fmt.Fprintf(w, "\nCHANGE LOG\n")
 
-				for _, setting := range settings {
-					fmt.Printf("    %-*s", longest_setting_name+2, setting+":")
-					fmt.Printf("\"%v\" => \"%v\"\n", changelog[name][subsection][setting]["From"], changelog[name][subsection][setting]["To"])
+		for i, entry := range entries {
+			if i == 0 || entries[i-1].Project != entry.Project {
+				if i != 0 {
+					fmt.Fprintf(w, "\n")
 				}
+				fmt.Fprintf(w, "  %s\n", entry.Project)
 			}
 
-			fmt.Printf("\n")
+			fmt.Fprintf(w, "    %-*s", longest_setting_name+2, entry.Setting+":")
+			if entry.ListDiff {
+				fmt.Fprintf(w, "-%v +%v\n", entry.Removed, entry.Added)
+			} else {
+				fmt.Fprintf(w, "\"%v\" => \"%v\"\n", entry.From, entry.To)
+			}
 		}
+		fmt.Fprintf(w, "\n")
 	} else {
-		fmt.Printf("\nNo changes discovered.\n")
+		fmt.Fprintf(w, "\nNo changes discovered.\n")
 	}
 
-	return nil
-}
+	if len(m.BlockedChanges) != 0 {
+		fmt.Fprintf(w, "\nBLOCKED BY POLICY\n")
+		for _, name := range m.blockedProjects() {
+			fmt.Fprintf(w, "  %s\n", name)
+			for _, field := range m.BlockedChanges[name] {
+				fmt.Fprintf(w, "    %s\n", field)
+			}
+		}
+	}
 
-// GenerateComplianceEmail emails the compliance state of mandatory settings
-func (m *ProjectManager) GenerateComplianceEmail() error {
-	if m.config.Compliance.Email.From == "" || m.config.Compliance.Email.Server == "" || m.config.Compliance.Email.Port == 0 {
-		m.logger.Debugf("---[ Skipping Compliance Settings as From, Server or Port is not set ]---")
-		return nil
+	if len(m.ProjectsWithoutCI) != 0 {
+		fmt.Fprintf(w, "\nSKIPPED WITHOUT CI (only_allow_merge_if_pipeline_succeeds)\n")
+		for _, name := range m.ProjectsWithoutCI {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
 	}
+}
 
-	if err := m.debugPrintAllSettings(); err != nil {
-		panic(err)
+// blockedProjects returns the sorted names of the projects with changes blocked by policy
+func (m *ProjectManager) blockedProjects() []string {
+	var names []string
+	for name := range m.BlockedChanges {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	m.logger.Debugf("---[ Compliance Settings ]---")
-	m.logger.Debugf("%v\n", m.config.Compliance)
+	return names
+}
 
-	// Create sorted list of projects
-	var project_names []string
-	for project_name := range m.ProjectSettingsOriginal {
+// ComplianceResults compares the original settings of each project with the mandatory
+// settings of the compliance config. The results are sorted by project, subsection and setting.
+func (m *ProjectManager) ComplianceResults() []ComplianceResult {
+	// Create sorted list of projects, only the subsections with mandatory settings are fetched
+	var projectNames []string
+	for projectName := range m.ProjectSettingsOriginal {
 		// Add to list of project names to allow sorting
-		project_names = append(project_names, project_name)
-
+		projectNames = append(projectNames, projectName)
+	}
+	for projectName := range m.ApprovalSettingsOriginal {
+		if _, ok := m.ProjectSettingsOriginal[projectName]; !ok {
+			projectNames = append(projectNames, projectName)
+		}
 	}
-	sort.Strings(project_names)
+	sort.Strings(projectNames)
 
 	// Create sorted list of subsections
 	var subsections []string
@@ -322,80 +940,104 @@ func (m *ProjectManager) GenerateComplianceEmail() error {
 	sort.Strings(subsections)
 
 	// Create sorted list of settings, per subsection
-	var longestSettingName int
 	var settings = make(map[string][]string)
 	for _, subsection := range subsections {
 		settings[subsection] = make([]string, 0)
 
 		for setting := range m.config.Compliance.Mandatory[subsection] {
 			settings[subsection] = append(settings[subsection], setting)
-			if len(setting) > longestSettingName {
-				longestSettingName = len(setting)
-			}
 		}
 		sort.Strings(settings[subsection])
 	}
 
-	// Print Title
-	emailBody := "\r\n<h2>Compliance Report</h2>\r\n"
-	emailBody += "<table>\r\n"
-
-	// Loop through projects
-	for _, name := range project_names {
-		emailBody += " <tr>\r\n"
-		emailBody += fmt.Sprintf("  <td colspan=\"2\" style=\"text-indent:20px\"><b>%s</b></td>\r\n", name)
-		emailBody += " </tr>\r\n"
-
-		// Loop through subsections
+	results := make([]ComplianceResult, 0)
+	for _, name := range projectNames {
 		for _, subsection := range subsections {
-			emailBody += " <tr>\r\n"
-			emailBody += fmt.Sprintf("  <td colspan=\"2\" style=\"text-indent:40px\"><b>%s</b></td>\r\n", subsection)
-			emailBody += " </tr>\r\n"
-
-			// Loop through settings
 			for _, setting := range settings[subsection] {
-				emailBody += " <tr>\r\n"
-				emailBody += fmt.Sprintf("  <td style=\"text-indent:60px\">%-*s</td>", longestSettingName+2, setting+":")
-
-				var settingValue interface{}
+				var current interface{}
 				switch subsection {
 				case "approval_settings":
-					structure := reflect.ValueOf(m.ApprovalSettingsOriginal[name])
-					field := structure.Elem().FieldByName(strcase.ToCamel(setting))
-					if field.IsValid() {
-						settingValue = field.Interface()
-					} else {
-						settingValue = "NOT VALID SETTING"
-					}
+					current = m.ApprovalSettingsOriginal[name]
 				case "project_settings":
-					structure := reflect.ValueOf(m.ProjectSettingsOriginal[name])
-					field := structure.Elem().FieldByName(strcase.ToCamel(setting))
-					if field.IsValid() {
-						settingValue = field.Interface()
-					} else {
-						settingValue = "NOT VALID SETTING"
-					}
+					current = m.ProjectSettingsOriginal[name]
+				}
+
+				expected := m.config.Compliance.Mandatory[subsection][setting]
+				result := ComplianceResult{
+					Project:    name,
+					Subsection: subsection,
+					Setting:    setting,
+					Expected:   readableValue(expected),
+					Weight:     m.config.Compliance.Weight(subsection, setting),
 				}
 
-				emailBody += fmt.Sprintf("  <td style=\"text-indent:40px\">%v", settingValue)
+				structure := reflect.ValueOf(current)
+				if !structure.IsValid() || structure.IsNil() {
+					// The settings could not be fetched, e.g. due to missing permissions
+					result.Unavailable = true
+					results = append(results, result)
+					continue
+				}
+
+				var actual interface{}
+				field := fieldByJSONKey(structure.Elem(), setting)
+				if field.IsValid() {
+					actual = field.Interface()
+				} else {
+					m.warnf("Unknown setting %s.%s in compliance config", subsection, setting)
+					actual = "NOT VALID SETTING"
+				}
 
-				if settingValue != m.config.Compliance.Mandatory[subsection][setting] {
-					emailBody += fmt.Sprintf(" (%v)", m.config.Compliance.Mandatory[subsection][setting])
+				// Topics are a required set, validated as list of strings by the config
+				if topics, ok := actual.([]string); ok && subsection == "project_settings" && setting == "topics" {
+					topicsCompliance(&result, topics, expected.([]string))
+				} else {
+					// Fields may be pointers or slices, compare by value instead of with ==
+					result.Actual = readableValue(actual)
+					result.Compliant = complianceEqual(actual, expected)
+				}
+				if subsection == "approval_settings" {
+					result.Inherited = m.ApprovalSettingLocks[name][setting]
 				}
 
-				emailBody += "</td>\r\n"
-				emailBody += "</tr>\r\n"
+				results = append(results, result)
 			}
 		}
+	}
+
+	return results
+}
 
-		emailBody += "</table>\r\n"
+// fieldByJSONKey returns the field of the struct with the given json key, e.g. CIConfigPath
+// for ci_config_path. Camel-casing the key would miss acronyms like CI, ID or URL. Fields
+// without a json tag are matched by their camel-cased name.
+func fieldByJSONKey(v reflect.Value, key string) reflect.Value {
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if name == key {
+			return v.Field(i)
+		}
 	}
 
-	if err := m.SendEmail(m.config.Compliance.Email.To, m.config.Compliance.Email.From, "Compliance Report", emailBody); err != nil {
-		m.logger.Fatal(err)
+	return v.FieldByName(strcase.ToCamel(key))
+}
+
+// GenerateComplianceEmail emails the compliance state of mandatory settings
+func (m *ProjectManager) GenerateComplianceEmail() error {
+	if !m.config.EmailConfigured() {
+		m.logger.Debugf("---[ Skipping Compliance Settings as From, Server or Port is not set ]---")
+		return nil
 	}
 
-	return nil
+	if err := m.debugPrintAllSettings(); err != nil {
+		panic(err)
+	}
+
+	m.logger.Debugf("---[ Compliance Settings ]---")
+	m.logger.Debugf("%v\n", m.config.Compliance)
+
+	results := m.ComplianceResults()
+	return m.writeOutput(Output{Sink: OutputEmail, Format: FormatHTML}, complianceReport{results: results, scores: newComplianceScores(results)})
 }
 
 // GenerateComplianceReport prints to console the compliance state of mandatory settings
@@ -407,83 +1049,70 @@ func (m *ProjectManager) GenerateComplianceReport() error {
 	m.logger.Debugf("---[ Compliance Settings ]---")
 	m.logger.Debugf("%v\n", m.config.Compliance)
 
-	// Print Title
-	fmt.Printf("\nCOMPLIANCE REPORT\n")
+	results := m.ComplianceResults()
+	m.complianceText(m.out, m.reportOptions.complianceResults(results), newComplianceScores(results))
 
-	// Create sorted list of projects
-	var projectNames []string
-	for projectName := range m.ProjectSettingsOriginal {
-		// Add to list of project names to allow sorting
-		projectNames = append(projectNames, projectName)
+	return nil
+}
 
-	}
-	sort.Strings(projectNames)
+// complianceText renders the sorted and filtered compliance results as the console report,
+// with the scores of all results
+func (m *ProjectManager) complianceText(w io.Writer, results []ComplianceResult, scores ComplianceScores) {
+	// Print Title
+	fmt.Fprintf(w, "\nCOMPLIANCE REPORT\n")
+	fmt.Fprintf(w, "\nCompliance score: %s\n", formatScore(scores.Overall))
 
-	// Create sorted list of subsections
-	var subsections []string
-	for subsection := range m.config.Compliance.Mandatory {
-		subsections = append(subsections, subsection)
+	longestSettingName := longestComplianceSettingName(results)
+
+	if len(results) == 0 && m.reportOptions.OnlyNonCompliant {
+		fmt.Fprintf(w, "\nAll projects are compliant.\n")
 	}
-	sort.Strings(subsections)
 
-	// Create sorted list of settings, per subsection
-	var longestSettingName int
-	var settings = make(map[string][]string)
-	for _, subsection := range subsections {
-		settings[subsection] = make([]string, 0)
+	for i, result := range results {
+		newProject := i == 0 || results[i-1].Project != result.Project
+		if newProject {
+			fmt.Fprintf(w, "\n")
+			fmt.Fprintf(w, "  %s (%s)\n", result.Project, formatScore(scores.Projects[result.Project]))
+		}
 
-		for setting := range m.config.Compliance.Mandatory[subsection] {
-			settings[subsection] = append(settings[subsection], setting)
-			if len(setting) > longestSettingName {
-				longestSettingName = len(setting)
+		if newProject || results[i-1].Subsection != result.Subsection {
+			if result.Unavailable {
+				fmt.Fprintf(w, "    %s: settings unavailable\n", result.Subsection)
+			} else {
+				fmt.Fprintf(w, "    %s:\n", result.Subsection)
 			}
 		}
-		sort.Strings(settings[subsection])
-	}
 
-	// Loop through projects
-	for _, name := range projectNames {
-		fmt.Printf("  %s\n", name)
-
-		// Loop through subsections
-		for _, subsection := range subsections {
-			fmt.Printf("    %s:\n", subsection)
-
-			// Loop through settings
-			for _, setting := range settings[subsection] {
-				fmt.Printf("      %-*s", longestSettingName+2, setting+":")
+		if result.Unavailable {
+			continue
+		}
 
-				var settingValue interface{}
-				switch subsection {
-				case "approval_settings":
-					structure := reflect.ValueOf(m.ApprovalSettingsOriginal[name])
-					field := structure.Elem().FieldByName(strcase.ToCamel(setting))
-					if field.IsValid() {
-						settingValue = field.Interface()
-					} else {
-						settingValue = "NOT VALID SETTING"
-					}
-				case "project_settings":
-					structure := reflect.ValueOf(m.ProjectSettingsOriginal[name])
-					field := structure.Elem().FieldByName(strcase.ToCamel(setting))
-					if field.IsValid() {
-						settingValue = field.Interface()
-					} else {
-						settingValue = "NOT VALID SETTING"
-					}
-				}
+		fmt.Fprintf(w, "      %-*s", longestSettingName+2, result.Setting+":")
+		fmt.Fprintf(w, "%v", result.Actual)
 
-				fmt.Printf("%v", settingValue)
+		if len(result.Missing) > 0 {
+			fmt.Fprintf(w, " (missing: %v)", valueList(result.Missing))
+		} else if !result.Compliant {
+			fmt.Fprintf(w, " (%v)", result.Expected)
+		}
+		if result.Inherited != "" {
+			fmt.Fprintf(w, " [inherited from %s, not enforceable]", result.Inherited)
+		}
 
-				if settingValue != m.config.Compliance.Mandatory[subsection][setting] {
-					fmt.Printf(" (%v)", m.config.Compliance.Mandatory[subsection][setting])
-				}
+		fmt.Fprintf(w, "\n")
+	}
 
-				fmt.Printf("\n")
-			}
-		}
+	if len(results) != 0 {
+		fmt.Fprintf(w, "\n")
+	}
+}
 
-		fmt.Printf("\n")
+// WriteComplianceJUnitReport writes the compliance state of mandatory settings as JUnit XML
+// to the given path, with one test suite per project and one test case per setting.
+func (m *ProjectManager) WriteComplianceJUnitReport(path string) error {
+	output := Output{Sink: OutputFile, Format: FormatJUnit, Path: path}
+	if err := m.writeOutput(output, complianceReport{results: m.ComplianceResults()}); err != nil {
+		return fmt.Errorf("failed to write junit report %q: %v", path, err)
 	}
 
 	return nil
@@ -493,7 +1122,7 @@ func (m *ProjectManager) GenerateComplianceReport() error {
 func (m *ProjectManager) GetProjectApprovalSettings(project gitlab.Project) (*gitlab.ProjectApprovals, error) {
 	m.logger.Debugf("Get merge request approval settings of project %s ...", project.PathWithNamespace)
 
-	returnedApproval, response, err := m.projectsClient.GetApprovalConfiguration(project.ID)
+	returnedApproval, response, err := m.projectsClient.GetApprovalConfiguration(project.ID, m.withContext())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current approval settings of project %s: %v", project.PathWithNamespace, err)
 	}
@@ -506,68 +1135,175 @@ func (m *ProjectManager) GetProjectApprovalSettings(project gitlab.Project) (*gi
 	return returnedApproval, nil
 }
 
-// GetProjects fetches a list of accessible repos within the groups set in config file
+// GetProjects fetches a list of accessible repos within the groups set in config file, and
+// the personal projects of the users set by SetPersonalProjectUsers
 func (m *ProjectManager) GetProjects() ([]gitlab.Project, error) {
 	var repos []gitlab.Project
 
-	m.logger.Debugf("Fetching projects under %s path ...", m.config.GroupName)
+	m.logger.Debugf("Fetching projects under %s path ...", m.config.GroupName)
+
+	// Identify Group/Subgroup's ID
+	var groupID int
+
+	m.logger.Debugf("Identifying %s's GroupID", m.config.GroupName)
+	if strings.ContainsAny(m.config.GroupName, "/") {
+		// Nested Path
+		group_ID, err := m.GetSubgroupID(m.config.GroupName, 1, 0)
+		if err != nil {
+			return []gitlab.Project{}, err
+		}
+		groupID = group_ID
+	} else {
+		// BugFix: Without this pre-processing, go-gitlab library stalls.
+		var groupName = strings.Replace(url.PathEscape(m.config.GroupName), ".", "%2E", -1)
+		group, resp, err := m.groupsClient.GetGroup(groupName, nil)
+		if err != nil {
+			return []gitlab.Project{}, groupError(m.config.GroupName, resp, err)
+		}
+		groupID = group.ID
+	}
+
+	m.logger.Debugf("GroupID is %d", groupID)
+	opt := &gitlab.ListGroupProjectsOptions{
+		ListOptions: gitlab.ListOptions{
+			PerPage: 100,
+		},
+		Archived:         gitlab.Bool(false),
+		IncludeSubGroups: gitlab.Bool(m.config.IncludeSubgroups),
+	}
+
+	// GitLab filters by the topics already, the client side check of selectProjects remains
+	// for instances ignoring the parameter
+	if len(m.config.ProjectTopics) > 0 {
+		opt.Topic = gitlab.String(strings.Join(m.config.ProjectTopics, ","))
+	}
+
+	// Get Project objects
+	var fetched, skippedByTopic, skippedByAge int
+	for {
+		projects, resp, err := m.groupsClient.ListGroupProjects(groupID, opt)
+		if err != nil {
+			return []gitlab.Project{}, fmt.Errorf("failed to fetch GitLab projects for %s [%d]: %v", m.config.GroupName, groupID, err)
+		}
+
+		fetched += len(projects)
+		selected, byTopic, byAge := m.selectProjects(projects)
+		repos = append(repos, selected...)
+		skippedByTopic += byTopic
+		skippedByAge += byAge
+
+		// Exit the loop when we've seen all pages.
+		if opt.Page >= resp.TotalPages || resp.TotalPages == 1 {
+			break
+		}
+
+		// Update the page number to get the next page.
+		opt.Page = resp.NextPage
+	}
+
+	if skippedByTopic > 0 {
+		m.logger.Infof("Skipped %d project(s) without the topic(s) %v.", skippedByTopic, m.config.ProjectTopics)
+	}
+	if skippedByAge > 0 {
+		m.logger.Infof("Skipped %d project(s) created before %s.", skippedByAge, m.createdSince.Format(time.RFC3339))
+	}
+
+	m.logger.Infof("Fetched %d project(s) of group %s, %d remain after filtering.", fetched, m.config.GroupName, len(repos))
+	switch {
+	case fetched == 0 && len(m.config.ProjectTopics) > 0:
+		m.warn("", "Group %s contains no projects with the topic(s) %v, check group_name, include_subgroups and project_topics.", m.config.GroupName, m.config.ProjectTopics)
+	case fetched == 0:
+		m.warn("", "Group %s contains no projects, check group_name and include_subgroups.", m.config.GroupName)
+	case len(repos) == 0:
+		m.warn("", "All %d project(s) of group %s were filtered out, check project_whitelist, project_blacklist, project_topics and --created-since.", fetched, m.config.GroupName)
+	}
+
+	for _, user := range m.personalProjectUsers {
+		projects, err := m.listUserProjects(user)
+		if err != nil {
+			return []gitlab.Project{}, err
+		}
+
+		selected, _, _ := m.selectProjects(projects)
+		m.logger.Infof("Fetched %d personal project(s) of user %s, %d remain after filtering.", len(projects), user, len(selected))
+		repos = append(repos, selected...)
+	}
+
+	return repos, nil
+}
+
+// missingTopics returns the topics the project isn't tagged with
+func missingTopics(p *gitlab.Project, topics []string) []string {
+	var missing []string
+	for _, topic := range topics {
+		if !stringslice.Contains(topic, p.Topics) {
+			missing = append(missing, topic)
+		}
+	}
 
-	// Identify Group/Subgroup's ID
-	var groupID int
+	return missing
+}
 
-	m.logger.Debugf("Identifying %s's GroupID", m.config.GroupName)
-	if strings.ContainsAny(m.config.GroupName, "/") {
-		// Nested Path
-		group_ID, err := m.GetSubgroupID(m.config.GroupName, 1, 0)
-		if err != nil {
-			return []gitlab.Project{}, fmt.Errorf("failed to fetch GitLab group info for %q: %v", m.config.GroupName, err)
+// selectProjects returns the projects passing the whitelist, blacklist, topic and creation
+// time filters, and the numbers of projects skipped for lacking the topics and for their age
+func (m *ProjectManager) selectProjects(projects []*gitlab.Project) ([]gitlab.Project, int, int) {
+	var selected []gitlab.Project
+	var skippedByTopic, skippedByAge int
+
+	for _, p := range projects {
+		if len(m.config.ProjectWhitelist) > 0 && !stringslice.Contains(p.PathWithNamespace, m.config.ProjectWhitelist) {
+			m.logger.Debugf("Skipping repo %s as it's not whitelisted", p.PathWithNamespace)
+			continue
 		}
-		groupID = group_ID
-	} else {
-		// BugFix: Without this pre-processing, go-gitlab library stalls.
-		var groupName = strings.Replace(url.PathEscape(m.config.GroupName), ".", "%2E", -1)
-		group, _, err := m.groupsClient.GetGroup(groupName)
-		if err != nil {
-			return []gitlab.Project{}, fmt.Errorf("failed to fetch GitLab group info for %q: %v", groupName, err)
+		if stringslice.Contains(p.PathWithNamespace, m.config.ProjectBlacklist) {
+			m.logger.Debugf("Skipping repo %s as it's blacklisted", p.PathWithNamespace)
+			continue
 		}
-		groupID = group.ID
+		if missing := missingTopics(p, m.config.ProjectTopics); len(missing) > 0 {
+			m.logger.Debugf("Skipping repo %s as it lacks the topic(s) %v", p.PathWithNamespace, missing)
+			skippedByTopic++
+			continue
+		}
+		if m.createdTooEarly(p) {
+			m.logger.Debugf("Skipping repo %s as it was created before %s", p.PathWithNamespace, m.createdSince.Format(time.RFC3339))
+			skippedByAge++
+			continue
+		}
+
+		selected = append(selected, *p)
 	}
 
-	m.logger.Debugf("GroupID is %d", groupID)
-	listGroupProjectOps.IncludeSubgroups = gitlab.Bool(m.config.IncludeSubgroups)
+	return selected, skippedByTopic, skippedByAge
+}
 
-	// Get Project objects
+// listUserProjects returns the unarchived projects in the personal namespace of the user
+func (m *ProjectManager) listUserProjects(user string) ([]*gitlab.Project, error) {
+	var projects []*gitlab.Project
+
+	opt := &gitlab.ListProjectsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}, Archived: gitlab.Bool(false)}
 	for {
-		projects, resp, err := m.groupsClient.ListGroupProjects(groupID, listGroupProjectOps)
+		page, resp, err := m.projectsClient.ListUserProjects(user, opt)
 		if err != nil {
-			return []gitlab.Project{}, fmt.Errorf("failed to fetch GitLab projects for %s [%d]: %v", m.config.GroupName, groupID, err)
-		}
-
-		for _, p := range projects {
-			if len(m.config.ProjectWhitelist) > 0 && !stringslice.Contains(p.PathWithNamespace, m.config.ProjectWhitelist) {
-				m.logger.Debugf("Skipping repo %s as it's not whitelisted", p.PathWithNamespace)
-				continue
-			}
-			if stringslice.Contains(p.PathWithNamespace, m.config.ProjectBlacklist) {
-				m.logger.Debugf("Skipping repo %s as it's blacklisted", p.PathWithNamespace)
-				continue
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				return nil, fmt.Errorf("user %s not found, check --include-personal-projects", user)
 			}
-
-			repos = append(repos, *p)
+			return nil, fmt.Errorf("failed to fetch personal projects of user %s: %v", user, err)
 		}
+		projects = append(projects, page...)
 
-		// Exit the loop when we've seen all pages.
-		if listGroupProjectOps.Page >= resp.TotalPages || resp.TotalPages == 1 {
+		if resp.NextPage == 0 {
 			break
 		}
-
-		// Update the page number to get the next page.
-		listGroupProjectOps.Page = resp.NextPage
+		opt.Page = resp.NextPage
 	}
 
-	m.logger.Debugf("Fetching projects under path done. Retrieved %d.", len(repos))
+	return projects, nil
+}
 
-	return repos, nil
+// SetPersonalProjectUsers sets the users whose personal projects GetProjects returns in
+// addition to the projects of the group
+func (m *ProjectManager) SetPersonalProjectUsers(users []string) {
+	m.personalProjectUsers = users
 }
 
 // GetProjectSettings gets the settings in GitLab for the provided project, using
@@ -576,7 +1312,7 @@ func (m *ProjectManager) GetProjects() ([]gitlab.Project, error) {
 func (m *ProjectManager) GetProjectSettings(project gitlab.Project) (*gitlab.Project, error) {
 	m.logger.Debugf("Get project settings of project %s ...", project.PathWithNamespace)
 
-	returnedProject, response, err := m.projectsClient.GetProject(project.ID, &gitlab.GetProjectOptions{})
+	returnedProject, response, err := m.projectsClient.GetProject(project.ID, &gitlab.GetProjectOptions{}, m.withContext())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
 	}
@@ -586,6 +1322,8 @@ func (m *ProjectManager) GetProjectSettings(project gitlab.Project) (*gitlab.Pro
 	m.logger.Debugf("---[ Returned Project ]---\n")
 	m.logger.Debugf("%v\n", returnedProject)
 
+	normalizeEmailSettings(returnedProject)
+
 	return returnedProject, nil
 }
 
@@ -607,9 +1345,11 @@ func (m *ProjectManager) GetSubgroupID(path string, indent int, group_ID int) (i
 	}
 
 	m.logger.Debugf("Getting Subgroup(s) of %v.", group_info)
-	subgroups, _, err := m.groupsClient.ListSubgroups(group_info, listSubgroupOps)
+	subgroups, resp, err := m.groupsClient.ListSubGroups(group_info, listSubgroupOps)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch GitLab subgroups for %s [%s]: %v", path, subpath, err)
+		// The parent of the first subgroup is the base of the path
+		parent := strings.Join(strings.Split(path, "/")[:indent], "/")
+		return 0, groupError(parent, resp, err)
 	}
 
 	// Get desired subgroup_ID
@@ -622,75 +1362,117 @@ func (m *ProjectManager) GetSubgroupID(path string, indent int, group_ID int) (i
 		}
 	}
 
+	if subgroup_ID == 0 {
+		subgroupPath := strings.Join(strings.Split(path, "/")[:indent+1], "/")
+		return 0, fmt.Errorf("group %q not found (check group_name/path)", subgroupPath)
+	}
+
 	if indent != pathCount {
 		m.logger.Debugf("Found Group ID %d, going deeper.", subgroup_ID)
-		subgroup_ID, _ = m.GetSubgroupID(path, indent+1, subgroup_ID)
+		return m.GetSubgroupID(path, indent+1, subgroup_ID)
 	}
 
 	m.logger.Debugf("Coming back up from %s.", subpath)
 	return subgroup_ID, nil
 }
 
-// SetError returns the Error status
-func (m *ProjectManager) SetError(state bool) bool {
-	m.config.Error = state
-	return m.config.Error
+// groupError returns an actionable error for a failed request of the group, telling a wrong
+// group path apart from missing permissions
+func groupError(group string, resp *gitlab.Response, err error) error {
+	if resp != nil {
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("group %q not found (check group_name/path): %v", group, err)
+		case http.StatusForbidden:
+			return fmt.Errorf("token lacks access to group %q: %v", group, err)
+		case http.StatusUnauthorized:
+			return fmt.Errorf("token is invalid or expired, failed to fetch group %q: %v", group, err)
+		}
+	}
+
+	return fmt.Errorf("failed to fetch GitLab group info for %q: %v", group, err)
 }
 
-// SendEmail
-func (m *ProjectManager) SendEmail(to []string, from string, subject string, body string) error {
-	// Connect to remote SMTP server
-	smtpServer, err := smtp.Dial(m.config.Compliance.Email.Server + ":" + strconv.Itoa(m.config.Compliance.Email.Port))
-	if err != nil {
-		m.logger.Fatal(err)
+// warnf logs a warning and records it for the project whose config is used. In strict mode
+// the warning is logged as an error instead and sets the error flag, so the run fails.
+func (m *ProjectManager) warnf(format string, args ...interface{}) {
+	if m.config.Strict {
+		m.logger.Errorf(format, args...)
+		m.SetError(true)
+		return
 	}
 
-	// Set the sender
-	if err := smtpServer.Mail(from); err != nil {
-		m.logger.Fatal(err)
-	}
+	m.warn(m.currentProject, format, args...)
+}
 
-	// Set the recipient
-	if err := smtpServer.Rcpt(strings.Join(to, ",")); err != nil {
-		m.logger.Fatal(err)
+// SetError returns the Error status. Each error set is counted, see ErrorCount.
+func (m *ProjectManager) SetError(state bool) bool {
+	if state {
+		m.errorCount++
 	}
 
-	// Send the email body
-	smtp_writer, err := smtpServer.Data()
-	if err != nil {
-		m.logger.Fatal(err)
-	}
+	// The status of the run, not of the effective config of a project
+	m.baseConfig.Error = state
+	return m.baseConfig.Error
+}
 
-	message := "Content-Type: text/html; charset=UTF-8\r\n"
-	message += fmt.Sprintf("From: %s\r\n", from)
-	message += fmt.Sprintf("To: %s\r\n", strings.Join(to, ","))
-	message += fmt.Sprintf("Subject: %s\r\n", subject)
-	message += "<html>\r\n"
-	message += " <head>\r\n"
-	message += fmt.Sprintf("  <title>%s</title>\r\n", subject)
-	message += " </head>\r\n"
-	message += " <body>\r\n"
-	message += fmt.Sprintf("\r\n%s\r\n", body)
-	message += " </body>\r\n"
-	message += "</html>"
+// ErrorCount returns the number of errors set during the run
+func (m *ProjectManager) ErrorCount() int {
+	return m.errorCount
+}
 
-	_, err = smtp_writer.Write([]byte(message))
-	if err != nil {
-		m.logger.Fatal(err)
+// MaxErrorsReached reports whether the number of errors reached the given maximum. A maximum
+// of 0 means unlimited.
+func (m *ProjectManager) MaxErrorsReached(max int) bool {
+	return max > 0 && m.errorCount >= max
+}
+
+// SendEmail sends the html body to the recipients using the email sender, by default via
+// the SMTP server of compliance.email
+func (m *ProjectManager) SendEmail(to []string, from string, subject string, body string) error {
+	return m.emailSender.SendEmail(from, to, subject, body)
+}
+
+// SetHomogeneousApprovals sets whether the projects of a namespace are assumed to share their
+// approval settings. The settings fetched for the first project of each namespace are then
+// taken as the current settings of the others, saving the fetch before the update of every
+// further project. Updates are still verified by fetching the settings of the updated
+// project, and projects the snapshot finds compliant are fetched to confirm it.
+func (m *ProjectManager) SetHomogeneousApprovals(homogeneous bool) {
+	m.homogeneousApprovals = homogeneous
+}
+
+// currentApprovalSettings returns the current approval settings of the project, in homogeneous
+// mode those fetched for the first project of its namespace, which is reported as reused for
+// the further projects. The snapshot keeps the settings before any update, so the further
+// projects are updated like the first one.
+func (m *ProjectManager) currentApprovalSettings(project gitlab.Project) (*gitlab.ProjectApprovals, bool, error) {
+	if !m.homogeneousApprovals {
+		settings, err := m.GetProjectApprovalSettings(project)
+		return settings, false, err
 	}
 
-	err = smtp_writer.Close()
-	if err != nil {
-		m.logger.Fatal(err)
+	namespace := project.PathWithNamespace
+	if i := strings.LastIndex(namespace, "/"); i >= 0 {
+		namespace = namespace[:i]
+	}
+	if snapshot, ok := m.approvalSnapshots[namespace]; ok {
+		m.logger.Debugf("Using the approval settings of namespace %s for project %s", namespace, project.PathWithNamespace)
+		settings := *snapshot
+		return &settings, true, nil
 	}
 
-	// Send the QUIT command and close the connection.
-	err = smtpServer.Quit()
+	settings, err := m.GetProjectApprovalSettings(project)
 	if err != nil {
-		m.logger.Fatal(err)
+		return nil, false, err
+	}
+	if m.approvalSnapshots == nil {
+		m.approvalSnapshots = make(map[string]*gitlab.ProjectApprovals)
 	}
+	snapshot := *settings
+	m.approvalSnapshots[namespace] = &snapshot
 
-	return nil
+	return settings, false, nil
 }
 
 // UpdateProjectMergeRequestSettings updates the project settings on gitlab
@@ -704,7 +1486,7 @@ func (m *ProjectManager) UpdateProjectApprovalSettings(project gitlab.Project, d
 	}
 
 	// Get current settings states
-	approvalSettings, err := m.GetProjectApprovalSettings(project)
+	approvalSettings, reused, err := m.currentApprovalSettings(project)
 	if err != nil {
 		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
 	}
@@ -712,15 +1494,41 @@ func (m *ProjectManager) UpdateProjectApprovalSettings(project gitlab.Project, d
 	// Record current settings states
 	m.ApprovalSettingsOriginal[project.PathWithNamespace] = approvalSettings
 
+	allowed, blocked := m.applyFieldPolicy("approval_settings", m.config.ApprovalSettings)
+	options, err := m.skipLockedApprovalSettings(project, approvalSettings, allowed.(*gitlab.ChangeApprovalConfigurationOptions))
+	if err != nil {
+		return err
+	}
+
 	m.logger.Debugf("---[ HTTP Payload for UpdateProjectApprovalSettings ]---\n")
-	m.logger.Debugf("%+v\n", m.config.ApprovalSettings)
+	m.logger.Debugf("%+v\n", options)
+
+	if len(blocked) > 0 {
+		desired, err := m.convertChangeApprovalConfigurationOptionsToProjectApprovals(*m.config.ApprovalSettings)
+		if err != nil {
+			return err
+		}
+		m.recordBlockedChanges(project, "approval_settings", approvalSettings, &desired, blocked)
+	}
 
-	settingsToChange, err := m.convertChangeApprovalConfigurationOptionsToProjectApprovals(*m.config.ApprovalSettings)
+	settingsToChange, err := m.convertChangeApprovalConfigurationOptionsToProjectApprovals(*options)
 	if err != nil {
 		return err
 	}
 
-	if !m.willChangeApprovalSettings(approvalSettings, &settingsToChange) {
+	fields := configuredFields(options)
+
+	// The snapshot of the namespace is no observed state of the project, so its own settings
+	// are fetched unless it is updated anyway
+	if reused && !m.willChangeApprovalSettings(approvalSettings, &settingsToChange, fields) {
+		approvalSettings, err = m.GetProjectApprovalSettings(project)
+		if err != nil {
+			return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+		}
+		m.ApprovalSettingsOriginal[project.PathWithNamespace] = approvalSettings
+	}
+
+	if !m.willChangeApprovalSettings(approvalSettings, &settingsToChange, fields) {
 		m.logger.Debugf("No action required.")
 
 		// Record current settings states
@@ -729,14 +1537,22 @@ func (m *ProjectManager) UpdateProjectApprovalSettings(project gitlab.Project, d
 		return nil
 	}
 
-	var returned_mr *gitlab.ProjectApprovals
-	var response *gitlab.Response
 	if dryrun {
-		m.logger.Infof("DRYRUN: Skipped executing API call [ChangeApprovalConfiguration]")
-	} else {
-		returned_mr, response, err = m.projectsClient.ChangeApprovalConfiguration(project.ID, m.config.ApprovalSettings)
+		m.skipAPICall("ChangeApprovalConfiguration", "")
+
+		// Record the expected settings states to show the planned changes
+		projected := &gitlab.ProjectApprovals{}
+		if err := applyOptions(approvalSettings, options, projected); err != nil {
+			return err
+		}
+		normalizeApprovalSettings(projected)
+		m.ApprovalSettingsUpdated[project.PathWithNamespace] = projected
+
+		return nil
 	}
 
+	returned_mr, response, err := m.projectsClient.ChangeApprovalConfiguration(project.ID, options, m.withContext())
+
 	m.logger.Debugf("---[ HTTP Response for UpdateProjectApprovalSettings ]---\n")
 	m.logger.Debugf("%v\n", response)
 	m.logger.Debugf("---[ Returned MR for UpdateProjectApprovalSettings ]---\n")
@@ -752,14 +1568,46 @@ func (m *ProjectManager) UpdateProjectApprovalSettings(project gitlab.Project, d
 		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
 	}
 
+	// GitLab occasionally acknowledges the change without storing it, retry once
+	if m.willChangeApprovalSettings(approvalSettings, &settingsToChange, fields) {
+		m.logger.Infof("Approval settings of project %s still differ after the update, retrying once ...", project.PathWithNamespace)
+
+		if _, _, err := m.projectsClient.ChangeApprovalConfiguration(project.ID, options, m.withContext()); err != nil {
+			return fmt.Errorf("failed to update merge request approval settings or project %s: %v", project.PathWithNamespace, err)
+		}
+
+		approvalSettings, err = m.GetProjectApprovalSettings(project)
+		if err != nil {
+			return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+		}
+	}
+
 	// Record current settings states
 	m.ApprovalSettingsUpdated[project.PathWithNamespace] = approvalSettings
 
+	m.verifyApprovalSettings(project, approvalSettings, &settingsToChange, fields)
+
 	m.logger.Debugf("Updating merge request approval settings of project %s done.", project.PathWithNamespace)
 
 	return nil
 }
 
+// withoutProjectIdentity returns the options without name and path. The config validation
+// rejects both already, as they would rename or move every project to the same name; this is
+// the safety net for configs built otherwise.
+func (m *ProjectManager) withoutProjectIdentity(project gitlab.Project, options *gitlab.EditProjectOptions) *gitlab.EditProjectOptions {
+	if options.Name == nil && options.Path == nil {
+		return options
+	}
+
+	m.warnf("Ignoring project_settings.name and path for project %s, projects are never renamed.", project.PathWithNamespace)
+	stripped := *options
+	stripped.Name = nil
+	stripped.Path = nil
+
+	return &stripped
+}
+
 // UpdateProjectSettings updates the settings in GitLab for the provided project,
 // using the Project API
 // https://docs.gitlab.com/ee/api/projects.html
@@ -778,18 +1626,47 @@ func (m *ProjectManager) UpdateProjectSettings(project gitlab.Project, dryrun bo
 		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
 	}
 
-	// Record current settings states
-	m.ProjectSettingsOriginal[project.PathWithNamespace] = projectSettings
+	// Record current settings states, unless an earlier step (e.g. EnsureDefaultBranch) already
+	// did. Dryruns build on the settings planned by that step.
+	if _, ok := m.ProjectSettingsOriginal[project.PathWithNamespace]; !ok {
+		m.ProjectSettingsOriginal[project.PathWithNamespace] = projectSettings
+	}
+	if planned, ok := m.ProjectSettingsUpdated[project.PathWithNamespace]; ok && dryrun {
+		projectSettings = planned
+	}
+
+	// Create the default branch before setting it
+	if err := m.ensureDefaultBranch(project, dryrun); err != nil {
+		return err
+	}
+
+	allowed, blocked := m.applyFieldPolicy("project_settings", m.config.ProjectSettings)
+	options, err := m.skipMissingDefaultBranch(project, projectSettings, m.withoutProjectIdentity(project, allowed.(*gitlab.EditProjectOptions)))
+	if err != nil {
+		return err
+	}
+	if options, err = m.skipPipelineSucceedsWithoutCI(project, projectSettings, options); err != nil {
+		return err
+	}
+	options = withEmailSettings(options)
 
 	m.logger.Debugf("---[ HTTP Payload for UpdateProjectSettings ]---\n")
-	m.logger.Debugf("%+v\n", m.config.ProjectSettings)
+	m.logger.Debugf("%+v\n", options)
+
+	if len(blocked) > 0 {
+		desired, err := m.convertEditProjectOptionsToProject(*m.config.ProjectSettings)
+		if err != nil {
+			return err
+		}
+		m.recordBlockedChanges(project, "project_settings", projectSettings, &desired, blocked)
+	}
 
-	settingsToChange, err := m.convertEditProjectOptionsToProject(*m.config.ProjectSettings)
+	settingsToChange, err := m.convertEditProjectOptionsToProject(*options)
 	if err != nil {
 		return err
 	}
 
-	if !m.willChangeProjectSettings(projectSettings, &settingsToChange) {
+	if !m.willChangeProjectSettings(projectSettings, &settingsToChange, configuredFields(options)) {
 		m.logger.Debugf("No action required.")
 
 		// Record current settings states
@@ -798,14 +1675,21 @@ func (m *ProjectManager) UpdateProjectSettings(project gitlab.Project, dryrun bo
 		return nil
 	}
 
-	var returned_project *gitlab.Project
-	var response *gitlab.Response
 	if dryrun {
-		m.logger.Infof("DRYRUN: Skipped executing API call [EditProject]")
-	} else {
-		returned_project, response, err = m.projectsClient.EditProject(project.ID, m.config.ProjectSettings)
+		m.skipAPICall("EditProject", "")
+
+		// Record the expected settings states to show the planned changes
+		projected := &gitlab.Project{}
+		if err := applyOptions(projectSettings, options, projected); err != nil {
+			return err
+		}
+		m.ProjectSettingsUpdated[project.PathWithNamespace] = projected
+
+		return nil
 	}
 
+	returned_project, response, err := m.projectsClient.EditProject(project.ID, options, m.withContext())
+
 	m.logger.Debugf("---[ HTTP Response for UpdateProjectSettings ]---\n")
 	m.logger.Debugf("%v\n", response)
 	m.logger.Debugf("---[ Returned Project for UpdateProjectSettings ]---\n")
@@ -850,6 +1734,29 @@ func (m *ProjectManager) convertChangeApprovalConfigurationOptionsToProjectAppro
 	return returnValue, nil
 }
 
+// applyOptions stores the current settings with the given options applied into projected,
+// which is used to show the planned changes in dryrun. Options and settings share their
+// json keys, so the options are decoded on top of a copy of the current settings.
+func applyOptions(current interface{}, options interface{}, projected interface{}) error {
+	currentData, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("failed to convert current settings to json: %v", err)
+	}
+	if err := json.Unmarshal(currentData, projected); err != nil {
+		return fmt.Errorf("failed to copy current settings: %v", err)
+	}
+
+	optionsData, err := json.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("failed to convert options to json: %v", err)
+	}
+	if err := json.Unmarshal(optionsData, projected); err != nil {
+		return fmt.Errorf("failed to apply options to current settings: %v", err)
+	}
+
+	return nil
+}
+
 // convertEditProjectOptionsToProject
 func (m *ProjectManager) convertEditProjectOptionsToProject(current gitlab.EditProjectOptions) (gitlab.Project, error) {
 	jsonData, err := json.Marshal(current)
@@ -866,6 +1773,241 @@ func (m *ProjectManager) convertEditProjectOptionsToProject(current gitlab.EditP
 	return returnValue, nil
 }
 
+// addChangeLogEntries adds the changes of the difflog to the given section of the changelog.
+// The original and updated settings maps are used to collapse the per element changes of
+// list settings into a single entry.
+func addChangeLogEntries(
+	changelog map[string]map[string]map[string]map[string]interface{},
+	section string,
+	difflog diff.Changelog,
+	original interface{},
+	updated interface{},
+	fullDiff bool,
+) {
+	for _, v := range difflog {
+		// If REPO doesn't exist in map, make it.
+		if _, ok := changelog[v.Path[0]]; !ok {
+			changelog[v.Path[0]] = make(map[string]map[string]map[string]interface{})
+		}
+		if _, ok := changelog[v.Path[0]][section]; !ok {
+			changelog[v.Path[0]][section] = make(map[string]map[string]interface{})
+		}
+
+		var from, to reflect.Value
+		if len(v.Path) > 1 {
+			from = settingsField(original, v.Path[0], v.Path[1])
+			to = settingsField(updated, v.Path[0], v.Path[1])
+		}
+		if from.Kind() != reflect.Slice && to.Kind() != reflect.Slice {
+			setting_name := strcase.ToSnake(v.Path[len(v.Path)-1])
+			if len(v.Path) == 2 {
+				setting_name = settingName(original, v.Path[1])
+			}
+			changelog[v.Path[0]][section][setting_name] = make(map[string]interface{})
+			changelog[v.Path[0]][section][setting_name]["From"] = v.From
+			changelog[v.Path[0]][section][setting_name]["To"] = v.To
+			continue
+		}
+
+		// List settings produce one change per element, only record them once.
+		setting_name := strcase.ToSnake(v.Path[1])
+		if _, ok := changelog[v.Path[0]][section][setting_name]; ok {
+			continue
+		}
+
+		changelog[v.Path[0]][section][setting_name] = make(map[string]interface{})
+		if fullDiff {
+			changelog[v.Path[0]][section][setting_name]["From"] = describeSlice(from)
+			changelog[v.Path[0]][section][setting_name]["To"] = describeSlice(to)
+		} else {
+			removed, added := sliceSetDiff(describeSlice(from), describeSlice(to))
+			changelog[v.Path[0]][section][setting_name]["Removed"] = removed
+			changelog[v.Path[0]][section][setting_name]["Added"] = added
+		}
+	}
+}
+
+// settingsField returns the named field of the settings stored under key in the given
+// map of settings pointers, or an invalid value if there is none.
+func settingsField(settings interface{}, key string, field string) reflect.Value {
+	entry := reflect.ValueOf(settings).MapIndex(reflect.ValueOf(key))
+	if !entry.IsValid() || entry.IsNil() {
+		return reflect.Value{}
+	}
+
+	return entry.Elem().FieldByName(field)
+}
+
+// settingName returns the config key of the field of the settings map values, e.g.
+// mr_default_target_self for MergeRequestDefaultTargetSelf. Fields without a json tag are
+// named by their snake-cased name.
+func settingName(settings interface{}, field string) string {
+	t := reflect.TypeOf(settings).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		if structField, ok := t.FieldByName(field); ok {
+			if name := strings.Split(structField.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+				return name
+			}
+		}
+	}
+
+	return strcase.ToSnake(field)
+}
+
+// describeSlice returns a readable description of each element of the slice
+func describeSlice(slice reflect.Value) []string {
+	descriptions := make([]string, 0)
+	if slice.Kind() != reflect.Slice {
+		return descriptions
+	}
+
+	for i := 0; i < slice.Len(); i++ {
+		descriptions = append(descriptions, describeValue(slice.Index(i)))
+	}
+
+	return descriptions
+}
+
+// describeValue returns a readable identifier of the value. Structs are described by their
+// first identifying field (e.g. the username of an approver).
+func describeValue(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "<nil>"
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return fmt.Sprintf("%v", v.Interface())
+	}
+
+	for _, name := range []string{"Username", "FullPath", "Name", "ID"} {
+		if f := v.FieldByName(name); f.IsValid() && !f.IsZero() {
+			return fmt.Sprintf("%v", f.Interface())
+		}
+	}
+
+	// Look for identifying fields in nested structs (e.g. MergeRequestApproverUser.User).
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() == reflect.Struct || (f.Kind() == reflect.Ptr && f.Type().Elem().Kind() == reflect.Struct) {
+			return describeValue(f)
+		}
+	}
+
+	return fmt.Sprintf("%+v", v.Interface())
+}
+
+// sliceSetDiff returns the sorted elements removed from and added to the list
+func sliceSetDiff(from []string, to []string) ([]string, []string) {
+	removed := make([]string, 0)
+	for _, e := range from {
+		if !stringslice.Contains(e, to) {
+			removed = append(removed, e)
+		}
+	}
+	added := make([]string, 0)
+	for _, e := range to {
+		if !stringslice.Contains(e, from) {
+			added = append(added, e)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+
+	return removed, added
+}
+
+// complianceEmail renders the subject and body of the compliance email, using the configured
+// templates if present and the built-in layout otherwise
+func (m *ProjectManager) complianceEmail(results []ComplianceResult, scores ComplianceScores) (string, string, error) {
+	data := newComplianceReportData(results, scores)
+
+	subject := "Compliance Report"
+	if m.config.Compliance.Email.SubjectTemplate != "" {
+		tpl, err := texttemplate.New("subject").Parse(m.config.Compliance.Email.SubjectTemplate)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to parse email subject template: %v", err)
+		}
+
+		var b strings.Builder
+		if err := tpl.Execute(&b, data); err != nil {
+			return "", "", fmt.Errorf("failed to render email subject template: %v", err)
+		}
+		subject = b.String()
+	}
+
+	bodyTemplate := defaultComplianceEmailBodyTemplate
+	if m.config.Compliance.Email.BodyTemplate != "" {
+		bodyTemplate = m.config.Compliance.Email.BodyTemplate
+	}
+
+	tpl, err := template.New("body").Parse(bodyTemplate)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse email body template: %v", err)
+	}
+
+	var b strings.Builder
+	if err := tpl.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email body template: %v", err)
+	}
+
+	return subject, b.String(), nil
+}
+
+// defaultComplianceEmailBodyTemplate renders the compliance results as a single table with
+// a row per setting, colored by its PASS/FAIL status
+const defaultComplianceEmailBodyTemplate = `
+<h2>Compliance Report</h2>
+<p>Compliance score: <b>{{printf "%.1f" .Score}}%</b></p>
+<table style="border-collapse:collapse">
+ <tr>
+  <th style="text-align:left;padding:2px 8px">Setting</th>
+  <th style="text-align:left;padding:2px 8px">Actual</th>
+  <th style="text-align:left;padding:2px 8px">Expected</th>
+  <th style="text-align:left;padding:2px 8px">Status</th>
+ </tr>
+{{- range .Projects}}
+ <tr>
+  <td colspan="4" style="padding:8px 8px 2px"><b>{{.Name}}</b> ({{printf "%.1f" .Score}}%)</td>
+ </tr>
+{{- range .Subsections}}
+ <tr>
+  <td colspan="4" style="padding:2px 8px 2px 20px"><b>{{.Name}}</b></td>
+ </tr>
+{{- range .Settings}}
+ <tr style="background-color:{{if .Compliant}}#e6ffed{{else if .Inherited}}#fff8c5{{else}}#ffeef0{{end}}">
+  <td style="padding:2px 8px 2px 40px">{{.Setting}}</td>
+{{- if .Unavailable}}
+  <td colspan="2" style="padding:2px 8px">settings unavailable</td>
+{{- else}}
+  <td style="padding:2px 8px">{{.Actual}}</td>
+  <td style="padding:2px 8px">{{.ExpectedText}}</td>
+{{- end}}
+  <td style="padding:2px 8px"><b>{{.Status}}</b></td>
+ </tr>
+{{- end}}
+{{- end}}
+{{- end}}
+</table>
+`
+
+// longestComplianceSettingName returns the length of the longest setting name of the results
+func longestComplianceSettingName(results []ComplianceResult) int {
+	var longest int
+	for _, result := range results {
+		if len(result.Setting) > longest {
+			longest = len(result.Setting)
+		}
+	}
+
+	return longest
+}
+
 // debugPrintAllSettings prints to console all capture settings
 func (m *ProjectManager) debugPrintAllSettings() error {
 	m.logger.Debugf("---[ ORIGINAL APPROVAL SETTINGS ]---")
@@ -927,7 +2069,7 @@ func (m *ProjectManager) ensureDefaultBranch(project gitlab.Project, dryrun bool
 
 	m.logger.Debugf("Ensuring default branch %s existence ... ", *opt.Branch)
 
-	_, resp, err := m.branchesClient.GetBranch(project.ID, *opt.Branch)
+	_, resp, err := m.branchesClient.GetBranch(project.ID, *opt.Branch, m.withContext())
 	if err == nil {
 		m.logger.Debugf("Ensuring default branch %s existence ... already exists!", *opt.Branch)
 		return nil
@@ -942,9 +2084,9 @@ func (m *ProjectManager) ensureDefaultBranch(project gitlab.Project, dryrun bool
 	}
 
 	if dryrun {
-		m.logger.Infof("DRYRUN: Skipped executing API call [CreateBranch]")
+		m.skipAPICall("CreateBranch", "")
 	} else {
-		if _, _, err := m.branchesClient.CreateBranch(project.ID, opt); err != nil {
+		if _, _, err := m.branchesClient.CreateBranch(project.ID, opt, m.withContext()); err != nil {
 			return fmt.Errorf("failed to create default branch %s: %v", *opt.Branch, err)
 		}
 	}
@@ -952,15 +2094,39 @@ func (m *ProjectManager) ensureDefaultBranch(project gitlab.Project, dryrun bool
 	return nil
 }
 
-// willChangeApprovalSettings takes two ProjectSettings, and confirms if the 2nd one changes the 1st
-func (m *ProjectManager) willChangeApprovalSettings(current *gitlab.ProjectApprovals, changes *gitlab.ProjectApprovals) bool {
-	changelog, _ := diff.Diff(current, changes)
+// approvalSettingNormalizers adjust desired approval settings the same way GitLab does when
+// storing them. Without them a value GitLab adjusts never matches the config, which causes
+// a change on every run.
+var approvalSettingNormalizers = []func(*gitlab.ProjectApprovals){
+	// GitLab clamps negative approval counts to zero
+	func(a *gitlab.ProjectApprovals) {
+		if a.ApprovalsBeforeMerge < 0 {
+			a.ApprovalsBeforeMerge = 0
+		}
+	},
+}
+
+// normalizeApprovalSettings applies all approvalSettingNormalizers to the settings
+func normalizeApprovalSettings(settings *gitlab.ProjectApprovals) {
+	for _, normalize := range approvalSettingNormalizers {
+		normalize(settings)
+	}
+}
+
+// willChangeApprovalSettings takes two ProjectSettings, and confirms if the 2nd one changes the 1st.
+// Only the given configured fields are taken into account, after normalizing the desired values
+// as GitLab would.
+func (m *ProjectManager) willChangeApprovalSettings(current *gitlab.ProjectApprovals, changes *gitlab.ProjectApprovals, fields map[string]bool) bool {
+	normalized := *changes
+	normalizeApprovalSettings(&normalized)
+
+	changelog, _ := diff.Diff(current, &normalized)
 
 	changeExpected := false
 	m.logger.Debugf("%v", changelog)
 
 	for _, change := range changelog {
-		if change.Type == "update" {
+		if fields[change.Path[0]] {
 			changeExpected = true
 		}
 	}
@@ -968,18 +2134,114 @@ func (m *ProjectManager) willChangeApprovalSettings(current *gitlab.ProjectAppro
 	return changeExpected
 }
 
-// willChangeProjectSettings takes two ProjectSettings, and confirms if the 2nd one changes the 1st
-func (m *ProjectManager) willChangeProjectSettings(current *gitlab.Project, changes *gitlab.Project) bool {
+// verifyApprovalSettings warns about configured approval settings which differ from the
+// requested value after the update, i.e. the update didn't stick or GitLab stored an adjusted
+// value. Either would otherwise cause a change on every run. In strict mode this is an error.
+func (m *ProjectManager) verifyApprovalSettings(project gitlab.Project, applied *gitlab.ProjectApprovals, changes *gitlab.ProjectApprovals, fields map[string]bool) {
+	if !m.willChangeApprovalSettings(applied, changes, fields) {
+		return
+	}
+
+	changelog, _ := diff.Diff(applied, changes)
+	for _, change := range changelog {
+		if fields[change.Path[0]] {
+			m.warnf("UPDATE DID NOT STICK: approval setting %s of project %s is %v instead of %v after the update, please check the project or align the config",
+				strcase.ToSnake(change.Path[0]), project.PathWithNamespace, change.From, change.To)
+		}
+	}
+}
+
+// willChangeProjectSettings takes two ProjectSettings, and confirms if the 2nd one changes the 1st.
+// Only the given configured fields are taken into account, as all others are left untouched by EditProject.
+// Settings which are not part of the project representation, like show_default_award_emojis,
+// can't be compared and never count as change; they are applied along with the next change.
+func (m *ProjectManager) willChangeProjectSettings(current *gitlab.Project, changes *gitlab.Project, fields map[string]bool) bool {
 	changelog, _ := diff.Diff(current, changes)
 
 	changeExpected := false
 	m.logger.Debugf("%v", changelog)
 
 	for _, change := range changelog {
-		if change.Type == "update" {
+		if fields[change.Path[0]] {
 			changeExpected = true
 		}
 	}
 
+	projectType := reflect.TypeOf(gitlab.Project{})
+	for field := range fields {
+		if _, ok := projectType.FieldByName(field); !ok {
+			m.logger.Debugf("Setting %s is not returned by the API, it is applied with the next change.", strcase.ToSnake(field))
+		}
+	}
+
 	return changeExpected
 }
+
+// applyFieldPolicy returns a copy of the options without the fields sync is not permitted to
+// change by the managed_fields/immutable_fields policy. The removed fields are returned as a
+// map of field name to json key.
+func (m *ProjectManager) applyFieldPolicy(section string, options interface{}) (interface{}, map[string]string) {
+	blocked := make(map[string]string)
+
+	v := reflect.ValueOf(options).Elem()
+	allowed := reflect.New(v.Type())
+	allowed.Elem().Set(v)
+
+	for field := range configuredFields(options) {
+		structField, _ := v.Type().FieldByName(field)
+		key := strings.Split(structField.Tag.Get("json"), ",")[0]
+
+		if !m.config.FieldAllowed(section, key) {
+			allowed.Elem().FieldByName(field).Set(reflect.Zero(structField.Type))
+			blocked[field] = key
+		}
+	}
+
+	return allowed.Interface(), blocked
+}
+
+// recordBlockedChanges records and warns about the blocked fields which differ between the
+// current and the desired settings. Fields not returned by the API are assumed to differ.
+func (m *ProjectManager) recordBlockedChanges(project gitlab.Project, section string, current interface{}, desired interface{}, blocked map[string]string) {
+	changed := make(map[string]bool)
+
+	changelog, _ := diff.Diff(current, desired)
+	for _, change := range changelog {
+		if _, ok := blocked[change.Path[0]]; ok {
+			changed[change.Path[0]] = true
+		}
+	}
+
+	currentType := reflect.TypeOf(current).Elem()
+	for field := range blocked {
+		if _, ok := currentType.FieldByName(field); !ok {
+			changed[field] = true
+		}
+	}
+
+	for field := range changed {
+		key := section + "." + blocked[field]
+		m.warnf("%s of project %s would change but is blocked by policy", key, project.PathWithNamespace)
+		m.BlockedChanges[project.PathWithNamespace] = append(m.BlockedChanges[project.PathWithNamespace], key)
+	}
+	sort.Strings(m.BlockedChanges[project.PathWithNamespace])
+}
+
+// configuredFields returns the names of all fields set in the given options struct, i.e. all
+// non-nil pointer fields
+func configuredFields(options interface{}) map[string]bool {
+	fields := make(map[string]bool)
+
+	v := reflect.Indirect(reflect.ValueOf(options))
+	if v.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); f.Kind() == reflect.Ptr && !f.IsNil() {
+			fields[v.Type().Field(i).Name] = true
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,2168 @@
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/xanzy/go-gitlab"
+	"golang.org/x/net/html"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+// newTestClient returns a fake client with the group "example", its subgroup "example/sub"
+// and one project in each of them.
+func newTestClient() *fake.Client {
+	client := fake.NewClient()
+	client.AddGroup(&gitlab.Group{ID: 1, Path: "example", FullPath: "example"})
+	client.AddGroup(&gitlab.Group{ID: 2, Path: "sub", FullPath: "example/sub", ParentID: 1})
+	client.AddProject(&gitlab.Project{
+		ID:                10,
+		PathWithNamespace: "example/foo",
+		DefaultBranch:     "master",
+		WikiEnabled:       true,
+		Topics:            []string{"enforce-policy", "go"},
+		Namespace:         &gitlab.ProjectNamespace{ID: 1},
+	})
+	client.AddProject(&gitlab.Project{
+		ID:                11,
+		PathWithNamespace: "example/sub/bar",
+		DefaultBranch:     "master",
+		WikiEnabled:       true,
+		Namespace:         &gitlab.ProjectNamespace{ID: 2},
+	})
+
+	return client
+}
+
+// writeTestFile writes the content to a file in a temporary directory and returns its path
+func writeTestFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+
+	return path
+}
+
+// testClients returns the clients of the fake, without the users client
+func testClients(client *fake.Client) Clients {
+	return Clients{
+		Groups:               client.Groups,
+		Projects:             client.Projects,
+		ProtectedBranches:    client.ProtectedBranches,
+		ProtectedTags:        client.ProtectedTags,
+		Branches:             client.Branches,
+		AccessTokens:         client.ProjectAccessTokens,
+		RepositoryFiles:      client.RepositoryFiles,
+		Repositories:         client.Repositories,
+		ComplianceFrameworks: client.ComplianceFrameworks,
+		GroupVariables:       client.GroupVariables,
+		ProjectVariables:     client.ProjectVariables,
+		ApprovalSettingLocks: client.ApprovalSettingLocks,
+		ProjectMirrors:       client.ProjectMirrors,
+		GroupMembers:         client.GroupMembers,
+	}
+}
+
+func newTestManager(client *fake.Client, cfg *config.Config) *ProjectManager {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+
+	return NewProjectManager(logrus.NewEntry(logger), testClients(client), cfg)
+}
+
+func TestGetProjects(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		expected []string
+	}{
+		{
+			name:     "group including subgroups",
+			cfg:      &config.Config{GroupName: "example", IncludeSubgroups: true},
+			expected: []string{"example/foo", "example/sub/bar"},
+		},
+		{
+			name:     "group excluding subgroups",
+			cfg:      &config.Config{GroupName: "example"},
+			expected: []string{"example/foo"},
+		},
+		{
+			name:     "nested group",
+			cfg:      &config.Config{GroupName: "example/sub", IncludeSubgroups: true},
+			expected: []string{"example/sub/bar"},
+		},
+		{
+			name:     "whitelist",
+			cfg:      &config.Config{GroupName: "example", IncludeSubgroups: true, ProjectWhitelist: []string{"example/sub/bar"}},
+			expected: []string{"example/sub/bar"},
+		},
+		{
+			name:     "blacklist",
+			cfg:      &config.Config{GroupName: "example", IncludeSubgroups: true, ProjectBlacklist: []string{"example/sub/bar"}},
+			expected: []string{"example/foo"},
+		},
+		{
+			name:     "topic",
+			cfg:      &config.Config{GroupName: "example", IncludeSubgroups: true, ProjectTopics: []string{"enforce-policy"}},
+			expected: []string{"example/foo"},
+		},
+		{
+			name:     "all topics required",
+			cfg:      &config.Config{GroupName: "example", IncludeSubgroups: true, ProjectTopics: []string{"enforce-policy", "python"}},
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(newTestClient(), tt.cfg)
+
+			projects, err := manager.GetProjects()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if len(projects) != len(tt.expected) {
+				t.Fatalf("Expected %d projects, got %d", len(tt.expected), len(projects))
+			}
+			for i, p := range projects {
+				if p.PathWithNamespace != tt.expected[i] {
+					t.Errorf("Expected project #%d to be %s, got %s", i, tt.expected[i], p.PathWithNamespace)
+				}
+			}
+		})
+	}
+}
+
+// topicRecordingGroups records the topic filters of the project list calls
+type topicRecordingGroups struct {
+	*fake.GroupsService
+	topics []string
+	opts   []*gitlab.ListGroupProjectsOptions
+}
+
+func (f *topicRecordingGroups) ListGroupProjects(gid interface{}, opt *gitlab.ListGroupProjectsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error) {
+	topic := "<none>"
+	if opt.Topic != nil {
+		topic = *opt.Topic
+	}
+	f.topics = append(f.topics, topic)
+	f.opts = append(f.opts, opt)
+
+	return f.GroupsService.ListGroupProjects(gid, opt, options...)
+}
+
+func TestGetProjectsTopicFilter(t *testing.T) {
+	var opts []*gitlab.ListGroupProjectsOptions
+	for topics, expected := range map[string][]string{"enforce-policy,go": {"enforce-policy", "go"}, "<none>": nil} {
+		client := newTestClient()
+		manager := newTestManager(client, &config.Config{GroupName: "example", IncludeSubgroups: true, ProjectTopics: expected})
+		recording := &topicRecordingGroups{GroupsService: client.Groups}
+		manager.groupsClient = recording
+
+		projects, err := manager.GetProjects()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		// The topics are filtered by GitLab rather than only after listing all projects
+		if !reflect.DeepEqual(recording.topics, []string{topics}) {
+			t.Errorf("Expected the projects to be listed with the topic filter %q, got %q", topics, recording.topics)
+		}
+		if expected != nil && (len(projects) != 1 || projects[0].PathWithNamespace != "example/foo") {
+			t.Errorf("Expected only example/foo to be listed, got %+v", projects)
+		}
+		opts = append(opts, recording.opts...)
+	}
+
+	// Each manager lists its projects with its own options
+	if len(opts) != 2 || opts[0] == opts[1] {
+		t.Errorf("Expected the list options not to be shared between managers, got %v", opts)
+	}
+}
+
+// forbiddenGroups denies access to all groups, like GitLab does for tokens without access
+type forbiddenGroups struct {
+	*fake.GroupsService
+}
+
+func (f *forbiddenGroups) GetGroup(gid interface{}, opt *gitlab.GetGroupOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Group, *gitlab.Response, error) {
+	return nil, &gitlab.Response{Response: &http.Response{StatusCode: http.StatusForbidden}}, errors.New("403 Forbidden")
+}
+
+func (f *forbiddenGroups) ListSubGroups(gid interface{}, opt *gitlab.ListSubGroupsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Group, *gitlab.Response, error) {
+	return nil, &gitlab.Response{Response: &http.Response{StatusCode: http.StatusForbidden}}, errors.New("403 Forbidden")
+}
+
+func TestGetProjectsGroupErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		group     string
+		forbidden bool
+		expected  string
+	}{
+		{name: "unknown group", group: "missing", expected: `group "missing" not found (check group_name/path)`},
+		{name: "unknown base of subgroup", group: "missing/sub", expected: `group "missing" not found (check group_name/path)`},
+		{name: "unknown subgroup", group: "example/nope", expected: `group "example/nope" not found (check group_name/path)`},
+		{name: "unknown nested subgroup", group: "example/sub/nope", expected: `group "example/sub/nope" not found (check group_name/path)`},
+		{name: "forbidden group", group: "example", forbidden: true, expected: `token lacks access to group "example"`},
+		{name: "forbidden subgroup", group: "example/sub", forbidden: true, expected: `token lacks access to group "example"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient()
+			manager := newTestManager(client, &config.Config{GroupName: tt.group})
+			if tt.forbidden {
+				manager.groupsClient = &forbiddenGroups{GroupsService: client.Groups}
+			}
+
+			_, err := manager.GetProjects()
+			if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+				t.Errorf("Expected an error starting with %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestGetProjectsPersonalProjects(t *testing.T) {
+	tests := []struct {
+		name     string
+		users    []string
+		cfg      *config.Config
+		expected []string
+		err      string
+	}{
+		{
+			name:     "disabled",
+			cfg:      &config.Config{GroupName: "example"},
+			expected: []string{"example/foo"},
+		},
+		{
+			name:     "user",
+			users:    []string{"alice"},
+			cfg:      &config.Config{GroupName: "example"},
+			expected: []string{"example/foo", "alice/tool"},
+		},
+		{
+			name:     "blacklist",
+			users:    []string{"alice"},
+			cfg:      &config.Config{GroupName: "example", ProjectBlacklist: []string{"alice/tool"}},
+			expected: []string{"example/foo"},
+		},
+		{
+			name:  "unknown user",
+			users: []string{"bob"},
+			cfg:   &config.Config{GroupName: "example"},
+			err:   "user bob not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient()
+			client.AddProject(&gitlab.Project{
+				ID:                20,
+				PathWithNamespace: "alice/tool",
+				DefaultBranch:     "main",
+				Namespace:         &gitlab.ProjectNamespace{ID: 100, Kind: "user", Path: "alice"},
+			})
+			manager := newTestManager(client, tt.cfg)
+			manager.SetPersonalProjectUsers(tt.users)
+
+			projects, err := manager.GetProjects()
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("Expected an error starting with %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if len(projects) != len(tt.expected) {
+				t.Fatalf("Expected %d projects, got %d", len(tt.expected), len(projects))
+			}
+			for i, p := range projects {
+				if p.PathWithNamespace != tt.expected[i] {
+					t.Errorf("Expected project #%d to be %s, got %s", i, tt.expected[i], p.PathWithNamespace)
+				}
+			}
+		})
+	}
+}
+
+func TestGetProjectsEmptyWarning(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		expected string
+	}{
+		{
+			name:     "empty group",
+			cfg:      &config.Config{GroupName: "empty"},
+			expected: "Group empty contains no projects",
+		},
+		{
+			name:     "everything filtered out",
+			cfg:      &config.Config{GroupName: "example", IncludeSubgroups: true, ProjectWhitelist: []string{"example/baz"}},
+			expected: "All 2 project(s) of group example were filtered out",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient()
+			client.AddGroup(&gitlab.Group{ID: 3, Path: "empty", FullPath: "empty"})
+			logger, hook := test.NewNullLogger()
+			manager := NewProjectManager(logrus.NewEntry(logger), testClients(client), tt.cfg)
+
+			if _, err := manager.GetProjects(); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var warnings []string
+			for _, e := range hook.AllEntries() {
+				if e.Level == logrus.WarnLevel {
+					warnings = append(warnings, e.Message)
+				}
+			}
+			if len(warnings) != 1 || !strings.HasPrefix(warnings[0], tt.expected) {
+				t.Errorf("Expected a warning starting with %q, got %v", tt.expected, warnings)
+			}
+		})
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	client := newTestClient()
+	manager := newTestManager(client, &config.Config{
+		ProjectSettings: &gitlab.EditProjectOptions{WikiEnabled: gitlab.Bool(false)},
+	})
+	client.Projects.EditProject(11, &gitlab.EditProjectOptions{WikiEnabled: gitlab.Bool(false)})
+
+	for _, project := range []gitlab.Project{
+		{ID: 10, PathWithNamespace: "example/foo"},
+		{ID: 11, PathWithNamespace: "example/sub/bar"},
+	} {
+		if err := manager.UpdateProjectSettings(project, true); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	manager.SetError(true)
+
+	summary, err := manager.RunSummary(2, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := RunSummary{Dryrun: true, Projects: 2, Errors: 1, ChangedProjects: []string{"example/foo"}}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Expected summary %+v, got %+v", expected, summary)
+	}
+}
+
+func TestSync(t *testing.T) {
+	client := newTestClient()
+	cfg := &config.Config{
+		GroupName:        "example",
+		IncludeSubgroups: true,
+		ProtectedBranches: []config.ProtectedBranch{
+			{Name: "master", PushAccessLevel: config.AccessLevelMaintainer, MergeAccessLevel: config.AccessLevelDeveloper},
+		},
+		ProtectedTags: []config.ProtectedTag{
+			{Name: "v*", CreateAccessLevel: config.AccessLevelMaintainer},
+		},
+		ApprovalSettings: &gitlab.ChangeApprovalConfigurationOptions{
+			ResetApprovalsOnPush: gitlab.Bool(true),
+		},
+		ProjectSettings: &gitlab.EditProjectOptions{
+			WikiEnabled: gitlab.Bool(false),
+		},
+	}
+	manager := newTestManager(client, cfg)
+
+	projects, err := manager.GetProjects()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, project := range projects {
+		if err := manager.EnsureBranchesAndProtection(project, false); err != nil {
+			t.Errorf("Expected no error ensuring branches of %s, got %v", project.PathWithNamespace, err)
+		}
+		if err := manager.EnsureTagsProtection(project, false); err != nil {
+			t.Errorf("Expected no error ensuring tags of %s, got %v", project.PathWithNamespace, err)
+		}
+		if err := manager.UpdateProjectSettings(project, false); err != nil {
+			t.Errorf("Expected no error updating settings of %s, got %v", project.PathWithNamespace, err)
+		}
+		if err := manager.UpdateProjectApprovalSettings(project, false); err != nil {
+			t.Errorf("Expected no error updating approvals of %s, got %v", project.PathWithNamespace, err)
+		}
+	}
+
+	for _, project := range projects {
+		p, _, _ := client.Projects.GetProject(project.ID, nil)
+		if p.WikiEnabled {
+			t.Errorf("Expected wiki of %s to be disabled", project.PathWithNamespace)
+		}
+
+		a, _, _ := client.Projects.GetApprovalConfiguration(project.ID)
+		if !a.ResetApprovalsOnPush {
+			t.Errorf("Expected reset_approvals_on_push of %s to be enabled", project.PathWithNamespace)
+		}
+
+		b, _, err := client.ProtectedBranches.GetProtectedBranch(project.ID, "master")
+		if err != nil {
+			t.Errorf("Expected master of %s to be protected, got %v", project.PathWithNamespace, err)
+		} else if !compareAccessLevels(b.PushAccessLevels, config.AccessLevelMaintainer) ||
+			!compareAccessLevels(b.MergeAccessLevels, config.AccessLevelDeveloper) {
+			t.Errorf("Expected master of %s to be protected with configured access levels, got %+v", project.PathWithNamespace, b)
+		}
+
+		if _, _, err := client.ProtectedTags.GetProtectedTag(project.ID, "v*"); err != nil {
+			t.Errorf("Expected v* of %s to be protected, got %v", project.PathWithNamespace, err)
+		}
+
+		original := manager.ProjectSettingsOriginal[project.PathWithNamespace]
+		updated := manager.ProjectSettingsUpdated[project.PathWithNamespace]
+		if original == nil || updated == nil || original.WikiEnabled == updated.WikiEnabled {
+			t.Errorf("Expected the change of %s to be recorded, got %+v => %+v", project.PathWithNamespace, original, updated)
+		}
+	}
+}
+
+func TestSyncDryrun(t *testing.T) {
+	client := newTestClient()
+	cfg := &config.Config{
+		GroupName: "example",
+		ProtectedBranches: []config.ProtectedBranch{
+			{Name: "master", PushAccessLevel: config.AccessLevelMaintainer, MergeAccessLevel: config.AccessLevelDeveloper},
+		},
+		ProjectSettings: &gitlab.EditProjectOptions{
+			WikiEnabled: gitlab.Bool(false),
+		},
+	}
+	manager := newTestManager(client, cfg)
+
+	projects, err := manager.GetProjects()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, project := range projects {
+		if err := manager.EnsureBranchesAndProtection(project, true); err != nil {
+			t.Errorf("Expected no error ensuring branches of %s, got %v", project.PathWithNamespace, err)
+		}
+		if err := manager.UpdateProjectSettings(project, true); err != nil {
+			t.Errorf("Expected no error updating settings of %s, got %v", project.PathWithNamespace, err)
+		}
+
+		p, _, _ := client.Projects.GetProject(project.ID, nil)
+		if !p.WikiEnabled {
+			t.Errorf("Expected wiki of %s to be left untouched in dryrun", project.PathWithNamespace)
+		}
+		if _, _, err := client.ProtectedBranches.GetProtectedBranch(project.ID, "master"); err == nil {
+			t.Errorf("Expected master of %s to be left unprotected in dryrun", project.PathWithNamespace)
+		}
+		if manager.ProjectSettingsUpdated[project.PathWithNamespace].WikiEnabled {
+			t.Errorf("Expected the planned settings of %s to have the wiki disabled", project.PathWithNamespace)
+		}
+	}
+
+	if changes, err := manager.HasChanges(); err != nil || !changes {
+		t.Errorf("Expected the dryrun to plan changes, got %v (%v)", changes, err)
+	}
+}
+
+func TestUpdateProjectSettingsImmutableFields(t *testing.T) {
+	client := newTestClient()
+	manager := newTestManager(client, &config.Config{
+		ImmutableFields: []string{"project_settings.visibility"},
+		ProjectSettings: &gitlab.EditProjectOptions{
+			Visibility:  gitlab.Visibility(gitlab.PublicVisibility),
+			WikiEnabled: gitlab.Bool(false),
+		},
+	})
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	if err := manager.UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	p, _, _ := client.Projects.GetProject(10, nil)
+	if p.WikiEnabled {
+		t.Errorf("Expected the allowed wiki_enabled to be applied")
+	}
+	if p.Visibility == gitlab.PublicVisibility {
+		t.Errorf("Expected the immutable visibility to be left untouched")
+	}
+
+	blocked := manager.BlockedChanges["example/foo"]
+	if len(blocked) != 1 || blocked[0] != "project_settings.visibility" {
+		t.Errorf("Expected visibility to be reported as blocked, got %v", blocked)
+	}
+}
+
+func TestUpdateProjectApprovalSettingsNormalized(t *testing.T) {
+	client := newTestClient()
+	cfg := &config.Config{
+		ApprovalSettings: &gitlab.ChangeApprovalConfigurationOptions{
+			ApprovalsBeforeMerge: gitlab.Int(-1),
+			ResetApprovalsOnPush: gitlab.Bool(true),
+		},
+	}
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	first := newTestManager(client, cfg)
+	if err := first.UpdateProjectApprovalSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if changes, _ := first.HasChanges(); !changes {
+		t.Errorf("Expected the first run to change the approval settings")
+	}
+
+	// GitLab clamped the count to 0, which must not be planned as a change in the next run
+	second := newTestManager(client, cfg)
+	if err := second.UpdateProjectApprovalSettings(project, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if changes, _ := second.HasChanges(); changes {
+		t.Errorf("Expected the second run not to change anything, got %+v => %+v",
+			second.ApprovalSettingsOriginal["example/foo"], second.ApprovalSettingsUpdated["example/foo"])
+	}
+}
+
+func TestUpdateProjectSettingsGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  *gitlab.EditProjectOptions
+		legacy   bool
+		settings string
+		// subgroup syncs example/sub/bar too, which keeps the defaults of the fake
+		subgroup        bool
+		expectedChanges []string
+		expected        map[string]interface{}
+	}{
+		{
+			name:            "auto devops disabled",
+			current:         &gitlab.EditProjectOptions{AutoDevopsEnabled: gitlab.Bool(true), AutoDevopsDeployStrategy: gitlab.String("continuous"), CIConfigPath: gitlab.String("custom.yml")},
+			settings:        `{"auto_devops_enabled": false, "ci_config_path": ".gitlab-ci.yml@ci/templates"}`,
+			expectedChanges: []string{"example/foo auto_devops_enabled: true => false", "example/foo ci_config_path: custom.yml => .gitlab-ci.yml@ci/templates"},
+			expected:        map[string]interface{}{"auto_devops_enabled": false, "ci_config_path": ".gitlab-ci.yml@ci/templates"},
+		},
+		{
+			name:            "auto devops unset",
+			current:         &gitlab.EditProjectOptions{AutoDevopsEnabled: gitlab.Bool(true), AutoDevopsDeployStrategy: gitlab.String("continuous"), CIConfigPath: gitlab.String("custom.yml")},
+			settings:        `{"ci_config_path": ".gitlab-ci.yml@ci/templates"}`,
+			expectedChanges: []string{"example/foo ci_config_path: custom.yml => .gitlab-ci.yml@ci/templates"},
+			expected:        map[string]interface{}{"auto_devops_enabled": true, "ci_config_path": ".gitlab-ci.yml@ci/templates"},
+		},
+		{
+			name:            "auto devops null",
+			current:         &gitlab.EditProjectOptions{AutoDevopsEnabled: gitlab.Bool(true), AutoDevopsDeployStrategy: gitlab.String("continuous"), CIConfigPath: gitlab.String("custom.yml")},
+			settings:        `{"auto_devops_enabled": null, "auto_devops_deploy_strategy": "manual"}`,
+			expectedChanges: []string{"example/foo auto_devops_deploy_strategy: continuous => manual"},
+			expected:        map[string]interface{}{"auto_devops_enabled": true, "ci_config_path": "custom.yml"},
+		},
+		{
+			name:            "merge request toggles disabled",
+			current:         &gitlab.EditProjectOptions{ResolveOutdatedDiffDiscussions: gitlab.Bool(true), PrintingMergeRequestLinkEnabled: gitlab.Bool(true)},
+			settings:        `{"resolve_outdated_diff_discussions": false, "printing_merge_request_link_enabled": false}`,
+			expectedChanges: []string{"example/foo printing_merge_request_link_enabled: true => false", "example/foo resolve_outdated_diff_discussions: true => false"},
+			expected:        map[string]interface{}{"resolve_outdated_diff_discussions": false, "printing_merge_request_link_enabled": false},
+		},
+		{
+			name:     "merge request toggles already enabled",
+			current:  &gitlab.EditProjectOptions{ResolveOutdatedDiffDiscussions: gitlab.Bool(true), PrintingMergeRequestLinkEnabled: gitlab.Bool(true)},
+			settings: `{"resolve_outdated_diff_discussions": true, "printing_merge_request_link_enabled": true}`,
+			expected: map[string]interface{}{"resolve_outdated_diff_discussions": true, "printing_merge_request_link_enabled": true},
+		},
+		{
+			name:            "merge request toggles omitted",
+			current:         &gitlab.EditProjectOptions{ResolveOutdatedDiffDiscussions: gitlab.Bool(true), PrintingMergeRequestLinkEnabled: gitlab.Bool(true)},
+			settings:        `{"wiki_enabled": false}`,
+			expectedChanges: []string{"example/foo wiki_enabled: true => false"},
+			expected:        map[string]interface{}{"resolve_outdated_diff_discussions": true, "printing_merge_request_link_enabled": true},
+		},
+		{
+			name:            "merge request toggles null",
+			current:         &gitlab.EditProjectOptions{ResolveOutdatedDiffDiscussions: gitlab.Bool(true), PrintingMergeRequestLinkEnabled: gitlab.Bool(true)},
+			settings:        `{"resolve_outdated_diff_discussions": null, "printing_merge_request_link_enabled": false}`,
+			expectedChanges: []string{"example/foo printing_merge_request_link_enabled: true => false"},
+			expected:        map[string]interface{}{"resolve_outdated_diff_discussions": true, "printing_merge_request_link_enabled": false},
+		},
+		{
+			name:            "remove source branch after merge",
+			current:         &gitlab.EditProjectOptions{RemoveSourceBranchAfterMerge: gitlab.Bool(false)},
+			settings:        `{"remove_source_branch_after_merge": true}`,
+			expectedChanges: []string{"example/foo remove_source_branch_after_merge: false => true"},
+			expected:        map[string]interface{}{"remove_source_branch_after_merge": true},
+		},
+		{
+			name:            "request access and lfs governance tier",
+			current:         &gitlab.EditProjectOptions{RequestAccessEnabled: gitlab.Bool(true), LFSEnabled: gitlab.Bool(false)},
+			settings:        `{"request_access_enabled": false, "lfs_enabled": true}`,
+			expectedChanges: []string{"example/foo lfs_enabled: false => true", "example/foo request_access_enabled: true => false"},
+			expected:        map[string]interface{}{"request_access_enabled": false, "lfs_enabled": true},
+		},
+		{
+			name:     "request access and lfs already set",
+			current:  &gitlab.EditProjectOptions{RequestAccessEnabled: gitlab.Bool(true), LFSEnabled: gitlab.Bool(false)},
+			settings: `{"request_access_enabled": true, "lfs_enabled": false}`,
+			expected: map[string]interface{}{"request_access_enabled": true, "lfs_enabled": false},
+		},
+		{
+			name:     "request access and lfs omitted",
+			current:  &gitlab.EditProjectOptions{RequestAccessEnabled: gitlab.Bool(true), LFSEnabled: gitlab.Bool(false)},
+			settings: `{"wiki_enabled": true}`,
+			expected: map[string]interface{}{"request_access_enabled": true, "lfs_enabled": false},
+		},
+		{
+			name:            "request access and lfs null",
+			current:         &gitlab.EditProjectOptions{RequestAccessEnabled: gitlab.Bool(true), LFSEnabled: gitlab.Bool(false)},
+			settings:        `{"request_access_enabled": null, "lfs_enabled": true}`,
+			expectedChanges: []string{"example/foo lfs_enabled: false => true"},
+			expected:        map[string]interface{}{"request_access_enabled": true, "lfs_enabled": true},
+		},
+		{
+			// Instances before GitLab 16.5 only return emails_disabled
+			name:     "emails on legacy instance already enabled",
+			current:  &gitlab.EditProjectOptions{EmailsEnabled: gitlab.Bool(false), EmailsDisabled: gitlab.Bool(false)},
+			legacy:   true,
+			settings: `{"emails_enabled": true}`,
+			expected: map[string]interface{}{"emails_enabled": true, "emails_disabled": false},
+		},
+		{
+			name:            "emails on legacy instance disabling",
+			current:         &gitlab.EditProjectOptions{EmailsEnabled: gitlab.Bool(false), EmailsDisabled: gitlab.Bool(false)},
+			legacy:          true,
+			settings:        `{"emails_enabled": false}`,
+			expectedChanges: []string{"example/foo emails_disabled: false => true", "example/foo emails_enabled: true => false"},
+			expected:        map[string]interface{}{"emails_enabled": false, "emails_disabled": true},
+		},
+		{
+			name:     "emails by legacy setting already disabled",
+			current:  &gitlab.EditProjectOptions{EmailsEnabled: gitlab.Bool(false), EmailsDisabled: gitlab.Bool(true)},
+			settings: `{"emails_disabled": true}`,
+			expected: map[string]interface{}{"emails_enabled": false, "emails_disabled": true},
+		},
+		{
+			name:            "emails by legacy setting enabling",
+			current:         &gitlab.EditProjectOptions{EmailsEnabled: gitlab.Bool(false), EmailsDisabled: gitlab.Bool(true)},
+			settings:        `{"emails_disabled": false}`,
+			expectedChanges: []string{"example/foo emails_disabled: true => false", "example/foo emails_enabled: false => true"},
+			expected:        map[string]interface{}{"emails_enabled": true, "emails_disabled": false},
+		},
+		{
+			name:            "shared runners disabled",
+			current:         &gitlab.EditProjectOptions{SharedRunnersEnabled: gitlab.Bool(true), GroupRunnersEnabled: gitlab.Bool(true)},
+			settings:        `{"shared_runners_enabled": false}`,
+			expectedChanges: []string{"example/foo shared_runners_enabled: true => false"},
+			expected:        map[string]interface{}{"shared_runners_enabled": false, "group_runners_enabled": true},
+		},
+		{
+			name:            "all runners disabled",
+			current:         &gitlab.EditProjectOptions{SharedRunnersEnabled: gitlab.Bool(true), GroupRunnersEnabled: gitlab.Bool(true)},
+			settings:        `{"shared_runners_enabled": false, "group_runners_enabled": false}`,
+			expectedChanges: []string{"example/foo group_runners_enabled: true => false", "example/foo shared_runners_enabled: true => false"},
+			expected:        map[string]interface{}{"shared_runners_enabled": false, "group_runners_enabled": false},
+		},
+		{
+			name:     "runners unset",
+			current:  &gitlab.EditProjectOptions{SharedRunnersEnabled: gitlab.Bool(true), GroupRunnersEnabled: gitlab.Bool(true)},
+			settings: `{"shared_runners_enabled": null, "wiki_enabled": true}`,
+			expected: map[string]interface{}{"shared_runners_enabled": true, "group_runners_enabled": true},
+		},
+		{
+			// foo runs merged results pipelines already, bar neither of them
+			name:     "merge trains",
+			current:  &gitlab.EditProjectOptions{MergePipelinesEnabled: gitlab.Bool(true)},
+			settings: `{"merge_trains_enabled": true, "merge_pipelines_enabled": true}`,
+			subgroup: true,
+			expectedChanges: []string{
+				"example/foo merge_trains_enabled: false => true",
+				"example/sub/bar merge_pipelines_enabled: false => true",
+				"example/sub/bar merge_trains_enabled: false => true",
+			},
+			expected: map[string]interface{}{"merge_trains_enabled": true, "merge_pipelines_enabled": true},
+		},
+		{
+			// false must be sent, not dropped as the zero value
+			name:            "keep latest artifact disabled",
+			current:         &gitlab.EditProjectOptions{KeepLatestArtifact: gitlab.Bool(true)},
+			settings:        `{"keep_latest_artifact": false}`,
+			expectedChanges: []string{"example/foo keep_latest_artifact: true => false"},
+			expected:        map[string]interface{}{"keep_latest_artifact": false},
+		},
+		{
+			name:            "keep latest artifact enabled",
+			current:         &gitlab.EditProjectOptions{KeepLatestArtifact: gitlab.Bool(false)},
+			settings:        `{"keep_latest_artifact": true}`,
+			expectedChanges: []string{"example/foo keep_latest_artifact: false => true"},
+			expected:        map[string]interface{}{"keep_latest_artifact": true},
+		},
+		{
+			name:     "keep latest artifact unchanged",
+			current:  &gitlab.EditProjectOptions{KeepLatestArtifact: gitlab.Bool(false)},
+			settings: `{"keep_latest_artifact": false}`,
+			expected: map[string]interface{}{"keep_latest_artifact": false},
+		},
+		{
+			name:     "keep latest artifact not configured",
+			current:  &gitlab.EditProjectOptions{KeepLatestArtifact: gitlab.Bool(true)},
+			settings: `{"wiki_enabled": true}`,
+			expected: map[string]interface{}{"keep_latest_artifact": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Parse(writeTestFile(t, "config.json", `{"project_settings": `+tt.settings+`}`))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			client := newTestClient()
+			client.Projects.EditProject(10, tt.current)
+			if tt.legacy {
+				client.UseLegacyEmailSettings()
+			}
+			projects := []gitlab.Project{{ID: 10, PathWithNamespace: "example/foo"}}
+			if tt.subgroup {
+				projects = append(projects, gitlab.Project{ID: 11, PathWithNamespace: "example/sub/bar"})
+			}
+
+			// The changes are planned by a dryrun already, and no longer once applied
+			for i, dryrun := range []bool{true, false, true} {
+				manager := newTestManager(client, cfg)
+				for _, project := range projects {
+					if err := manager.UpdateProjectSettings(project, dryrun); err != nil {
+						t.Fatalf("Expected no error, got %v", err)
+					}
+				}
+
+				entries, err := manager.ChangeLogEntries(false)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				var changes []string
+				for _, entry := range entries {
+					changes = append(changes, fmt.Sprintf("%s %s: %v => %v", entry.Project, entry.Setting, entry.From, entry.To))
+				}
+				sort.Strings(changes)
+				expected := tt.expectedChanges
+				if i == 2 {
+					expected = nil
+				}
+				if !reflect.DeepEqual(changes, expected) {
+					t.Errorf("Expected changes %q in run %d, got %q", expected, i+1, changes)
+				}
+			}
+
+			for _, project := range projects {
+				p, err := newTestManager(client, cfg).GetProjectSettings(project)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				b, _ := json.Marshal(p)
+				var actual map[string]interface{}
+				if err := json.Unmarshal(b, &actual); err != nil {
+					t.Fatal(err)
+				}
+				for key, value := range tt.expected {
+					if actual[key] != value {
+						t.Errorf("Expected %s of %s to be %v, got %v", key, project.PathWithNamespace, value, actual[key])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateProjectSettingsRequestAccessDrift(t *testing.T) {
+	for settings, configured := range map[string]bool{`{"request_access_enabled": false}`: true, `{"wiki_enabled": true}`: false} {
+		cfg, err := config.Parse(writeTestFile(t, "config.json", `{"project_settings": `+settings+`}`))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		client := newTestClient()
+		client.Projects.EditProject(10, &gitlab.EditProjectOptions{RequestAccessEnabled: gitlab.Bool(true)})
+		project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+		first := newTestManager(client, cfg)
+		if err := first.UpdateProjectSettings(project, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		// Toggling access requests in the UI is drift from the state of this run
+		p, _, _ := client.Projects.GetProject(10, nil)
+		previous := []ProjectState{{Project: "example/foo", ProjectSettings: p}}
+		client.Projects.EditProject(10, &gitlab.EditProjectOptions{RequestAccessEnabled: gitlab.Bool(!p.RequestAccessEnabled)})
+		second := newTestManager(client, cfg)
+		second.ProjectSettingsOriginal["example/foo"], _, _ = client.Projects.GetProject(10, nil)
+		drift := second.DriftEntries(previous)
+		if configured {
+			if len(drift) != 1 || drift[0].Setting != "request_access_enabled" {
+				t.Errorf("Expected request_access_enabled to have drifted, got %+v", drift)
+			}
+		} else if len(drift) != 0 {
+			t.Errorf("Expected no drift of settings left to the projects, got %+v", drift)
+		}
+	}
+}
+
+func TestUpdateProjectSettingsShowDefaultAwardEmojis(t *testing.T) {
+	tests := []struct {
+		name         string
+		settings     string
+		dryrun       bool
+		expectedEdit bool
+	}{
+		{name: "alone", settings: `{"show_default_award_emojis": false}`},
+		{name: "alone dryrun", settings: `{"show_default_award_emojis": false}`, dryrun: true},
+		{name: "with a changed setting", settings: `{"show_default_award_emojis": false, "emails_enabled": false}`, expectedEdit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Parse(writeTestFile(t, "config.json", `{"project_settings": `+tt.settings+`}`))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			client := newTestClient()
+			manager := newTestManager(client, cfg)
+			recording := &editRecordingProjects{ProjectsService: client.Projects}
+			manager.projectsClient = recording
+
+			if err := manager.UpdateProjectSettings(gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}, tt.dryrun); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			// GitLab doesn't return show_default_award_emojis, so it is no drift on its own
+			if changes, _ := manager.HasChanges(); changes != tt.expectedEdit {
+				t.Errorf("Expected changes %v, got %v", tt.expectedEdit, changes)
+			}
+			if tt.expectedEdit {
+				if len(recording.edits) != 1 || recording.edits[0].ShowDefaultAwardEmojis == nil || *recording.edits[0].ShowDefaultAwardEmojis {
+					t.Errorf("Expected show_default_award_emojis to be applied with the change, got edits %+v", recording.edits)
+				}
+			} else if len(recording.edits) != 0 || manager.skippedCalls["EditProject"] != 0 {
+				t.Errorf("Expected no (planned) EditProject call, got edits %+v and skipped calls %v", recording.edits, manager.skippedCalls)
+			}
+		})
+	}
+}
+
+func TestUpdateProjectSettingsIssueSettings(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"project_settings": {
+			"autoclose_referenced_issues": false,
+			"issues_template": "## Steps to reproduce"
+		},
+		"compliance": {
+			"mandatory": {
+				"project_settings": {"autoclose_referenced_issues": false, "issues_template": "## Steps to reproduce"}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	client := newTestClient()
+	client.Projects.EditProject(10, &gitlab.EditProjectOptions{AutocloseReferencedIssues: gitlab.Bool(true)})
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	first := newTestManager(client, cfg)
+	if err := first.UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// false is enforced like any other value
+	entries, err := first.ChangeLogEntries(false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	changes := make(map[string]interface{})
+	for _, entry := range entries {
+		changes[entry.Setting] = entry.To
+	}
+	expected := map[string]interface{}{"autoclose_referenced_issues": false, "issues_template": "## Steps to reproduce"}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+
+	for _, result := range first.ComplianceResults() {
+		if result.Compliant {
+			t.Errorf("Expected %s to be non-compliant before the sync, got %+v", result.Setting, result)
+		}
+	}
+
+	p, _, _ := client.Projects.GetProject(10, nil)
+	if p.AutocloseReferencedIssues || p.IssuesTemplate != "## Steps to reproduce" {
+		t.Errorf("Expected the issue settings to be applied, got %v and %q", p.AutocloseReferencedIssues, p.IssuesTemplate)
+	}
+
+	second := newTestManager(client, cfg)
+	if err := second.UpdateProjectSettings(project, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if changes, _ := second.HasChanges(); changes {
+		t.Errorf("Expected no changes once the settings are applied")
+	}
+	for _, result := range second.ComplianceResults() {
+		if !result.Compliant {
+			t.Errorf("Expected %s to be compliant after the sync, got %+v", result.Setting, result)
+		}
+	}
+}
+
+func TestUpdateProjectSettingsMergeRequestDefaults(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{"project_settings": {
+		"mr_default_target_self": true,
+		"suggestion_commit_message": "Apply suggestion to %{file_path}"
+	}}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	client := newTestClient()
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	first := newTestManager(client, cfg)
+	if err := first.UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	entries, err := first.ChangeLogEntries(false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	changed := make(map[string]interface{})
+	for _, entry := range entries {
+		changed[entry.Setting] = entry.To
+	}
+	if len(changed) != 2 || changed["mr_default_target_self"] != true || changed["suggestion_commit_message"] != "Apply suggestion to %{file_path}" {
+		t.Errorf("Expected both settings to be changed, got %v", changed)
+	}
+
+	p, _, _ := client.Projects.GetProject(10, nil)
+	if !p.MergeRequestDefaultTargetSelf || p.SuggestionCommitMessage != "Apply suggestion to %{file_path}" {
+		t.Errorf("Expected both settings to be applied, got %v and %q", p.MergeRequestDefaultTargetSelf, p.SuggestionCommitMessage)
+	}
+
+	// Changed in the UI, the drift is detected and planned to be reverted
+	client.Projects.EditProject(10, &gitlab.EditProjectOptions{SuggestionCommitMessage: gitlab.String("custom")})
+	second := newTestManager(client, cfg)
+	if err := second.UpdateProjectSettings(project, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	entries, err = second.ChangeLogEntries(false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 1 || entries[0].Setting != "suggestion_commit_message" || entries[0].From != "custom" {
+		t.Errorf("Expected the drifted suggestion commit message to be planned, got %+v", entries)
+	}
+}
+
+// ignoringProjects acknowledges the first ignore approval changes without storing them, like
+// GitLab occasionally does
+type ignoringProjects struct {
+	*fake.ProjectsService
+	ignore int
+}
+
+func (f *ignoringProjects) ChangeApprovalConfiguration(pid interface{}, opt *gitlab.ChangeApprovalConfigurationOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovals, *gitlab.Response, error) {
+	if f.ignore > 0 {
+		f.ignore--
+		approvals, resp, err := f.GetApprovalConfiguration(pid)
+		return approvals, resp, err
+	}
+
+	return f.ProjectsService.ChangeApprovalConfiguration(pid, opt, options...)
+}
+
+func TestUpdateProjectApprovalSettingsVerified(t *testing.T) {
+	tests := []struct {
+		name        string
+		ignore      int
+		expectError bool
+	}{
+		{name: "stuck after retry", ignore: 1},
+		{name: "didn't stick", ignore: 2, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient()
+			manager := newTestManager(client, &config.Config{
+				Strict:           true,
+				ApprovalSettings: &gitlab.ChangeApprovalConfigurationOptions{ResetApprovalsOnPush: gitlab.Bool(true)},
+			})
+			manager.projectsClient = &ignoringProjects{ProjectsService: client.Projects, ignore: tt.ignore}
+
+			if err := manager.UpdateProjectApprovalSettings(gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}, false); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if manager.GetError() != tt.expectError {
+				t.Errorf("Expected the error flag to be %v, got %v", tt.expectError, manager.GetError())
+			}
+			if updated := manager.ApprovalSettingsUpdated["example/foo"]; updated.ResetApprovalsOnPush == tt.expectError {
+				t.Errorf("Expected the refetched settings to be recorded, got %+v", updated)
+			}
+		})
+	}
+}
+
+// countingProjects counts the approval settings API calls
+type countingProjects struct {
+	*fake.ProjectsService
+	calls int
+}
+
+func (f *countingProjects) GetApprovalConfiguration(pid interface{}, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovals, *gitlab.Response, error) {
+	f.calls++
+	return f.ProjectsService.GetApprovalConfiguration(pid, options...)
+}
+
+func (f *countingProjects) ChangeApprovalConfiguration(pid interface{}, opt *gitlab.ChangeApprovalConfigurationOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovals, *gitlab.Response, error) {
+	f.calls++
+	return f.ProjectsService.ChangeApprovalConfiguration(pid, opt, options...)
+}
+
+// newHomogeneousTestClient returns the test client with two more projects in the namespace
+// example, and the projects of both namespaces
+func newHomogeneousTestClient() (*fake.Client, []gitlab.Project) {
+	client := newTestClient()
+	client.AddProject(&gitlab.Project{ID: 12, PathWithNamespace: "example/baz", Namespace: &gitlab.ProjectNamespace{ID: 1}})
+	client.AddProject(&gitlab.Project{ID: 13, PathWithNamespace: "example/qux", Namespace: &gitlab.ProjectNamespace{ID: 1}})
+
+	return client, []gitlab.Project{
+		{ID: 10, PathWithNamespace: "example/foo"},
+		{ID: 12, PathWithNamespace: "example/baz"},
+		{ID: 13, PathWithNamespace: "example/qux"},
+		{ID: 11, PathWithNamespace: "example/sub/bar"},
+	}
+}
+
+func TestUpdateProjectApprovalSettingsHomogeneous(t *testing.T) {
+	tests := []struct {
+		name          string
+		homogeneous   bool
+		compliant     bool
+		expectedCalls int
+	}{
+		// A fetch per project, plus an update and a verifying fetch per changed project
+		{name: "changed", expectedCalls: 12},
+		{name: "compliant", compliant: true, expectedCalls: 4},
+		// A fetch per namespace, the verifying fetches are kept
+		{name: "changed homogeneous", homogeneous: true, expectedCalls: 10},
+		// The projects found compliant by the snapshot are fetched to record their own settings
+		{name: "compliant homogeneous", homogeneous: true, compliant: true, expectedCalls: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, projects := newHomogeneousTestClient()
+			if tt.compliant {
+				for _, project := range projects {
+					client.SetApprovals(project.ID, &gitlab.ProjectApprovals{ResetApprovalsOnPush: true})
+				}
+			}
+			manager := newTestManager(client, &config.Config{
+				ApprovalSettings: &gitlab.ChangeApprovalConfigurationOptions{ResetApprovalsOnPush: gitlab.Bool(true)},
+			})
+			counting := &countingProjects{ProjectsService: client.Projects}
+			manager.projectsClient = counting
+			manager.SetHomogeneousApprovals(tt.homogeneous)
+
+			for _, project := range projects {
+				if err := manager.UpdateProjectApprovalSettings(project, false); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+
+			if counting.calls != tt.expectedCalls {
+				t.Errorf("Expected %d API calls, got %d", tt.expectedCalls, counting.calls)
+			}
+			for _, project := range projects {
+				if original := manager.ApprovalSettingsOriginal[project.PathWithNamespace]; original.ResetApprovalsOnPush != tt.compliant {
+					t.Errorf("Expected the original settings of %s to be recorded, got %+v", project.PathWithNamespace, original)
+				}
+				if updated := manager.ApprovalSettingsUpdated[project.PathWithNamespace]; !updated.ResetApprovalsOnPush {
+					t.Errorf("Expected the updated settings of %s to be recorded, got %+v", project.PathWithNamespace, updated)
+				}
+				if settings, _, _ := client.Projects.GetApprovalConfiguration(project.ID); !settings.ResetApprovalsOnPush {
+					t.Errorf("Expected the settings of %s to be updated, got %+v", project.PathWithNamespace, settings)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateProjectApprovalSettingsHomogeneousDrift(t *testing.T) {
+	client, projects := newHomogeneousTestClient()
+	for _, project := range projects {
+		if project.PathWithNamespace != "example/baz" {
+			client.SetApprovals(project.ID, &gitlab.ProjectApprovals{ResetApprovalsOnPush: true})
+		}
+	}
+	manager := newTestManager(client, &config.Config{
+		ApprovalSettings: &gitlab.ChangeApprovalConfigurationOptions{ResetApprovalsOnPush: gitlab.Bool(true)},
+	})
+	manager.SetHomogeneousApprovals(true)
+
+	for _, project := range projects {
+		if err := manager.UpdateProjectApprovalSettings(project, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	// The snapshot of example/foo finds example/baz compliant, its own settings do not
+	if original := manager.ApprovalSettingsOriginal["example/baz"]; original.ResetApprovalsOnPush {
+		t.Errorf("Expected the observed settings of example/baz to be recorded, got %+v", original)
+	}
+	if settings, _, _ := client.Projects.GetApprovalConfiguration(12); !settings.ResetApprovalsOnPush {
+		t.Errorf("Expected the drifted settings of example/baz to be updated, got %+v", settings)
+	}
+}
+
+func BenchmarkUpdateProjectApprovalSettings(b *testing.B) {
+	for _, homogeneous := range []bool{false, true} {
+		b.Run(fmt.Sprintf("homogeneous=%v", homogeneous), func(b *testing.B) {
+			calls := 0
+			for i := 0; i < b.N; i++ {
+				client, projects := newHomogeneousTestClient()
+				manager := newTestManager(client, &config.Config{
+					ApprovalSettings: &gitlab.ChangeApprovalConfigurationOptions{ResetApprovalsOnPush: gitlab.Bool(true)},
+				})
+				counting := &countingProjects{ProjectsService: client.Projects}
+				manager.projectsClient = counting
+				manager.SetHomogeneousApprovals(homogeneous)
+
+				for _, project := range projects {
+					if err := manager.UpdateProjectApprovalSettings(project, false); err != nil {
+						b.Fatalf("Expected no error, got %v", err)
+					}
+				}
+				calls += counting.calls
+			}
+
+			b.ReportMetric(float64(calls)/float64(b.N*4), "calls/project")
+		})
+	}
+}
+
+func TestUpdateProjectSettingsAccessLevels(t *testing.T) {
+	client := newTestClient()
+	options := &gitlab.EditProjectOptions{}
+	if err := json.Unmarshal([]byte(`{
+		"issues_access_level": "disabled",
+		"merge_requests_access_level": "private",
+		"forking_access_level": "enabled",
+		"repository_access_level": "enabled"
+	}`), options); err != nil {
+		t.Fatalf("Expected access levels to be parsed, got %v", err)
+	}
+	cfg := &config.Config{ProjectSettings: options}
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	client.Projects.EditProject(10, &gitlab.EditProjectOptions{
+		IssuesAccessLevel:     gitlab.AccessControl(gitlab.EnabledAccessControl),
+		ForkingAccessLevel:    gitlab.AccessControl(gitlab.EnabledAccessControl),
+		RepositoryAccessLevel: gitlab.AccessControl(gitlab.EnabledAccessControl),
+	})
+
+	first := newTestManager(client, cfg)
+	if err := first.UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if changes, _ := first.HasChanges(); !changes {
+		t.Errorf("Expected the differing access levels to be detected")
+	}
+
+	p, _, _ := client.Projects.GetProject(10, nil)
+	if p.IssuesAccessLevel != gitlab.DisabledAccessControl || p.MergeRequestsAccessLevel != gitlab.PrivateAccessControl {
+		t.Errorf("Expected access levels to be applied, got issues %q and merge requests %q", p.IssuesAccessLevel, p.MergeRequestsAccessLevel)
+	}
+
+	second := newTestManager(client, cfg)
+	if err := second.UpdateProjectSettings(project, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if changes, _ := second.HasChanges(); changes {
+		t.Errorf("Expected no changes once the access levels are applied")
+	}
+}
+
+func TestUpdateProjectSettingsFeatureAccessLevels(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{"project_settings": {
+		"packages_enabled": false,
+		"analytics_access_level": "private",
+		"security_and_compliance_access_level": "private",
+		"releases_access_level": "enabled",
+		"feature_flags_access_level": "disabled"
+	}}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	client := newTestClient()
+	client.Projects.EditProject(10, &gitlab.EditProjectOptions{
+		PackagesEnabled:                  gitlab.Bool(true),
+		AnalyticsAccessLevel:             gitlab.AccessControl(gitlab.EnabledAccessControl),
+		SecurityAndComplianceAccessLevel: gitlab.AccessControl(gitlab.PrivateAccessControl),
+		ReleasesAccessLevel:              gitlab.AccessControl(gitlab.PrivateAccessControl),
+		FeatureFlagsAccessLevel:          gitlab.AccessControl(gitlab.EnabledAccessControl),
+	})
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	first := newTestManager(client, cfg)
+	if err := first.UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Only the differing settings are changed, access levels are listed by their names
+	entries, err := first.ChangeLogEntries(false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	changes := make(map[string]string)
+	for _, entry := range entries {
+		changes[entry.Setting] = fmt.Sprintf("%v -> %v", entry.From, entry.To)
+	}
+	expected := map[string]string{
+		"packages_enabled":           "true -> false",
+		"analytics_access_level":     "enabled -> private",
+		"releases_access_level":      "private -> enabled",
+		"feature_flags_access_level": "enabled -> disabled",
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+
+	p, _, _ := client.Projects.GetProject(10, nil)
+	if p.PackagesEnabled || p.AnalyticsAccessLevel != gitlab.PrivateAccessControl || p.FeatureFlagsAccessLevel != gitlab.DisabledAccessControl {
+		t.Errorf("Expected the settings to be applied, got packages %v, analytics %q and feature flags %q",
+			p.PackagesEnabled, p.AnalyticsAccessLevel, p.FeatureFlagsAccessLevel)
+	}
+
+	second := newTestManager(client, cfg)
+	if err := second.UpdateProjectSettings(project, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if changes, _ := second.HasChanges(); changes {
+		t.Errorf("Expected no changes once the settings are applied")
+	}
+}
+
+func TestUpdateProjectSettingsCISettings(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{"project_settings": {
+		"build_git_strategy": "clone",
+		"ci_forward_deployment_enabled": true,
+		"ci_separated_caches": false
+	}}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	client := newTestClient()
+	client.Projects.EditProject(10, &gitlab.EditProjectOptions{
+		BuildGitStrategy:           gitlab.String("fetch"),
+		CIForwardDeploymentEnabled: gitlab.Bool(false),
+		CISeperateCache:            gitlab.Bool(false),
+	})
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	first := newTestManager(client, cfg)
+	if err := first.UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	entries, err := first.ChangeLogEntries(false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	changes := make(map[string]string)
+	for _, entry := range entries {
+		changes[entry.Setting] = fmt.Sprintf("%v -> %v", entry.From, entry.To)
+	}
+	expected := map[string]string{
+		"build_git_strategy":            "fetch -> clone",
+		"ci_forward_deployment_enabled": "false -> true",
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+
+	p, _, _ := client.Projects.GetProject(10, nil)
+	if p.BuildGitStrategy != "clone" || !p.CIForwardDeploymentEnabled || p.CISeperateCache {
+		t.Errorf("Expected the settings to be applied, got git strategy %q, forward deployment %v and separated caches %v",
+			p.BuildGitStrategy, p.CIForwardDeploymentEnabled, p.CISeperateCache)
+	}
+
+	// Changes made in the GitLab UI since are reported as drift
+	previous := first.ProjectStates()
+	client.Projects.EditProject(10, &gitlab.EditProjectOptions{CISeperateCache: gitlab.Bool(true)})
+
+	second := newTestManager(client, cfg)
+	if err := second.UpdateProjectSettings(project, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	drift := second.DriftEntries(previous)
+	if len(drift) != 1 || drift[0].Setting != "ci_separated_caches" {
+		t.Errorf("Expected ci_separated_caches to drift, got %+v", drift)
+	}
+	entries, _ = second.ChangeLogEntries(false)
+	if len(entries) != 1 || entries[0].Setting != "ci_separated_caches" || fmt.Sprint(entries[0].To) != "false" {
+		t.Errorf("Expected ci_separated_caches to be planned back to false, got %+v", entries)
+	}
+}
+
+func TestUpdateProjectSettingsNeverRenames(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		client := newTestClient()
+		client.Projects.EditProject(10, &gitlab.EditProjectOptions{Name: gitlab.String("foo"), Path: gitlab.String("foo")})
+
+		// Built without the config validation, which rejects name and path
+		cfg := &config.Config{
+			Strict: strict,
+			ProjectSettings: &gitlab.EditProjectOptions{
+				Name:        gitlab.String("renamed"),
+				Path:        gitlab.String("renamed"),
+				WikiEnabled: gitlab.Bool(false),
+			},
+		}
+		manager := newTestManager(client, cfg)
+
+		if err := manager.UpdateProjectSettings(gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		p, _, _ := client.Projects.GetProject(10, nil)
+		if p.Name != "foo" || p.Path != "foo" || p.WikiEnabled {
+			t.Errorf("Expected only the wiki to be disabled, got name %q, path %q and wiki %v", p.Name, p.Path, p.WikiEnabled)
+		}
+		if *cfg.ProjectSettings.Name != "renamed" {
+			t.Errorf("Expected the config to be left untouched")
+		}
+		if manager.GetError() != strict {
+			t.Errorf("Expected the error flag to be %v in strict mode %v, got %v", strict, strict, manager.GetError())
+		}
+	}
+}
+
+func TestCommitTemplates(t *testing.T) {
+	const (
+		mergeTemplate  = "Merge branch '%{source_branch}' into '%{target_branch}'\n\n%{title}\n\nSee merge request %{reference}"
+		squashTemplate = "%{title} <%{url}> & \"co\"\n\n%{co_authored_by}"
+	)
+
+	cfg := &config.Config{GroupName: "example"}
+	raw := `{"project_settings": {
+		"merge_commit_template": "Merge branch '%{source_branch}' into '%{target_branch}'\n\n%{title}\n\nSee merge request %{reference}",
+		"squash_commit_template": "%{title} <%{url}> & \"co\"\n\n%{co_authored_by}"
+	}}`
+	if err := json.Unmarshal([]byte(raw), cfg); err != nil {
+		t.Fatalf("Expected config to parse, got %v", err)
+	}
+	if *cfg.ProjectSettings.MergeCommitTemplate != mergeTemplate || *cfg.ProjectSettings.SquashCommitTemplate != squashTemplate {
+		t.Fatalf("Expected templates to be read verbatim, got %q and %q",
+			*cfg.ProjectSettings.MergeCommitTemplate, *cfg.ProjectSettings.SquashCommitTemplate)
+	}
+
+	client := newTestClient()
+	manager := newTestManager(client, cfg)
+
+	settingsToChange, err := manager.convertEditProjectOptionsToProject(*cfg.ProjectSettings)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settingsToChange.MergeCommitTemplate != mergeTemplate || settingsToChange.SquashCommitTemplate != squashTemplate {
+		t.Fatalf("Expected templates to survive the conversion, got %q and %q",
+			settingsToChange.MergeCommitTemplate, settingsToChange.SquashCommitTemplate)
+	}
+
+	fields := configuredFields(cfg.ProjectSettings)
+	current := &gitlab.Project{ID: 10, Name: "foo", MergeCommitTemplate: "%{title}"}
+	if !manager.willChangeProjectSettings(current, &settingsToChange, fields) {
+		t.Errorf("Expected differing templates to be detected as drift")
+	}
+
+	current.MergeCommitTemplate = mergeTemplate
+	current.SquashCommitTemplate = squashTemplate
+	if manager.willChangeProjectSettings(current, &settingsToChange, fields) {
+		t.Errorf("Expected matching templates to be a no-op")
+	}
+
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+	if err := manager.UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	p, _, _ := client.Projects.GetProject(project.ID, nil)
+	if p.MergeCommitTemplate != mergeTemplate || p.SquashCommitTemplate != squashTemplate {
+		t.Errorf("Expected templates to be applied verbatim, got %q and %q", p.MergeCommitTemplate, p.SquashCommitTemplate)
+	}
+	if manager.willChangeProjectSettings(p, &settingsToChange, fields) {
+		t.Errorf("Expected no further change after applying the templates")
+	}
+}
+
+// editRecordingProjects records the options of the EditProject calls
+type editRecordingProjects struct {
+	*fake.ProjectsService
+	edits []*gitlab.EditProjectOptions
+}
+
+func (f *editRecordingProjects) EditProject(pid interface{}, opt *gitlab.EditProjectOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error) {
+	f.edits = append(f.edits, opt)
+	return f.ProjectsService.EditProject(pid, opt, options...)
+}
+
+func TestUpdateProjectSettingsNotReturnedFields(t *testing.T) {
+	tests := []struct {
+		name         string
+		settings     *gitlab.EditProjectOptions
+		expectedEdit bool
+	}{
+		{
+			name:     "alone",
+			settings: &gitlab.EditProjectOptions{OnlyAllowMergeIfAllStatusChecksPassed: gitlab.Bool(true)},
+		},
+		{
+			name:     "with a compliant setting",
+			settings: &gitlab.EditProjectOptions{OnlyAllowMergeIfAllStatusChecksPassed: gitlab.Bool(true), WikiEnabled: gitlab.Bool(true)},
+		},
+		{
+			name:         "with a changed setting",
+			settings:     &gitlab.EditProjectOptions{OnlyAllowMergeIfAllStatusChecksPassed: gitlab.Bool(true), WikiEnabled: gitlab.Bool(false)},
+			expectedEdit: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient()
+			manager := newTestManager(client, &config.Config{ProjectSettings: tt.settings})
+			recording := &editRecordingProjects{ProjectsService: client.Projects}
+			manager.projectsClient = recording
+
+			if err := manager.UpdateProjectSettings(gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}, false); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if !tt.expectedEdit {
+				if len(recording.edits) != 0 {
+					t.Errorf("Expected the setting not returned by the API to be no drift, got edits %+v", recording.edits)
+				}
+				if changed, _ := manager.HasChanges(); changed {
+					t.Errorf("Expected no changes to be recorded")
+				}
+				return
+			}
+			if len(recording.edits) != 1 || recording.edits[0].OnlyAllowMergeIfAllStatusChecksPassed == nil {
+				t.Errorf("Expected the setting not returned by the API to be applied with the change, got edits %+v", recording.edits)
+			}
+		})
+	}
+}
+
+func TestGenerateChangeLogReportListSettings(t *testing.T) {
+	approver := func(username string) *gitlab.MergeRequestApproverUser {
+		return &gitlab.MergeRequestApproverUser{User: &gitlab.BasicUser{Username: username}}
+	}
+
+	tests := []struct {
+		name     string
+		fullDiff bool
+		expected string
+	}{
+		{name: "set diff", fullDiff: false, expected: "approvers:              -[bob] +[carol]\n"},
+		{name: "full diff", fullDiff: true, expected: "approvers:              \"[alice bob]\" => \"[alice carol]\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(fake.NewClient(), &config.Config{})
+			out := &bytes.Buffer{}
+			manager.out = out
+
+			manager.ApprovalSettingsOriginal["example/foo"] = &gitlab.ProjectApprovals{
+				Approvers:            []*gitlab.MergeRequestApproverUser{approver("alice"), approver("bob")},
+				ApprovalsBeforeMerge: 1,
+			}
+			manager.ApprovalSettingsUpdated["example/foo"] = &gitlab.ProjectApprovals{
+				Approvers:            []*gitlab.MergeRequestApproverUser{approver("alice"), approver("carol")},
+				ApprovalsBeforeMerge: 2,
+			}
+
+			if err := manager.GenerateChangeLogReport(tt.fullDiff); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if !strings.Contains(out.String(), tt.expected) {
+				t.Errorf("Expected report to contain %q, got:\n%s", tt.expected, out.String())
+			}
+			if !strings.Contains(out.String(), "approvals_before_merge: \"1\" => \"2\"\n") {
+				t.Errorf("Expected report to contain the scalar change, got:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestComplianceEmailBody(t *testing.T) {
+	cfg := &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"project_settings": {"wiki_enabled": false, "description": "<b>owned</b>"},
+			},
+		},
+	}
+	manager := newTestManager(fake.NewClient(), cfg)
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: true, Description: "<b>owned</b>"}
+	manager.ProjectSettingsOriginal["example/sub/bar"] = &gitlab.Project{WikiEnabled: false, Description: "<b>owned</b>"}
+
+	_, body, err := manager.complianceEmail(manager.ComplianceResults(), manager.ComplianceScores())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if strings.Count(body, "<table") != 1 || strings.Count(body, "</table>") != 1 {
+		t.Errorf("Expected a single table for all projects, got:\n%s", body)
+	}
+	if strings.Count(body, "<tr") != strings.Count(body, "</tr>") {
+		t.Errorf("Expected all rows to be closed, got:\n%s", body)
+	}
+	if strings.Count(body, "PASS") != 3 || strings.Count(body, "FAIL") != 1 {
+		t.Errorf("Expected 3 passing and 1 failing setting, got:\n%s", body)
+	}
+	if !strings.Contains(body, "#ffeef0") || strings.Contains(body, "<b>owned</b>") {
+		t.Errorf("Expected colored rows and escaped values, got:\n%s", body)
+	}
+}
+
+// assertBalancedHTML fails the test if the start and end tags of the HTML don't match up
+func assertBalancedHTML(t *testing.T, body string) {
+	t.Helper()
+
+	var open []string
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if tokenizer.Err() != io.EOF {
+				t.Fatalf("failed to tokenize html: %v", tokenizer.Err())
+			}
+			if len(open) != 0 {
+				t.Errorf("Expected all tags to be closed, still open: %v", open)
+			}
+			return
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			open = append(open, string(name))
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if len(open) == 0 || open[len(open)-1] != string(name) {
+				t.Fatalf("Unexpected end tag </%s>, open tags: %v", name, open)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+}
+
+func TestComplianceEmailBalancedHTML(t *testing.T) {
+	cfg := &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"approval_settings": {"reset_approvals_on_push": true},
+				"project_settings":  {"wiki_enabled": false},
+			},
+		},
+	}
+	manager := newTestManager(fake.NewClient(), cfg)
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: true}
+	manager.ApprovalSettingsOriginal["example/foo"] = &gitlab.ProjectApprovals{ResetApprovalsOnPush: true}
+	manager.ProjectSettingsOriginal["example/sub/bar"] = &gitlab.Project{}
+	manager.ApprovalSettingsOriginal["example/sub/bar"] = nil
+
+	for _, results := range [][]ComplianceResult{manager.ComplianceResults(), nil} {
+		_, body, err := manager.complianceEmail(results, newComplianceScores(results))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertBalancedHTML(t, body)
+	}
+}
+
+func TestComplianceEmailTemplates(t *testing.T) {
+	cfg := &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"project_settings": {"wiki_enabled": false, "description": "<b>owned</b>"},
+			},
+		},
+	}
+	manager := newTestManager(fake.NewClient(), cfg)
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: true, Description: "<b>owned</b>"}
+
+	subject, body, err := manager.complianceEmail(manager.ComplianceResults(), manager.ComplianceScores())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if subject != "Compliance Report" || !strings.Contains(body, "<h2>Compliance Report</h2>") {
+		t.Errorf("Expected the built-in email without templates, got %q / %q", subject, body)
+	}
+
+	cfg.Compliance.Email.SubjectTemplate = "[ACME] {{.NonCompliant}}/{{.Total}} settings non-compliant"
+	cfg.Compliance.Email.BodyTemplate = `{{range .Projects}}<h3>{{.Name}}</h3>{{range .Subsections}}{{range .Settings}}` +
+		`<p>{{.Setting}}={{.Actual}}{{if not .Compliant}} expected {{.Expected}}{{end}}</p>{{end}}{{end}}{{end}}`
+
+	subject, body, err = manager.complianceEmail(manager.ComplianceResults(), manager.ComplianceScores())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if subject != "[ACME] 1/2 settings non-compliant" {
+		t.Errorf("Expected rendered subject, got %q", subject)
+	}
+
+	expected := "<h3>example/foo</h3><p>description=&lt;b&gt;owned&lt;/b&gt;</p><p>wiki_enabled=true expected false</p>"
+	if body != expected {
+		t.Errorf("Expected rendered and escaped body %q, got %q", expected, body)
+	}
+}
+
+func TestEnsureCodeOwnerApprovalPerBranch(t *testing.T) {
+	client := newTestClient()
+	manager := newTestManager(client, &config.Config{
+		ProtectedBranches: []config.ProtectedBranch{
+			{Name: "main", PushAccessLevel: "noone", MergeAccessLevel: config.AccessLevelMaintainer, CodeOwnerApprovalRequired: gitlab.Bool(true)},
+			{Name: "develop", PushAccessLevel: "noone", MergeAccessLevel: config.AccessLevelDeveloper, CodeOwnerApprovalRequired: gitlab.Bool(false)},
+		},
+	})
+
+	levels := func(level gitlab.AccessLevelValue) []*gitlab.BranchAccessDescription {
+		return []*gitlab.BranchAccessDescription{{AccessLevel: level}}
+	}
+	client.AddProtectedBranch(10, &gitlab.ProtectedBranch{
+		ID: 101, Name: "main", PushAccessLevels: levels(gitlab.NoPermissions), MergeAccessLevels: levels(gitlab.MaintainerPermissions),
+	})
+	client.AddProtectedBranch(10, &gitlab.ProtectedBranch{
+		ID: 102, Name: "develop", PushAccessLevels: levels(gitlab.NoPermissions), MergeAccessLevels: levels(gitlab.DeveloperPermissions),
+		CodeOwnerApprovalRequired: true,
+	})
+	// Reprotecting a branch would drop it from the protected_branch_ids of the rule
+	client.AddApprovalRule(10, &gitlab.ProjectApprovalRule{
+		Name: "code review", ApprovalsRequired: 1,
+		ProtectedBranches: []*gitlab.ProtectedBranch{{ID: 101, Name: "main"}, {ID: 102, Name: "develop"}},
+	})
+
+	if err := manager.EnsureBranchesAndProtection(gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for name, expected := range map[string]struct {
+		id        int
+		codeOwner bool
+	}{"main": {101, true}, "develop": {102, false}} {
+		b, _, err := client.ProtectedBranches.GetProtectedBranch(10, name)
+		if err != nil {
+			t.Fatalf("Expected %s to stay protected, got %v", name, err)
+		}
+		if b.CodeOwnerApprovalRequired != expected.codeOwner {
+			t.Errorf("Expected code owner approval of %s to be %v, got %v", name, expected.codeOwner, b.CodeOwnerApprovalRequired)
+		}
+		if b.ID != expected.id {
+			t.Errorf("Expected %s to be updated in place as protected branch %d, got %d", name, expected.id, b.ID)
+		}
+	}
+
+	rules, _, _ := client.Projects.GetProjectApprovalRules(10, nil)
+	if len(rules) != 1 {
+		t.Fatalf("Expected the approval rule to be kept, got %+v", rules)
+	}
+	var ids []int
+	for _, b := range rules[0].ProtectedBranches {
+		ids = append(ids, b.ID)
+	}
+	sort.Ints(ids)
+	if !reflect.DeepEqual(ids, []int{101, 102}) {
+		t.Errorf("Expected the approval rule to stay scoped to protected branches [101 102], got %v", ids)
+	}
+}
+
+func TestEnsureProtectedBranchPatterns(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{"protected_branch_patterns": [
+		{"pattern": "release/.*", "push_access_level": "noone", "merge_access_level": "maintainer"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	client := newTestClient()
+	// More branches than fit on a page
+	for i := 0; i < 25; i++ {
+		client.AddBranch(10, fmt.Sprintf("feature/%02d", i))
+	}
+	client.AddBranch(10, "release/1.0")
+	client.AddBranch(10, "release/2.0")
+	client.AddBranch(10, "hotfix/release/3.0")
+	manager := newTestManager(client, cfg)
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	if err := manager.EnsureBranchesAndProtection(project, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, _, err := client.ProtectedBranches.GetProtectedBranch(10, "release/1.0"); err == nil {
+		t.Errorf("Expected a dryrun to protect no branches")
+	}
+
+	if err := manager.EnsureBranchesAndProtection(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for branch, expected := range map[string]bool{"release/1.0": true, "release/2.0": true, "hotfix/release/3.0": false, "feature/00": false} {
+		protected, _, err := client.ProtectedBranches.GetProtectedBranch(10, branch)
+		if (err == nil) != expected {
+			t.Errorf("Expected branch %s to be protected: %v, got %v", branch, expected, err == nil)
+			continue
+		}
+		if expected && !compareAccessLevels(protected.PushAccessLevels, "noone") {
+			t.Errorf("Expected branch %s to be protected with the pattern's levels, got %+v", branch, protected)
+		}
+	}
+}
+
+func TestEnsureWildcardProtectionExceptions(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"protected_branches": [{"name": "*", "push_access_level": "maintainer", "merge_access_level": "maintainer", "unprotected_exceptions": ["feature/*"]}],
+		"protected_branch_patterns": [{"pattern": ".*/.*", "push_access_level": "noone", "merge_access_level": "maintainer"}]
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	client := newTestClient()
+	client.AddBranch(10, "feature/login")
+	client.AddBranch(10, "release/1.0")
+	manager := newTestManager(client, cfg)
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	if err := manager.EnsureBranchesAndProtection(project, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, _, err := client.ProtectedBranches.GetProtectedBranch(10, "*"); err == nil {
+		t.Errorf("Expected a dryrun to protect no branches")
+	}
+
+	if err := manager.EnsureBranchesAndProtection(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	wildcard, _, err := client.ProtectedBranches.GetProtectedBranch(10, "*")
+	if err != nil || !compareAccessLevels(wildcard.PushAccessLevels, config.AccessLevelMaintainer) {
+		t.Fatalf("Expected * to be protected for maintainers, got %+v, %v", wildcard, err)
+	}
+	exception, _, err := client.ProtectedBranches.GetProtectedBranch(10, "feature/*")
+	if err != nil || !exception.AllowForcePush || !compareAccessLevels(exception.PushAccessLevels, config.AccessLevelDeveloper) {
+		t.Errorf("Expected feature/* to be exempt for developers, got %+v, %v", exception, err)
+	}
+	if _, _, err := client.ProtectedBranches.GetProtectedBranch(10, "feature/login"); err == nil {
+		t.Errorf("Expected the exception to be skipped by protected branch patterns")
+	}
+	if _, _, err := client.ProtectedBranches.GetProtectedBranch(10, "release/1.0"); err != nil {
+		t.Errorf("Expected other branches to be protected by patterns, got %v", err)
+	}
+
+	// A user granted access in addition, e.g. in the GitLab UI, must not recreate the protections
+	wildcard.PushAccessLevels = append(wildcard.PushAccessLevels, &gitlab.BranchAccessDescription{AccessLevel: gitlab.DeveloperPermissions, UserID: 7})
+	if _, err := client.ProtectedBranches.UnprotectRepositoryBranches(10, "*"); err != nil {
+		t.Fatal(err)
+	}
+	client.AddProtectedBranch(10, wildcard)
+
+	if err := manager.EnsureBranchesAndProtection(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for name, id := range map[string]int{"*": wildcard.ID, "feature/*": exception.ID} {
+		if b, _, err := client.ProtectedBranches.GetProtectedBranch(10, name); err != nil || b.ID != id {
+			t.Errorf("Expected protection %s to be kept, got %+v, %v", name, b, err)
+		}
+	}
+}
+
+func TestMaxErrorsReached(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{})
+
+	manager.SetError(true)
+	manager.SetError(true)
+
+	if manager.ErrorCount() != 2 {
+		t.Errorf("Expected 2 errors to be counted, got %d", manager.ErrorCount())
+	}
+	if manager.MaxErrorsReached(0) {
+		t.Errorf("Expected a maximum of 0 to be unlimited")
+	}
+	if manager.MaxErrorsReached(3) || !manager.MaxErrorsReached(2) {
+		t.Errorf("Expected the maximum to be reached at 2 errors")
+	}
+}
+
+// failingProtectedBranches fails to return protected branches with a server error
+type failingProtectedBranches struct {
+	*fake.ProtectedBranchesService
+}
+
+func (f failingProtectedBranches) GetProtectedBranch(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch, *gitlab.Response, error) {
+	resp := &gitlab.Response{Response: &http.Response{StatusCode: http.StatusInternalServerError}}
+	return nil, resp, errors.New("500 Internal Server Error")
+}
+
+func TestEnsureBranchesAndProtectionStrict(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		client := newTestClient()
+		cfg := &config.Config{
+			Strict: strict,
+			ProtectedBranches: []config.ProtectedBranch{
+				{Name: "master", PushAccessLevel: config.AccessLevelMaintainer, MergeAccessLevel: config.AccessLevelDeveloper},
+			},
+		}
+		manager := newTestManager(client, cfg)
+		manager.protectedBranchesClient = failingProtectedBranches{client.ProtectedBranches}
+
+		if err := manager.EnsureBranchesAndProtection(gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}, true); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if manager.GetError() != strict {
+			t.Errorf("Expected the error flag to be %v in strict mode %v, got %v", strict, strict, manager.GetError())
+		}
+	}
+}
+
+func TestEnsureTagsProtectionAllowedToCreate(t *testing.T) {
+	client := newTestClient()
+	manager := newTestManager(client, &config.Config{
+		ProtectedTags: []config.ProtectedTag{{
+			Name:              "v*",
+			CreateAccessLevel: "noone",
+			AllowedToCreate:   []config.TagPermission{{UserID: 42}},
+		}},
+	})
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	if err := manager.EnsureTagsProtection(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tag, _, err := client.ProtectedTags.GetProtectedTag(10, "v*")
+	if err != nil {
+		t.Fatalf("Expected v* to be protected, got %v", err)
+	}
+	if !tagPermissionsMatch(tag.CreateAccessLevels, manager.config.ProtectedTags[0]) {
+		t.Errorf("Expected creation restricted to user 42, got %+v", tag.CreateAccessLevels)
+	}
+
+	// A matching protection is kept as is
+	client.AddProtectedTag(10, &gitlab.ProtectedTag{Name: "v*", CreateAccessLevels: []*gitlab.TagAccessDescription{
+		{ID: 1, AccessLevel: gitlab.NoPermissions},
+		{ID: 2, UserID: 42, AccessLevel: gitlab.MaintainerPermissions},
+	}})
+	if err := manager.EnsureTagsProtection(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	tag, _, _ = client.ProtectedTags.GetProtectedTag(10, "v*")
+	if tag.CreateAccessLevels[0].ID != 1 {
+		t.Errorf("Expected matching protection not to be recreated, got %+v", tag.CreateAccessLevels)
+	}
+
+	// Grants to other users are drift
+	other := config.ProtectedTag{Name: "v*", CreateAccessLevel: "noone", AllowedToCreate: []config.TagPermission{{UserID: 43}}}
+	if tagPermissionsMatch(tag.CreateAccessLevels, other) {
+		t.Errorf("Expected a grant to another user not to match")
+	}
+}
+
+func TestGenerateComplianceReportUnavailableSettings(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"approval_settings": {"reset_approvals_on_push": true},
+				"project_settings":  {"wiki_enabled": false},
+			},
+		},
+	})
+	out := &bytes.Buffer{}
+	manager.out = out
+
+	// example/bar could not be fetched at all
+	manager.ApprovalSettingsOriginal["example/bar"] = nil
+	manager.ProjectSettingsOriginal["example/bar"] = nil
+	manager.ApprovalSettingsOriginal["example/foo"] = &gitlab.ProjectApprovals{ResetApprovalsOnPush: true}
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{WikiEnabled: false}
+
+	if err := manager.GenerateComplianceReport(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	report := out.String()
+	if !strings.Contains(report, "    approval_settings: settings unavailable\n    project_settings: settings unavailable\n") {
+		t.Errorf("Expected example/bar to be reported as unavailable, got:\n%s", report)
+	}
+	if !strings.Contains(report, "wiki_enabled:") || !strings.Contains(report, "reset_approvals_on_push:") {
+		t.Errorf("Expected example/foo to be reported, got:\n%s", report)
+	}
+
+	for _, result := range manager.ComplianceResults() {
+		if result.Project == "example/bar" && (!result.Unavailable || result.Compliant) {
+			t.Errorf("Expected unavailable non-compliant result for example/bar, got %+v", result)
+		}
+		if result.Project == "example/foo" && !result.Compliant {
+			t.Errorf("Expected compliant result for example/foo, got %+v", result)
+		}
+	}
+}
+
+func TestEnsureMetadata(t *testing.T) {
+	avatar := filepath.Join(t.TempDir(), "logo.png")
+	if err := ioutil.WriteFile(avatar, []byte("\x89PNG"), 0600); err != nil {
+		t.Fatalf("failed to write avatar: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		description *config.DescriptionSettings
+		current     string
+		expected    string
+	}{
+		{
+			name:        "non_empty sets blank description",
+			description: &config.DescriptionSettings{Mode: config.DescriptionModeNonEmpty, Value: "Please describe me"},
+			current:     " ",
+			expected:    "Please describe me",
+		},
+		{
+			name:        "non_empty keeps custom description",
+			description: &config.DescriptionSettings{Mode: config.DescriptionModeNonEmpty, Value: "Please describe me"},
+			current:     "Our billing service",
+			expected:    "Our billing service",
+		},
+		{
+			name:        "exact overwrites custom description",
+			description: &config.DescriptionSettings{Mode: config.DescriptionModeExact, Value: "Managed by platform"},
+			current:     "Our billing service",
+			expected:    "Managed by platform",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient()
+			project, _, _ := client.Projects.GetProject(10, nil)
+			_, _, _ = client.Projects.EditProject(10, &gitlab.EditProjectOptions{Description: gitlab.String(tt.current)})
+
+			manager := newTestManager(client, &config.Config{
+				Metadata: &config.MetadataSettings{Description: tt.description, Avatar: avatar},
+			})
+			out := &bytes.Buffer{}
+			manager.out = out
+
+			if err := manager.EnsureMetadata(*project, false); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			p, _, _ := client.Projects.GetProject(10, nil)
+			if p.Description != tt.expected {
+				t.Errorf("Expected description %q, got %q", tt.expected, p.Description)
+			}
+			if !strings.HasSuffix(p.AvatarURL, "/logo.png") {
+				t.Errorf("Expected avatar to be uploaded, got %q", p.AvatarURL)
+			}
+
+			if err := manager.GenerateChangeLogReport(false); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.current != tt.expected && !strings.Contains(out.String(), tt.expected) {
+				t.Errorf("Expected description change in the change log, got:\n%s", out.String())
+			}
+
+			// A second run must not change anything
+			manager = newTestManager(client, manager.config)
+			if err := manager.EnsureMetadata(*project, false); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if original, updated := manager.ProjectSettingsOriginal["example/foo"], manager.ProjectSettingsUpdated["example/foo"]; original.Description != updated.Description ||
+				original.AvatarURL != updated.AvatarURL {
+				t.Errorf("Expected no change on the second run, got %+v => %+v", original, updated)
+			}
+		})
+	}
+}
+
+func TestEnsureMetadataDescriptionTemplate(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"group_name": "example",
+		"metadata": {"description": {"mode": "exact", "value": "Service owned by {{.Team}}"}}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	client := newTestClient()
+	_, _, _ = client.Projects.EditProject(10, &gitlab.EditProjectOptions{
+		Description: gitlab.String("Our billing service"),
+		Topics:      &[]string{"go", "team:payments"},
+	})
+	_, _, _ = client.Projects.EditProject(11, &gitlab.EditProjectOptions{Description: gitlab.String("Our ledger")})
+
+	logger, hook := test.NewNullLogger()
+	manager := newTestManager(client, cfg)
+	manager.logger = logrus.NewEntry(logger)
+	for _, pid := range []int{10, 11} {
+		project, _, _ := client.Projects.GetProject(pid, nil)
+		if err := manager.EnsureMetadata(*project, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	foo, _, _ := client.Projects.GetProject(10, nil)
+	if foo.Description != "Service owned by payments" {
+		t.Errorf("Expected the rendered description, got %q", foo.Description)
+	}
+	bar, _, _ := client.Projects.GetProject(11, nil)
+	if bar.Description != "Our ledger" {
+		t.Errorf("Expected the project without team topic to keep its description, got %q", bar.Description)
+	}
+	if last := hook.LastEntry(); last == nil || last.Level != logrus.WarnLevel || !strings.Contains(last.Message, "Skipping the description of project example/sub/bar") {
+		t.Errorf("Expected a warning about the project without team topic, got %v", last)
+	}
+
+	// Once rendered, the description is left untouched
+	second := newTestManager(client, cfg)
+	if err := second.EnsureMetadata(*foo, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if changes, err := second.HasChanges(); err != nil || changes {
+		t.Errorf("Expected no changes on the second run, got %v (%v)", changes, err)
+	}
+}
+
+func TestComplianceResultsApprovalSettingsOnly(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"approval_settings": {"reset_approvals_on_push": true},
+			},
+		},
+	})
+	// Without mandatory project settings only the approval settings are fetched
+	manager.ApprovalSettingsOriginal["example/foo"] = &gitlab.ProjectApprovals{ResetApprovalsOnPush: true}
+	manager.ApprovalSettingsOriginal["example/bar"] = &gitlab.ProjectApprovals{}
+
+	results := manager.ComplianceResults()
+	if len(results) != 2 {
+		t.Fatalf("Expected a result per project, got %+v", results)
+	}
+	if results[0].Project != "example/bar" || results[0].Compliant || results[1].Project != "example/foo" || !results[1].Compliant {
+		t.Errorf("Expected example/bar to fail and example/foo to pass, got %+v", results)
+	}
+}
+
+func TestComplianceResultsJSONKeys(t *testing.T) {
+	manager := newTestManager(fake.NewClient(), &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"project_settings": {
+					"ci_config_path": ".gitlab-ci.yml@group/ci-templates",
+					"id":             42,
+					"web_url":        "https://gitlab.example.com/example/foo",
+				},
+			},
+		},
+	})
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{
+		ID:           42,
+		CIConfigPath: ".gitlab-ci.yml@group/ci-templates",
+		WebURL:       "https://gitlab.example.com/example/foo",
+	}
+
+	results := manager.ComplianceResults()
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.Actual == "NOT VALID SETTING" || !result.Compliant {
+			t.Errorf("Expected %s to resolve and be compliant, got %+v", result.Setting, result)
+		}
+	}
+}
+
+func TestUpdateProjectSettingsMergeSettings(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"project_settings": {
+			"merge_method": "ff",
+			"squash_option": "default_on",
+			"only_allow_merge_if_pipeline_succeeds": true,
+			"allow_merge_on_skipped_pipeline": true
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	client := newTestClient()
+	client.Projects.EditProject(10, &gitlab.EditProjectOptions{
+		MergeMethod:  gitlab.MergeMethod(gitlab.NoFastForwardMerge),
+		SquashOption: gitlab.SquashOption(gitlab.SquashOptionNever),
+	})
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+	first := newTestManager(client, cfg)
+	if err := first.UpdateProjectSettings(project, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Enums are listed by their names
+	entries, err := first.ChangeLogEntries(false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	changes := make(map[string]string)
+	for _, entry := range entries {
+		changes[entry.Setting] = fmt.Sprintf("%v -> %v", entry.From, entry.To)
+	}
+	expected := map[string]string{
+		"merge_method":                          "merge -> ff",
+		"squash_option":                         "never -> default_on",
+		"only_allow_merge_if_pipeline_succeeds": "false -> true",
+		"allow_merge_on_skipped_pipeline":       "false -> true",
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, got %v", expected, changes)
+	}
+
+	second := newTestManager(client, cfg)
+	if err := second.UpdateProjectSettings(project, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if changes, _ := second.HasChanges(); changes {
+		t.Errorf("Expected no changes once the settings are applied")
+	}
+}
@@ -0,0 +1,224 @@
+package gitlab
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// EnsureProjectVariables ensures the CI/CD variables configured in project_ci_variables on the
+// project. Variables are matched by key and created or updated as needed. It warns about
+//   - variables an ancestor group already provides identically, which are not created in the
+//     project, as the project inherits them
+//   - protected variables of projects without protected branches, as GitLab only exposes
+//     protected variables to pipelines of protected branches and tags
+func (m *ProjectManager) EnsureProjectVariables(project gitlab.Project, dryrun bool) error {
+	if m.config.ProjectCIVariables == nil {
+		return nil
+	}
+
+	existing, err := m.listProjectVariables(project)
+	if err != nil {
+		return err
+	}
+
+	hasProtectedBranches := false
+	for _, v := range m.config.ProjectCIVariables.Variables {
+		if v.Protected {
+			branches, _, err := m.protectedBranchesClient.ListProtectedBranches(project.ID, &gitlab.ListProtectedBranchesOptions{ListOptions: gitlab.ListOptions{PerPage: 1}}, m.withContext())
+			if err != nil {
+				return fmt.Errorf("failed to list protected branches of project %s: %v", project.PathWithNamespace, err)
+			}
+			hasProtectedBranches = len(branches) > 0
+			break
+		}
+	}
+
+	for _, v := range m.config.ProjectCIVariables.Variables {
+		if existing[v.Key] == nil {
+			group, err := m.inheritingGroup(project, v)
+			if err != nil {
+				return err
+			}
+			if group != "" {
+				m.logger.Infof("Variable %s of project %s is inherited from group %s with the same settings, skipping it.", v.Key, project.PathWithNamespace, group)
+				continue
+			}
+		}
+
+		if v.Protected && !hasProtectedBranches {
+			m.warnf("Variable %s of project %s is protected, but the project has no protected branch whose pipelines could use it.", v.Key, project.PathWithNamespace)
+		}
+
+		if err := m.ensureProjectVariable(project, v, existing[v.Key], dryrun); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureProjectVariable creates or updates the variable of the project
+func (m *ProjectManager) ensureProjectVariable(project gitlab.Project, v config.CIVariable, existing *gitlab.ProjectVariable, dryrun bool) error {
+	path := project.PathWithNamespace
+	current := &GroupVariableSettings{}
+	if existing != nil {
+		current = projectVariableSettings(existing)
+	}
+	recordVariable(m.ProjectVariablesOriginal, path, v.Key, current)
+
+	if existing != nil && projectCIVariable(existing) == v {
+		m.logger.Debugf("Variable %s of project %s is up to date.", v.Key, path)
+		recordVariable(m.ProjectVariablesUpdated, path, v.Key, current)
+		return nil
+	}
+
+	desired := &GroupVariableSettings{
+		Exists:           true,
+		Value:            v.Value,
+		VariableType:     v.VariableType,
+		Protected:        v.Protected,
+		Masked:           v.Masked,
+		Raw:              v.Raw,
+		EnvironmentScope: v.EnvironmentScope,
+	}
+	if v.Masked {
+		desired.Value = maskedValue
+		if existing != nil && existing.Value != v.Value {
+			desired.Value = maskedValueChanged
+		}
+	}
+
+	if dryrun {
+		if existing == nil {
+			m.skipAPICall("CreateVariable", "for %s.", v.Key)
+		} else {
+			m.skipAPICall("UpdateVariable", "for %s.", v.Key)
+		}
+		recordVariable(m.ProjectVariablesUpdated, path, v.Key, desired)
+		return nil
+	}
+
+	variableType := gitlab.VariableTypeValue(v.VariableType)
+	if existing == nil {
+		opt := &gitlab.CreateProjectVariableOptions{
+			Key:              gitlab.String(v.Key),
+			Value:            gitlab.String(v.Value),
+			VariableType:     &variableType,
+			Protected:        gitlab.Bool(v.Protected),
+			Masked:           gitlab.Bool(v.Masked),
+			Raw:              gitlab.Bool(v.Raw),
+			EnvironmentScope: gitlab.String(v.EnvironmentScope),
+		}
+		if _, _, err := m.projectVariablesClient.CreateVariable(project.ID, opt, m.withContext()); err != nil {
+			return fmt.Errorf("failed to create variable %s of project %s: %v", v.Key, path, err)
+		}
+		m.logger.Infof("Created variable %s of project %s.", v.Key, path)
+	} else {
+		opt := &gitlab.UpdateProjectVariableOptions{
+			Value:            gitlab.String(v.Value),
+			VariableType:     &variableType,
+			Protected:        gitlab.Bool(v.Protected),
+			Masked:           gitlab.Bool(v.Masked),
+			Raw:              gitlab.Bool(v.Raw),
+			EnvironmentScope: gitlab.String(v.EnvironmentScope),
+		}
+		if _, _, err := m.projectVariablesClient.UpdateVariable(project.ID, v.Key, opt, m.withContext()); err != nil {
+			return fmt.Errorf("failed to update variable %s of project %s: %v", v.Key, path, err)
+		}
+		m.logger.Infof("Updated variable %s of project %s.", v.Key, path)
+	}
+
+	recordVariable(m.ProjectVariablesUpdated, path, v.Key, desired)
+
+	return nil
+}
+
+// inheritingGroup returns the nearest ancestor group of the project which provides the
+// variable with the same settings, empty if none does. The variables of each group are only
+// fetched once per run. Personal projects belong to a user, so they inherit no variables.
+func (m *ProjectManager) inheritingGroup(project gitlab.Project, v config.CIVariable) (string, error) {
+	if project.Namespace != nil && project.Namespace.Kind == "user" {
+		return "", nil
+	}
+
+	groups := strings.Split(project.PathWithNamespace, "/")
+	for i := len(groups) - 1; i > 0; i-- {
+		group := strings.Join(groups[:i], "/")
+
+		variables, ok := m.inheritedVariables[group]
+		if !ok {
+			var err error
+			if variables, err = m.listGroupVariables(group); err != nil {
+				return "", err
+			}
+			if m.inheritedVariables == nil {
+				m.inheritedVariables = make(map[string]map[string]*gitlab.GroupVariable)
+			}
+			m.inheritedVariables[group] = variables
+		}
+
+		if inherited := variables[v.Key]; inherited != nil && groupCIVariable(inherited) == v {
+			return group, nil
+		}
+	}
+
+	return "", nil
+}
+
+// listProjectVariables returns all variables of the project by key
+func (m *ProjectManager) listProjectVariables(project gitlab.Project) (map[string]*gitlab.ProjectVariable, error) {
+	variables := make(map[string]*gitlab.ProjectVariable)
+
+	opt := &gitlab.ListProjectVariablesOptions{PerPage: 100}
+	for {
+		page, resp, err := m.projectVariablesClient.ListVariables(project.ID, opt, m.withContext())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list variables of project %s: %v", project.PathWithNamespace, err)
+		}
+		for _, v := range page {
+			variables[v.Key] = v
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return variables, nil
+}
+
+// projectCIVariable returns the existing variable of the project as configured
+func projectCIVariable(v *gitlab.ProjectVariable) config.CIVariable {
+	return config.CIVariable{
+		Key:              v.Key,
+		Value:            v.Value,
+		VariableType:     string(v.VariableType),
+		Protected:        v.Protected,
+		Masked:           v.Masked,
+		Raw:              v.Raw,
+		EnvironmentScope: v.EnvironmentScope,
+	}
+}
+
+// projectVariableSettings returns the recorded state of the existing variable
+func projectVariableSettings(v *gitlab.ProjectVariable) *GroupVariableSettings {
+	settings := &GroupVariableSettings{
+		Exists:           true,
+		Value:            v.Value,
+		VariableType:     string(v.VariableType),
+		Protected:        v.Protected,
+		Masked:           v.Masked,
+		Raw:              v.Raw,
+		EnvironmentScope: v.EnvironmentScope,
+	}
+	if v.Masked {
+		settings.Value = maskedValue
+	}
+
+	return settings
+}
@@ -0,0 +1,149 @@
+package gitlab
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestEnsureProjectVariables(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"group_name": "example",
+		"project_ci_variables": {
+			"variables": [
+				{"key": "DEPLOY_TOKEN", "value": "s3cr3t", "masked": true, "protected": true},
+				{"key": "REGISTRY", "value": "registry.example.com"},
+				{"key": "LINT", "value": "strict"}
+			]
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, dryrun := range []bool{true, false} {
+		client := newTestClient()
+		// The parent group provides REGISTRY identically, the root group LINT differently
+		client.AddGroupVariable(2, &gitlab.GroupVariable{Key: "REGISTRY", Value: "registry.example.com", VariableType: gitlab.EnvVariableType, EnvironmentScope: "*"})
+		client.AddGroupVariable(1, &gitlab.GroupVariable{Key: "LINT", Value: "relaxed", VariableType: gitlab.EnvVariableType, EnvironmentScope: "*"})
+		client.AddProjectVariable(11, &gitlab.ProjectVariable{Key: "DEPLOY_TOKEN", Value: "old", VariableType: gitlab.EnvVariableType, EnvironmentScope: "*"})
+		project, _, _ := client.Projects.GetProject(11, nil)
+
+		logger, hook := test.NewNullLogger()
+		manager := newTestManager(client, cfg)
+		manager.logger = logrus.NewEntry(logger)
+		if err := manager.EnsureProjectVariables(*project, dryrun); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var warnings, infos []string
+		for _, entry := range hook.AllEntries() {
+			switch entry.Level {
+			case logrus.WarnLevel:
+				warnings = append(warnings, entry.Message)
+			case logrus.InfoLevel:
+				infos = append(infos, entry.Message)
+			}
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "DEPLOY_TOKEN of project example/sub/bar is protected, but the project has no protected branch") {
+			t.Errorf("Expected a warning about the protected variable (dryrun %v), got %v", dryrun, warnings)
+		}
+		if !strings.Contains(strings.Join(infos, "\n"), "REGISTRY of project example/sub/bar is inherited from group example/sub") {
+			t.Errorf("Expected the inherited variable to be logged (dryrun %v), got %v", dryrun, infos)
+		}
+
+		entries, err := manager.ChangeLogEntries(false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		changed := make(map[string]interface{})
+		for _, e := range entries {
+			if strings.Contains(fmt.Sprint(e.From, e.To), "s3cr3t") {
+				t.Errorf("Expected the masked value to be redacted, got %+v", e)
+			}
+			changed[e.Subsection+"."+e.Setting] = e.To
+		}
+		if changed["project_ci_variables[DEPLOY_TOKEN].value"] != maskedValueChanged || changed["project_ci_variables[DEPLOY_TOKEN].protected"] != true {
+			t.Errorf("Expected DEPLOY_TOKEN to be updated with a redacted value (dryrun %v), got %v", dryrun, changed)
+		}
+		if changed["project_ci_variables[LINT].exists"] != true {
+			t.Errorf("Expected LINT to be created, overriding the group variable (dryrun %v), got %v", dryrun, changed)
+		}
+		if _, ok := changed["project_ci_variables[REGISTRY].exists"]; ok {
+			t.Errorf("Expected the inherited REGISTRY not to be created (dryrun %v), got %v", dryrun, changed)
+		}
+
+		variables, _, _ := client.ProjectVariables.ListVariables(11, nil)
+		values := make(map[string]string)
+		for _, v := range variables {
+			values[v.Key] = v.Value
+		}
+		if dryrun {
+			if len(values) != 1 || values["DEPLOY_TOKEN"] != "old" {
+				t.Errorf("Expected a dryrun to leave the variables untouched, got %v", values)
+			}
+			continue
+		}
+		if len(values) != 2 || values["DEPLOY_TOKEN"] != "s3cr3t" || values["LINT"] != "strict" {
+			t.Errorf("Expected the variables not provided by the groups, got %v", values)
+		}
+
+		// A second run has nothing left to do, and with a protected branch no protected warning
+		if _, _, err := client.ProtectedBranches.ProtectRepositoryBranches(11, &gitlab.ProtectRepositoryBranchesOptions{Name: gitlab.String("master")}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		hook.Reset()
+		second := newTestManager(client, cfg)
+		second.logger = logrus.NewEntry(logger)
+		if err := second.EnsureProjectVariables(*project, false); err != nil {
+			t.Fatalf("Expected no error on the second run, got %v", err)
+		}
+		if changes, err := second.HasChanges(); err != nil || changes {
+			t.Errorf("Expected no changes on the second run, got %v (%v)", changes, err)
+		}
+		for _, entry := range hook.AllEntries() {
+			if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "protected") {
+				t.Errorf("Expected no warning about protected variables, got %s", entry.Message)
+			}
+		}
+	}
+}
+
+func TestEnsureProjectVariablesPersonalProject(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"group_name": "example",
+		"strict": true,
+		"project_ci_variables": {"variables": [{"key": "REGISTRY", "value": "registry.example.com"}]}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	client := newTestClient()
+	client.AddProject(&gitlab.Project{
+		ID:                20,
+		PathWithNamespace: "alice/tool",
+		DefaultBranch:     "main",
+		Namespace:         &gitlab.ProjectNamespace{ID: 100, Kind: "user", Path: "alice"},
+	})
+	project, _, _ := client.Projects.GetProject(20, nil)
+
+	manager := newTestManager(client, cfg)
+	if err := manager.EnsureProjectVariables(*project, false); err != nil {
+		t.Fatalf("Expected the user namespace not to be looked up as group, got %v", err)
+	}
+	if manager.GetError() {
+		t.Errorf("Expected no error to be reported")
+	}
+
+	variables, _, _ := client.ProjectVariables.ListVariables(20, nil)
+	if len(variables) != 1 || variables[0].Key != "REGISTRY" {
+		t.Errorf("Expected REGISTRY to be created, got %+v", variables)
+	}
+}
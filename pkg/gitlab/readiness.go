@@ -0,0 +1,43 @@
+package gitlab
+
+import (
+	"fmt"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// notReadyReason returns why the project can't be synced yet, or an empty string if it can
+func notReadyReason(project gitlab.Project) string {
+	switch project.ImportStatus {
+	case "", "none", "finished":
+	case "failed":
+		return "its import failed"
+	default:
+		return fmt.Sprintf("it is still being imported (import status %s)", project.ImportStatus)
+	}
+
+	if project.EmptyRepo {
+		return "its repository is empty"
+	}
+
+	return ""
+}
+
+// CheckProjectReady reports whether the project can be synced. Projects which are still
+// being imported or have an empty repository are skipped with a warning, or reported as
+// error with not_ready_projects set to error.
+func (m *ProjectManager) CheckProjectReady(project gitlab.Project) (bool, error) {
+	reason := notReadyReason(project)
+	if reason == "" {
+		return true, nil
+	}
+
+	if m.config.NotReadyProjects == config.NotReadyProjectsError {
+		return false, fmt.Errorf("project %s is not ready as %s", project.PathWithNamespace, reason)
+	}
+
+	m.warn(project.PathWithNamespace, "Skipping repo %s as %s.", project.PathWithNamespace, reason)
+	return false, nil
+}
@@ -0,0 +1,65 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestCheckProjectReady(t *testing.T) {
+	// baz has just been created without any commit, so there is no branch to protect
+	client := newTestClient()
+	client.AddProject(&gitlab.Project{ID: 12, PathWithNamespace: "example/baz", EmptyRepo: true, Namespace: &gitlab.ProjectNamespace{ID: 1}})
+	client.AddProject(&gitlab.Project{ID: 13, PathWithNamespace: "example/qux", ImportStatus: "started", Namespace: &gitlab.ProjectNamespace{ID: 1}})
+
+	tests := []struct {
+		notReadyProjects string
+		wantErr          bool
+	}{
+		{notReadyProjects: config.NotReadyProjectsSkip},
+		{notReadyProjects: config.NotReadyProjectsError, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.notReadyProjects, func(t *testing.T) {
+			manager := newTestManager(client, &config.Config{GroupName: "example", IncludeSubgroups: true, NotReadyProjects: tt.notReadyProjects})
+			logger, hook := test.NewNullLogger()
+			manager.logger = logrus.NewEntry(logger)
+
+			projects, err := manager.GetProjects()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var ready []string
+			for _, project := range projects {
+				ok, err := manager.CheckProjectReady(project)
+				if ok {
+					ready = append(ready, project.PathWithNamespace)
+					continue
+				}
+				if tt.wantErr != (err != nil) {
+					t.Errorf("Expected an error %v for %s, got %v", tt.wantErr, project.PathWithNamespace, err)
+				}
+			}
+
+			if len(ready) != 2 || ready[0] != "example/foo" || ready[1] != "example/sub/bar" {
+				t.Errorf("Expected only foo and bar to be ready, got %v", ready)
+			}
+
+			var warnings int
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel {
+					warnings++
+				}
+			}
+			if expected := map[bool]int{false: 2, true: 0}[tt.wantErr]; warnings != expected {
+				t.Errorf("Expected %d warnings, got %d", expected, warnings)
+			}
+		})
+	}
+}
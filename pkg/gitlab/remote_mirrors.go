@@ -0,0 +1,184 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/r3labs/diff"
+	"github.com/xanzy/go-gitlab"
+)
+
+// RemoteMirrorSettings is the recorded state of a remote mirror
+type RemoteMirrorSettings struct {
+	OnlyProtectedBranches     bool   `json:"only_protected_branches"`
+	MirrorBranchRegex         string `json:"mirror_branch_regex"`
+	OverwriteDivergedBranches bool   `json:"overwrite_diverged_branches"`
+}
+
+// remoteMirrorDiff holds the changes of the remote mirrors with the same URL
+type remoteMirrorDiff struct {
+	url      string
+	difflog  diff.Changelog
+	original map[string]*RemoteMirrorSettings
+	updated  map[string]*RemoteMirrorSettings
+}
+
+// EnsureRemoteMirrors applies the configured options to the existing remote mirrors of the
+// project. Mirrors are neither created nor removed. Their URLs are only logged and reported
+// without credentials.
+func (m *ProjectManager) EnsureRemoteMirrors(project gitlab.Project, dryrun bool) error {
+	if m.config.RemoteMirrors == nil {
+		return nil
+	}
+
+	mirrors, err := m.listRemoteMirrors(project)
+	if err != nil {
+		return err
+	}
+
+	for _, mirror := range mirrors {
+		if err := m.ensureRemoteMirror(project, mirror, dryrun); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureRemoteMirror updates the options of the remote mirror which differ from the config
+func (m *ProjectManager) ensureRemoteMirror(project gitlab.Project, mirror *gitlab.ProjectMirror, dryrun bool) error {
+	mirrorURL := redactURL(mirror.URL)
+	current := remoteMirrorSettings(mirror)
+
+	opt := &gitlab.EditProjectMirrorOptions{}
+	desired := *current
+	if v := m.config.RemoteMirrors.OnlyProtectedBranches; v != nil {
+		opt.OnlyProtectedBranches = gitlab.Bool(*v)
+		desired.OnlyProtectedBranches = *v
+	}
+	if v := m.config.RemoteMirrors.MirrorBranchRegex; v != nil {
+		opt.MirrorBranchRegex = gitlab.String(*v)
+		desired.MirrorBranchRegex = *v
+	}
+	if v := m.config.RemoteMirrors.OverwriteDivergedBranches; v != nil {
+		opt.KeepDivergentRefs = gitlab.Bool(!*v)
+		desired.OverwriteDivergedBranches = *v
+	}
+
+	m.recordRemoteMirror(m.RemoteMirrorsOriginal, project, mirrorURL, current)
+
+	if reflect.DeepEqual(current, &desired) {
+		m.logger.Debugf("Remote mirror %s of project %s is up to date.", mirrorURL, project.PathWithNamespace)
+		m.recordRemoteMirror(m.RemoteMirrorsUpdated, project, mirrorURL, current)
+		return nil
+	}
+
+	if dryrun {
+		m.skipAPICall("EditProjectMirror", "for %s.", mirrorURL)
+		m.recordRemoteMirror(m.RemoteMirrorsUpdated, project, mirrorURL, &desired)
+		return nil
+	}
+
+	applied, _, err := m.mirrorsClient.EditProjectMirror(project.ID, mirror.ID, opt, m.withContext())
+	if err != nil {
+		return fmt.Errorf("failed to update remote mirror %s of project %s: %v", mirrorURL, project.PathWithNamespace, err)
+	}
+	m.logger.Infof("Updated remote mirror %s of project %s.", mirrorURL, project.PathWithNamespace)
+
+	m.recordRemoteMirror(m.RemoteMirrorsUpdated, project, mirrorURL, remoteMirrorSettings(applied))
+
+	return nil
+}
+
+// listRemoteMirrors returns all remote mirrors of the project
+func (m *ProjectManager) listRemoteMirrors(project gitlab.Project) ([]*gitlab.ProjectMirror, error) {
+	var mirrors []*gitlab.ProjectMirror
+
+	opt := &gitlab.ListProjectMirrorOptions{PerPage: 100}
+	for {
+		page, resp, err := m.mirrorsClient.ListProjectMirror(project.ID, opt, m.withContext())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list remote mirrors of project %s: %v", project.PathWithNamespace, err)
+		}
+		mirrors = append(mirrors, page...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return mirrors, nil
+}
+
+// recordRemoteMirror stores the settings of the remote mirror in the given original or
+// updated states
+func (m *ProjectManager) recordRemoteMirror(states map[string]map[string]*RemoteMirrorSettings, project gitlab.Project, mirrorURL string, settings *RemoteMirrorSettings) {
+	if _, ok := states[project.PathWithNamespace]; !ok {
+		states[project.PathWithNamespace] = make(map[string]*RemoteMirrorSettings)
+	}
+	states[project.PathWithNamespace][mirrorURL] = settings
+}
+
+// remoteMirrorDiffs returns the changes of the remote mirrors per URL, sorted by URL. The
+// states are regrouped by URL to diff them like the other settings.
+func (m *ProjectManager) remoteMirrorDiffs() ([]remoteMirrorDiff, error) {
+	byURL := make(map[string]*remoteMirrorDiff)
+	for project, mirrors := range m.RemoteMirrorsOriginal {
+		for mirrorURL, settings := range mirrors {
+			if _, ok := byURL[mirrorURL]; !ok {
+				byURL[mirrorURL] = &remoteMirrorDiff{
+					url:      mirrorURL,
+					original: make(map[string]*RemoteMirrorSettings),
+					updated:  make(map[string]*RemoteMirrorSettings),
+				}
+			}
+			byURL[mirrorURL].original[project] = settings
+			byURL[mirrorURL].updated[project] = m.RemoteMirrorsUpdated[project][mirrorURL]
+		}
+	}
+
+	diffs := make([]remoteMirrorDiff, 0, len(byURL))
+	for _, d := range byURL {
+		difflog, err := diff.Diff(d.original, d.updated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff remote mirror %s: %v", d.url, err)
+		}
+		d.difflog = difflog
+		diffs = append(diffs, *d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].url < diffs[j].url
+	})
+
+	return diffs, nil
+}
+
+// remoteMirrorSettings returns the recorded state of the remote mirror
+func remoteMirrorSettings(mirror *gitlab.ProjectMirror) *RemoteMirrorSettings {
+	return &RemoteMirrorSettings{
+		OnlyProtectedBranches:     mirror.OnlyProtectedBranches,
+		MirrorBranchRegex:         mirror.MirrorBranchRegex,
+		OverwriteDivergedBranches: !mirror.KeepDivergentRefs,
+	}
+}
+
+// redactURL returns the URL without the credentials it may embed, e.g. a token as user or
+// password. Unparsable URLs are dropped entirely, as they might still hold credentials.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "[invalid url]"
+	}
+	if u.User == nil {
+		return u.String()
+	}
+
+	// url.User would escape the mask
+	u.User = nil
+	return strings.Replace(u.String(), "//", "//*****@", 1)
+}
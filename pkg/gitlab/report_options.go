@@ -0,0 +1,82 @@
+package gitlab
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Report sort orders
+const (
+	SortByName          = "name"
+	SortByNonCompliance = "noncompliance"
+	SortByChanges       = "changes"
+)
+
+// ReportOptions controls the order and filtering of the projects in the console reports. By
+// default projects are sorted alphabetically. Sorting by noncompliance or changes lists the
+// projects with the most non-compliant or changed settings first.
+type ReportOptions struct {
+	Sort             string
+	OnlyNonCompliant bool
+}
+
+// Validate checks the sort order
+func (o ReportOptions) Validate() error {
+	switch o.Sort {
+	case "", SortByName, SortByNonCompliance, SortByChanges:
+		return nil
+	}
+
+	return fmt.Errorf("unknown sort order %q, must be one of: %s, %s, %s", o.Sort, SortByName, SortByNonCompliance, SortByChanges)
+}
+
+// SetReportOptions sets the order and filtering of the projects in the reports
+func (m *ProjectManager) SetReportOptions(options ReportOptions) {
+	m.reportOptions = options
+}
+
+// complianceResults sorts and filters the compliance results, which are sorted by project name
+func (o ReportOptions) complianceResults(results []ComplianceResult) []ComplianceResult {
+	nonCompliant := make(map[string]int)
+	for _, result := range results {
+		if !result.Compliant {
+			nonCompliant[result.Project]++
+		}
+	}
+
+	filtered := make([]ComplianceResult, 0, len(results))
+	for _, result := range results {
+		if o.OnlyNonCompliant && nonCompliant[result.Project] == 0 {
+			continue
+		}
+		filtered = append(filtered, result)
+	}
+
+	if o.Sort == SortByNonCompliance || o.Sort == SortByChanges {
+		// Stable, so projects with the same count stay grouped and alphabetical
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return nonCompliant[filtered[i].Project] > nonCompliant[filtered[j].Project]
+		})
+	}
+
+	return filtered
+}
+
+// changeLogEntries sorts the change log entries, which are sorted by project name
+func (o ReportOptions) changeLogEntries(entries []ChangeLogEntry) []ChangeLogEntry {
+	if o.Sort != SortByNonCompliance && o.Sort != SortByChanges {
+		return entries
+	}
+
+	changes := make(map[string]int)
+	for _, entry := range entries {
+		changes[entry.Project]++
+	}
+
+	sorted := append([]ChangeLogEntry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return changes[sorted[i].Project] > changes[sorted[j].Project]
+	})
+
+	return sorted
+}
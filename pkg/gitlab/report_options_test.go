@@ -0,0 +1,54 @@
+package gitlab
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReportOptionsComplianceResults(t *testing.T) {
+	results := []ComplianceResult{
+		{Project: "a", Setting: "x", Compliant: true},
+		{Project: "b", Setting: "x", Compliant: false},
+		{Project: "c", Setting: "x", Compliant: false},
+		{Project: "c", Setting: "y", Compliant: false},
+	}
+
+	projects := func(results []ComplianceResult) []string {
+		var names []string
+		for _, r := range results {
+			names = append(names, r.Project+"."+r.Setting)
+		}
+		return names
+	}
+
+	sorted := ReportOptions{Sort: SortByNonCompliance}.complianceResults(results)
+	if expected := []string{"c.x", "c.y", "b.x", "a.x"}; !reflect.DeepEqual(projects(sorted), expected) {
+		t.Errorf("Expected %v, got %v", expected, projects(sorted))
+	}
+
+	filtered := ReportOptions{OnlyNonCompliant: true}.complianceResults(results)
+	if expected := []string{"b.x", "c.x", "c.y"}; !reflect.DeepEqual(projects(filtered), expected) {
+		t.Errorf("Expected %v, got %v", expected, projects(filtered))
+	}
+
+	if unchanged := (ReportOptions{}).complianceResults(results); !reflect.DeepEqual(unchanged, results) {
+		t.Errorf("Expected the default to keep the alphabetical order, got %v", projects(unchanged))
+	}
+}
+
+func TestReportOptionsChangeLogEntries(t *testing.T) {
+	entries := []ChangeLogEntry{
+		{Project: "a", Setting: "x"},
+		{Project: "b", Setting: "x"},
+		{Project: "b", Setting: "y"},
+	}
+
+	sorted := ReportOptions{Sort: SortByChanges}.changeLogEntries(entries)
+	if sorted[0].Project != "b" || sorted[1].Project != "b" || sorted[2].Project != "a" {
+		t.Errorf("Expected the project with the most changes first, got %+v", sorted)
+	}
+
+	if err := (ReportOptions{Sort: "size"}).Validate(); err == nil {
+		t.Errorf("Expected an unknown sort order to be rejected")
+	}
+}
@@ -0,0 +1,95 @@
+package gitlab
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// EffectiveConfig returns the config of the project with the settings of the matching rules
+// applied in order, together with the names of the rules. Projects matching no rule get the
+// config itself. The main language is only fetched from GitLab if a rule matches languages.
+func (m *ProjectManager) EffectiveConfig(project gitlab.Project) (*config.Config, []string, error) {
+	if len(m.baseConfig.Rules) == 0 {
+		return m.baseConfig, nil, nil
+	}
+
+	language := ""
+	for _, r := range m.baseConfig.Rules {
+		if r.Match.Language != "" {
+			var err error
+			if language, err = m.mainLanguage(project); err != nil {
+				return nil, nil, err
+			}
+			break
+		}
+	}
+
+	var matched []config.Rule
+	var names []string
+	for _, r := range m.baseConfig.Rules {
+		if r.Match.Matches(project.PathWithNamespace, project.Topics, language) {
+			matched = append(matched, r)
+			names = append(names, r.Name)
+		}
+	}
+
+	// Projects matching the same rules share their effective config
+	key := strings.Join(names, "\x00")
+	if m.ruleConfigs == nil {
+		m.ruleConfigs = make(map[string]*config.Config)
+	}
+	if effective, ok := m.ruleConfigs[key]; ok {
+		return effective, names, nil
+	}
+
+	effective, err := m.baseConfig.ForRules(matched)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply the rules %s to project %s: %v", strings.Join(names, ", "), project.PathWithNamespace, err)
+	}
+	m.ruleConfigs[key] = effective
+
+	return effective, names, nil
+}
+
+// UseProjectConfig switches to the effective config of the project for the following steps,
+// which also record their warnings for it, and records the matching rules in ProjectRules
+func (m *ProjectManager) UseProjectConfig(project gitlab.Project) error {
+	m.config = m.baseConfig
+	m.currentProject = project.PathWithNamespace
+
+	effective, names, err := m.EffectiveConfig(project)
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		m.logger.Infof("Project %s matches the rules %s.", project.PathWithNamespace, strings.Join(names, ", "))
+		m.ProjectRules[project.PathWithNamespace] = names
+	}
+	m.config = effective
+
+	return nil
+}
+
+// mainLanguage returns the language with the largest share of the repository of the project,
+// empty if GitLab detected none
+func (m *ProjectManager) mainLanguage(project gitlab.Project) (string, error) {
+	languages, _, err := m.projectsClient.GetProjectLanguages(project.ID, m.withContext())
+	if err != nil {
+		return "", fmt.Errorf("failed to get languages of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	main := ""
+	share := float32(0)
+	for language, percentage := range *languages {
+		// Ties are broken by name for a stable result
+		if percentage > share || (percentage == share && language < main) {
+			main, share = language, percentage
+		}
+	}
+
+	return main, nil
+}
@@ -0,0 +1,66 @@
+package gitlab
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestUseProjectConfig(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+		"group_name": "example",
+		"project_settings": {"build_git_strategy": "fetch", "wiki_enabled": true},
+		"rules": [
+			{"name": "go", "match": {"language": "Go"}, "settings": {"project_settings": {"build_git_strategy": "clone"}}},
+			{"name": "no wiki", "match": {"path": "example/sub/**", "topics": ["internal"]}, "settings": {"project_settings": {"wiki_enabled": false}}}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	client := newTestClient()
+	client.SetLanguages(10, gitlab.ProjectLanguages{"Go": 80.5, "Shell": 19.5})
+	client.SetLanguages(11, gitlab.ProjectLanguages{"Go": 30, "JavaScript": 70})
+	bar, _, _ := client.Projects.GetProject(11, nil)
+	bar.Topics = []string{"internal"}
+	client.AddProject(bar)
+
+	manager := newTestManager(client, cfg)
+	projects, err := manager.GetProjects()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, project := range projects {
+		if err := manager.UseProjectConfig(project); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := manager.UpdateProjectSettings(project, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	expected := map[string][]string{"example/foo": {"go"}, "example/sub/bar": {"no wiki"}}
+	if !reflect.DeepEqual(manager.ProjectRules, expected) {
+		t.Errorf("Expected rules %v, got %v", expected, manager.ProjectRules)
+	}
+
+	foo, _, _ := client.Projects.GetProject(10, nil)
+	if foo.BuildGitStrategy != "clone" || !foo.WikiEnabled {
+		t.Errorf("Expected example/foo to get the settings of the go rule, got git strategy %q and wiki %v", foo.BuildGitStrategy, foo.WikiEnabled)
+	}
+	bar, _, _ = client.Projects.GetProject(11, nil)
+	if bar.BuildGitStrategy != "fetch" || bar.WikiEnabled {
+		t.Errorf("Expected example/sub/bar to get the settings of the no wiki rule, got git strategy %q and wiki %v", bar.BuildGitStrategy, bar.WikiEnabled)
+	}
+
+	// Errors are recorded for the run, whatever config a project used
+	manager.SetError(true)
+	if !manager.GetError() || !cfg.Error {
+		t.Errorf("Expected the error to be recorded on the config of the run")
+	}
+}
@@ -0,0 +1,59 @@
+package gitlab
+
+import "fmt"
+
+// ComplianceScores are the weighted percentages of compliant mandatory settings, per project
+// and over all projects. Settings count with their weight from the compliance config, settings
+// which could not be fetched count as non-compliant.
+type ComplianceScores struct {
+	Overall  float64            `json:"overall"`
+	Projects map[string]float64 `json:"projects"`
+}
+
+// ComplianceScores returns the compliance scores of all projects, unaffected by the report
+// options
+func (m *ProjectManager) ComplianceScores() ComplianceScores {
+	return newComplianceScores(m.ComplianceResults())
+}
+
+// newComplianceScores computes the scores of the results. Without any results the score is
+// 100, as nothing mandatory is violated.
+func newComplianceScores(results []ComplianceResult) ComplianceScores {
+	var compliant, total float64
+	projectCompliant := make(map[string]float64)
+	projectTotal := make(map[string]float64)
+	for _, result := range results {
+		weight := result.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		total += weight
+		projectTotal[result.Project] += weight
+		if result.Compliant {
+			compliant += weight
+			projectCompliant[result.Project] += weight
+		}
+	}
+
+	scores := ComplianceScores{Overall: score(compliant, total), Projects: make(map[string]float64, len(projectTotal))}
+	for project, t := range projectTotal {
+		scores.Projects[project] = score(projectCompliant[project], t)
+	}
+
+	return scores
+}
+
+// score returns the percentage of compliant of total
+func score(compliant, total float64) float64 {
+	if total == 0 {
+		return 100
+	}
+
+	return 100 * compliant / total
+}
+
+// formatScore formats the score as percentage with one decimal, e.g. 83.3%
+func formatScore(score float64) string {
+	return fmt.Sprintf("%.1f%%", score)
+}
@@ -0,0 +1,74 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestComplianceScores(t *testing.T) {
+	manager := newTestManager(newTestClient(), &config.Config{
+		Compliance: &config.ComplianceSettings{
+			Mandatory: map[string]map[string]interface{}{
+				"project_settings": {"visibility": "private", "wiki_access_level": "disabled"},
+			},
+			Weights: map[string]map[string]float64{"project_settings": {"visibility": 3}},
+		},
+	})
+	manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{Visibility: gitlab.PrivateVisibility, WikiAccessLevel: gitlab.EnabledAccessControl}
+	manager.ProjectSettingsOriginal["example/sub/bar"] = &gitlab.Project{Visibility: gitlab.PublicVisibility, WikiAccessLevel: gitlab.DisabledAccessControl}
+	manager.ProjectSettingsOriginal["example/unavailable"] = nil
+
+	// 3 of 4 for foo, 1 of 4 for bar and 0 of 4 for the unavailable settings
+	scores := manager.ComplianceScores()
+	if scores.Overall != 100*4.0/12 {
+		t.Errorf("Expected the overall score 33.3, got %v", scores.Overall)
+	}
+	expected := map[string]float64{"example/foo": 75, "example/sub/bar": 25, "example/unavailable": 0}
+	for project, score := range expected {
+		if scores.Projects[project] != score {
+			t.Errorf("Expected the score %v of %s, got %v", score, project, scores.Projects[project])
+		}
+	}
+
+	// Without mandatory settings nothing is violated
+	if empty := newComplianceScores(nil); empty.Overall != 100 {
+		t.Errorf("Expected the score 100 without results, got %v", empty.Overall)
+	}
+
+	var text strings.Builder
+	results := manager.ComplianceResults()
+	manager.complianceText(&text, results, scores)
+	for _, line := range []string{"Compliance score: 33.3%", "  example/foo (75.0%)", "  example/sub/bar (25.0%)"} {
+		if !strings.Contains(text.String(), line) {
+			t.Errorf("Expected %q in the report, got\n%s", line, text.String())
+		}
+	}
+
+	if markdown := complianceMarkdown(results, scores); !strings.Contains(markdown, "compliance score 33.3%") || !strings.Contains(markdown, "#### `example/foo` (75.0%)") {
+		t.Errorf("Expected the scores in the markdown report, got\n%s", markdown)
+	}
+
+	_, body, err := manager.complianceEmail(results, scores)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(body, "Compliance score: <b>33.3%</b>") || !strings.Contains(body, "<b>example/foo</b> (75.0%)") {
+		t.Errorf("Expected the scores in the email, got\n%s", body)
+	}
+
+	report, err := complianceReport{results: results, scores: scores}.render(manager, FormatJSON)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var decoded struct {
+		Scores ComplianceScores `json:"scores"`
+	}
+	if err := json.Unmarshal(report, &decoded); err != nil || decoded.Scores.Projects["example/foo"] != 75 {
+		t.Errorf("Expected the scores in the json report, got %s (%v)", report, err)
+	}
+}
@@ -0,0 +1,123 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// EnsureServiceDesk enables or disables Service Desk on the project as configured and checks
+// the suffix of its email address. GitLab only supports Service Desk with incoming email set
+// up on the instance; otherwise enabling it fails or doesn't stick, and the step is skipped.
+func (m *ProjectManager) EnsureServiceDesk(project gitlab.Project, dryrun bool) error {
+	if m.config.ServiceDesk == nil || m.serviceDeskUnavailable {
+		return nil
+	}
+	enabled := m.config.ServiceDesk.Enabled
+	action := "disable"
+	if enabled {
+		action = "enable"
+	}
+
+	projectSettings, err := m.GetProjectSettings(project)
+	if err != nil {
+		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	// Record current settings states, unless already recorded by UpdateProjectSettings
+	if _, ok := m.ProjectSettingsOriginal[project.PathWithNamespace]; !ok {
+		m.ProjectSettingsOriginal[project.PathWithNamespace] = projectSettings
+	}
+
+	if projectSettings.ServiceDeskEnabled == enabled {
+		m.logger.Debugf("Service desk of project %s is already %s.", project.PathWithNamespace, serviceDeskState(enabled))
+
+		if _, ok := m.ProjectSettingsUpdated[project.PathWithNamespace]; !ok {
+			m.ProjectSettingsUpdated[project.PathWithNamespace] = projectSettings
+		}
+
+		m.checkServiceDeskAddress(project, projectSettings)
+		return nil
+	}
+
+	if dryrun {
+		m.skipAPICall("EditProject", "to %s service desk.", action)
+
+		// Record the expected settings states on top of the planned project settings
+		planned, ok := m.ProjectSettingsUpdated[project.PathWithNamespace]
+		if !ok {
+			planned = projectSettings
+		}
+		projected := *planned
+		projected.ServiceDeskEnabled = enabled
+		m.ProjectSettingsUpdated[project.PathWithNamespace] = &projected
+
+		return nil
+	}
+
+	_, resp, err := m.projectsClient.EditProject(project.ID, &gitlab.EditProjectOptions{ServiceDeskEnabled: gitlab.Bool(enabled)}, m.withContext())
+	if err != nil {
+		if enabled && resp != nil && (resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity) {
+			m.skipServiceDesk(project, projectSettings, err)
+			return nil
+		}
+		return fmt.Errorf("failed to %s service desk of project %s: %v", action, project.PathWithNamespace, err)
+	}
+
+	// Get new settings states
+	projectSettings, err = m.GetProjectSettings(project)
+	if err != nil {
+		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	// GitLab acknowledges enabling Service Desk without incoming email, but keeps it disabled
+	if projectSettings.ServiceDeskEnabled != enabled {
+		m.skipServiceDesk(project, projectSettings, fmt.Errorf("service desk of project %s is still %s", project.PathWithNamespace, serviceDeskState(!enabled)))
+		return nil
+	}
+	m.logger.Infof("Service desk of project %s %s.", project.PathWithNamespace, serviceDeskState(enabled))
+
+	// Record current settings states
+	m.ProjectSettingsUpdated[project.PathWithNamespace] = projectSettings
+
+	m.checkServiceDeskAddress(project, projectSettings)
+	return nil
+}
+
+// skipServiceDesk skips service_desk for this and the remaining projects, as Service Desk is
+// not supported by the instance. The unchanged settings of the project are recorded.
+func (m *ProjectManager) skipServiceDesk(project gitlab.Project, projectSettings *gitlab.Project, err error) {
+	m.warn("", "Service desk is not available on this GitLab instance (incoming email not configured), skipping service_desk: %v", err)
+	m.serviceDeskUnavailable = true
+
+	if _, ok := m.ProjectSettingsUpdated[project.PathWithNamespace]; !ok {
+		m.ProjectSettingsUpdated[project.PathWithNamespace] = projectSettings
+	}
+}
+
+// checkServiceDeskAddress warns about an enabled Service Desk whose email address lacks the
+// configured suffix. GitLab derives the address from the project path and the suffix, e.g.
+// contact+group-project-support@example.com, and has no API to change the suffix.
+func (m *ProjectManager) checkServiceDeskAddress(project gitlab.Project, projectSettings *gitlab.Project) {
+	suffix := m.config.ServiceDesk.AddressSuffix
+	if suffix == "" || !projectSettings.ServiceDeskEnabled || projectSettings.ServiceDeskAddress == "" {
+		return
+	}
+
+	local := strings.Split(projectSettings.ServiceDeskAddress, "@")[0]
+	if !strings.HasSuffix(local, "-"+suffix) {
+		m.warnf("service desk address %s of project %s lacks the suffix %s, set it in the Service Desk settings of the project",
+			projectSettings.ServiceDeskAddress, project.PathWithNamespace, suffix)
+	}
+}
+
+// serviceDeskState returns enabled or disabled
+func serviceDeskState(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+
+	return "disabled"
+}
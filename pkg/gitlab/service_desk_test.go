@@ -0,0 +1,94 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestEnsureServiceDesk(t *testing.T) {
+	for _, dryrun := range []bool{true, false} {
+		client := newTestClient()
+		cfg := &config.Config{ServiceDesk: &config.ServiceDeskSettings{Enabled: true}}
+		project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo"}
+
+		manager := newTestManager(client, cfg)
+		if err := manager.EnsureServiceDesk(project, dryrun); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		entries, err := manager.ChangeLogEntries(false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(entries) != 1 || entries[0].Setting != "service_desk_enabled" || entries[0].To != true {
+			t.Errorf("Expected service_desk_enabled to change to true (dryrun %v), got %+v", dryrun, entries)
+		}
+
+		p, _, _ := client.Projects.GetProject(10, nil)
+		if p.ServiceDeskEnabled != !dryrun {
+			t.Errorf("Expected service desk to be enabled %v (dryrun %v), got %v", !dryrun, dryrun, p.ServiceDeskEnabled)
+		}
+		if dryrun {
+			continue
+		}
+
+		// A second run has nothing left to do
+		second := newTestManager(client, cfg)
+		if err := second.EnsureServiceDesk(project, false); err != nil {
+			t.Fatalf("Expected no error on the second run, got %v", err)
+		}
+		if changes, err := second.HasChanges(); err != nil || changes {
+			t.Errorf("Expected no changes on the second run, got %v (%v)", changes, err)
+		}
+	}
+}
+
+func TestEnsureServiceDeskUnavailable(t *testing.T) {
+	client := newTestClient()
+	client.DisableServiceDesk()
+	manager := newTestManager(client, &config.Config{ServiceDesk: &config.ServiceDeskSettings{Enabled: true}})
+
+	for _, project := range []gitlab.Project{{ID: 10, PathWithNamespace: "example/foo"}, {ID: 11, PathWithNamespace: "example/sub/bar"}} {
+		if err := manager.EnsureServiceDesk(project, false); err != nil {
+			t.Errorf("Expected service desk to be skipped without incoming email, got %v", err)
+		}
+	}
+	if !manager.serviceDeskUnavailable {
+		t.Errorf("Expected service desk to be marked unavailable")
+	}
+	if changes, err := manager.HasChanges(); err != nil || changes {
+		t.Errorf("Expected no changes, got %v (%v)", changes, err)
+	}
+}
+
+func TestEnsureServiceDeskAddressSuffix(t *testing.T) {
+	tests := []struct {
+		address   string
+		compliant bool
+	}{
+		{address: "contact+example-baz-support@example.com", compliant: true},
+		{address: "contact+example-baz-12-issue-@example.com", compliant: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			client := newTestClient()
+			client.AddProject(&gitlab.Project{ID: 12, PathWithNamespace: "example/baz", ServiceDeskEnabled: true, ServiceDeskAddress: tt.address})
+			manager := newTestManager(client, &config.Config{
+				Strict:      true,
+				ServiceDesk: &config.ServiceDeskSettings{Enabled: true, AddressSuffix: "support"},
+			})
+
+			if err := manager.EnsureServiceDesk(gitlab.Project{ID: 12, PathWithNamespace: "example/baz"}, false); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			// The suffix can't be changed via the API, a differing one is only reported
+			if manager.GetError() == tt.compliant {
+				t.Errorf("Expected the error flag to be %v, got %v", !tt.compliant, manager.GetError())
+			}
+		})
+	}
+}
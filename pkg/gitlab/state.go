@@ -0,0 +1,66 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/sink"
+)
+
+// ProjectState holds the effective settings of a project after a sync
+type ProjectState struct {
+	Project          string                   `json:"project"`
+	ProjectSettings  *gitlab.Project          `json:"project_settings,omitempty"`
+	ApprovalSettings *gitlab.ProjectApprovals `json:"approval_settings,omitempty"`
+}
+
+// ProjectStates returns the effective settings of the processed projects, sorted by path.
+// Projects without changes are included with their unchanged settings. In dryrun the
+// states are the planned ones.
+func (m *ProjectManager) ProjectStates() []ProjectState {
+	paths := make(map[string]bool)
+	for path := range m.ProjectSettingsOriginal {
+		paths[path] = true
+	}
+	for path := range m.ApprovalSettingsOriginal {
+		paths[path] = true
+	}
+
+	states := make([]ProjectState, 0, len(paths))
+	for path := range paths {
+		state := ProjectState{Project: path}
+
+		// Fall back to the original settings of projects failing before the update
+		state.ProjectSettings = m.ProjectSettingsUpdated[path]
+		if state.ProjectSettings == nil {
+			state.ProjectSettings = m.ProjectSettingsOriginal[path]
+		}
+		state.ApprovalSettings = m.ApprovalSettingsUpdated[path]
+		if state.ApprovalSettings == nil {
+			state.ApprovalSettings = m.ApprovalSettingsOriginal[path]
+		}
+
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Project < states[j].Project })
+
+	return states
+}
+
+// WriteStateFile writes the effective settings of the processed projects as JSON to the
+// given path
+func (m *ProjectManager) WriteStateFile(path string) error {
+	body, err := json.MarshalIndent(m.ProjectStates(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to convert project states to json: %v", err)
+	}
+
+	if err := sink.Write(path, append(body, '\n')); err != nil {
+		return fmt.Errorf("failed to write state file %s: %v", path, err)
+	}
+
+	return nil
+}
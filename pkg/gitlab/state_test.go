@@ -0,0 +1,58 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestWriteStateFile(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{"project_settings": {"wiki_enabled": false}}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// foo has the wiki enabled, bar is compliant already
+	client := newTestClient()
+	client.Projects.EditProject(11, &gitlab.EditProjectOptions{WikiEnabled: gitlab.Bool(false)})
+	manager := newTestManager(client, cfg)
+	for _, project := range []gitlab.Project{
+		{ID: 11, PathWithNamespace: "example/sub/bar"},
+		{ID: 10, PathWithNamespace: "example/foo"},
+	} {
+		if err := manager.UpdateProjectSettings(project, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := manager.WriteStateFile(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected the state file to be written, got %v", err)
+	}
+	var states []ProjectState
+	if err := json.Unmarshal(b, &states); err != nil {
+		t.Fatalf("Expected valid json, got %v", err)
+	}
+
+	if len(states) != 2 || states[0].Project != "example/foo" || states[1].Project != "example/sub/bar" {
+		t.Fatalf("Expected the states of both projects sorted by path, got %+v", states)
+	}
+	for _, state := range states {
+		if state.ProjectSettings == nil || state.ProjectSettings.WikiEnabled {
+			t.Errorf("Expected the wiki of %s disabled after the sync, got %+v", state.Project, state.ProjectSettings)
+		}
+		if state.ApprovalSettings != nil {
+			t.Errorf("Expected no approval settings of %s without approval_settings config, got %+v", state.Project, state.ApprovalSettings)
+		}
+	}
+}
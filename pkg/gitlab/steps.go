@@ -0,0 +1,42 @@
+package gitlab
+
+import (
+	"github.com/xanzy/go-gitlab"
+)
+
+// ProjectStep enforces a config section on a project
+type ProjectStep struct {
+	Section string
+	Action  string
+	Run     func(gitlab.Project, bool) error
+}
+
+// ProjectSteps returns the sync steps of a project in the order of sync_order, see
+// config.ProjectSyncOrder
+func (m *ProjectManager) ProjectSteps() []ProjectStep {
+	steps := map[string]ProjectStep{
+		"default_branch":        {Action: "migrate default branch", Run: m.EnsureDefaultBranch},
+		"project_settings":      {Action: "update project settings", Run: m.UpdateProjectSettings},
+		"required_files":        {Action: "ensure required files", Run: m.EnsureFiles},
+		"templates_source":      {Action: "ensure templates", Run: m.EnsureTemplates},
+		"protected_branches":    {Action: "ensure branches", Run: m.EnsureBranchesAndProtection},
+		"approval_rules":        {Action: "ensure approval rules", Run: m.EnsureApprovalRules},
+		"compliance_framework":  {Action: "ensure compliance framework", Run: m.EnsureComplianceFramework},
+		"service_desk":          {Action: "ensure service desk", Run: m.EnsureServiceDesk},
+		"remote_mirrors":        {Action: "ensure remote mirrors", Run: m.EnsureRemoteMirrors},
+		"protected_tags":        {Action: "ensure tags", Run: m.EnsureTagsProtection},
+		"project_ci_variables":  {Action: "ensure CI/CD variables", Run: m.EnsureProjectVariables},
+		"metadata":              {Action: "ensure metadata", Run: m.EnsureMetadata},
+		"project_access_tokens": {Action: "ensure project access tokens", Run: m.EnsureProjectAccessTokens},
+		"approval_settings":     {Action: "update approval settings", Run: m.UpdateProjectApprovalSettings},
+	}
+
+	var ordered []ProjectStep
+	for _, section := range m.config.ProjectSyncOrder() {
+		step := steps[section]
+		step.Section = section
+		ordered = append(ordered, step)
+	}
+
+	return ordered
+}
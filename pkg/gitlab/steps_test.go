@@ -0,0 +1,83 @@
+package gitlab
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestProjectStepsOrder(t *testing.T) {
+	// The default branch is renamed from master to main by project_settings, the pattern
+	// protects the branches existing when the protected_branches step runs
+	content := `{
+		"group_name": "example",
+		"create_default_branch": true,
+		"project_settings": {"default_branch": "main"},
+		"protected_branch_patterns": [{"pattern": "main|release/.*", "push_access_level": "maintainer", "merge_access_level": "developer"}]
+		%s
+	}`
+
+	tests := []struct {
+		name      string
+		syncOrder string
+		protected bool
+	}{
+		{name: "default order", protected: true},
+		// The former fixed order protects the branches before the rename
+		{name: "protect then rename", syncOrder: `, "sync_order": ["protected_branches", "project_settings"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Parse(writeTestFile(t, "config.json", fmt.Sprintf(content, tt.syncOrder)))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			client := newTestClient()
+			manager := newTestManager(client, cfg)
+			project, _, _ := client.Projects.GetProject(10, nil)
+
+			for _, step := range manager.ProjectSteps() {
+				if err := step.Run(*project, false); err != nil {
+					t.Fatalf("Expected no error in step %s, got %v", step.Section, err)
+				}
+			}
+
+			project, _, _ = client.Projects.GetProject(10, nil)
+			if project.DefaultBranch != "main" {
+				t.Errorf("Expected default branch main, got %s", project.DefaultBranch)
+			}
+			_, _, err = client.ProtectedBranches.GetProtectedBranch(10, "main")
+			if protected := err == nil; protected != tt.protected {
+				t.Errorf("Expected main protected: %v, got %v", tt.protected, protected)
+			}
+		})
+	}
+}
+
+func TestProjectStepsSyncOrder(t *testing.T) {
+	cfg, err := config.Parse(writeTestFile(t, "config.json", `{"sync_order": ["approval_settings", "protected_branches"]}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var sections []string
+	for _, step := range newTestManager(newTestClient(), cfg).ProjectSteps() {
+		if step.Run == nil {
+			t.Errorf("Expected step %s to run a function", step.Section)
+		}
+		sections = append(sections, step.Section)
+	}
+
+	expected := []string{
+		"approval_settings", "protected_branches", "default_branch", "project_settings", "required_files",
+		"templates_source", "approval_rules", "compliance_framework", "service_desk", "remote_mirrors",
+		"protected_tags", "project_ci_variables", "metadata", "project_access_tokens",
+	}
+	if !reflect.DeepEqual(sections, expected) {
+		t.Errorf("Expected steps %v, got %v", expected, sections)
+	}
+}
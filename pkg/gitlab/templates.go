@@ -0,0 +1,129 @@
+package gitlab
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// templateDirs are the directories GitLab reads the description templates of issues and
+// merge requests from, below .gitlab
+var templateDirs = []string{"issue_templates", "merge_request_templates"}
+
+// EnsureTemplates ensures that the description templates of the templates_source repository
+// exist in the default branch of the project, committing missing and changed templates. The
+// templates are read from the source once per run.
+func (m *ProjectManager) EnsureTemplates(project gitlab.Project, dryrun bool) error {
+	source := m.config.TemplatesSource
+	if source == nil {
+		return nil
+	}
+	if project.PathWithNamespace == source.Project {
+		m.logger.Debugf("Project %s is the templates source, skipping templates.", project.PathWithNamespace)
+		return nil
+	}
+
+	files, err := m.getTemplateFiles()
+	if err != nil {
+		return err
+	}
+
+	// The default branch may have been migrated earlier in this run
+	projectSettings, err := m.GetProjectSettings(project)
+	if err != nil {
+		return fmt.Errorf("failed to get current project settings of project %s: %v", project.PathWithNamespace, err)
+	}
+
+	if projectSettings.DefaultBranch == "" {
+		m.logger.Infof("Project %s has no default branch (empty repository), skipping templates.", project.PathWithNamespace)
+		return nil
+	}
+
+	for _, f := range files {
+		if err := m.ensureFile(project, projectSettings.DefaultBranch, f, dryrun); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getTemplateFiles returns the templates of the templates_source repository as required
+// files, reading them on the first call
+func (m *ProjectManager) getTemplateFiles() ([]config.RequiredFile, error) {
+	if m.templateFiles != nil {
+		return m.templateFiles, nil
+	}
+
+	source := m.config.TemplatesSource
+	ref := source.Ref
+	if ref == "" {
+		p, _, err := m.projectsClient.GetProject(source.Project, nil, m.withContext())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get templates source project %s: %v", source.Project, err)
+		}
+		ref = p.DefaultBranch
+	}
+
+	files := make([]config.RequiredFile, 0)
+	for _, dir := range templateDirs {
+		opt := &gitlab.ListTreeOptions{
+			ListOptions: gitlab.ListOptions{PerPage: 100},
+			Path:        gitlab.String(path.Join(source.Path, dir)),
+			Ref:         gitlab.String(ref),
+		}
+		for {
+			tree, resp, err := m.repositoriesClient.ListTree(source.Project, opt, m.withContext())
+			if err != nil {
+				// The source may only hold the templates of either issues or merge requests
+				if resp != nil && resp.StatusCode == http.StatusNotFound {
+					break
+				}
+				return nil, fmt.Errorf("failed to list templates %s of project %s: %v", *opt.Path, source.Project, err)
+			}
+
+			for _, node := range tree {
+				// GitLab only offers markdown files as templates
+				if node.Type != "blob" || !strings.HasSuffix(node.Name, ".md") {
+					continue
+				}
+
+				file, _, err := m.repositoryFilesClient.GetFile(source.Project, node.Path, &gitlab.GetFileOptions{Ref: gitlab.String(ref)}, m.withContext())
+				if err != nil {
+					return nil, fmt.Errorf("failed to get template %s of project %s: %v", node.Path, source.Project, err)
+				}
+				content, err := base64.StdEncoding.DecodeString(file.Content)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode template %s of project %s: %v", node.Path, source.Project, err)
+				}
+
+				files = append(files, config.RequiredFile{
+					Path:          path.Join(".gitlab", dir, node.Name),
+					Content:       string(content),
+					Overwrite:     true,
+					CommitMessage: source.CommitMessage,
+				})
+			}
+
+			if resp.NextPage == 0 {
+				break
+			}
+			opt.Page = resp.NextPage
+		}
+	}
+
+	if len(files) == 0 {
+		m.warnf("No templates found below %s of project %s", source.Path, source.Project)
+	} else {
+		m.logger.Debugf("Read %d template(s) from project %s.", len(files), source.Project)
+	}
+	m.templateFiles = files
+
+	return files, nil
+}
@@ -0,0 +1,86 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+// countingFiles counts the files read from the templates source
+type countingFiles struct {
+	*fake.RepositoryFilesService
+	gets int
+}
+
+func (f *countingFiles) GetFile(pid interface{}, fileName string, opt *gitlab.GetFileOptions, options ...gitlab.RequestOptionFunc) (*gitlab.File, *gitlab.Response, error) {
+	if pid == "example/templates" {
+		f.gets++
+	}
+	return f.RepositoryFilesService.GetFile(pid, fileName, opt, options...)
+}
+
+func TestEnsureTemplates(t *testing.T) {
+	client := fake.NewClient()
+	client.AddProject(&gitlab.Project{ID: 10, PathWithNamespace: "example/foo", DefaultBranch: "main"})
+	client.AddProject(&gitlab.Project{ID: 11, PathWithNamespace: "example/bar", DefaultBranch: "main"})
+	client.AddProject(&gitlab.Project{ID: 20, PathWithNamespace: "example/templates", DefaultBranch: "main"})
+	client.AddFile(20, "main", "templates/merge_request_templates/Default.md", "## What does this MR do?\n")
+	client.AddFile(20, "main", "templates/issue_templates/Bug.md", "## Steps to reproduce\n")
+	client.AddFile(20, "main", "templates/issue_templates/README.txt", "Not a template\n")
+	client.AddFile(10, "main", ".gitlab/merge_request_templates/Default.md", "Outdated\n")
+	client.AddFile(10, "main", ".gitlab/issue_templates/Feature.md", "Project specific\n")
+
+	manager := newTestManager(client, &config.Config{TemplatesSource: &config.TemplatesSource{Project: "example/templates", Path: "templates"}})
+	files := &countingFiles{RepositoryFilesService: client.RepositoryFiles}
+	manager.repositoryFilesClient = files
+
+	foo, _, _ := client.Projects.GetProject(10, nil)
+	if err := manager.EnsureTemplates(*foo, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if content := fileContent(t, client, 10, "main", ".gitlab/issue_templates/Bug.md"); content != "" {
+		t.Errorf("Expected a dryrun to create no templates, got %q", content)
+	}
+
+	for _, pid := range []int{10, 11, 20} {
+		project, _, _ := client.Projects.GetProject(pid, nil)
+		if err := manager.EnsureTemplates(*project, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	expected := map[string]string{
+		".gitlab/merge_request_templates/Default.md": "## What does this MR do?\n",
+		".gitlab/issue_templates/Bug.md":             "## Steps to reproduce\n",
+		".gitlab/issue_templates/README.txt":         "",
+	}
+	for _, pid := range []int{10, 11} {
+		for path, content := range expected {
+			if actual := fileContent(t, client, pid, "main", path); actual != content {
+				t.Errorf("Expected %s of project %d to be %q, got %q", path, pid, content, actual)
+			}
+		}
+	}
+	if actual := fileContent(t, client, 10, "main", ".gitlab/issue_templates/Feature.md"); actual != "Project specific\n" {
+		t.Errorf("Expected further templates of the project to be kept, got %q", actual)
+	}
+	if actual := fileContent(t, client, 20, "main", ".gitlab/issue_templates/Bug.md"); actual != "" {
+		t.Errorf("Expected the templates source to be skipped, got %q", actual)
+	}
+	if files.gets != 2 {
+		t.Errorf("Expected the 2 templates to be read once, got %d reads", files.gets)
+	}
+}
+
+func TestEnsureTemplatesSourceMissing(t *testing.T) {
+	client := newTestClient()
+	manager := newTestManager(client, &config.Config{TemplatesSource: &config.TemplatesSource{Project: "example/missing", Path: ".gitlab"}})
+
+	project, _, _ := client.Projects.GetProject(10, nil)
+	if err := manager.EnsureTemplates(*project, false); err == nil {
+		t.Errorf("Expected an error for a missing templates source, got none")
+	}
+}
@@ -0,0 +1,40 @@
+package gitlab
+
+import (
+	"context"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// DefaultProjectTimeout is the time a single project may take to sync
+const DefaultProjectTimeout = 10 * time.Minute
+
+// StartProject bounds the API calls of the project processed next to the timeout, so a
+// pathological project, e.g. with thousands of branches, can't stall the whole run. Once
+// the timeout passed, all further calls for the project fail. The returned function ends
+// the project and has to be called before the next one is started. A timeout of 0 disables
+// the limit.
+func (m *ProjectManager) StartProject(timeout time.Duration) func() {
+	if timeout <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	m.ctx = ctx
+
+	return func() {
+		cancel()
+		m.ctx = context.Background()
+	}
+}
+
+// ProjectTimedOut reports whether the timeout of the current project passed
+func (m *ProjectManager) ProjectTimedOut() bool {
+	return m.ctx.Err() == context.DeadlineExceeded
+}
+
+// withContext returns the request option binding an API call to the current project
+func (m *ProjectManager) withContext() gitlab.RequestOptionFunc {
+	return gitlab.WithContext(m.ctx)
+}
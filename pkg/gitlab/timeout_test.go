@@ -0,0 +1,78 @@
+package gitlab
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/sirupsen/logrus"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/gitlab/fake"
+)
+
+// slowProtectedBranches delays each lookup of a protected branch, failing once the context
+// passed as request option is done
+type slowProtectedBranches struct {
+	*fake.ProtectedBranchesService
+	delay time.Duration
+}
+
+func (s *slowProtectedBranches) GetProtectedBranch(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch, *gitlab.Response, error) {
+	req, _ := retryablehttp.NewRequest(http.MethodGet, "https://gitlab.fake", nil)
+	for _, option := range options {
+		_ = option(req)
+	}
+
+	select {
+	case <-time.After(s.delay):
+		return s.ProtectedBranchesService.GetProtectedBranch(pid, branch, options...)
+	case <-req.Context().Done():
+		return nil, nil, req.Context().Err()
+	}
+}
+
+func TestStartProjectTimeout(t *testing.T) {
+	client := newTestClient()
+	cfg := &config.Config{}
+	for i := 0; i < 100; i++ {
+		cfg.ProtectedBranches = append(cfg.ProtectedBranches, config.ProtectedBranch{
+			Name:             "release-" + string(rune('a'+i%26)) + string(rune('a'+i/26)),
+			PushAccessLevel:  config.AccessLevelMaintainer,
+			MergeAccessLevel: config.AccessLevelMaintainer,
+		})
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	clients := testClients(client)
+	clients.ProtectedBranches = &slowProtectedBranches{ProtectedBranchesService: client.ProtectedBranches, delay: 50 * time.Millisecond}
+	manager := NewProjectManager(logrus.NewEntry(logger), clients, cfg)
+	project := gitlab.Project{ID: 10, PathWithNamespace: "example/foo", DefaultBranch: "master"}
+
+	// Without the timeout the 100 branches take 5 seconds
+	start := time.Now()
+	done := manager.StartProject(100 * time.Millisecond)
+	if err := manager.EnsureBranchesAndProtection(project, true); err == nil && !manager.ProjectTimedOut() {
+		t.Fatalf("Expected the project to time out")
+	}
+	if !manager.ProjectTimedOut() {
+		t.Errorf("Expected the project to be reported as timed out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the project to be cancelled after the timeout, took %v", elapsed)
+	}
+
+	// The next project starts with a fresh timeout
+	done()
+	if manager.ProjectTimedOut() {
+		t.Errorf("Expected the timeout to end with the project")
+	}
+	client.AddProtectedBranch(10, &gitlab.ProtectedBranch{Name: "master"})
+	if _, _, err := manager.protectedBranchesClient.GetProtectedBranch(10, "master", manager.withContext()); err != nil {
+		t.Errorf("Expected calls after the project to succeed, got %v", err)
+	}
+}
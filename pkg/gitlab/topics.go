@@ -0,0 +1,35 @@
+package gitlab
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/internal/stringslice"
+)
+
+// topicsCompliance sets the result of the mandatory project topics: the project must have all
+// of the required topics, further topics are allowed. Missing topics are listed in the result.
+func topicsCompliance(result *ComplianceResult, actual []string, required []string) {
+	current := append(valueList{}, actual...)
+	sort.Strings(current)
+
+	result.Actual = current
+	result.Expected = valueList(required)
+	result.Missing = nil
+	for _, topic := range required {
+		if !stringslice.Contains(topic, actual) {
+			result.Missing = append(result.Missing, topic)
+		}
+	}
+	result.Compliant = len(result.Missing) == 0
+}
+
+// ExpectedText renders the expected value of the result together with the missing elements
+// of required sets, e.g. "[go, python] (missing: [python])"
+func (r ComplianceResult) ExpectedText() string {
+	if len(r.Missing) == 0 {
+		return fmt.Sprintf("%v", r.Expected)
+	}
+
+	return fmt.Sprintf("%v (missing: %v)", r.Expected, valueList(r.Missing))
+}
@@ -0,0 +1,63 @@
+package gitlab
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestComplianceResultsTopics(t *testing.T) {
+	tests := []struct {
+		name      string
+		topics    []string
+		compliant bool
+		text      string
+	}{
+		{name: "all required", topics: []string{"python", "go"}, compliant: true, text: "topics: [go, python]\n"},
+		{name: "further topics", topics: []string{"go", "docker", "python"}, compliant: true, text: "topics: [docker, go, python]\n"},
+		{name: "missing topic", topics: []string{"go", "docker"}, text: "topics: [docker, go] (missing: [python])\n"},
+		{name: "no topics", text: "topics: [] (missing: [go, python])\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(newTestClient(), &config.Config{
+				Compliance: &config.ComplianceSettings{
+					Mandatory: map[string]map[string]interface{}{
+						"project_settings": {"topics": []string{"go", "python"}},
+					},
+				},
+			})
+			manager.ProjectSettingsOriginal["example/foo"] = &gitlab.Project{Topics: tt.topics}
+
+			results := manager.ComplianceResults()
+			if len(results) != 1 {
+				t.Fatalf("Expected 1 result, got %d", len(results))
+			}
+			if results[0].Compliant != tt.compliant {
+				t.Errorf("Expected compliant %v, got %v", tt.compliant, results[0].Compliant)
+			}
+
+			var text strings.Builder
+			manager.complianceText(&text, results, newComplianceScores(results))
+			if !strings.Contains(text.String(), tt.text) {
+				t.Errorf("Expected the report to contain %q, got\n%s", tt.text, text.String())
+			}
+		})
+	}
+}
+
+func TestComplianceResultExpectedText(t *testing.T) {
+	result := ComplianceResult{Expected: valueList{"go", "python"}, Missing: []string{"python"}}
+	if actual, expected := result.ExpectedText(), "[go, python] (missing: [python])"; actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+
+	result = ComplianceResult{Expected: true}
+	if actual, expected := result.ExpectedText(), "true"; actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,101 @@
+package gitlab
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+// checkTwoFactorMembers returns the group settings to apply. If they turn on
+// require_two_factor_authentication, the direct members of the group without two-factor
+// authentication lose access to it once the grace period ends, so they are named in a
+// warning. As configured in two_factor_noncompliant_members, the setting is then applied
+// anyway (warn), left out and reported as blocked (skip), or the group settings fail (error).
+// Members whose state can't be read count as without two-factor authentication.
+func (m *ProjectManager) checkTwoFactorMembers(group *gitlab.Group, settings *gitlab.UpdateGroupOptions) (*gitlab.UpdateGroupOptions, error) {
+	if settings.RequireTwoFactorAuth == nil || !*settings.RequireTwoFactorAuth || group.RequireTwoFactorAuth {
+		return settings, nil
+	}
+	path := m.config.GroupName
+
+	members, checked, err := m.membersWithoutTwoFactor(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return settings, nil
+	}
+
+	grace := group.TwoFactorGracePeriod
+	if settings.TwoFactorGracePeriod != nil {
+		grace = *settings.TwoFactorGracePeriod
+	}
+	affected := fmt.Sprintf("%d member(s) without two-factor authentication", len(members))
+	if !checked {
+		affected = fmt.Sprintf("%d member(s), whose two-factor authentication can't be checked without administrator access,", len(members))
+	}
+	message := fmt.Sprintf("Requiring two-factor authentication in group %s locks out %s unless they set it up within %d hours: %s",
+		path, affected, grace, strings.Join(members, ", "))
+
+	switch m.config.TwoFactorMembers {
+	case config.TwoFactorMembersError:
+		return nil, fmt.Errorf("%s (two_factor_noncompliant_members: error)", message)
+	case config.TwoFactorMembersSkip:
+		m.warn(path, "%s. Skipping group_settings.require_two_factor_authentication.", message)
+		m.BlockedChanges[path] = append(m.BlockedChanges[path], "group_settings.require_two_factor_authentication")
+		skipped := *settings
+		skipped.RequireTwoFactorAuth = nil
+		return &skipped, nil
+	}
+
+	m.warn(path, "%s.", message)
+	return settings, nil
+}
+
+// membersWithoutTwoFactor returns the usernames of the active direct members of the group
+// without two-factor authentication, and whether their state could be checked. Without
+// administrator access all active members are returned.
+func (m *ProjectManager) membersWithoutTwoFactor(group string) ([]string, bool, error) {
+	checked := false
+	if m.usersClient != nil {
+		user, _, err := m.usersClient.CurrentUser(m.withContext())
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get the current user: %v", err)
+		}
+		checked = user.IsAdmin
+	}
+
+	var members []string
+	opt := &gitlab.ListGroupMembersOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := m.groupsClient.ListGroupMembers(group, opt, m.withContext())
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to list members of group %s: %v", group, err)
+		}
+		for _, member := range page {
+			if member.State != "" && member.State != "active" {
+				continue
+			}
+			if checked {
+				user, _, err := m.usersClient.GetUser(member.ID, gitlab.GetUsersOptions{}, m.withContext())
+				if err != nil {
+					return nil, false, fmt.Errorf("failed to get user %s: %v", member.Username, err)
+				}
+				if user.TwoFactorEnabled {
+					continue
+				}
+			}
+			members = append(members, member.Username)
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return members, checked, nil
+}
@@ -0,0 +1,85 @@
+package gitlab
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestEnsureGroupSettingsTwoFactor(t *testing.T) {
+	tests := []struct {
+		mode     string
+		admin    bool
+		wantErr  bool
+		required bool
+		warning  string
+	}{
+		{mode: "warn", admin: true, required: true, warning: "locks out 1 member(s) without two-factor authentication unless they set it up within 24 hours: bob"},
+		{mode: "warn", admin: false, required: true, warning: "locks out 2 member(s), whose two-factor authentication can't be checked without administrator access, unless they set it up within 24 hours: alice, bob"},
+		{mode: "skip", admin: true, required: false, warning: "Skipping group_settings.require_two_factor_authentication"},
+		{mode: "error", admin: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cfg, err := config.Parse(writeTestFile(t, "config.json", `{
+				"group_name": "example",
+				"group_settings": {"require_two_factor_authentication": true, "two_factor_grace_period": 24},
+				"two_factor_noncompliant_members": "`+tt.mode+`"
+			}`))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			client := newTestClient()
+			client.SetAdmin(tt.admin)
+			client.AddUser(&gitlab.User{ID: 7, Username: "alice", TwoFactorEnabled: true})
+			client.AddUser(&gitlab.User{ID: 8, Username: "bob"})
+			client.AddUser(&gitlab.User{ID: 9, Username: "carol"})
+			client.AddGroupMember(1, &gitlab.GroupMember{ID: 7, Username: "alice", State: "active", AccessLevel: gitlab.OwnerPermissions})
+			client.AddGroupMember(1, &gitlab.GroupMember{ID: 8, Username: "bob", State: "active", AccessLevel: gitlab.DeveloperPermissions})
+			client.AddGroupMember(1, &gitlab.GroupMember{ID: 9, Username: "carol", State: "blocked", AccessLevel: gitlab.DeveloperPermissions})
+
+			logger, hook := test.NewNullLogger()
+			manager := newTestManager(client, cfg)
+			manager.logger = logrus.NewEntry(logger)
+			manager.usersClient = client.Users
+
+			err = manager.EnsureGroupSettings(false)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "bob") {
+					t.Errorf("Expected an error naming bob, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			group, _, _ := client.Groups.GetGroup(1, nil)
+			if group.RequireTwoFactorAuth != tt.required || group.TwoFactorGracePeriod != 24 {
+				t.Errorf("Expected require_two_factor_authentication %v with a grace period of 24 hours, got %v and %d", tt.required, group.RequireTwoFactorAuth, group.TwoFactorGracePeriod)
+			}
+
+			var warnings []string
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel {
+					warnings = append(warnings, entry.Message)
+				}
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.warning) {
+				t.Errorf("Expected a warning containing %q, got %v", tt.warning, warnings)
+			}
+
+			blocked := manager.BlockedChanges["example"]
+			if tt.required == (len(blocked) == 1) {
+				t.Errorf("Expected require_two_factor_authentication to be blocked only when skipped, got %v", blocked)
+			}
+		})
+	}
+}
@@ -10,10 +10,123 @@ type ProjectSettings struct {
 	General  gitlab.Project          `json:"project_settings,omitempty"`
 }
 
+// ComplianceResult is the compliance state of a single mandatory setting of a project.
+// Unavailable is set if the settings of the project could not be fetched, Inherited to the
+// level (e.g. group) the setting is locked by, so it can't be enforced per project. Weight is
+// the weight of the setting in the compliance score.
+type ComplianceResult struct {
+	Project     string      `json:"project"`
+	Subsection  string      `json:"subsection"`
+	Setting     string      `json:"setting"`
+	Actual      interface{} `json:"actual"`
+	Expected    interface{} `json:"expected"`
+	Compliant   bool        `json:"compliant"`
+	Unavailable bool        `json:"unavailable,omitempty"`
+	Inherited   string      `json:"inherited,omitempty"`
+	Missing     []string    `json:"missing,omitempty"`
+	Weight      float64     `json:"weight"`
+}
+
+// Status returns PASS for compliant settings, INHERITED for non-compliant settings locked by
+// the group or instance and FAIL otherwise
+func (r ComplianceResult) Status() string {
+	switch {
+	case r.Compliant:
+		return "PASS"
+	case r.Inherited != "":
+		return "INHERITED"
+	default:
+		return "FAIL"
+	}
+}
+
+// ChangeLogEntry is a single altered setting of a project. Changes of list settings either
+// have From and To set to the complete lists, or, as ListDiff, only the Removed and Added
+// elements.
+type ChangeLogEntry struct {
+	Project    string      `json:"project"`
+	Subsection string      `json:"subsection"`
+	Setting    string      `json:"setting"`
+	From       interface{} `json:"from,omitempty"`
+	To         interface{} `json:"to,omitempty"`
+	ListDiff   bool        `json:"list_diff,omitempty"`
+	Removed    []string    `json:"removed,omitempty"`
+	Added      []string    `json:"added,omitempty"`
+}
+
+// RunSummary is the outcome of a sync run, passed to the post run hook as JSON
+type RunSummary struct {
+	Dryrun          bool     `json:"dryrun"`
+	Projects        int      `json:"projects"`
+	Errors          int      `json:"errors"`
+	ChangedProjects []string `json:"changed_projects"`
+}
+
+// ComplianceReportData groups the compliance results by project and subsection. It is the
+// context passed to the compliance email templates. Score is the overall compliance score in
+// percent.
+type ComplianceReportData struct {
+	Projects     []ComplianceProject
+	Total        int
+	NonCompliant int
+	Score        float64
+}
+
+// ComplianceProject holds the compliance results and score of a single project
+type ComplianceProject struct {
+	Name        string
+	Compliant   bool
+	Score       float64
+	Subsections []ComplianceSubsection
+}
+
+// ComplianceSubsection holds the compliance results of a config subsection of a project
+type ComplianceSubsection struct {
+	Name     string
+	Settings []ComplianceResult
+}
+
+// newComplianceReportData groups the sorted compliance results. The scores are those of all
+// results, the results may be filtered by the report options.
+func newComplianceReportData(results []ComplianceResult, scores ComplianceScores) ComplianceReportData {
+	data := ComplianceReportData{Projects: make([]ComplianceProject, 0), Score: scores.Overall}
+
+	for _, result := range results {
+		if len(data.Projects) == 0 || data.Projects[len(data.Projects)-1].Name != result.Project {
+			data.Projects = append(data.Projects, ComplianceProject{Name: result.Project, Compliant: true, Score: scores.Projects[result.Project]})
+		}
+		project := &data.Projects[len(data.Projects)-1]
+
+		if len(project.Subsections) == 0 || project.Subsections[len(project.Subsections)-1].Name != result.Subsection {
+			project.Subsections = append(project.Subsections, ComplianceSubsection{Name: result.Subsection})
+		}
+		subsection := &project.Subsections[len(project.Subsections)-1]
+
+		subsection.Settings = append(subsection.Settings, result)
+		data.Total++
+		if !result.Compliant {
+			project.Compliant = false
+			data.NonCompliant++
+		}
+	}
+
+	return data
+}
+
 type groupsClient interface {
-	GetGroup(gid interface{}, options ...gitlab.RequestOptionFunc) (*gitlab.Group, *gitlab.Response, error)
+	GetGroup(gid interface{}, opt *gitlab.GetGroupOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Group, *gitlab.Response, error)
 	ListGroupProjects(gid interface{}, opt *gitlab.ListGroupProjectsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error)
-	ListSubgroups(gid interface{}, opt *gitlab.ListSubgroupsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Group, *gitlab.Response, error)
+	ListSubGroups(gid interface{}, opt *gitlab.ListSubGroupsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Group, *gitlab.Response, error)
+	ListGroupMembers(gid interface{}, opt *gitlab.ListGroupMembersOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.GroupMember, *gitlab.Response, error)
+	UpdateGroup(gid interface{}, opt *gitlab.UpdateGroupOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Group, *gitlab.Response, error)
+}
+
+type approvalSettingLocksClient interface {
+	ApprovalSettingLocks(pid interface{}, options ...gitlab.RequestOptionFunc) (map[string]string, *gitlab.Response, error)
+}
+
+type metadataClient interface {
+	GetMetadata(options ...gitlab.RequestOptionFunc) (*gitlab.Metadata, *gitlab.Response, error)
 }
 
 type projectsClient interface {
@@ -21,7 +134,15 @@ type projectsClient interface {
 		*gitlab.Response, error)
 	GetApprovalConfiguration(pid interface{}, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovals, *gitlab.Response, error)
 	GetProject(pid interface{}, opt *gitlab.GetProjectOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error)
+	GetProjectLanguages(pid interface{}, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectLanguages, *gitlab.Response, error)
+	ListUserProjects(uid interface{}, opt *gitlab.ListProjectsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error)
 	EditProject(pid interface{}, opt *gitlab.EditProjectOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error)
+	GetProjectApprovalRules(pid interface{}, opt *gitlab.GetProjectApprovalRulesListsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.ProjectApprovalRule,
+		*gitlab.Response, error)
+	CreateProjectApprovalRule(pid interface{}, opt *gitlab.CreateProjectLevelRuleOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovalRule,
+		*gitlab.Response, error)
+	UpdateProjectApprovalRule(pid interface{}, approvalRule int, opt *gitlab.UpdateProjectLevelRuleOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectApprovalRule,
+		*gitlab.Response, error)
 }
 
 type protectedBranchesClient interface {
@@ -29,6 +150,9 @@ type protectedBranchesClient interface {
 		*gitlab.Response, error)
 	UnprotectRepositoryBranches(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error)
 	GetProtectedBranch(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch, *gitlab.Response, error)
+	ListProtectedBranches(pid interface{}, opt *gitlab.ListProtectedBranchesOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.ProtectedBranch, *gitlab.Response, error)
+	UpdateProtectedBranch(pid interface{}, branch string, opt *gitlab.UpdateProtectedBranchOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedBranch,
+		*gitlab.Response, error)
 }
 
 type protectedTagsClient interface {
@@ -38,22 +162,69 @@ type protectedTagsClient interface {
 	GetProtectedTag(pid interface{}, tag string, options ...gitlab.RequestOptionFunc) (*gitlab.ProtectedTag, *gitlab.Response, error)
 }
 
+type projectAccessTokensClient interface {
+	ListProjectAccessTokens(pid interface{}, opt *gitlab.ListProjectAccessTokensOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.ProjectAccessToken,
+		*gitlab.Response, error)
+	CreateProjectAccessToken(pid interface{}, opt *gitlab.CreateProjectAccessTokenOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectAccessToken,
+		*gitlab.Response, error)
+	RevokeProjectAccessToken(pid interface{}, id int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error)
+}
+
+type repositoryFilesClient interface {
+	GetFile(pid interface{}, fileName string, opt *gitlab.GetFileOptions, options ...gitlab.RequestOptionFunc) (*gitlab.File, *gitlab.Response, error)
+	CreateFile(pid interface{}, fileName string, opt *gitlab.CreateFileOptions, options ...gitlab.RequestOptionFunc) (*gitlab.FileInfo, *gitlab.Response, error)
+	UpdateFile(pid interface{}, fileName string, opt *gitlab.UpdateFileOptions, options ...gitlab.RequestOptionFunc) (*gitlab.FileInfo, *gitlab.Response, error)
+}
+
+type repositoriesClient interface {
+	ListTree(pid interface{}, opt *gitlab.ListTreeOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.TreeNode, *gitlab.Response, error)
+}
+
+type complianceFrameworksClient interface {
+	ComplianceFrameworkID(namespace string, name string) (string, error)
+	SetProjectComplianceFramework(projectID int, frameworkID string) error
+}
+
+type groupVariablesClient interface {
+	ListVariables(gid interface{}, opt *gitlab.ListGroupVariablesOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.GroupVariable, *gitlab.Response, error)
+	CreateVariable(gid interface{}, opt *gitlab.CreateGroupVariableOptions, options ...gitlab.RequestOptionFunc) (*gitlab.GroupVariable, *gitlab.Response, error)
+	UpdateVariable(gid interface{}, key string, opt *gitlab.UpdateGroupVariableOptions, options ...gitlab.RequestOptionFunc) (*gitlab.GroupVariable, *gitlab.Response, error)
+	RemoveVariable(gid interface{}, key string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error)
+}
+
+type projectVariablesClient interface {
+	ListVariables(pid interface{}, opt *gitlab.ListProjectVariablesOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.ProjectVariable, *gitlab.Response, error)
+	CreateVariable(pid interface{}, opt *gitlab.CreateProjectVariableOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectVariable, *gitlab.Response, error)
+	UpdateVariable(pid interface{}, key string, opt *gitlab.UpdateProjectVariableOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectVariable, *gitlab.Response, error)
+}
+
+type projectMirrorsClient interface {
+	ListProjectMirror(pid interface{}, opt *gitlab.ListProjectMirrorOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.ProjectMirror, *gitlab.Response, error)
+	EditProjectMirror(pid interface{}, mirror int, opt *gitlab.EditProjectMirrorOptions, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectMirror, *gitlab.Response, error)
+}
+
+type groupMembersClient interface {
+	AddGroupMember(gid interface{}, opt *gitlab.AddGroupMemberOptions, options ...gitlab.RequestOptionFunc) (*gitlab.GroupMember, *gitlab.Response, error)
+	EditGroupMember(gid interface{}, user int, opt *gitlab.EditGroupMemberOptions, options ...gitlab.RequestOptionFunc) (*gitlab.GroupMember, *gitlab.Response, error)
+	RemoveGroupMember(gid interface{}, user int, opt *gitlab.RemoveGroupMemberOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error)
+	ShareWithGroup(gid interface{}, opt *gitlab.ShareWithGroupOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Group, *gitlab.Response, error)
+	DeleteShareWithGroup(gid interface{}, groupID int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error)
+}
+
+type usersClient interface {
+	GetUser(user int, opt gitlab.GetUsersOptions, options ...gitlab.RequestOptionFunc) (*gitlab.User, *gitlab.Response, error)
+	CurrentUser(options ...gitlab.RequestOptionFunc) (*gitlab.User, *gitlab.Response, error)
+}
+
 type branchesClient interface {
 	CreateBranch(pid interface{}, opt *gitlab.CreateBranchOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Branch, *gitlab.Response, error)
 	GetBranch(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.Branch, *gitlab.Response, error)
+	DeleteBranch(pid interface{}, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error)
+	ListBranches(pid interface{}, opt *gitlab.ListBranchesOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Branch, *gitlab.Response, error)
 }
 
-var (
-	listGroupProjectOps = &gitlab.ListGroupProjectsOptions{
-		ListOptions: gitlab.ListOptions{
-			PerPage: 100,
-		},
-		Archived: gitlab.Bool(false),
-	}
-
-	listSubgroupOps = &gitlab.ListSubgroupsOptions{
-		ListOptions: gitlab.ListOptions{
-			PerPage: 100,
-		},
-	}
-)
+var listSubgroupOps = &gitlab.ListSubGroupsOptions{
+	ListOptions: gitlab.ListOptions{
+		PerPage: 100,
+	},
+}
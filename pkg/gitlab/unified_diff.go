@@ -0,0 +1,90 @@
+package gitlab
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// changeLogUnifiedDiff renders the change log like diff -u: each project is a file listing its
+// changed settings, a/ before and b/ after the sync, and each setting change is a hunk headed
+// by its subsection. Changes of list settings remove and add single elements. The entries are
+// sorted by project, subsection and setting whatever --sort says, so the diffs of two runs can
+// be compared.
+func changeLogUnifiedDiff(entries []ChangeLogEntry) string {
+	sorted := append([]ChangeLogEntry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Project != sorted[j].Project {
+			return sorted[i].Project < sorted[j].Project
+		}
+		if sorted[i].Subsection != sorted[j].Subsection {
+			return sorted[i].Subsection < sorted[j].Subsection
+		}
+		return sorted[i].Setting < sorted[j].Setting
+	})
+
+	var b strings.Builder
+	var oldLine, newLine int
+	for i, entry := range sorted {
+		if i == 0 || sorted[i-1].Project != entry.Project {
+			fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", entry.Project, entry.Project)
+			oldLine, newLine = 0, 0
+		}
+
+		var removed, added []string
+		if entry.ListDiff {
+			for _, v := range entry.Removed {
+				removed = append(removed, diffLine(entry.Setting, v))
+			}
+			for _, v := range entry.Added {
+				added = append(added, diffLine(entry.Setting, v))
+			}
+		} else {
+			if entry.From != nil {
+				removed = append(removed, diffLine(entry.Setting, entry.From))
+			}
+			if entry.To != nil {
+				added = append(added, diffLine(entry.Setting, entry.To))
+			}
+		}
+		if len(removed) == 0 && len(added) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@ %s\n", hunkRange(oldLine, len(removed)), hunkRange(newLine, len(added)), entry.Subsection)
+		for _, line := range removed {
+			fmt.Fprintf(&b, "-%s\n", line)
+		}
+		for _, line := range added {
+			fmt.Fprintf(&b, "+%s\n", line)
+		}
+		oldLine += len(removed)
+		newLine += len(added)
+	}
+
+	return b.String()
+}
+
+// hunkRange returns the line range of a hunk with count lines after the first lines of the
+// file. Like diff -u, an empty range starts at the line before it.
+func hunkRange(first, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", first)
+	}
+	if count == 1 {
+		return strconv.Itoa(first + 1)
+	}
+
+	return fmt.Sprintf("%d,%d", first+1, count)
+}
+
+// diffLine renders the setting with its value as a single line, quoting multi-line values
+func diffLine(setting string, v interface{}) string {
+	s := fmt.Sprintf("%v", readableValue(v))
+	if strings.ContainsAny(s, "\r\n") {
+		s = strconv.Quote(s)
+	}
+
+	return setting + ": " + s
+}
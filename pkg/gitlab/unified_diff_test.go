@@ -0,0 +1,46 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestChangeLogUnifiedDiff(t *testing.T) {
+	// Unsorted, as with --sort changes
+	entries := []ChangeLogEntry{
+		{Project: "example/sub/bar", Subsection: "project_settings", Setting: "wiki_enabled", From: true, To: false},
+		{Project: "example/foo", Subsection: "project_settings", Setting: "visibility", From: "internal", To: "private"},
+		{Project: "example/foo", Subsection: "approval_settings", Setting: "reset_approvals_on_push", From: false, To: true},
+		{Project: "example/foo", Subsection: "project_settings", Setting: "topics", ListDiff: true, Removed: []string{"old"}, Added: []string{"go", "service"}},
+		{Project: "example/foo", Subsection: "project_settings", Setting: "description", To: gitlab.String("first\nsecond")},
+	}
+
+	expected := `--- a/example/foo
++++ b/example/foo
+@@ -1 +1 @@ approval_settings
+-reset_approvals_on_push: false
++reset_approvals_on_push: true
+@@ -1,0 +2 @@ project_settings
++description: "first\nsecond"
+@@ -2 +3,2 @@ project_settings
+-topics: old
++topics: go
++topics: service
+@@ -3 +5 @@ project_settings
+-visibility: internal
++visibility: private
+--- a/example/sub/bar
++++ b/example/sub/bar
+@@ -1 +1 @@ project_settings
+-wiki_enabled: true
++wiki_enabled: false
+`
+
+	if actual := changeLogUnifiedDiff(entries); actual != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, actual)
+	}
+	if actual := changeLogUnifiedDiff(nil); actual != "" {
+		t.Errorf("Expected an empty diff without changes, got\n%s", actual)
+	}
+}
@@ -0,0 +1,61 @@
+package gitlab
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Warning is a condition of a run which is neither a success nor an error, but deserves
+// attention, e.g. a project skipped as its repository is empty. Warnings of the run as a whole
+// have no project.
+type Warning struct {
+	Project string `json:"project,omitempty"`
+	Message string `json:"message"`
+}
+
+// warn logs the warning about the project and records it for the GenerateWarningsReport.
+// Unlike warnf it is never an error in strict mode.
+func (m *ProjectManager) warn(project string, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	m.logger.Warn(message)
+
+	m.AddWarning(project, message)
+}
+
+// AddWarning records a warning already logged, e.g. about the run before the ProjectManager
+// was created
+func (m *ProjectManager) AddWarning(project string, message string) {
+	m.warnings = append(m.warnings, Warning{Project: project, Message: message})
+}
+
+// Warnings returns the recorded warnings, those of the run first, followed by those of each
+// project sorted by project. The warnings of a project keep their order.
+func (m *ProjectManager) Warnings() []Warning {
+	warnings := append([]Warning{}, m.warnings...)
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Project < warnings[j].Project
+	})
+
+	return warnings
+}
+
+// GenerateWarningsReport prints to console the recorded warnings grouped by project, apart
+// from the errors which need action
+func (m *ProjectManager) GenerateWarningsReport() {
+	warnings := m.Warnings()
+	if len(warnings) == 0 {
+		return
+	}
+
+	fmt.Fprintf(m.out, "\nWARNINGS\n")
+	for i, w := range warnings {
+		if i == 0 || warnings[i-1].Project != w.Project {
+			name := w.Project
+			if name == "" {
+				name = "(run)"
+			}
+			fmt.Fprintf(m.out, "  %s\n", name)
+		}
+		fmt.Fprintf(m.out, "    %s\n", w.Message)
+	}
+}
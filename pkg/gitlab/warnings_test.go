@@ -0,0 +1,72 @@
+package gitlab
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/config"
+)
+
+func TestWarnings(t *testing.T) {
+	manager := newTestManager(newTestClient(), &config.Config{GroupName: "example"})
+	out := &bytes.Buffer{}
+	manager.out = out
+
+	manager.GenerateWarningsReport()
+	if out.Len() != 0 {
+		t.Errorf("Expected no report without warnings, got %q", out.String())
+	}
+
+	manager.warn("example/sub/bar", "Skipping repo %s as it is empty.", "example/sub/bar")
+	if err := manager.UseProjectConfig(gitlab.Project{PathWithNamespace: "example/foo"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	manager.warnf("first of %s", "example/foo")
+	manager.warnf("second of %s", "example/foo")
+	manager.AddWarning("", "GitLab is no enterprise edition.")
+
+	expected := []Warning{
+		{Message: "GitLab is no enterprise edition."},
+		{Project: "example/foo", Message: "first of example/foo"},
+		{Project: "example/foo", Message: "second of example/foo"},
+		{Project: "example/sub/bar", Message: "Skipping repo example/sub/bar as it is empty."},
+	}
+	if warnings := manager.Warnings(); !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("Expected the warnings %v, got %v", expected, warnings)
+	}
+	if manager.GetError() {
+		t.Errorf("Expected warnings not to set the error flag")
+	}
+
+	manager.GenerateWarningsReport()
+	report := "\nWARNINGS\n" +
+		"  (run)\n" +
+		"    GitLab is no enterprise edition.\n" +
+		"  example/foo\n" +
+		"    first of example/foo\n" +
+		"    second of example/foo\n" +
+		"  example/sub/bar\n" +
+		"    Skipping repo example/sub/bar as it is empty.\n"
+	if out.String() != report {
+		t.Errorf("Expected the report %q, got %q", report, out.String())
+	}
+}
+
+func TestWarningsStrict(t *testing.T) {
+	manager := newTestManager(newTestClient(), &config.Config{GroupName: "example", Strict: true})
+
+	// In strict mode warnf is an error, no warning
+	manager.warnf("inherited setting")
+	manager.warn("example/foo", "Skipping repo example/foo as it is empty.")
+
+	expected := []Warning{{Project: "example/foo", Message: "Skipping repo example/foo as it is empty."}}
+	if warnings := manager.Warnings(); !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("Expected the warnings %v, got %v", expected, warnings)
+	}
+	if !manager.GetError() {
+		t.Errorf("Expected warnf to set the error flag in strict mode")
+	}
+}
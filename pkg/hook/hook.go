@@ -0,0 +1,50 @@
+// Package hook notifies downstream jobs once a run completed, either by executing a command
+// or by posting to a webhook URL. Both receive the run summary as JSON payload.
+package hook
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Timeout limits the duration of webhook requests
+const Timeout = 30 * time.Second
+
+// Command executes the command with its arguments, passing the payload on stdin. The
+// combined output is returned with the error if the command fails.
+func Command(command []string, payload []byte) error {
+	if len(command) == 0 {
+		return fmt.Errorf("no command given")
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("command %s failed: %v: %s", command[0], err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// Post posts the payload as JSON to the URL, failing on non 2xx responses
+func Post(url string, payload []byte) error {
+	client := &http.Client{Timeout: Timeout}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook responded with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
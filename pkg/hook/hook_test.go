@@ -0,0 +1,48 @@
+package hook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "summary.json")
+	if err := Command([]string{"sh", "-c", `cat > "$0"`, out}, []byte(`{"projects": 2}`)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	written, err := ioutil.ReadFile(out)
+	if err != nil || string(written) != `{"projects": 2}` {
+		t.Errorf("Expected the payload on stdin, got %q (%v)", written, err)
+	}
+
+	if err := Command([]string{"sh", "-c", "echo broken >&2; exit 3"}, nil); err == nil || err.Error() != "command sh failed: exit status 3: broken" {
+		t.Errorf("Expected the failure with its output, got %v", err)
+	}
+}
+
+func TestPost(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+		if r.URL.Path == "/fail" {
+			http.Error(w, "nope", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	if err := Post(server.URL+"/ok", []byte(`{"projects": 2}`)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if received != `{"projects": 2}` {
+		t.Errorf("Expected the payload to be posted, got %q", received)
+	}
+
+	if err := Post(server.URL+"/fail", nil); err == nil {
+		t.Errorf("Expected an error on a 500 response")
+	}
+}
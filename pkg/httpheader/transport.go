@@ -0,0 +1,50 @@
+package httpheader
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// RequestIDHeader is the header carrying the correlation ID of a run
+const RequestIDHeader = "X-Request-ID"
+
+// Transport is a http.RoundTripper adding the User-Agent and the correlation ID of the run
+// to each request, so the requests of a run can be found in the GitLab logs
+type Transport struct {
+	Base      http.RoundTripper
+	UserAgent string
+	RequestID string
+}
+
+// RoundTrip executes a copy of the request with the headers added with the base transport.
+// A User-Agent already set on the request, e.g. by go-gitlab, is kept.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// A RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	if t.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", t.UserAgent)
+	}
+	if t.RequestID != "" {
+		req.Header.Set(RequestIDHeader, t.RequestID)
+	}
+
+	return base.RoundTrip(req)
+}
+
+// NewRequestID returns a random (version 4) UUID as correlation ID
+func NewRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate request id: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,53 @@
+package httpheader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestTransportAddsHeaders(t *testing.T) {
+	var userAgents, requestIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		requestIDs = append(requestIDs, r.Header.Get(RequestIDHeader))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{UserAgent: "enforcer/1.0", RequestID: "run-1"}}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if req.Header.Get(RequestIDHeader) != "" {
+		t.Errorf("Expected the original request to be left unchanged")
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("User-Agent", "go-gitlab")
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if userAgents[0] != "enforcer/1.0" || userAgents[1] != "go-gitlab" {
+		t.Errorf("Expected the User-Agent to be set unless present, got %v", userAgents)
+	}
+	if requestIDs[0] != "run-1" || requestIDs[1] != "run-1" {
+		t.Errorf("Expected the same request id on all requests, got %v", requestIDs)
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	a, err := NewRequestID()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	b, _ := NewRequestID()
+	if !uuid.MatchString(a) || a == b {
+		t.Errorf("Expected distinct version 4 UUIDs, got %s and %s", a, b)
+	}
+}
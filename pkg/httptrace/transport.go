@@ -0,0 +1,131 @@
+package httptrace
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultMaxBody is the number of body bytes logged if Transport.MaxBody is not set
+const DefaultMaxBody = 2048
+
+const redacted = "[REDACTED]"
+
+var (
+	// sensitiveHeaders are never logged with their value
+	sensitiveHeaders = []string{"Authorization", "Cookie", "Job-Token", "Private-Token", "Set-Cookie"}
+
+	// sensitiveJSON matches JSON string values of keys like token, runners_token or password
+	sensitiveJSON = regexp.MustCompile(`("[^"]*(?i:token|password|secret)[^"]*"\s*:\s*)"[^"]*"`)
+
+	// variableValueJSON matches the JSON string values of CI/CD variables, which may be masked
+	variableValueJSON = regexp.MustCompile(`("value"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+	// sensitiveQuery matches query parameters like private_token
+	sensitiveQuery = regexp.MustCompile(`((?i:token|password|secret)[^=&]*=)[^&]*`)
+)
+
+// Transport is a http.RoundTripper logging method, URL, status and the truncated bodies of
+// each request. Authentication headers and secrets in URLs and JSON bodies are redacted, as
+// are the values of CI/CD variables.
+type Transport struct {
+	Base    http.RoundTripper
+	Logger  logrus.FieldLogger
+	MaxBody int
+}
+
+// RoundTrip logs the request, executes it with the base transport and logs the response
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	var reqBody []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+
+	variables := isVariablesPath(req.URL.Path)
+	t.Logger.Infof("---> %s %s %s %s", req.Method, redactURL(req.URL.String()), redactHeaders(req.Header), t.truncate(reqBody, variables))
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		t.Logger.Infof("<--- %s %s failed: %v", req.Method, redactURL(req.URL.String()), err)
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	t.Logger.Infof("<--- %s %s %s %s", req.Method, redactURL(req.URL.String()), resp.Status, t.truncate(respBody, variables))
+
+	return resp, nil
+}
+
+// truncate redacts the body, including the variable values of the bodies of the variables API,
+// and cuts it to MaxBody bytes
+func (t *Transport) truncate(body []byte, variables bool) string {
+	max := t.MaxBody
+	if max <= 0 {
+		max = DefaultMaxBody
+	}
+
+	s := sensitiveJSON.ReplaceAllString(string(body), `$1"`+redacted+`"`)
+	if variables {
+		s = variableValueJSON.ReplaceAllString(s, `$1"`+redacted+`"`)
+	}
+	if len(s) > max {
+		return s[:max] + "...(truncated)"
+	}
+
+	return s
+}
+
+// isVariablesPath reports whether the path is one of the CI/CD variables API of a group,
+// project or the instance, e.g. /api/v4/projects/1/variables/KEY
+func isVariablesPath(path string) bool {
+	return strings.HasSuffix(path, "/variables") || strings.Contains(path, "/variables/")
+}
+
+// redactURL redacts secrets passed as query parameters
+func redactURL(u string) string {
+	return sensitiveQuery.ReplaceAllString(u, "${1}"+redacted)
+}
+
+// redactHeaders formats the headers sorted by name, hiding the values of sensitive ones
+func redactHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(header[name], ",")
+		for _, sensitive := range sensitiveHeaders {
+			if http.CanonicalHeaderKey(name) == sensitive {
+				value = redacted
+			}
+		}
+		parts = append(parts, name+"="+value)
+	}
+
+	return "[" + strings.Join(parts, " ") + "]"
+}
@@ -0,0 +1,89 @@
+package httptrace
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestTransportRedactsSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 1, "runners_token": "GR1348941abc", "name": "foo"}`))
+	}))
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(out)
+
+	client := &http.Client{Transport: &Transport{Logger: logger}}
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/projects/1?private_token=s3cr3t", strings.NewReader(`{"password": "hunter2"}`))
+	req.Header.Set("Private-Token", "glpat-xyz")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "GR1348941abc") {
+		t.Errorf("Expected the response body to be passed on unchanged, got %s", body)
+	}
+
+	log := out.String()
+	for _, secret := range []string{"s3cr3t", "glpat-xyz", "hunter2", "GR1348941abc"} {
+		if strings.Contains(log, secret) {
+			t.Errorf("Expected %q to be redacted, got:\n%s", secret, log)
+		}
+	}
+	for _, expected := range []string{"PUT", "/projects/1", "200 OK", `\"name\": \"foo\"`} {
+		if !strings.Contains(log, expected) {
+			t.Errorf("Expected %q to be logged, got:\n%s", expected, log)
+		}
+	}
+}
+
+func TestTransportTruncatesBodies(t *testing.T) {
+	transport := &Transport{MaxBody: 5}
+
+	if got := transport.truncate([]byte("0123456789"), false); got != "01234...(truncated)" {
+		t.Errorf("Expected truncated body, got %q", got)
+	}
+}
+
+func TestTransportRedactsVariableValues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"key": "DEPLOY_TOKEN", "value": "dXNlcjpwYXNz\"x", "masked": true, "protected": true}`))
+	}))
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(out)
+
+	client := &http.Client{Transport: &Transport{Logger: logger}}
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v4/projects/1/variables",
+		strings.NewReader(`{"key": "DEPLOY_TOKEN", "value": "dXNlcjpwYXNz\"x", "masked": true, "protected": true}`))
+
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	log := out.String()
+	if strings.Contains(log, "dXNlcjpwYXNz") {
+		t.Errorf("Expected the variable value to be redacted, got:\n%s", log)
+	}
+	if strings.Count(log, "DEPLOY_TOKEN") != 2 || strings.Count(log, redacted) != 2 {
+		t.Errorf("Expected the key to be logged and the value redacted in request and response, got:\n%s", log)
+	}
+
+	// Value fields of other APIs are logged
+	transport := &Transport{}
+	if got := transport.truncate([]byte(`{"value": "visible"}`), false); !strings.Contains(got, "visible") {
+		t.Errorf("Expected values outside the variables API to be logged, got %q", got)
+	}
+}
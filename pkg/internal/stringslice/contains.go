@@ -1,5 +1,7 @@
 package stringslice
 
+import "sort"
+
 // Contains returns weather the given slice contains the given element
 func Contains(elem string, slice []string) bool {
   for _, s := range slice {
@@ -10,3 +12,23 @@ func Contains(elem string, slice []string) bool {
 
   return false
 }
+
+// SameElements returns whether both slices contain the same elements, regardless of their order
+func SameElements(a []string, b []string) bool {
+  if len(a) != len(b) {
+    return false
+  }
+
+  sortedA := append([]string{}, a...)
+  sortedB := append([]string{}, b...)
+  sort.Strings(sortedA)
+  sort.Strings(sortedB)
+
+  for i := range sortedA {
+    if sortedA[i] != sortedB[i] {
+      return false
+    }
+  }
+
+  return true
+}
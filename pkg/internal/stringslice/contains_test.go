@@ -13,3 +13,17 @@ func TestContains(t *testing.T) {
     t.Errorf("Expected contains to returns false as the slice does not contain the element, but it returned true")
   }
 }
+
+func TestSameElements(t *testing.T) {
+  if !SameElements([]string{"api", "read_repository"}, []string{"read_repository", "api"}) {
+    t.Errorf("Expected the slices to have the same elements regardless of their order, but they did not")
+  }
+
+  if SameElements([]string{"api", "api"}, []string{"api", "read_repository"}) {
+    t.Errorf("Expected duplicates not to hide a missing element, but the slices had the same elements")
+  }
+
+  if SameElements([]string{"api"}, []string{"api", "read_repository"}) {
+    t.Errorf("Expected slices of different length not to have the same elements, but they had")
+  }
+}
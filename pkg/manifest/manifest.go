@@ -0,0 +1,253 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/sink"
+)
+
+// Statuses of a run
+const (
+	// StatusSuccess is a run completed without errors
+	StatusSuccess = "success"
+	// StatusFailed is a run completed with errors
+	StatusFailed = "failed"
+	// StatusAborted is a run which ended before completing, e.g. by a fatal error
+	StatusAborted = "aborted"
+)
+
+// Statuses of a project
+const (
+	ProjectOK           = "ok"
+	ProjectChanged      = "changed"
+	ProjectNoncompliant = "noncompliant"
+	ProjectError        = "error"
+	ProjectSkipped      = "skipped"
+)
+
+// Manifest summarizes a sync or compliance run, the machine-readable artifact of the run.
+// Compliance runs also record the compliance score in percent.
+type Manifest struct {
+	Command         string         `json:"command"`
+	Status          string         `json:"status"`
+	ConfigHash      string         `json:"config_hash"`
+	Groups          []string       `json:"groups"`
+	Dryrun          bool           `json:"dryrun"`
+	StartedAt       time.Time      `json:"started_at"`
+	FinishedAt      time.Time      `json:"finished_at"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	Counts          map[string]int `json:"counts"`
+	ComplianceScore *float64       `json:"compliance_score,omitempty"`
+	Projects        []Project      `json:"projects"`
+	Errors          []string       `json:"errors"`
+}
+
+// Project is the outcome of a run for a single project
+type Project struct {
+	Path            string   `json:"path"`
+	Status          string   `json:"status"`
+	ComplianceScore *float64 `json:"compliance_score,omitempty"`
+	Errors          []string `json:"errors,omitempty"`
+}
+
+// Recorder collects the manifest of a run. As logrus hook it records the errors logged while
+// a project is processed for the project, all others for the run. Errors logged once the run
+// completed, like the final fatal error summary, are not recorded.
+type Recorder struct {
+	mu        sync.Mutex
+	manifest  Manifest
+	projects  map[string]*Project
+	order     []string
+	current   string
+	completed bool
+	written   bool
+	now       func() time.Time
+}
+
+// New returns the recorder of a run of the command, started now
+func New(command string, configHash string, groups []string, dryrun bool) *Recorder {
+	return newRecorder(command, configHash, groups, dryrun, time.Now)
+}
+
+// newRecorder returns the recorder of a run reading the time from now
+func newRecorder(command string, configHash string, groups []string, dryrun bool, now func() time.Time) *Recorder {
+	return &Recorder{
+		manifest: Manifest{
+			Command:    command,
+			ConfigHash: configHash,
+			Groups:     groups,
+			Dryrun:     dryrun,
+			StartedAt:  now(),
+			Counts:     map[string]int{},
+			Errors:     []string{},
+		},
+		projects: make(map[string]*Project),
+		now:      now,
+	}
+}
+
+// Levels returns the levels recorded as errors
+func (r *Recorder) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+// Fire records the message of the entry as error of the current project or of the run
+func (r *Recorder) Fire(entry *logrus.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.completed {
+		return nil
+	}
+	if p, ok := r.projects[r.current]; ok {
+		p.Status = ProjectError
+		p.Errors = append(p.Errors, entry.Message)
+		return nil
+	}
+	r.manifest.Errors = append(r.manifest.Errors, entry.Message)
+
+	return nil
+}
+
+// AddProjects lists the projects of the run as skipped, until they are started
+func (r *Recorder) AddProjects(paths []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, path := range paths {
+		r.addProject(path, ProjectSkipped)
+	}
+}
+
+// StartProject attributes the following errors to the project, until EndProject
+func (r *Recorder) StartProject(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addProject(path, ProjectOK)
+	r.current = path
+}
+
+// EndProject attributes the following errors to the run again
+func (r *Recorder) EndProject() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.current = ""
+}
+
+// MarkProjects sets the status of the projects processed without errors, e.g. to changed
+func (r *Recorder) MarkProjects(status string, paths []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, path := range paths {
+		if p, ok := r.projects[path]; ok && p.Status == ProjectOK {
+			p.Status = status
+		}
+	}
+}
+
+// SetCounts sets the counters of the run, e.g. projects.processed
+func (r *Recorder) SetCounts(counts map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, value := range counts {
+		r.manifest.Counts[name] = value
+	}
+}
+
+// SetComplianceScores sets the overall compliance score of the run and those of the projects
+func (r *Recorder) SetComplianceScores(overall float64, projects map[string]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.manifest.ComplianceScore = &overall
+	for path, score := range projects {
+		if p, ok := r.projects[path]; ok {
+			score := score
+			p.ComplianceScore = &score
+		}
+	}
+}
+
+// Complete marks the run as completed, errors logged afterwards are not recorded
+func (r *Recorder) Complete() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.completed = true
+}
+
+// Manifest returns the manifest of the run so far
+func (r *Recorder) Manifest() Manifest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := r.manifest
+	m.Counts = make(map[string]int, len(r.manifest.Counts))
+	for name, value := range r.manifest.Counts {
+		m.Counts[name] = value
+	}
+	m.Errors = append([]string{}, r.manifest.Errors...)
+	m.FinishedAt = r.now()
+	m.DurationSeconds = m.FinishedAt.Sub(m.StartedAt).Seconds()
+
+	m.Status = StatusSuccess
+	if len(m.Errors) > 0 {
+		m.Status = StatusFailed
+	}
+	m.Projects = make([]Project, 0, len(r.order))
+	for _, path := range r.order {
+		p := *r.projects[path]
+		if p.Status == ProjectError {
+			m.Status = StatusFailed
+		}
+		m.Projects = append(m.Projects, p)
+	}
+	if !r.completed {
+		m.Status = StatusAborted
+	}
+
+	return m
+}
+
+// Write writes the manifest as JSON to the path or s3:// URL. Only the first call writes, so
+// it can be called both deferred and from the exit handler of fatal errors.
+func (r *Recorder) Write(path string) error {
+	r.mu.Lock()
+	written := r.written
+	r.written = true
+	r.mu.Unlock()
+	if written {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(r.Manifest(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to convert manifest to json: %v", err)
+	}
+	if err := sink.Write(path, append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write manifest file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// addProject adds the project with the status, or sets the status of a listed one. The caller
+// must hold the lock.
+func (r *Recorder) addProject(path string, status string) {
+	if p, ok := r.projects[path]; ok {
+		p.Status = status
+		return
+	}
+
+	r.order = append(r.order, path)
+	r.projects[path] = &Project{Path: path, Status: status}
+}
@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRecorder(t *testing.T) {
+	start := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	now := start
+	r := newRecorder("sync", "abc", []string{"example"}, true, func() time.Time { return now })
+
+	logger, _ := test.NewNullLogger()
+	logger.AddHook(r)
+
+	r.AddProjects([]string{"example/foo", "example/sub/bar", "example/baz"})
+	logger.Error("failed to ensure group settings of group example")
+	r.StartProject("example/foo")
+	logger.Warn("only a warning")
+	r.EndProject()
+	r.StartProject("example/sub/bar")
+	logger.WithField("module", "project_manager").Errorf("failed to ensure tags of repo %s", "example/sub/bar")
+	r.EndProject()
+	r.MarkProjects(ProjectChanged, []string{"example/foo", "example/sub/bar"})
+	r.SetCounts(map[string]int{"projects.processed": 2})
+
+	now = start.Add(90 * time.Second)
+	if m := r.Manifest(); m.Status != StatusAborted {
+		t.Errorf("Expected an incomplete run to be aborted, got %s", m.Status)
+	}
+
+	r.Complete()
+	logger.Error("Error(s) encountered.")
+
+	expected := Manifest{
+		Command:         "sync",
+		Status:          StatusFailed,
+		ConfigHash:      "abc",
+		Groups:          []string{"example"},
+		Dryrun:          true,
+		StartedAt:       start,
+		FinishedAt:      now,
+		DurationSeconds: 90,
+		Counts:          map[string]int{"projects.processed": 2},
+		Projects: []Project{
+			{Path: "example/foo", Status: ProjectChanged},
+			{Path: "example/sub/bar", Status: ProjectError, Errors: []string{"failed to ensure tags of repo example/sub/bar"}},
+			{Path: "example/baz", Status: ProjectSkipped},
+		},
+		Errors: []string{"failed to ensure group settings of group example"},
+	}
+	if actual := r.Manifest(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected manifest\n%+v\ngot\n%+v", expected, actual)
+	}
+}
+
+func TestRecorderComplianceScores(t *testing.T) {
+	r := New("compliance", "abc", []string{"example"}, false)
+	r.StartProject("example/foo")
+	r.EndProject()
+	r.SetComplianceScores(75, map[string]float64{"example/foo": 50, "example/unknown": 100})
+	r.Complete()
+
+	m := r.Manifest()
+	if m.ComplianceScore == nil || *m.ComplianceScore != 75 {
+		t.Errorf("Expected the overall score 75, got %v", m.ComplianceScore)
+	}
+	if len(m.Projects) != 1 || m.Projects[0].ComplianceScore == nil || *m.Projects[0].ComplianceScore != 50 {
+		t.Errorf("Expected only the score 50 of example/foo, got %+v", m.Projects)
+	}
+}
+
+func TestRecorderSuccess(t *testing.T) {
+	r := New("compliance", "abc", []string{"example"}, false)
+	r.StartProject("example/foo")
+	r.EndProject()
+	r.Complete()
+
+	if m := r.Manifest(); m.Status != StatusSuccess || m.Projects[0].Status != ProjectOK {
+		t.Errorf("Expected a successful run, got %+v", m)
+	}
+}
+
+func TestRecorderWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	r := New("sync", "abc", []string{"example"}, false)
+	r.Complete()
+
+	if err := r.Write(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Only the first call writes, e.g. the exit handler after the deferred write
+	r.SetCounts(map[string]int{"projects.processed": 1})
+	if err := r.Write(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("Expected valid json, got %v", err)
+	}
+	if m["status"] != StatusSuccess || m["config_hash"] != "abc" || len(m["counts"].(map[string]interface{})) != 0 {
+		t.Errorf("Expected the manifest of the first write, got %s", b)
+	}
+}
+
+func TestRecorderLevels(t *testing.T) {
+	r := New("sync", "", nil, false)
+	for _, level := range r.Levels() {
+		if level > logrus.ErrorLevel {
+			t.Errorf("Expected only errors to be recorded, got %s", level)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultInterval is the minimum time between two progress log lines without a terminal
+const DefaultInterval = 30 * time.Second
+
+// Progress reports how many of the projects of a run are processed. On a terminal a single
+// line is kept up to date, otherwise the progress is logged at most once per interval. It is
+// safe for concurrent use, so projects may be processed in parallel.
+type Progress struct {
+	mu       sync.Mutex
+	out      io.Writer
+	logger   logrus.FieldLogger
+	terminal bool
+	interval time.Duration
+	total    int
+	count    int
+	started  time.Time
+	logged   time.Time
+	now      func() time.Time
+}
+
+// New returns a Progress for total projects. With terminal set, the progress line is written
+// to out, otherwise it is logged to the logger.
+func New(out io.Writer, logger logrus.FieldLogger, terminal bool, total int) *Progress {
+	p := &Progress{
+		out:      out,
+		logger:   logger,
+		terminal: terminal,
+		interval: DefaultInterval,
+		total:    total,
+		now:      time.Now,
+	}
+	p.started = p.now()
+
+	return p
+}
+
+// Next counts the project as started and reports it, e.g. [37/412] processing group/foo
+func (p *Progress) Next(project string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.count++
+	line := fmt.Sprintf("[%d/%d] processing %s", p.count, p.total, project)
+
+	if p.terminal {
+		// Return to the line start and clear the previous, possibly longer, line
+		fmt.Fprintf(p.out, "\r\033[K%s", line)
+		return
+	}
+
+	now := p.now()
+	if p.count == 1 || p.count == p.total || now.Sub(p.logged) >= p.interval {
+		p.logger.Infof("%s (%s elapsed)", line, now.Sub(p.started).Round(time.Second))
+		p.logged = now
+	}
+}
+
+// Done ends the progress line on a terminal and logs how many projects were processed
+func (p *Progress) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.terminal && p.count > 0 {
+		fmt.Fprintln(p.out)
+	}
+	p.logger.Infof("Processed %d/%d project(s) in %s.", p.count, p.total, p.now().Sub(p.started).Round(time.Second))
+}
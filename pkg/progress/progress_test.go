@@ -0,0 +1,74 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestProgressTerminal(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	out := &bytes.Buffer{}
+
+	p := New(out, logger, true, 100)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p.Next(fmt.Sprintf("group/project-%d", i))
+		}(i)
+	}
+	wg.Wait()
+	p.Done()
+
+	if !strings.Contains(out.String(), "\r\033[K[100/100] processing group/project-") {
+		t.Errorf("Expected the line to be updated up to 100/100, got %q", out.String())
+	}
+	if strings.Count(out.String(), "\n") != 1 || !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("Expected a single line ended by Done, got %q", out.String())
+	}
+}
+
+func TestProgressLog(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	out := &bytes.Buffer{}
+
+	now := time.Unix(0, 0)
+	p := New(out, logger, false, 4)
+	p.now = func() time.Time { return now }
+	p.started = now
+
+	p.Next("group/a")
+	now = now.Add(time.Second)
+	p.Next("group/b")
+	now = now.Add(DefaultInterval)
+	p.Next("group/c")
+	p.Next("group/d")
+
+	var lines []string
+	for _, entry := range hook.AllEntries() {
+		lines = append(lines, entry.Message)
+	}
+
+	expected := []string{
+		"[1/4] processing group/a (0s elapsed)",
+		"[3/4] processing group/c (31s elapsed)",
+		"[4/4] processing group/d (31s elapsed)",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected log lines %q, got %q", expected, lines)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing to be written without a terminal, got %q", out.String())
+	}
+}
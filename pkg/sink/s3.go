@@ -0,0 +1,101 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultS3Region is used if neither the env nor the shared config set a region
+const defaultS3Region = "us-east-1"
+
+// S3 uploads and downloads objects with the AWS SDK
+type S3 struct {
+	Client *s3.Client
+}
+
+// NewS3 returns an S3 sink configured by the default credential chain of the AWS SDK: the
+// standard env variables like AWS_ACCESS_KEY_ID, AWS_REGION and AWS_PROFILE, the shared
+// config and credentials files, web identity tokens, and container or EC2 instance roles.
+// AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL) selects an S3 compatible storage, whose objects
+// are addressed path-style.
+func NewS3(ctx context.Context) (*S3, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("s3: failed to load the AWS config: %v", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultS3Region
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL") != ""
+	})
+
+	return &S3{Client: client}, nil
+}
+
+// Put uploads the data as object key of the bucket
+func (s *S3) Put(ctx context.Context, bucket string, key string, data []byte) error {
+	if bucket == "" || key == "" {
+		return fmt.Errorf("s3: bucket and key must be set, got s3://%s/%s", bucket, key)
+	}
+
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(http.DetectContentType(data)),
+	})
+	if err != nil {
+		return fmt.Errorf("s3: failed to put s3://%s/%s: %v", bucket, key, err)
+	}
+
+	return nil
+}
+
+// Get downloads the object key of the bucket. Missing objects are reported as ErrNotExist.
+func (s *S3) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("s3: bucket and key must be set, got s3://%s/%s", bucket, key)
+	}
+
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) && status.HTTPStatusCode() == http.StatusNotFound {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("s3: failed to get s3://%s/%s: %v", bucket, key, err)
+	}
+	defer out.Body.Close()
+
+	body, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: failed to get s3://%s/%s: %v", bucket, key, err)
+	}
+
+	return body, nil
+}
+
+// firstEnv returns the value of the first set env variable
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,97 @@
+package sink
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setS3Env points the AWS SDK at the server with static credentials, isolated from the
+// shared config files and the instance metadata of the host
+func setS3Env(t *testing.T, endpoint string) {
+	t.Helper()
+	t.Setenv("AWS_ENDPOINT_URL", endpoint)
+	t.Setenv("AWS_REGION", "eu-central-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+	t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", t.TempDir()+"/credentials")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+func TestS3Put(t *testing.T) {
+	var method, path, body, token, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.EscapedPath(), string(b)
+		token, auth = r.Header.Get("X-Amz-Security-Token"), r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+	setS3Env(t, server.URL)
+
+	if err := Write("s3://audit/reports/2026 10/junit.xml", []byte("<testsuites/>")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if method != http.MethodPut || path != "/audit/reports/2026%2010/junit.xml" || body != "<testsuites/>" {
+		t.Errorf("Expected the object to be put path-style, got %s %s %q", method, path, body)
+	}
+	if token != "session" || !strings.Contains(auth, "Credential=id/") || !strings.Contains(auth, "/eu-central-1/s3/aws4_request") {
+		t.Errorf("Expected the request to be signed with the env credentials, got %q (token %q)", auth, token)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	path := t.TempDir() + "/report.md"
+	for _, location := range []string{path, "file://" + path} {
+		if err := Write(location, []byte("# Report")); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if b, _ := ioutil.ReadFile(path); string(b) != "# Report" {
+			t.Errorf("Expected the report to be written to %s, got %q", location, b)
+		}
+	}
+
+	if err := Write("gs://bucket/report.md", nil); err == nil {
+		t.Errorf("Expected unsupported schemes to fail")
+	}
+}
+
+func TestS3Get(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/audit/state.json" || r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code></Error>`))
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	setS3Env(t, server.URL)
+
+	if body, err := Read("s3://audit/state.json"); err != nil || string(body) != "[]" {
+		t.Errorf("Expected the signed object to be read, got %q (%v)", body, err)
+	}
+	if _, err := Read("s3://audit/missing.json"); err != ErrNotExist {
+		t.Errorf("Expected %v for a missing object, got %v", ErrNotExist, err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	path := t.TempDir() + "/state.json"
+	if _, err := Read(path); err != ErrNotExist {
+		t.Errorf("Expected %v for a missing file, got %v", ErrNotExist, err)
+	}
+
+	if err := Write(path, []byte("[]")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, location := range []string{path, "file://" + path} {
+		if b, err := Read(location); err != nil || string(b) != "[]" {
+			t.Errorf("Expected the state to be read from %s, got %q (%v)", location, b, err)
+		}
+	}
+}
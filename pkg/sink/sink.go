@@ -0,0 +1,75 @@
+// Package sink writes reports to the location given by a path or URL. Plain paths and
+// file:// URLs are written to the local file system, s3://bucket/key URLs to S3 or an S3
+// compatible object storage. Locations can be read back, e.g. the state of a previous run.
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ErrNotExist is returned by Read for missing files and objects
+var ErrNotExist = errors.New("location does not exist")
+
+// Write writes the data to the location, selecting the sink by the URL scheme
+func Write(location string, data []byte) error {
+	u, err := url.Parse(location)
+	if err != nil || !strings.Contains(location, "://") {
+		// Plain local paths, including Windows paths like C:\reports
+		return writeFile(location, data)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return writeFile(u.Path, data)
+	case "s3":
+		s3, err := NewS3(context.Background())
+		if err != nil {
+			return err
+		}
+		return s3.Put(context.Background(), u.Host, strings.TrimPrefix(u.Path, "/"), data)
+	default:
+		return fmt.Errorf("unsupported report location %q: scheme must be file or s3", location)
+	}
+}
+
+// Read reads the data from the location, selecting the sink by the URL scheme. Missing
+// locations are reported as ErrNotExist.
+func Read(location string) ([]byte, error) {
+	u, err := url.Parse(location)
+	if err != nil || !strings.Contains(location, "://") {
+		return readFile(location)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return readFile(u.Path)
+	case "s3":
+		s3, err := NewS3(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return s3.Get(context.Background(), u.Host, strings.TrimPrefix(u.Path, "/"))
+	default:
+		return nil, fmt.Errorf("unsupported report location %q: scheme must be file or s3", location)
+	}
+}
+
+func readFile(path string) ([]byte, error) {
+	// nolint: gosec
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+
+	return data, err
+}
+
+func writeFile(path string, data []byte) error {
+	return ioutil.WriteFile(path, data, 0644)
+}
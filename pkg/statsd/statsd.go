@@ -0,0 +1,85 @@
+// Package statsd sends the metrics of a run to a StatsD server over UDP. Tags are appended
+// in the dogstatsd format, which plain StatsD servers don't understand, so they are optional.
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client sends counters, gauges and timings, each as a single UDP packet. Sending is fire and
+// forget, errors only occur if the packet can't be written.
+type Client struct {
+	conn   net.Conn
+	prefix string
+	tags   string
+}
+
+// New returns a client sending to the StatsD server at address (host:port). The prefix is
+// prepended to all metric names, separated by a dot. Tags are added to every metric, pass nil
+// for servers without tag support.
+func New(address, prefix string, tags map[string]string) (*Client, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd %s: %v", address, err)
+	}
+
+	return &Client{conn: conn, prefix: prefix, tags: formatTags(tags)}, nil
+}
+
+// Count sends the counter increment of the metric
+func (c *Client) Count(name string, value int) error {
+	return c.send(name, fmt.Sprintf("%d|c", value))
+}
+
+// Gauge sends the current value of the metric, e.g. a score
+func (c *Client) Gauge(name string, value float64) error {
+	return c.send(name, strconv.FormatFloat(value, 'f', -1, 64)+"|g")
+}
+
+// Timing sends the duration of the metric in milliseconds
+func (c *Client) Timing(name string, d time.Duration) error {
+	return c.send(name, fmt.Sprintf("%d|ms", d.Milliseconds()))
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// send writes the metric line, e.g. "enforcer.projects.processed:12|c|#group:example"
+func (c *Client) send(name, value string) error {
+	if c.prefix != "" {
+		name = c.prefix + "." + name
+	}
+
+	if _, err := c.conn.Write([]byte(name + ":" + value + c.tags)); err != nil {
+		return fmt.Errorf("failed to send metric %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// formatTags returns the tags sorted by name in the dogstatsd format, e.g. "|#a:1,b:2"
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+":"+tags[name])
+	}
+
+	return "|#" + strings.Join(parts, ",")
+}
@@ -0,0 +1,93 @@
+package statsd
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// listen returns a UDP server receiving the metric packets
+func listen(t *testing.T) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// receive returns the next packet
+func receive(t *testing.T, conn *net.UDPConn) string {
+	t.Helper()
+
+	buf := make([]byte, 1024)
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Expected a metric, got %v", err)
+	}
+
+	return string(buf[:n])
+}
+
+func TestClient(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		tags     map[string]string
+		expected []string
+	}{
+		{
+			name:     "plain",
+			expected: []string{"projects.processed:12|c", "duration:1500|ms", "compliance.score:87.5|g"},
+		},
+		{
+			name:   "prefix and tags",
+			prefix: "enforcer",
+			tags:   map[string]string{"group": "example", "command": "sync"},
+			expected: []string{
+				"enforcer.projects.processed:12|c|#command:sync,group:example",
+				"enforcer.duration:1500|ms|#command:sync,group:example",
+				"enforcer.compliance.score:87.5|g|#command:sync,group:example",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := listen(t)
+			client, err := New(server.LocalAddr().String(), tt.prefix, tt.tags)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			defer client.Close()
+
+			if err := client.Count("projects.processed", 12); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if err := client.Timing("duration", 1500*time.Millisecond); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if err := client.Gauge("compliance.score", 87.5); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			for _, expected := range tt.expected {
+				if actual := receive(t, server); actual != expected {
+					t.Errorf("Expected %q, got %q", expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestNewInvalidAddress(t *testing.T) {
+	if _, err := New("localhost", "", nil); err == nil {
+		t.Errorf("Expected an error for an address without port, got none")
+	}
+}
@@ -0,0 +1,35 @@
+package tokenpool
+
+import (
+	"fmt"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/libri-gmbh/gitlab-settings-enforcer/pkg/internal/stringslice"
+)
+
+// Check returns an error unless all tokens are active personal access tokens of the same user
+// with the same scopes, including api or read_api. The tokens are only referred to by their
+// position, never by their value.
+func Check(tokens []*gitlab.PersonalAccessToken) error {
+	for i, token := range tokens {
+		if !token.Active || token.Revoked {
+			return fmt.Errorf("GITLAB_TOKEN %d of %d is not active", i+1, len(tokens))
+		}
+		if !stringslice.Contains("api", token.Scopes) && !stringslice.Contains("read_api", token.Scopes) {
+			return fmt.Errorf("GITLAB_TOKEN %d of %d has neither the api nor the read_api scope, only %v", i+1, len(tokens), token.Scopes)
+		}
+
+		if i == 0 {
+			continue
+		}
+		if token.UserID != tokens[0].UserID {
+			return fmt.Errorf("GITLAB_TOKEN %d of %d belongs to another user than GITLAB_TOKEN 1", i+1, len(tokens))
+		}
+		if !stringslice.SameElements(token.Scopes, tokens[0].Scopes) {
+			return fmt.Errorf("GITLAB_TOKEN %d of %d has the scopes %v, GITLAB_TOKEN 1 has %v", i+1, len(tokens), token.Scopes, tokens[0].Scopes)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package tokenpool
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "[REDACTED]"
+
+// RedactHook is a logrus hook replacing the tokens in the messages and string fields of all
+// log entries, e.g. of errors quoting a request
+type RedactHook struct {
+	Tokens []string
+}
+
+// Levels returns all levels
+func (h *RedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire redacts the tokens in the entry. The fields are shared with the logger the entry was
+// created from, so they are copied before being changed.
+func (h *RedactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.redact(entry.Message)
+
+	var data logrus.Fields
+	for key, value := range entry.Data {
+		s, ok := value.(string)
+		if !ok || h.redact(s) == s {
+			continue
+		}
+		if data == nil {
+			data = make(logrus.Fields, len(entry.Data))
+			for k, v := range entry.Data {
+				data[k] = v
+			}
+		}
+		data[key] = h.redact(s)
+	}
+	if data != nil {
+		entry.Data = data
+	}
+
+	return nil
+}
+
+// redact replaces the tokens in s
+func (h *RedactHook) redact(s string) string {
+	for _, token := range h.Tokens {
+		if token != "" {
+			s = strings.ReplaceAll(s, token, redacted)
+		}
+	}
+
+	return s
+}
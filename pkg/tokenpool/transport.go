@@ -0,0 +1,93 @@
+package tokenpool
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// rateLimitHeader is the header GitLab announces the requests per minute of a token in,
+// which go-gitlab configures its client side rate limiter from
+const rateLimitHeader = "RateLimit-Limit"
+
+// Transport is a http.RoundTripper authenticating each request with the next of several
+// personal access tokens of the same user in turn, spreading the requests of a run over the
+// rate limits of all tokens. A request rate limited by GitLab (429) is retried with each of
+// the other tokens before the response is returned. The announced rate limit is multiplied
+// by the number of tokens, so the client side limiter of go-gitlab allows their combined
+// rate. The tokens replace the one of the Private-Token or Authorization header of the
+// request and are never logged.
+type Transport struct {
+	Base   http.RoundTripper
+	Tokens []string
+
+	next uint64
+}
+
+// RoundTrip executes copies of the request authenticated with the next token with the base
+// transport, until one isn't rate limited or all tokens were tried
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if len(t.Tokens) == 0 {
+		return base.RoundTrip(req)
+	}
+
+	// The body is sent again with every retry
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	first := atomic.AddUint64(&t.next, 1) - 1
+	for i := 0; ; i++ {
+		token := t.Tokens[(first+uint64(i))%uint64(len(t.Tokens))]
+
+		// A RoundTripper must not modify the request
+		r := req.Clone(req.Context())
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		authenticate(r.Header, token)
+
+		resp, err := base.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || i == len(t.Tokens)-1 {
+			t.scaleRateLimit(resp.Header)
+			return resp, nil
+		}
+
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// scaleRateLimit multiplies the announced requests per minute by the number of tokens
+func (t *Transport) scaleRateLimit(header http.Header) {
+	if limit, err := strconv.Atoi(header.Get(rateLimitHeader)); err == nil && limit > 0 {
+		header.Set(rateLimitHeader, strconv.Itoa(limit*len(t.Tokens)))
+	}
+}
+
+// authenticate replaces the token of the request, a bearer token (e.g. of GraphQL requests)
+// or the private token go-gitlab sends
+func authenticate(header http.Header, token string) {
+	if strings.HasPrefix(header.Get("Authorization"), "Bearer ") {
+		header.Set("Authorization", "Bearer "+token)
+		return
+	}
+	header.Set("Private-Token", token)
+}
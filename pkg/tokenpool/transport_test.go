@@ -0,0 +1,153 @@
+package tokenpool
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestTransportRotatesTokens(t *testing.T) {
+	var tokens, bearers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("Private-Token"))
+		bearers = append(bearers, r.Header.Get("Authorization"))
+		w.Header().Set(rateLimitHeader, "600")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{Tokens: []string{"a", "b", "c"}}}
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Private-Token", "a")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if limit := resp.Header.Get(rateLimitHeader); limit != "1800" {
+			t.Errorf("Expected the rate limit of all tokens, got %s", limit)
+		}
+		if req.Header.Get("Private-Token") != "a" {
+			t.Errorf("Expected the original request to be left unchanged")
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+	req.Header.Set("Authorization", "Bearer a")
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if expected := []string{"a", "b", "c", "a", ""}; !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Expected the private tokens %v, got %v", expected, tokens)
+	}
+	if bearers[4] != "Bearer b" {
+		t.Errorf("Expected the bearer token to be rotated, got %q", bearers[4])
+	}
+}
+
+func TestTransportRetriesRateLimited(t *testing.T) {
+	var tokens, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Private-Token")
+		body, _ := ioutil.ReadAll(r.Body)
+		tokens = append(tokens, token)
+		bodies = append(bodies, string(body))
+		if token != "c" {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{Tokens: []string{"a", "b", "c"}}}
+
+	// The request is retried with the other tokens, sending the body again
+	req, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(`{"visibility":"private"}`))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the request to succeed with the last token, got %d", resp.StatusCode)
+	}
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Expected the tokens %v, got %v", expected, tokens)
+	}
+	for _, body := range bodies {
+		if body != `{"visibility":"private"}` {
+			t.Errorf("Expected the body to be sent with every attempt, got %v", bodies)
+		}
+	}
+
+	// Once all tokens are rate limited, the response is returned
+	client = &http.Client{Transport: &Transport{Tokens: []string{"a", "b"}}}
+	tokens = nil
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || len(tokens) != 2 {
+		t.Errorf("Expected the rate limited response after trying both tokens, got %d after %v", resp.StatusCode, tokens)
+	}
+}
+
+func TestRedactHook(t *testing.T) {
+	// Hooks fire in the order they were added, the redaction must come first
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(&RedactHook{Tokens: []string{"glpat-one", "glpat-two", ""}})
+	hook := test.NewLocal(logger)
+
+	entry := logger.WithField("url", "https://gitlab.example.com?private_token=glpat-two")
+	entry.Errorf("request with glpat-one failed")
+
+	last := hook.LastEntry()
+	if last.Message != "request with [REDACTED] failed" || last.Data["url"] != "https://gitlab.example.com?private_token=[REDACTED]" {
+		t.Errorf("Expected the tokens to be redacted, got %q and %v", last.Message, last.Data)
+	}
+	if entry.Data["url"] != "https://gitlab.example.com?private_token=glpat-two" {
+		t.Errorf("Expected the fields of the logger to be left unchanged, got %v", entry.Data)
+	}
+	if last.Level != logrus.ErrorLevel {
+		t.Errorf("Expected the entry to be logged as error, got %s", last.Level)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	token := func(userID int, scopes ...string) *gitlab.PersonalAccessToken {
+		return &gitlab.PersonalAccessToken{UserID: userID, Scopes: scopes, Active: true}
+	}
+	revoked := token(1, "api")
+	revoked.Revoked = true
+
+	tests := []struct {
+		name    string
+		tokens  []*gitlab.PersonalAccessToken
+		wantErr string
+	}{
+		{"same user and scopes", []*gitlab.PersonalAccessToken{token(1, "api", "read_user"), token(1, "read_user", "api")}, ""},
+		{"read only", []*gitlab.PersonalAccessToken{token(1, "read_api"), token(1, "read_api")}, ""},
+		{"revoked", []*gitlab.PersonalAccessToken{token(1, "api"), revoked}, "GITLAB_TOKEN 2 of 2 is not active"},
+		{"missing api scope", []*gitlab.PersonalAccessToken{token(1, "read_repository"), token(1, "read_repository")}, "GITLAB_TOKEN 1 of 2 has neither the api nor the read_api scope"},
+		{"other user", []*gitlab.PersonalAccessToken{token(1, "api"), token(2, "api")}, "GITLAB_TOKEN 2 of 2 belongs to another user"},
+		{"other scopes", []*gitlab.PersonalAccessToken{token(1, "api"), token(1, "api", "write_repository")}, "GITLAB_TOKEN 2 of 2 has the scopes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.tokens)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}